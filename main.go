@@ -1,41 +1,496 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha1"
+	"flag"
+	"fmt"
 	"gonesem/nes"
 	"gonesem/nes/cartridge"
 	"gonesem/nes/color"
+	"gonesem/nes/cpu"
+	"gonesem/nes/debugger"
+	"gonesem/nes/gdb"
+	"gonesem/nes/movie"
+	"gonesem/nes/testrom"
+	"gonesem/nes/trace"
+	"image/png"
+	"io"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 )
 
+// Exit codes, so CI can tell a broken setup from a regression
+const (
+	exitOK       = 0
+	exitError    = 1 // The ROM, movie or an output couldn't be loaded or written
+	exitUsage    = 2
+	exitMismatch = 3 // The final frame didn't match -expect, or the test ROM failed
+)
+
+const usage = `Usage: gonesem -rom PATH [options]
+
+Runs a ROM headless for a number of frames, optionally driven by an input
+movie, and writes the requested outputs.
+
+With -testrom the ROM is instead run until it reports a result through
+blargg's $6000 protocol, for at most -frames frames.
+
+With -debug the console is paused at power on and debugger commands are
+read from stdin, type help to list them. Ctrl+C pauses a running console.
+
+With -gdb the console is paused at power on and debugged through GDB's
+remote protocol, connect with "target remote ADDRESS". Sessions are served
+one after another until the runner is killed.
+
+With -gamedb dumps listed in the given NES 2.0 game database, nes20db.xml,
+get the mapper, mirroring and region recorded there rather than those in
+their header. Without it only a sample database listing nestest is consulted.
+
+With -trace every instruction run is logged in Nintendulator's, Mesen's or
+FCEUX's trace format, to diff against traces from those emulators.
+
+Exit status is 0 on success, 1 on errors, 2 on bad usage and 3 when the
+final frame doesn't match -expect or the test ROM fails.
+
+Options:
+`
+
+type options struct {
+	romPath        string
+	palettePath    string
+	gameDBPath     string
+	frames         int
+	moviePath      string
+	screenshotPath string
+	hashesPath     string
+	ramPath        string
+	expectedHash   string
+	testROM        bool
+	debug          bool
+	gdbAddress     string
+
+	tracePath       string
+	traceFormat     string
+	traceStartFrame int
+	traceStopFrame  int
+	tracePC         string
+}
+
 func main() {
-	nes, err := nesInit()
+	log.SetFlags(0)
+
+	opts := options{}
+
+	flag.StringVar(&opts.romPath, "rom", "", "path to the ROM to run")
+	flag.StringVar(&opts.palettePath, "palette", "", "path to a .pal file, a built-in palette is used by default")
+	flag.StringVar(&opts.gameDBPath, "gamedb", "", "path to nes20db.xml, used to correct headers of the dumps it lists")
+	flag.IntVar(&opts.frames, "frames", 0, "frames to run, defaults to the movie's length or 600 without a movie")
+	flag.StringVar(&opts.moviePath, "movie", "", "path to an .fm2 or .bk2 movie to play back")
+	flag.StringVar(&opts.screenshotPath, "screenshot", "", "write the final frame to this PNG file")
+	flag.StringVar(&opts.hashesPath, "hashes", "", "write the SHA-1 of every frame to this file, - for stdout")
+	flag.StringVar(&opts.ramPath, "ram", "", "write the 2KB of internal RAM at the end of the run to this file")
+	flag.StringVar(&opts.expectedHash, "expect", "", "SHA-1 the final frame must have")
+	flag.BoolVar(&opts.testROM, "testrom", false, "run a test ROM reporting its result at $6000")
+	flag.BoolVar(&opts.debug, "debug", false, "pause at power on and read debugger commands from stdin")
+	flag.StringVar(&opts.gdbAddress, "gdb", "", "pause at power on and serve GDB's remote protocol on this address, e.g. localhost:6502")
+	flag.StringVar(&opts.tracePath, "trace", "", "write a trace of every instruction run to this file, - for stdout")
+	flag.StringVar(&opts.traceFormat, "trace-format", "nintendulator", "trace format, nintendulator, mesen or fceux")
+	flag.IntVar(&opts.traceStartFrame, "trace-start-frame", 0, "start the trace once this many frames have run")
+	flag.IntVar(&opts.traceStopFrame, "trace-stop-frame", 0, "stop the trace once this many frames have run, 0 traces to the end")
+	flag.StringVar(&opts.tracePC, "trace-pc", "", "start the trace at the first instruction in an address range, e.g. 8000-80FF")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if opts.romPath == "" || flag.NArg() > 0 || opts.frames < 0 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	os.Exit(run(opts))
+}
+
+func run(opts options) (status int) {
+	if opts.gameDBPath != "" {
+		db, err := cartridge.LoadDatabase(opts.gameDBPath)
+
+		if err != nil {
+			log.Printf("Failed to load game database: %s\n", err)
+
+			return exitError
+		}
+
+		cartridge.SetDatabase(db)
+	}
+
+	console, err := nesInit(opts.romPath, opts.palettePath)
+
+	if err != nil {
+		log.Printf("Failed to initialize NES console: %s\n", err)
+
+		return exitError
+	}
+
+	finishTrace, err := startTrace(console, opts)
 
 	if err != nil {
-		log.Fatalf("Failed to initialize NES console: %s\n", err)
+		log.Printf("Failed to start trace: %s\n", err)
+
+		return exitError
+	}
+
+	// A trace cut short fails the run, whatever else happened
+	defer func() {
+		if err := finishTrace(); err != nil {
+			log.Printf("Failed to write trace: %s\n", err)
+
+			status = exitError
+		}
+	}()
+
+	if opts.gdbAddress != "" {
+		return runGDBServer(console, opts)
+	}
+
+	if opts.debug {
+		return runDebugger(console, opts)
+	}
+
+	if opts.testROM {
+		return runTestROM(console, opts)
+	}
 
-		os.Exit(1)
+	// The PPU keeps running after a jam so frames are still produced
+	console.SetHaltCallback(func(pc uint16) {
+		log.Printf("CPU jammed at $%04X in frame %d\n", pc, console.FrameCount()+1)
+	})
+
+	var session *movie.Session
+
+	if opts.moviePath != "" {
+		inputMovie, err := movie.Load(opts.moviePath)
+
+		if err != nil {
+			log.Printf("Failed to load movie: %s\n", err)
+
+			return exitError
+		}
+
+		session, err = movie.Play(console, inputMovie, movie.ModeReadOnly)
+
+		if err != nil {
+			log.Printf("Failed to play movie: %s\n", err)
+
+			return exitError
+		}
+
+		if opts.frames == 0 {
+			opts.frames = len(inputMovie.Frames)
+		}
+	}
+
+	if opts.frames == 0 {
+		opts.frames = 600
+	}
+
+	var hashes *bufio.Writer
+
+	if opts.hashesPath != "" {
+		output, closeOutput, err := createOutput(opts.hashesPath)
+
+		if err != nil {
+			log.Printf("Failed to create frame hash file: %s\n", err)
+
+			return exitError
+		}
+
+		defer closeOutput()
+
+		hashes = bufio.NewWriter(output)
+	}
+
+	for frame := 1; frame <= opts.frames; frame++ {
+		if session != nil {
+			if err := session.NextFrame(); err != nil {
+				log.Printf("Failed to play movie: %s\n", err)
+
+				return exitError
+			}
+		} else {
+			// GetFrame clears the frame complete flag, without it the next frame wouldn't run
+			console.NextFrame()
+			console.GetFrame()
+		}
+
+		if hashes != nil {
+			fmt.Fprintf(hashes, "%d %x\n", frame, sha1.Sum(console.GetFrame().Pix))
+		}
+	}
+
+	if hashes != nil {
+		if err := hashes.Flush(); err != nil {
+			log.Printf("Failed to write frame hashes: %s\n", err)
+
+			return exitError
+		}
 	}
 
-	for {
-		nes.Clock()
+	if err := writeOutputs(console, opts); err != nil {
+		log.Println(err)
+
+		return exitError
 	}
+
+	finalHash := fmt.Sprintf("%x", sha1.Sum(console.GetFrame().Pix))
+
+	fmt.Printf("Ran %d frames, final frame SHA-1 %s\n", opts.frames, finalHash)
+
+	if opts.expectedHash != "" && !strings.EqualFold(opts.expectedHash, finalHash) {
+		log.Printf("Final frame does not match, expected SHA-1 %s\n", opts.expectedHash)
+
+		return exitMismatch
+	}
+
+	return exitOK
 }
 
-func nesInit() (*nes.NES, error) {
-	cartridge, err := cartridge.NewCartridge("./test/data/roms/Donkey Kong.nes")
+func runTestROM(console *nes.NES, opts options) int {
+	testOptions := testrom.DefaultOptions
+
+	if opts.frames > 0 {
+		testOptions.MaxFrames = opts.frames
+	}
+
+	result, err := testrom.Run(console, testOptions)
 
 	if err != nil {
-		return nil, err
+		log.Println(err)
+
+		return exitError
+	}
+
+	if err := writeOutputs(console, opts); err != nil {
+		log.Println(err)
+
+		return exitError
 	}
 
-	colorPalette, err := color.NewColorPalette("./test/data/pals/NESdev.pal")
+	fmt.Print(result.Message)
+
+	if !result.Passed() {
+		log.Printf("Test failed with status %d after %d frames\n", result.Status, result.Frames)
+
+		return exitMismatch
+	}
+
+	return exitOK
+}
+
+func runDebugger(console *nes.NES, opts options) int {
+	consoleDebugger := debugger.NewDebugger(console)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	defer signal.Stop(interrupts)
+
+	go func() {
+		for range interrupts {
+			consoleDebugger.Interrupt()
+		}
+	}()
+
+	if err := consoleDebugger.RunREPL(os.Stdin, os.Stdout); err != nil {
+		log.Printf("Failed to read debugger commands: %s\n", err)
+
+		return exitError
+	}
+
+	if err := writeOutputs(console, opts); err != nil {
+		log.Println(err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+func runGDBServer(console *nes.NES, opts options) int {
+	listener, err := net.Listen("tcp", opts.gdbAddress)
+
+	if err != nil {
+		log.Printf("Failed to listen for GDB: %s\n", err)
+
+		return exitError
+	}
+
+	defer listener.Close()
+
+	log.Printf("Waiting for GDB on %s\n", listener.Addr())
+
+	if err := gdb.NewServer(debugger.NewDebugger(console)).Serve(listener); err != nil {
+		log.Printf("Failed to serve GDB: %s\n", err)
+
+		return exitError
+	}
+
+	return exitOK
+}
+
+func nesInit(romPath string, palettePath string) (*nes.NES, error) {
+	cartridge, err := cartridge.NewCartridge(romPath)
 
 	if err != nil {
 		return nil, err
 	}
 
+	colorPalette := color.DefaultPalette
+
+	if palettePath != "" {
+		colorPalette, err = color.NewColorPalette(palettePath)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	nes := nes.NewNES(cartridge, colorPalette)
 
 	return nes, nil
 }
+
+func writeOutputs(console *nes.NES, opts options) error {
+	if opts.screenshotPath != "" {
+		file, err := os.Create(opts.screenshotPath)
+
+		if err != nil {
+			return fmt.Errorf("failed to create screenshot: %s", err)
+		}
+
+		defer file.Close()
+
+		if err := png.Encode(file, console.GetFrame()); err != nil {
+			return fmt.Errorf("failed to write screenshot: %s", err)
+		}
+
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write screenshot: %s", err)
+		}
+	}
+
+	if opts.ramPath != "" {
+		ram := console.RAM()
+
+		if err := os.WriteFile(opts.ramPath, ram[:], 0644); err != nil {
+			return fmt.Errorf("failed to write RAM dump: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Starts tracing to opts.tracePath if it's set, returning a function that
+// finishes writing the trace
+func startTrace(console *nes.NES, opts options) (func() error, error) {
+	if opts.tracePath == "" {
+		return func() error { return nil }, nil
+	}
+
+	format, err := trace.ParseFormat(opts.traceFormat)
+
+	if err != nil {
+		return nil, err
+	}
+
+	start := trace.FromFrame(uint64(opts.traceStartFrame))
+
+	if opts.tracePC != "" {
+		low, high, err := parseAddressRange(opts.tracePC)
+
+		if err != nil {
+			return nil, err
+		}
+
+		start = trace.All(start, trace.PCRange(low, high))
+	}
+
+	output, closeOutput, err := createOutput(opts.tracePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(output)
+
+	tracer := trace.NewTracer(writer, format, cpu.Variant2A03)
+	tracer.SetStart(start)
+
+	if opts.traceStopFrame > 0 {
+		tracer.SetStop(trace.FromFrame(uint64(opts.traceStopFrame)))
+	}
+
+	console.SetTracer(tracer)
+
+	return func() error {
+		console.SetTracer(nil)
+
+		if err := tracer.Err(); err != nil {
+			closeOutput()
+			return err
+		}
+
+		if err := writer.Flush(); err != nil {
+			closeOutput()
+			return err
+		}
+
+		return closeOutput()
+	}, nil
+}
+
+// Parses a range of hex addresses such as "8000-80FF", or a single address
+func parseAddressRange(text string) (uint16, uint16, error) {
+	lowText, highText, isRange := strings.Cut(text, "-")
+
+	if !isRange {
+		highText = lowText
+	}
+
+	low, err := strconv.ParseUint(strings.TrimPrefix(lowText, "$"), 16, 16)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address range %q", text)
+	}
+
+	high, err := strconv.ParseUint(strings.TrimPrefix(highText, "$"), 16, 16)
+
+	if err != nil || high < low {
+		return 0, 0, fmt.Errorf("invalid address range %q", text)
+	}
+
+	return uint16(low), uint16(high), nil
+}
+
+// Opens path for writing, "-" writes to stdout
+func createOutput(path string) (io.Writer, func() error, error) {
+	if path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	file, err := os.Create(path)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, file.Close, nil
+}
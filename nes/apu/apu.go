@@ -0,0 +1,138 @@
+package apu
+
+// Status bits read from $4015, only the frame interrupt is driven as there are
+// no sound channels
+const StatusFrameIRQ uint8 = 0x40
+
+// Lengths of the frame counter's sequences in CPU cycles, the 4-step sequence
+// raises the IRQ on its last three cycles
+type timing struct {
+	fourStepPeriod uint16
+	fiveStepPeriod uint16
+}
+
+var (
+	ntscTiming = timing{29830, 37282}
+	palTiming  = timing{33254, 41566}
+)
+
+/*
+*
+APU frame counter, the part of the APU that can interrupt the CPU
+
+Writing $4017 picks the 4-step (bit 7 clear) or 5-step (bit 7 set) sequence
+and sets the IRQ inhibit flag (bit 6), which also clears a pending interrupt.
+The sequence restarts 3 or 4 CPU cycles after the write depending on whether
+it lands on an even or odd cycle. At the end of each 4-step sequence the frame
+interrupt flag is set on three consecutive cycles unless inhibited, asserting
+the IRQ line until $4015 is read.
+
+The sound channels, and the DMC's DMA and IRQ, aren't emulated yet: their
+registers are ignored and read back as silent.
+*
+*/
+type APU struct {
+	fiveStep   bool
+	irqInhibit bool
+	frameIRQ   bool
+
+	cycle      uint16 // CPU cycles since the sequence restarted, cycle 0 is only seen after a restart
+	resetDelay uint8  // CPU cycles until a $4017 write restarts the sequence, 0 when none is pending
+	oddCycle   bool   // Whether the current CPU cycle is odd, for the $4017 delay
+
+	pal bool // Counts PAL sequence lengths
+}
+
+// Selects the PAL frame counter's longer sequences, NTSC and Dendy consoles
+// share the same ones
+func (apu *APU) SetPAL(pal bool) {
+	apu.pal = pal
+}
+
+func (apu *APU) timing() timing {
+	if apu.pal {
+		return palTiming
+	}
+
+	return ntscTiming
+}
+
+// Advances the frame counter by a CPU cycle
+func (apu *APU) Clock() {
+	if apu.resetDelay > 0 {
+		apu.resetDelay--
+
+		if apu.resetDelay == 0 {
+			apu.cycle = 0
+		}
+	}
+
+	timing := apu.timing()
+
+	if !apu.fiveStep && !apu.irqInhibit && apu.cycle >= timing.fourStepPeriod-2 {
+		apu.frameIRQ = true
+	}
+
+	apu.cycle++
+
+	// The last cycle of a sequence is also the first of the next, which is
+	// why the 4-step interrupt spans the wrap
+	if (!apu.fiveStep && apu.cycle > timing.fourStepPeriod) || apu.cycle > timing.fiveStepPeriod {
+		apu.cycle = 1
+	}
+
+	apu.oddCycle = !apu.oddCycle
+}
+
+// Returns whether the APU is asserting the CPU's IRQ line
+func (apu *APU) IRQ() bool {
+	return apu.frameIRQ
+}
+
+// Handles a CPU read from $4015, which acknowledges the frame interrupt
+func (apu *APU) Read(addr uint16) uint8 {
+	value := apu.Peek(addr)
+
+	if addr == 0x4015 {
+		apu.frameIRQ = false
+	}
+
+	return value
+}
+
+// Returns what Read would without acknowledging the frame interrupt
+func (apu *APU) Peek(addr uint16) uint8 {
+	if addr == 0x4015 && apu.frameIRQ {
+		return StatusFrameIRQ
+	}
+
+	return 0
+}
+
+// Handles a CPU write to $4000-$4013, $4015 or $4017
+func (apu *APU) Write(addr uint16, value uint8) {
+	if addr != 0x4017 {
+		return
+	}
+
+	apu.fiveStep = value&0x80 != 0
+	apu.irqInhibit = value&0x40 != 0
+
+	if apu.irqInhibit {
+		apu.frameIRQ = false
+	}
+
+	apu.resetDelay = 3
+
+	if apu.oddCycle {
+		apu.resetDelay = 4
+	}
+}
+
+// Puts the APU in its state after the reset button is pressed, the frame
+// counter keeps its mode and restarts as if $4017 was written again
+func (apu *APU) Reset() {
+	apu.frameIRQ = false
+	apu.cycle = 0
+	apu.resetDelay = 0
+}
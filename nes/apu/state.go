@@ -0,0 +1,25 @@
+package apu
+
+import "gonesem/nes/state"
+
+var ChunkID = state.ChunkID{'A', 'P', 'U', ' '}
+
+func (apu *APU) SaveState(writer *state.Writer) {
+	writer.BeginChunk(ChunkID, 1)
+
+	writer.Bool(apu.fiveStep)
+	writer.Bool(apu.irqInhibit)
+	writer.Bool(apu.frameIRQ)
+	writer.Uint16(apu.cycle)
+	writer.Uint8(apu.resetDelay)
+	writer.Bool(apu.oddCycle)
+}
+
+func (apu *APU) LoadState(chunk *state.Chunk) {
+	apu.fiveStep = chunk.Bool()
+	apu.irqInhibit = chunk.Bool()
+	apu.frameIRQ = chunk.Bool()
+	apu.cycle = chunk.Uint16() % (apu.timing().fiveStepPeriod + 1)
+	apu.resetDelay = chunk.Uint8() % 5
+	apu.oddCycle = chunk.Bool()
+}
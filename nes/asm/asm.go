@@ -0,0 +1,431 @@
+package asm
+
+import (
+	"fmt"
+	"gonesem/nes/cpu"
+	"gonesem/nes/memory"
+	"strings"
+)
+
+// A run of bytes assembled to consecutive addresses
+type Segment struct {
+	Address uint16
+	Bytes   []uint8
+}
+
+type Program struct {
+	Segments []Segment         // In source order, a new one is started by every .org
+	Symbols  map[string]uint16 // Labels and constants, local labels as "global@local"
+}
+
+// Writes every segment to memory
+func (program *Program) Load(memory memory.Memory) {
+	for _, segment := range program.Segments {
+		for i, value := range segment.Bytes {
+			memory.Write(segment.Address+uint16(i), value)
+		}
+	}
+}
+
+// Other names for the unofficial mnemonics, as used by various assemblers and references
+var mnemonicAliases = map[string]string{
+	"ANE": "XAA",
+	"ASR": "ALR",
+	"DCM": "DCP",
+	"ISB": "ISC",
+	"INS": "ISC",
+	"JAM": "STP",
+	"KIL": "STP",
+	"LSE": "SRE",
+	"SBX": "AXS",
+	"SHA": "AHX",
+	"XAS": "SHX",
+	"SAY": "SHY",
+}
+
+type Assembler struct {
+	variant cpu.Variant
+	opcodes map[string]map[cpu.AddressingMode]uint8
+	symbols map[string]uint16
+}
+
+/*
+*
+Returns an assembler for the variant's instruction table, opcodes are looked
+up by mnemonic and addressing mode. Where several opcodes share both, as the
+unofficial NOPs do, the documented opcode is used if there is one, otherwise
+the lowest.
+*
+*/
+func NewAssembler(variant cpu.Variant) *Assembler {
+	opcodes := make(map[string]map[cpu.AddressingMode]uint8)
+
+	for opcode, instruction := range variant.Instructions() {
+		modes, ok := opcodes[instruction.Mnemonic]
+
+		if !ok {
+			modes = make(map[cpu.AddressingMode]uint8)
+			opcodes[instruction.Mnemonic] = modes
+		}
+
+		if existing, ok := modes[instruction.AddressingMode]; ok && (variant.Official(existing) || !variant.Official(uint8(opcode))) {
+			continue
+		}
+
+		modes[instruction.AddressingMode] = uint8(opcode)
+	}
+
+	return &Assembler{variant: variant, opcodes: opcodes}
+}
+
+// Sets symbols defined outside the source, such as hardware registers, nil removes them
+func (assembler *Assembler) SetSymbols(symbols map[string]uint16) {
+	assembler.symbols = symbols
+}
+
+// A line of source
+type statement struct {
+	line     int
+	scope    string // Global label local symbols in the statement belong to
+	label    string
+	constant string // Name defined by "name = value"
+	command  string // Mnemonic or directive, upper case
+	operand  string
+
+	// Decided on the first pass so every statement keeps its size
+	mode cpu.AddressingMode
+}
+
+/*
+*
+Assembles source written in a subset of ca65's syntax, starting at origin
+until the first .org:
+
+	PPUSTATUS = $2002
+	.org $C000
+	reset:  sei
+	@vblank:
+	        bit PPUSTATUS
+	        bpl @vblank
+	        jmp (vectors + 2)
+	vectors:
+	        .word reset, reset
+	        .res 4, $FF
+
+Along with instructions the directives .org, .byte, .word and .res are
+supported. Operands can force a zero page or absolute address with z: or a:.
+The source is assembled in two passes, so labels can be used before they are
+defined. Operands that aren't known on the first pass are assumed to be
+absolute.
+*
+*/
+func (assembler *Assembler) Assemble(source string, origin uint16) (*Program, error) {
+	statements := parse(source)
+	symbols := make(map[string]int)
+
+	for name, value := range assembler.symbols {
+		symbols[name] = int(value)
+	}
+
+	var program *Program
+	var err error
+
+	for _, final := range []bool{false, true} {
+		program, err = assembler.pass(statements, symbols, origin, final)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	program.Symbols = make(map[string]uint16)
+
+	for name, value := range symbols {
+		if _, external := assembler.symbols[name]; !external {
+			program.Symbols[name] = uint16(value)
+		}
+	}
+
+	return program, nil
+}
+
+func (assembler *Assembler) pass(statements []*statement, symbols map[string]int, origin uint16, final bool) (*Program, error) {
+	program := &Program{}
+	segment := Segment{Address: origin}
+	pc := int(origin)
+
+	for _, statement := range statements {
+		expressions := &evaluator{symbols: symbols, pc: pc, scope: statement.scope, final: final}
+
+		fail := func(err error) (*Program, error) {
+			return nil, fmt.Errorf("line %d: %s", statement.line, err)
+		}
+
+		if statement.label != "" {
+			if err := define(symbols, statement.label, pc, final); err != nil {
+				return fail(err)
+			}
+		}
+
+		if statement.constant != "" {
+			value, known, err := expressions.evaluate(statement.operand)
+
+			if err != nil {
+				return fail(err)
+			}
+
+			if known {
+				if err := define(symbols, statement.constant, value, final); err != nil {
+					return fail(err)
+				}
+			}
+
+			continue
+		}
+
+		var bytes []uint8
+		var err error
+
+		switch statement.command {
+		case "":
+			continue
+
+		case ".ORG":
+			value, known, err := expressions.evaluate(statement.operand)
+
+			if err != nil {
+				return fail(err)
+			}
+
+			if !known {
+				return fail(fmt.Errorf(".org must only use symbols defined before it"))
+			}
+
+			if len(segment.Bytes) > 0 {
+				program.Segments = append(program.Segments, segment)
+			}
+
+			segment = Segment{Address: uint16(value)}
+			pc = value
+
+			continue
+
+		case ".BYTE":
+			bytes, err = data(expressions, statement.operand, 1)
+		case ".WORD":
+			bytes, err = data(expressions, statement.operand, 2)
+		case ".RES":
+			bytes, err = reserve(expressions, statement.operand)
+		default:
+			bytes, err = assembler.instruction(expressions, statement, final)
+		}
+
+		if err != nil {
+			return fail(err)
+		}
+
+		segment.Bytes = append(segment.Bytes, bytes...)
+		pc += len(bytes)
+
+		if pc > 0x10000 {
+			return fail(fmt.Errorf("assembled past $FFFF"))
+		}
+	}
+
+	if len(segment.Bytes) > 0 {
+		program.Segments = append(program.Segments, segment)
+	}
+
+	return program, nil
+}
+
+// Defines a symbol, which can't change between or within passes
+func define(symbols map[string]int, name string, value int, final bool) error {
+	if existing, ok := symbols[name]; ok && (!final || existing != value) {
+		return fmt.Errorf("%q is already defined", name)
+	}
+
+	symbols[name] = value
+
+	return nil
+}
+
+// Parses source into statements, leaving operands to be evaluated by each pass
+func parse(source string) []*statement {
+	var statements []*statement
+
+	scope := ""
+
+	for i, line := range strings.Split(source, "\n") {
+		statement := &statement{line: i + 1}
+
+		if comment := indexOutsideQuotes(line, ';'); comment >= 0 {
+			line = line[:comment]
+		}
+
+		line = strings.TrimSpace(line)
+
+		if colon := indexOutsideQuotes(line, ':'); colon > 0 && isSymbol(line[:colon]) {
+			label := line[:colon]
+
+			if !strings.HasPrefix(label, "@") {
+				scope = label
+			}
+
+			statement.label = qualify(label, scope)
+			line = strings.TrimSpace(line[colon+1:])
+		}
+
+		statement.scope = scope
+
+		if equals := strings.Index(line, "="); equals > 0 && isSymbol(strings.TrimSpace(line[:equals])) {
+			statement.constant = qualify(strings.TrimSpace(line[:equals]), scope)
+			statement.operand = strings.TrimSpace(line[equals+1:])
+		} else if line != "" {
+			command, operand, _ := strings.Cut(line, " ")
+
+			if tab := strings.Index(command, "\t"); tab >= 0 {
+				command, operand = command[:tab], line[tab+1:]
+			}
+
+			statement.command = strings.ToUpper(command)
+			statement.operand = strings.TrimSpace(operand)
+		}
+
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
+
+func isSymbol(text string) bool {
+	if text == "" || !isSymbolStart(text[0]) {
+		return false
+	}
+
+	for i := 1; i < len(text); i++ {
+		if !isSymbolChar(text[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the index of the first char outside of a string or character literal, -1 if there is none
+func indexOutsideQuotes(text string, char byte) int {
+	quote := byte(0)
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case quote != 0:
+			if text[i] == quote {
+				quote = 0
+			}
+		case text[i] == '"':
+			quote = '"'
+		case text[i] == '\'' && i+2 < len(text) && text[i+2] == '\'':
+			i += 2
+		case text[i] == char:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Splits text on commas outside of parentheses and quotes
+func splitArguments(text string) []string {
+	var arguments []string
+
+	depth, start := 0, 0
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '"':
+			if end := strings.IndexByte(text[i+1:], '"'); end >= 0 {
+				i += end + 1
+			}
+		case '\'':
+			if i+2 < len(text) && text[i+2] == '\'' {
+				i += 2
+			}
+		case ',':
+			if depth == 0 {
+				arguments = append(arguments, strings.TrimSpace(text[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	return append(arguments, strings.TrimSpace(text[start:]))
+}
+
+// Assembles the values of a .byte or .word, .byte also takes strings
+func data(expressions *evaluator, operand string, size int) ([]uint8, error) {
+	var bytes []uint8
+
+	for _, argument := range splitArguments(operand) {
+		if size == 1 && len(argument) >= 2 && argument[0] == '"' && argument[len(argument)-1] == '"' {
+			bytes = append(bytes, argument[1:len(argument)-1]...)
+			continue
+		}
+
+		value, known, err := expressions.evaluate(argument)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if known && (value < -(1<<(8*size-1)) || value >= 1<<(8*size)) {
+			return nil, fmt.Errorf("$%X doesn't fit in %d bytes", value, size)
+		}
+
+		bytes = append(bytes, uint8(value))
+
+		if size == 2 {
+			bytes = append(bytes, uint8(value>>8))
+		}
+	}
+
+	return bytes, nil
+}
+
+// Assembles a .res, count bytes of an optional fill value that defaults to 0
+func reserve(expressions *evaluator, operand string) ([]uint8, error) {
+	arguments := splitArguments(operand)
+
+	if len(arguments) > 2 {
+		return nil, fmt.Errorf(".res takes a count and an optional fill value")
+	}
+
+	count, known, err := expressions.evaluate(arguments[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !known || count < 0 || count > 0x10000 {
+		return nil, fmt.Errorf("invalid .res count %q", arguments[0])
+	}
+
+	fill := 0
+
+	if len(arguments) == 2 {
+		if fill, _, err = expressions.evaluate(arguments[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	bytes := make([]uint8, count)
+
+	for i := range bytes {
+		bytes[i] = uint8(fill)
+	}
+
+	return bytes, nil
+}
@@ -0,0 +1,284 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+*
+Evaluates expressions in ca65 syntax:
+* Numbers in decimal, hex ($FF), binary (%1010) or as a character ('A')
+* Symbols, with local symbols starting with @ scoped to the last global label
+* The address of the current statement as *
+* Binary operators | ^ & << >> + - * / from lowest to highest precedence
+* Unary - ~ and < > for the low and high byte of a value
+
+Outside the final pass undefined symbols make the value unknown instead of
+being an error, so forward references can be sized before they're defined.
+*
+*/
+type evaluator struct {
+	symbols map[string]int
+	pc      int
+	scope   string // Global label local symbols belong to
+	final   bool
+
+	tokens []string
+	next   int
+	known  bool
+}
+
+func (evaluator *evaluator) evaluate(text string) (int, bool, error) {
+	tokens, err := tokenize(text)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	if len(tokens) == 0 {
+		return 0, false, fmt.Errorf("missing expression")
+	}
+
+	evaluator.tokens = tokens
+	evaluator.next = 0
+	evaluator.known = true
+
+	value, err := evaluator.binary(0)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	if evaluator.next < len(tokens) {
+		return 0, false, fmt.Errorf("unexpected %q in expression %q", tokens[evaluator.next], text)
+	}
+
+	return value, evaluator.known, nil
+}
+
+// Binary operators by precedence, lowest first
+var precedence = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (evaluator *evaluator) binary(level int) (int, error) {
+	if level == len(precedence) {
+		return evaluator.unary()
+	}
+
+	left, err := evaluator.binary(level + 1)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for evaluator.next < len(evaluator.tokens) {
+		operator := evaluator.tokens[evaluator.next]
+
+		if !contains(precedence[level], operator) {
+			break
+		}
+
+		evaluator.next++
+
+		right, err := evaluator.binary(level + 1)
+
+		if err != nil {
+			return 0, err
+		}
+
+		switch operator {
+		case "|":
+			left |= right
+		case "^":
+			left ^= right
+		case "&":
+			left &= right
+		case "<<":
+			left <<= uint(right)
+		case ">>":
+			left >>= uint(right)
+		case "+":
+			left += right
+		case "-":
+			left -= right
+		case "*":
+			left *= right
+		case "/":
+			// Unknown values are 0 before the final pass
+			if right == 0 {
+				if evaluator.known {
+					return 0, fmt.Errorf("division by zero")
+				}
+
+				right = 1
+			}
+
+			left /= right
+		}
+	}
+
+	return left, nil
+}
+
+func (evaluator *evaluator) unary() (int, error) {
+	if evaluator.next == len(evaluator.tokens) {
+		return 0, fmt.Errorf("expression ends early")
+	}
+
+	token := evaluator.tokens[evaluator.next]
+	evaluator.next++
+
+	switch token {
+	case "-", "~", "<", ">":
+		value, err := evaluator.unary()
+
+		if err != nil {
+			return 0, err
+		}
+
+		switch token {
+		case "-":
+			return -value, nil
+		case "~":
+			return ^value, nil
+		case "<":
+			return value & 0xFF, nil
+		default:
+			return value >> 8 & 0xFF, nil
+		}
+
+	case "(":
+		value, err := evaluator.binary(0)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if evaluator.next == len(evaluator.tokens) || evaluator.tokens[evaluator.next] != ")" {
+			return 0, fmt.Errorf("missing )")
+		}
+
+		evaluator.next++
+
+		return value, nil
+
+	case "*":
+		return evaluator.pc, nil
+	}
+
+	return evaluator.operand(token)
+}
+
+func (evaluator *evaluator) operand(token string) (int, error) {
+	switch {
+	case token[0] == '$':
+		return parseNumber(token[1:], 16)
+	case token[0] == '%':
+		return parseNumber(token[1:], 2)
+	case token[0] == '\'':
+		return int(token[1]), nil
+	case token[0] >= '0' && token[0] <= '9':
+		return parseNumber(token, 10)
+	case isSymbolStart(token[0]):
+		name := qualify(token, evaluator.scope)
+
+		if value, ok := evaluator.symbols[name]; ok {
+			return value, nil
+		}
+
+		if evaluator.final {
+			return 0, fmt.Errorf("undefined symbol %q", token)
+		}
+
+		evaluator.known = false
+
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("unexpected %q in expression", token)
+}
+
+func parseNumber(digits string, base int) (int, error) {
+	value, err := strconv.ParseInt(digits, base, 32)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", digits)
+	}
+
+	return int(value), nil
+}
+
+// Splits an expression into numbers, symbols, character literals and operators
+func tokenize(text string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(text); {
+		char := text[i]
+
+		switch {
+		case char == ' ' || char == '\t':
+			i++
+		case char == '\'':
+			if i+2 >= len(text) || text[i+2] != '\'' {
+				return nil, fmt.Errorf("invalid character literal in %q", text)
+			}
+
+			tokens = append(tokens, text[i:i+3])
+			i += 3
+		case strings.HasPrefix(text[i:], "<<") || strings.HasPrefix(text[i:], ">>"):
+			tokens = append(tokens, text[i:i+2])
+			i += 2
+		case strings.ContainsRune("|^&+-*/~<>()", rune(char)):
+			tokens = append(tokens, text[i:i+1])
+			i++
+		case char == '$' || char == '%' || isSymbolStart(char) || char >= '0' && char <= '9':
+			end := i + 1
+
+			for end < len(text) && isSymbolChar(text[end]) {
+				end++
+			}
+
+			tokens = append(tokens, text[i:end])
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q in expression %q", char, text)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isSymbolStart(char byte) bool {
+	return char == '_' || char == '@' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z'
+}
+
+func isSymbolChar(char byte) bool {
+	return isSymbolStart(char) || char >= '0' && char <= '9'
+}
+
+// Local symbols are stored under the global label they belong to, e.g. "main@loop"
+func qualify(name string, scope string) string {
+	if strings.HasPrefix(name, "@") {
+		return scope + name
+	}
+
+	return name
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
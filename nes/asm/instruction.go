@@ -0,0 +1,270 @@
+package asm
+
+import (
+	"fmt"
+	"gonesem/nes/cpu"
+	"strings"
+)
+
+// Operand syntax, each matching one or more addressing modes
+type operandForm uint8
+
+const (
+	formNone      operandForm = iota // Implied, or accumulator for instructions without an implied mode
+	formA                            // A, the accumulator
+	formImmediate                    // #value
+	formDirect                       // value, zero page, absolute or relative
+	formDirectX                      // value,X
+	formDirectY                      // value,Y
+	formIndirect                     // (value)
+	formIndirectX                    // (value,X)
+	formIndirectY                    // (value),Y
+	formBitBranch                    // zp, target for BBR and BBS
+)
+
+// Modes matching each form, zero page modes before absolute ones
+var formModes = map[operandForm][]cpu.AddressingMode{
+	formNone:      {cpu.AddressingModeImplied, cpu.AddressingModeAccumulator},
+	formA:         {cpu.AddressingModeAccumulator},
+	formImmediate: {cpu.AddressingModeImmediate},
+	formDirect:    {cpu.AddressingModeRelative, cpu.AddressingModeZeroPage, cpu.AddressingModeAbsolute},
+	formDirectX:   {cpu.AddressingModeZeroPageX, cpu.AddressingModeAbsoluteX},
+	formDirectY:   {cpu.AddressingModeZeroPageY, cpu.AddressingModeAbsoluteY},
+	formIndirect:  {cpu.AddressingModeZeroPageIndirect, cpu.AddressingModeIndirect},
+	formIndirectX: {cpu.AddressingModeIndirectX, cpu.AddressingModeAbsoluteIndexedIndirect},
+	formIndirectY: {cpu.AddressingModeIndirectY},
+	formBitBranch: {cpu.AddressingModeZeroPageRelative},
+}
+
+// Size of the address each mode takes, 0 for modes without one
+var addressSizes = map[cpu.AddressingMode]int{
+	cpu.AddressingModeZeroPage:                1,
+	cpu.AddressingModeZeroPageX:               1,
+	cpu.AddressingModeZeroPageY:               1,
+	cpu.AddressingModeIndirectX:               1,
+	cpu.AddressingModeIndirectY:               1,
+	cpu.AddressingModeZeroPageIndirect:        1,
+	cpu.AddressingModeAbsolute:                2,
+	cpu.AddressingModeAbsoluteX:               2,
+	cpu.AddressingModeAbsoluteY:               2,
+	cpu.AddressingModeIndirect:                2,
+	cpu.AddressingModeAbsoluteIndexedIndirect: 2,
+}
+
+// Splits an operand into its form and the expressions in it
+func parseOperand(operand string) (operandForm, []string, error) {
+	upper := strings.ToUpper(operand)
+
+	switch {
+	case operand == "":
+		return formNone, nil, nil
+	case upper == "A":
+		return formA, nil, nil
+	case strings.HasPrefix(operand, "#"):
+		return formImmediate, []string{operand[1:]}, nil
+	case strings.HasPrefix(operand, "(") && strings.HasSuffix(strings.ReplaceAll(upper, " ", ""), "),Y"):
+		inner := operand[1:strings.LastIndex(operand, ")")]
+		return formIndirectY, []string{inner}, nil
+	case strings.HasPrefix(operand, "(") && closingParenthesis(operand) == len(operand)-1:
+		arguments := splitArguments(operand[1 : len(operand)-1])
+
+		switch {
+		case len(arguments) == 1:
+			return formIndirect, arguments, nil
+		case len(arguments) == 2 && strings.ToUpper(arguments[1]) == "X":
+			return formIndirectX, arguments[:1], nil
+		}
+
+		return 0, nil, fmt.Errorf("invalid indirect operand %q", operand)
+	}
+
+	arguments := splitArguments(operand)
+
+	switch {
+	case len(arguments) == 1:
+		return formDirect, arguments, nil
+	case len(arguments) == 2 && strings.ToUpper(arguments[1]) == "X":
+		return formDirectX, arguments[:1], nil
+	case len(arguments) == 2 && strings.ToUpper(arguments[1]) == "Y":
+		return formDirectY, arguments[:1], nil
+	case len(arguments) == 2:
+		return formBitBranch, arguments, nil
+	}
+
+	return 0, nil, fmt.Errorf("invalid operand %q", operand)
+}
+
+// Returns the index of the parenthesis closing the one operand starts with
+func closingParenthesis(operand string) int {
+	depth := 0
+
+	for i := 0; i < len(operand); i++ {
+		switch operand[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// Strips a z: or a: prefix forcing the size of an address, returning the size it forces
+func forcedSize(expression string) (string, int) {
+	lower := strings.ToLower(expression)
+
+	switch {
+	case strings.HasPrefix(lower, "z:"):
+		return strings.TrimSpace(expression[2:]), 1
+	case strings.HasPrefix(lower, "a:"):
+		return strings.TrimSpace(expression[2:]), 2
+	}
+
+	return expression, 0
+}
+
+func (assembler *Assembler) instruction(expressions *evaluator, statement *statement, final bool) ([]uint8, error) {
+	mnemonic := statement.command
+
+	if alias, ok := mnemonicAliases[mnemonic]; ok {
+		mnemonic = alias
+	}
+
+	modes, ok := assembler.opcodes[mnemonic]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown instruction %q", statement.command)
+	}
+
+	form, arguments, err := parseOperand(statement.operand)
+
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]int, len(arguments))
+	known := true
+	forced := 0
+
+	for i, argument := range arguments {
+		argument, size := forcedSize(argument)
+		forced = max(forced, size)
+
+		value, valueKnown, err := expressions.evaluate(argument)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = value
+		known = known && valueKnown
+	}
+
+	// The mode is chosen on the first pass and kept, so addresses don't shift
+	if !final {
+		mode, err := chooseMode(modes, form, forced, known && len(values) > 0 && values[0] >= 0 && values[0] < 0x100)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s doesn't take operand %q", statement.command, statement.operand)
+		}
+
+		statement.mode = mode
+	}
+
+	mode := statement.mode
+	bytes := []uint8{modes[mode]}
+
+	switch mode {
+	case cpu.AddressingModeImmediate:
+		if known && (values[0] < -0x80 || values[0] > 0xFF) {
+			return nil, fmt.Errorf("immediate value $%X doesn't fit in a byte", values[0])
+		}
+
+		bytes = append(bytes, uint8(values[0]))
+
+	case cpu.AddressingModeRelative:
+		offset, err := branchOffset(expressions.pc+2, values[0], known)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bytes = append(bytes, offset)
+
+	case cpu.AddressingModeZeroPageRelative:
+		offset, err := branchOffset(expressions.pc+3, values[1], known)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bytes = append(bytes, uint8(values[0]), offset)
+
+	default:
+		switch addressSizes[mode] {
+		case 1:
+			if known && (values[0] < 0 || values[0] > 0xFF) {
+				return nil, fmt.Errorf("$%X isn't a zero page address", values[0])
+			}
+
+			bytes = append(bytes, uint8(values[0]))
+		case 2:
+			if known && (values[0] < 0 || values[0] > 0xFFFF) {
+				return nil, fmt.Errorf("$%X isn't an address", values[0])
+			}
+
+			bytes = append(bytes, uint8(values[0]), uint8(values[0]>>8))
+		}
+	}
+
+	return bytes, nil
+}
+
+// Picks the first of the form's modes the instruction has, preferring zero page
+// modes when the address fits and isn't forced to absolute
+func chooseMode(modes map[cpu.AddressingMode]uint8, form operandForm, forced int, fitsZeroPage bool) (cpu.AddressingMode, error) {
+	for _, mode := range formModes[form] {
+		if _, ok := modes[mode]; !ok {
+			continue
+		}
+
+		size := addressSizes[mode]
+
+		if forced != 0 && size != 0 && size != forced {
+			continue
+		}
+
+		// Without a forced size, only take a zero page mode if an absolute one can't be used instead
+		if forced == 0 && size == 1 && !fitsZeroPage && hasAbsolute(modes, form) {
+			continue
+		}
+
+		return mode, nil
+	}
+
+	return 0, fmt.Errorf("no addressing mode")
+}
+
+func hasAbsolute(modes map[cpu.AddressingMode]uint8, form operandForm) bool {
+	for _, mode := range formModes[form] {
+		if _, ok := modes[mode]; ok && addressSizes[mode] == 2 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the offset of a branch to target from the instruction after it
+func branchOffset(next int, target int, known bool) (uint8, error) {
+	offset := target - next
+
+	if known && (offset < -128 || offset > 127) {
+		return 0, fmt.Errorf("branch to $%04X is out of range", target)
+	}
+
+	return uint8(offset), nil
+}
@@ -0,0 +1,109 @@
+package cartridge
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"gonesem/nes/patch"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	zipMagic  = []byte{0x50, 0x4B, 0x03, 0x04} // "PK\x03\x04"
+	gzipMagic = []byte{0x1F, 0x8B}
+)
+
+// Returns the raw iNES image contained in rom, unpacking it first if rom
+// is a zip or gzip archive. Images that aren't archives are returned as is.
+func unpackROM(rom []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(rom, zipMagic):
+		return unpackZip(rom)
+	case bytes.HasPrefix(rom, gzipMagic):
+		return unpackGzip(rom)
+	default:
+		return rom, nil
+	}
+}
+
+// Extracts the single .nes file from a zip archive, archives with no .nes
+// file or more than one are rejected as the intended ROM would be ambiguous.
+func unpackZip(archive []byte) ([]byte, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %s", err)
+	}
+
+	var romFile *zip.File
+
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() || !strings.EqualFold(path.Ext(file.Name), ".nes") {
+			continue
+		}
+
+		if romFile != nil {
+			return nil, fmt.Errorf("zip archive contains more than one .nes file: %s, %s", romFile.Name, file.Name)
+		}
+
+		romFile = file
+	}
+
+	if romFile == nil {
+		return nil, fmt.Errorf("zip archive does not contain a .nes file")
+	}
+
+	reader, err := romFile.Open()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in zip archive: %s", romFile.Name, err)
+	}
+
+	defer reader.Close()
+
+	rom, err := readUnpacked(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from zip archive: %s", romFile.Name, err)
+	}
+
+	return rom, nil
+}
+
+// Decompresses a gzip stream, which by design only ever holds a single file.
+func unpackGzip(archive []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(archive))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip archive: %s", err)
+	}
+
+	defer reader.Close()
+
+	rom, err := readUnpacked(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzip archive: %s", err)
+	}
+
+	return rom, nil
+}
+
+// Reads a decompressed ROM, stopping past the size limit so an archive that
+// inflates without bound is rejected before it exhausts memory
+func readUnpacked(reader io.Reader) ([]byte, error) {
+	rom, err := io.ReadAll(io.LimitReader(reader, patch.MaxROMSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rom) > patch.MaxROMSize {
+		return nil, fmt.Errorf("decompresses to more than the %d byte limit", patch.MaxROMSize)
+	}
+
+	return rom, nil
+}
@@ -1,13 +1,20 @@
 package cartridge
 
 import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
 	"encoding/binary"
 	"fmt"
+	"gonesem/nes/patch"
+	"hash"
+	"hash/crc32"
 	"io"
 	"os"
+	"slices"
 )
 
-// iNES header
+// iNES header, see header.go for how NES 2.0 re-purposes bytes 7-15
 type Header struct {
 	NESConst   [4]uint8 // Constant $4E $45 $53 $1A (ASCII "NES" followed by MS-DOS EOF)
 	PRGSize    uint8    // Size of PRG ROM in 16kb units
@@ -17,68 +24,233 @@ type Header struct {
 	PRGRamSize uint8    // PRG RAM size
 	TvSystem1  uint8    // TV System type
 	TvSystem2  uint8    // TV System type
-	_          [5]uint8 // Unused in iNES 1.0 format
+	Unused     [5]uint8 // Unused in iNES 1.0 format
 }
 
 type Cartridge struct {
-	pgrBanks   uint8
-	chrBanks   uint8
-	mirrorMode uint8
+	info       Info
+	crc32      uint32 // CRC32 of PRG ROM followed by CHR ROM
+	md5        [16]byte
+	sha1       [20]byte
+	mirrorMode MirrorMode
 	pgrMemory  []uint8
 	chrMemory  []uint8
+	chrRAM     bool
+	prgRAM     []uint8
 	mapper     Mapper
 }
 
-func NewCartridge(romPath string) (*Cartridge, error) {
-	romFile, err := os.Open(romPath)
+// Loads a cartridge from the ROM file at romPath, zip and gzip archives containing
+// a single .nes file are unpacked transparently.
+//
+// IPS, UPS and BPS patches sharing the ROM's base name are applied automatically
+// followed by any patches in patchPaths, all before the header is parsed.
+func NewCartridge(romPath string, patchPaths ...string) (*Cartridge, error) {
+	rom, err := os.ReadFile(romPath)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to open ROM file: %s", err)
 	}
 
-	defer romFile.Close()
+	rom, err = unpackROM(rom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var allPatchPaths []string
+
+	for _, foundPath := range patch.Find(romPath) {
+		if !slices.Contains(patchPaths, foundPath) {
+			allPatchPaths = append(allPatchPaths, foundPath)
+		}
+	}
+
+	rom, err = patch.ApplyFiles(rom, append(allPatchPaths, patchPaths...)...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newCartridge(rom)
+}
+
+// Loads a cartridge from the ROM image read from reader until EOF, applying
+// patches in order before the header is parsed
+func NewCartridgeFromReader(reader io.Reader, patches ...[]byte) (*Cartridge, error) {
+	rom, err := io.ReadAll(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ROM data: %s", err)
+	}
+
+	return NewCartridgeFromBytes(rom, patches...)
+}
+
+// Loads a cartridge from an in-memory ROM image, applying patches in order
+// before the header is parsed
+func NewCartridgeFromBytes(rom []byte, patches ...[]byte) (*Cartridge, error) {
+	rom, err := unpackROM(rom)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, romPatch := range patches {
+		if rom, err = patch.Apply(rom, romPatch); err != nil {
+			return nil, fmt.Errorf("failed to apply patch %d: %s", i+1, err)
+		}
+	}
+
+	return newCartridge(rom)
+}
+
+// Parses a raw iNES image into a cartridge
+func newCartridge(rom []byte) (*Cartridge, error) {
+	romReader := bytes.NewReader(rom)
 
 	header := Header{}
 
-	if err := binary.Read(romFile, binary.LittleEndian, &header); err != nil {
+	if err := binary.Read(romReader, binary.LittleEndian, &header); err != nil {
 		return nil, fmt.Errorf("failed to read in header from rom file: %s", err)
 	}
 
-	cartridge := &Cartridge{}
+	if string(header.NESConst[:]) != "NES\x1A" {
+		return nil, fmt.Errorf("invalid iNES header constant % X", header.NESConst)
+	}
 
-	mapperID := (header.Mapper1 & 0xF0) | header.Mapper2>>4
-	hasTrainer := header.Mapper1>>2&0x01 != 0
+	info, err := header.info()
 
-	cartridge.mapper = NewMapper(mapperID, cartridge)
+	if err != nil {
+		return nil, err
+	}
 
-	if hasTrainer {
-		if _, err = romFile.Seek(512, io.SeekCurrent); err != nil {
+	if info.Trainer {
+		if _, err := romReader.Seek(512, io.SeekCurrent); err != nil {
 			return nil, fmt.Errorf("failed to skip trainer data: %s", err)
 		}
 	}
 
-	cartridge.pgrBanks = header.PRGSize
-	cartridge.chrBanks = header.CHRSize
+	// NES 2.0 exponent sizes reach almost 1GB, so a crafted header is checked
+	// against the data actually present before anything is allocated
+	romSize := uint64(info.PRGROMSize) + uint64(info.CHRROMSize)
 
-	cartridge.pgrMemory = make([]uint8, uint32(cartridge.pgrBanks)*16384)
+	if romSize > patch.MaxROMSize {
+		return nil, fmt.Errorf("ROM size %d is larger than the %d byte limit", romSize, patch.MaxROMSize)
+	}
+
+	if romSize > uint64(romReader.Len()) {
+		return nil, fmt.Errorf("header claims %d bytes of PRG and CHR ROM but only %d bytes follow", romSize, romReader.Len())
+	}
+
+	cartridge := &Cartridge{}
 
-	if _, err := io.ReadFull(romFile, cartridge.pgrMemory); err != nil {
+	cartridge.pgrMemory = make([]uint8, info.PRGROMSize)
+
+	if _, err := io.ReadFull(romReader, cartridge.pgrMemory); err != nil {
 		return nil, fmt.Errorf("failed to read PRG data into PRG ROM memory: %s", err)
 	}
 
-	cartridge.chrMemory = make([]uint8, uint32(cartridge.chrBanks)*8192)
+	cartridge.chrMemory = make([]uint8, info.CHRROMSize)
 
-	if _, err := io.ReadFull(romFile, cartridge.chrMemory); err != nil {
+	if _, err := io.ReadFull(romReader, cartridge.chrMemory); err != nil {
 		return nil, fmt.Errorf("failed to read CHR data into CHR ROM memory: %s", err)
 	}
 
+	cartridge.crc32 = crc32.Update(crc32.ChecksumIEEE(cartridge.pgrMemory), crc32.IEEETable, cartridge.chrMemory)
+
+	// Movie formats identify the game by these hashes of the same data
+	md5Hash, sha1Hash := md5.New(), sha1.New()
+
+	for _, hash := range []hash.Hash{md5Hash, sha1Hash} {
+		hash.Write(cartridge.pgrMemory)
+		hash.Write(cartridge.chrMemory)
+	}
+
+	md5Hash.Sum(cartridge.md5[:0])
+	sha1Hash.Sum(cartridge.sha1[:0])
+
+	// Known dumps take their board configuration from the game database as
+	// the header may be wrong, the ROM sizes are kept as read from the file
+	if game, ok := GetDatabase().Lookup(cartridge.pgrMemory, cartridge.chrMemory); ok {
+		dbInfo := game.Info
+		dbInfo.PRGROMSize = info.PRGROMSize
+		dbInfo.CHRROMSize = info.CHRROMSize
+		dbInfo.Trainer = info.Trainer
+		dbInfo.Cleaned = info.Cleaned
+
+		info = dbInfo
+	}
+
+	if info.CHRROMSize == 0 {
+		cartridge.chrMemory = make([]uint8, max(info.CHRRAMSize+info.CHRNVRAMSize, 8192))
+		cartridge.chrRAM = true
+	}
+
+	cartridge.prgRAM = make([]uint8, info.PRGRAMSize+info.PRGNVRAMSize)
+
+	cartridge.info = info
+	cartridge.mirrorMode = info.Mirroring
+	cartridge.mapper, err = NewMapper(info.Mapper, cartridge)
+
+	if err != nil {
+		return nil, err
+	}
+
 	return cartridge, nil
 }
 
+// Returns the board configuration of the cartridge
+func (cartridge *Cartridge) Info() Info {
+	return cartridge.info
+}
+
+// Overrides the region taken from the header or game database, e.g. with a
+// frontend's per-game setting for a dump whose header is wrong
+func (cartridge *Cartridge) SetRegion(region Region) {
+	cartridge.info.Region = region
+}
+
+// Returns an independent copy of the cartridge, sharing the read-only ROM but
+// with its own RAM and mapper, for running a second console alongside the first
+func (cartridge *Cartridge) Clone() *Cartridge {
+	clone := *cartridge
+
+	clone.prgRAM = append([]uint8(nil), cartridge.prgRAM...)
+
+	if cartridge.chrRAM {
+		clone.chrMemory = append([]uint8(nil), cartridge.chrMemory...)
+	}
+
+	// The mapper was created for this cartridge already, so it is supported
+	clone.mapper, _ = NewMapper(clone.info.Mapper, &clone)
+
+	return &clone
+}
+
+// Returns the CRC32 of the PRG ROM followed by the CHR ROM, identifying the game
+func (cartridge *Cartridge) CRC32() uint32 {
+	return cartridge.crc32
+}
+
+// Returns the MD5 of the PRG ROM followed by the CHR ROM, as used by FCEUX movies
+func (cartridge *Cartridge) MD5() [16]byte {
+	return cartridge.md5
+}
+
+// Returns the SHA-1 of the PRG ROM followed by the CHR ROM, as used by BizHawk movies
+func (cartridge *Cartridge) SHA1() [20]byte {
+	return cartridge.sha1
+}
+
 func (cartridge *Cartridge) PRGRead(addr uint16) uint8 {
 	return cartridge.mapper.PGRRead(addr)
 }
 
+func (cartridge *Cartridge) PRGPeek(addr uint16) uint8 {
+	return cartridge.mapper.PRGPeek(addr)
+}
+
 func (cartridge *Cartridge) PRGWrite(addr uint16, value uint8) {
 	cartridge.mapper.PRGWrite(addr, value)
 }
@@ -87,6 +259,10 @@ func (cartridge *Cartridge) CHRRead(addr uint16) uint8 {
 	return cartridge.mapper.CHRRead(addr)
 }
 
+func (cartridge *Cartridge) CHRPeek(addr uint16) uint8 {
+	return cartridge.mapper.CHRPeek(addr)
+}
+
 func (cartridge *Cartridge) CHRWrite(addr uint16, value uint8) {
 	cartridge.mapper.CHRWrite(addr, value)
 }
@@ -0,0 +1,203 @@
+package cartridge
+
+import (
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sample database in the NES 2.0 XML database format, parsed the first time
+// a cartridge is loaded. It only lists nestest, so headers are only corrected
+// once the full nes20db.xml is loaded with LoadDatabase and installed in its
+// place with SetDatabase.
+//
+//go:embed nes20db.xml
+var embeddedDatabase []byte
+
+var (
+	database       *Database
+	databaseLoaded bool
+	databaseLock   sync.Mutex
+)
+
+// Game database entry
+type Game struct {
+	Name  string // Name taken from the comment preceding the entry
+	CRC32 uint32 // CRC32 of PRG ROM followed by CHR ROM
+	SHA1  string // Upper case hex SHA-1 of PRG ROM followed by CHR ROM
+	Info  Info
+}
+
+// Game database keyed by the checksums of the combined PRG and CHR ROM data
+type Database struct {
+	byCRC32 map[uint32]*Game
+	bySHA1  map[string]*Game
+}
+
+type databaseXML struct {
+	Games []gameXML `xml:"game"`
+}
+
+type gameXML struct {
+	Comment string      `xml:",comment"`
+	PRGROM  sizeXML     `xml:"prgrom"`
+	CHRROM  sizeXML     `xml:"chrrom"`
+	ROM     checksumXML `xml:"rom"`
+	PRGRAM  sizeXML     `xml:"prgram"`
+	PRGNV   sizeXML     `xml:"prgnvram"`
+	CHRRAM  sizeXML     `xml:"chrram"`
+	CHRNV   sizeXML     `xml:"chrnvram"`
+	PCB     struct {
+		Mapper    uint16 `xml:"mapper,attr"`
+		Submapper uint8  `xml:"submapper,attr"`
+		Mirroring string `xml:"mirroring,attr"`
+		Battery   uint8  `xml:"battery,attr"`
+	} `xml:"pcb"`
+	Console struct {
+		Type   uint8 `xml:"type,attr"`
+		Region uint8 `xml:"region,attr"`
+	} `xml:"console"`
+}
+
+type sizeXML struct {
+	Size uint32 `xml:"size,attr"`
+}
+
+type checksumXML struct {
+	Size  uint32 `xml:"size,attr"`
+	CRC32 string `xml:"crc32,attr"`
+	SHA1  string `xml:"sha1,attr"`
+}
+
+// Parses a database in the NES 2.0 XML database format
+func ParseDatabase(reader io.Reader) (*Database, error) {
+	parsed := databaseXML{}
+
+	if err := xml.NewDecoder(reader).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse game database: %s", err)
+	}
+
+	db := &Database{
+		byCRC32: make(map[uint32]*Game, len(parsed.Games)),
+		bySHA1:  make(map[string]*Game, len(parsed.Games)),
+	}
+
+	for _, entry := range parsed.Games {
+		crc, err := strconv.ParseUint(entry.ROM.CRC32, 16, 32)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid crc32 %q in game database: %s", entry.ROM.CRC32, err)
+		}
+
+		game := &Game{
+			Name:  strings.TrimSpace(entry.Comment),
+			CRC32: uint32(crc),
+			SHA1:  strings.ToUpper(entry.ROM.SHA1),
+			Info: Info{
+				Mapper:       entry.PCB.Mapper,
+				Submapper:    entry.PCB.Submapper,
+				Battery:      entry.PCB.Battery != 0,
+				PRGROMSize:   entry.PRGROM.Size,
+				CHRROMSize:   entry.CHRROM.Size,
+				PRGRAMSize:   entry.PRGRAM.Size,
+				PRGNVRAMSize: entry.PRGNV.Size,
+				CHRRAMSize:   entry.CHRRAM.Size,
+				CHRNVRAMSize: entry.CHRNV.Size,
+				Region:       Region(entry.Console.Region & 0x03),
+				NES20:        true,
+				InDatabase:   true,
+			},
+		}
+
+		switch entry.PCB.Mirroring {
+		case "V":
+			game.Info.Mirroring = MirrorVertical
+		case "4":
+			game.Info.Mirroring = MirrorFourScreen
+		default:
+			game.Info.Mirroring = MirrorHorizontal
+		}
+
+		db.byCRC32[game.CRC32] = game
+
+		if game.SHA1 != "" {
+			db.bySHA1[game.SHA1] = game
+		}
+	}
+
+	return db, nil
+}
+
+// Loads a database in the NES 2.0 XML database format from path
+func LoadDatabase(path string) (*Database, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open game database: %s", err)
+	}
+
+	defer file.Close()
+
+	return ParseDatabase(file)
+}
+
+// Returns the database consulted when loading cartridges, by default the sample database
+func GetDatabase() *Database {
+	databaseLock.Lock()
+	defer databaseLock.Unlock()
+
+	if !databaseLoaded {
+		db, err := ParseDatabase(bytes.NewReader(embeddedDatabase))
+
+		if err != nil {
+			panic(fmt.Sprintf("Embedded game database is invalid: %s", err))
+		}
+
+		database = db
+		databaseLoaded = true
+	}
+
+	return database
+}
+
+// Replaces the database consulted when loading cartridges, nil disables lookups
+func SetDatabase(db *Database) {
+	databaseLock.Lock()
+	defer databaseLock.Unlock()
+
+	database = db
+	databaseLoaded = true
+}
+
+// Finds the entry matching the combined PRG and CHR ROM data, the SHA-1 is
+// preferred with the CRC32 used as a fallback for entries without one
+func (db *Database) Lookup(prgROM []byte, chrROM []byte) (*Game, bool) {
+	if db == nil {
+		return nil, false
+	}
+
+	sha := sha1.New()
+	sha.Write(prgROM)
+	sha.Write(chrROM)
+
+	if game, ok := db.bySHA1[strings.ToUpper(hex.EncodeToString(sha.Sum(nil)))]; ok {
+		return game, true
+	}
+
+	crc := crc32.Update(crc32.ChecksumIEEE(prgROM), crc32.IEEETable, chrROM)
+
+	if game, ok := db.byCRC32[crc]; ok && game.SHA1 == "" {
+		return game, true
+	}
+
+	return nil, false
+}
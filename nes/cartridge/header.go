@@ -0,0 +1,176 @@
+package cartridge
+
+import "fmt"
+
+type MirrorMode uint8
+
+const (
+	MirrorHorizontal MirrorMode = iota // Nametables mirrored vertically, arranged horizontally
+	MirrorVertical                     // Nametables mirrored horizontally, arranged vertically
+	MirrorFourScreen                   // Cartridge provides VRAM for all four nametables
+)
+
+type Region uint8
+
+const (
+	RegionNTSC     Region = iota // RP2C02, North America and Japan
+	RegionPAL                    // RP2C07, Europe and Australia
+	RegionMultiple               // Runs on either
+	RegionDendy                  // UMC 6527P famiclones
+)
+
+// Board configuration of a cartridge, taken from the ROM header and corrected
+// by the game database when the dump is known.
+type Info struct {
+	Mapper       uint16     // iNES mapper number
+	Submapper    uint8      // NES 2.0 submapper number
+	Mirroring    MirrorMode // Hard-wired nametable mirroring
+	Battery      bool       // Cartridge has battery backed memory
+	PRGROMSize   uint32     // PRG ROM size in bytes
+	CHRROMSize   uint32     // CHR ROM size in bytes
+	PRGRAMSize   uint32     // Volatile PRG RAM size in bytes
+	PRGNVRAMSize uint32     // Battery backed PRG RAM size in bytes
+	CHRRAMSize   uint32     // Volatile CHR RAM size in bytes
+	CHRNVRAMSize uint32     // Battery backed CHR RAM size in bytes
+	Region       Region     // CPU/PPU timing
+	Trainer      bool       // 512 byte trainer precedes PRG ROM
+	NES20        bool       // Header is in NES 2.0 format
+	Cleaned      bool       // Header bytes 7-15 contained garbage and were cleared
+	InDatabase   bool       // Info was corrected from the game database
+}
+
+// Returns whether the header is in the NES 2.0 format, signalled by bits 2-3 of byte 7
+func (header *Header) isNES20() bool {
+	return header.Mapper2&0x0C == 0x08
+}
+
+/*
+*
+Older ROM tools wrote their signature into the unused header bytes, most
+famously "DiskDude!" across bytes 7-15. As byte 7 holds the upper nibble of the
+mapper number this turns e.g. mapper 1 into mapper 65.
+
+iNES 1.0 headers must have bytes 12-15 zeroed, so a header that isn't NES 2.0
+and has data there is treated as garbage and bytes 7-15 are cleared.
+*
+*/
+func (header *Header) clean() bool {
+	if header.isNES20() {
+		return false
+	}
+
+	if string([]byte{header.Mapper2, header.PRGRamSize, header.TvSystem1, header.TvSystem2}) == "Disk" {
+		header.Mapper2, header.PRGRamSize, header.TvSystem1, header.TvSystem2 = 0, 0, 0, 0
+		header.Unused = [5]uint8{}
+
+		return true
+	}
+
+	for _, value := range header.Unused[1:] {
+		if value != 0 {
+			header.Mapper2, header.PRGRamSize, header.TvSystem1, header.TvSystem2 = 0, 0, 0, 0
+			header.Unused = [5]uint8{}
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Decodes the board configuration from an iNES 1.0 or NES 2.0 header
+func (header *Header) info() (Info, error) {
+	info := Info{}
+
+	info.Cleaned = header.clean()
+	info.NES20 = header.isNES20()
+	info.Trainer = header.Mapper1&0x04 != 0
+	info.Battery = header.Mapper1&0x02 != 0
+
+	switch {
+	case header.Mapper1&0x08 != 0:
+		info.Mirroring = MirrorFourScreen
+	case header.Mapper1&0x01 != 0:
+		info.Mirroring = MirrorVertical
+	default:
+		info.Mirroring = MirrorHorizontal
+	}
+
+	info.Mapper = uint16(header.Mapper1>>4) | uint16(header.Mapper2&0xF0)
+
+	if !info.NES20 {
+		info.PRGROMSize = uint32(header.PRGSize) * 16384
+		info.CHRROMSize = uint32(header.CHRSize) * 8192
+
+		// A PRG RAM size of 0 infers 8KB for compatibility
+		prgRAMSize := uint32(max(header.PRGRamSize, 1)) * 8192
+
+		if info.Battery {
+			info.PRGNVRAMSize = prgRAMSize
+		} else {
+			info.PRGRAMSize = prgRAMSize
+		}
+
+		if info.CHRROMSize == 0 {
+			info.CHRRAMSize = 8192
+		}
+
+		if header.TvSystem1&0x01 != 0 {
+			info.Region = RegionPAL
+		}
+
+		return info, nil
+	}
+
+	// NES 2.0 re-purposes bytes 8-12
+	info.Mapper |= uint16(header.PRGRamSize&0x0F) << 8
+	info.Submapper = header.PRGRamSize >> 4
+
+	prgROMSize, err := nes20ROMSize(header.PRGSize, header.TvSystem1&0x0F, 16384)
+
+	if err != nil {
+		return info, fmt.Errorf("invalid PRG ROM size: %s", err)
+	}
+
+	chrROMSize, err := nes20ROMSize(header.CHRSize, header.TvSystem1>>4, 8192)
+
+	if err != nil {
+		return info, fmt.Errorf("invalid CHR ROM size: %s", err)
+	}
+
+	info.PRGROMSize = prgROMSize
+	info.CHRROMSize = chrROMSize
+	info.PRGRAMSize = nes20RAMSize(header.TvSystem2 & 0x0F)
+	info.PRGNVRAMSize = nes20RAMSize(header.TvSystem2 >> 4)
+	info.CHRRAMSize = nes20RAMSize(header.Unused[0] & 0x0F)
+	info.CHRNVRAMSize = nes20RAMSize(header.Unused[0] >> 4)
+	info.Region = Region(header.Unused[1] & 0x03)
+
+	return info, nil
+}
+
+// NES 2.0 ROM sizes are either a plain 12-bit bank count or, when the upper
+// nibble is $F, an exponent-multiplier in the form 2^E * (MM*2+1)
+func nes20ROMSize(lsb uint8, msb uint8, bankSize uint32) (uint32, error) {
+	if msb != 0x0F {
+		return (uint32(msb)<<8 | uint32(lsb)) * bankSize, nil
+	}
+
+	exponent := lsb >> 2
+	multiplier := uint32(lsb&0x03)*2 + 1
+
+	if exponent > 27 {
+		return 0, fmt.Errorf("exponent 2^%d is too large", exponent)
+	}
+
+	return (uint32(1) << exponent) * multiplier, nil
+}
+
+// NES 2.0 RAM sizes are stored as a shift count, 64 << shift bytes or 0 if the shift is 0
+func nes20RAMSize(shift uint8) uint32 {
+	if shift == 0 {
+		return 0
+	}
+
+	return 64 << shift
+}
@@ -7,13 +7,20 @@ type Mapper interface {
 	PRGWrite(addr uint16, value uint8)
 	CHRRead(addr uint16) uint8
 	CHRWrite(addr uint16, value uint8)
+
+	// Return what a read would without side effects, e.g. a mapper latching
+	// CHR banks on reads of particular tiles
+	PRGPeek(addr uint16) uint8
+	CHRPeek(addr uint16) uint8
 }
 
-func NewMapper(mapperID uint8, cartridge *Cartridge) Mapper {
+func NewMapper(mapperID uint16, cartridge *Cartridge) (Mapper, error) {
 	switch mapperID {
 	case 0:
-		return Mapper000{cartridge: cartridge}
+		return Mapper000{cartridge: cartridge}, nil
+	case 1:
+		return newMapper001(cartridge), nil
 	default:
-		panic(fmt.Sprintf("Unsupported mapper, ID %d", mapperID))
+		return nil, fmt.Errorf("unsupported mapper, ID %d", mapperID)
 	}
 }
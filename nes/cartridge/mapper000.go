@@ -5,16 +5,28 @@ type Mapper000 struct {
 }
 
 func (mapper Mapper000) PGRRead(addr uint16) uint8 {
-	if addr >= 0x8000 && addr <= 0xFFFF {
+	switch {
+	case addr >= 0x8000:
 		pgrMemorySize := len(mapper.cartridge.pgrMemory)
 		return mapper.cartridge.pgrMemory[addr%uint16(pgrMemorySize)]
+	// Family BASIC style PRG RAM, present when the header or database declares it
+	case addr >= 0x6000 && len(mapper.cartridge.prgRAM) > 0:
+		return mapper.cartridge.prgRAM[int(addr-0x6000)%len(mapper.cartridge.prgRAM)]
 	}
 
 	return 0
 }
 
-// Mapper000 PRG rom only, no writing
+// Mapper000 reads have no side effects
+func (mapper Mapper000) PRGPeek(addr uint16) uint8 {
+	return mapper.PGRRead(addr)
+}
+
+// Mapper000 PRG rom only, writes are limited to PRG RAM if present
 func (mapper Mapper000) PRGWrite(addr uint16, value uint8) {
+	if addr >= 0x6000 && addr <= 0x7FFF && len(mapper.cartridge.prgRAM) > 0 {
+		mapper.cartridge.prgRAM[int(addr-0x6000)%len(mapper.cartridge.prgRAM)] = value
+	}
 }
 
 func (mapper Mapper000) CHRRead(addr uint16) uint8 {
@@ -25,6 +37,13 @@ func (mapper Mapper000) CHRRead(addr uint16) uint8 {
 	return 0
 }
 
-// Mapper000 CHR rom only, no writing
+func (mapper Mapper000) CHRPeek(addr uint16) uint8 {
+	return mapper.CHRRead(addr)
+}
+
+// Mapper000 CHR rom only, writes are only possible on boards with CHR RAM
 func (mapper Mapper000) CHRWrite(addr uint16, value uint8) {
+	if addr <= 0x1FFF && mapper.cartridge.chrRAM {
+		mapper.cartridge.chrMemory[addr] = value
+	}
 }
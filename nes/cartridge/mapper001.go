@@ -0,0 +1,176 @@
+package cartridge
+
+import "gonesem/nes/state"
+
+/*
+*
+MMC1 (SxROM), e.g. SNROM as used by blargg's test ROMs
+
+Registers are written a bit at a time through a 5-bit shift register mapped
+across $8000-$FFFF. Each write shifts in bit 0, a write with bit 7 set clears
+the shift register instead and fixes the last PRG bank at $C000. On the fifth
+write the value goes to the register selected by bits 13-14 of its address:
+
+	$8000-$9FFF  Control      ---CPPMM  CHR mode, PRG mode, mirroring
+	$A000-$BFFF  CHR bank 0   ---CCCCC  4KB bank at $0000, or 8KB bank in 8KB mode
+	$C000-$DFFF  CHR bank 1   ---CCCCC  4KB bank at $1000, ignored in 8KB mode
+	$E000-$FFFF  PRG bank     ---RPPPP  16KB bank, R disables PRG RAM
+
+The PPU doesn't apply nametable mirroring yet, so the mirroring bits are only
+kept for save states. Boards with more than 256KB of PRG ROM (SUROM) aren't
+supported, nor is the MMC1 ignoring the second of two writes on consecutive
+cycles.
+*
+*/
+type Mapper001 struct {
+	cartridge *Cartridge
+
+	shift      uint8 // Bits written so far, the first in bit 0
+	shiftCount uint8
+	control    uint8
+	chrBank0   uint8
+	chrBank1   uint8
+	prgBank    uint8
+}
+
+func newMapper001(cartridge *Cartridge) *Mapper001 {
+	// The last PRG bank is fixed at $C000 at power on
+	return &Mapper001{cartridge: cartridge, control: 0x0C}
+}
+
+func (mapper *Mapper001) PGRRead(addr uint16) uint8 {
+	switch {
+	case addr >= 0x8000:
+		return mapper.cartridge.pgrMemory[mapper.prgOffset(addr)]
+	case addr >= 0x6000 && mapper.prgRAMEnabled():
+		return mapper.cartridge.prgRAM[int(addr-0x6000)%len(mapper.cartridge.prgRAM)]
+	}
+
+	return 0
+}
+
+// Mapper001 reads have no side effects
+func (mapper *Mapper001) PRGPeek(addr uint16) uint8 {
+	return mapper.PGRRead(addr)
+}
+
+func (mapper *Mapper001) PRGWrite(addr uint16, value uint8) {
+	switch {
+	case addr >= 0x8000:
+		mapper.writeShift(addr, value)
+	case addr >= 0x6000 && mapper.prgRAMEnabled():
+		mapper.cartridge.prgRAM[int(addr-0x6000)%len(mapper.cartridge.prgRAM)] = value
+	}
+}
+
+func (mapper *Mapper001) CHRRead(addr uint16) uint8 {
+	if addr <= 0x1FFF {
+		return mapper.cartridge.chrMemory[mapper.chrOffset(addr)]
+	}
+
+	return 0
+}
+
+func (mapper *Mapper001) CHRPeek(addr uint16) uint8 {
+	return mapper.CHRRead(addr)
+}
+
+func (mapper *Mapper001) CHRWrite(addr uint16, value uint8) {
+	if addr <= 0x1FFF && mapper.cartridge.chrRAM {
+		mapper.cartridge.chrMemory[mapper.chrOffset(addr)] = value
+	}
+}
+
+func (mapper *Mapper001) writeShift(addr uint16, value uint8) {
+	if value&0x80 != 0 {
+		mapper.shift, mapper.shiftCount = 0, 0
+		mapper.control |= 0x0C
+
+		return
+	}
+
+	mapper.shift |= (value & 0x01) << mapper.shiftCount
+	mapper.shiftCount++
+
+	if mapper.shiftCount < 5 {
+		return
+	}
+
+	switch (addr >> 13) & 0x03 {
+	case 0:
+		mapper.control = mapper.shift
+	case 1:
+		mapper.chrBank0 = mapper.shift
+	case 2:
+		mapper.chrBank1 = mapper.shift
+	case 3:
+		mapper.prgBank = mapper.shift
+	}
+
+	mapper.shift, mapper.shiftCount = 0, 0
+}
+
+func (mapper *Mapper001) prgRAMEnabled() bool {
+	return mapper.prgBank&0x10 == 0 && len(mapper.cartridge.prgRAM) > 0
+}
+
+// Maps a CPU address in $8000-$FFFF to an offset into PRG ROM
+func (mapper *Mapper001) prgOffset(addr uint16) int {
+	bank := int(mapper.prgBank & 0x0F)
+	lastBank := len(mapper.cartridge.pgrMemory)/0x4000 - 1
+
+	switch (mapper.control >> 2) & 0x03 {
+	case 0, 1: // 32KB at $8000, the low bit of the bank number is ignored
+		bank = bank&^1 + int(addr-0x8000)/0x4000
+	case 2: // First bank fixed at $8000, switchable bank at $C000
+		if addr < 0xC000 {
+			bank = 0
+		}
+	case 3: // Switchable bank at $8000, last bank fixed at $C000
+		if addr >= 0xC000 {
+			bank = lastBank
+		}
+	}
+
+	return (bank%(lastBank+1))*0x4000 + int(addr&0x3FFF)
+}
+
+// Maps a PPU address in $0000-$1FFF to an offset into CHR ROM or RAM
+func (mapper *Mapper001) chrOffset(addr uint16) int {
+	banks := len(mapper.cartridge.chrMemory) / 0x1000
+	bank := int(mapper.chrBank0)
+
+	switch {
+	case mapper.control&0x10 == 0: // 8KB, the low bit of the bank number is ignored
+		bank = bank&^1 + int(addr)/0x1000
+	case addr >= 0x1000:
+		bank = int(mapper.chrBank1)
+	}
+
+	return (bank%banks)*0x1000 + int(addr&0x0FFF)
+}
+
+func (mapper *Mapper001) SaveState(writer *state.Writer) {
+	writer.Uint8(mapper.shift)
+	writer.Uint8(mapper.shiftCount)
+	writer.Uint8(mapper.control)
+	writer.Uint8(mapper.chrBank0)
+	writer.Uint8(mapper.chrBank1)
+	writer.Uint8(mapper.prgBank)
+}
+
+func (mapper *Mapper001) LoadState(chunk *state.Chunk) error {
+	mapper.shift = chunk.Uint8()
+	mapper.shiftCount = chunk.Uint8() % 5
+	mapper.control = chunk.Uint8()
+	mapper.chrBank0 = chunk.Uint8()
+	mapper.chrBank1 = chunk.Uint8()
+	mapper.prgBank = chunk.Uint8()
+
+	return nil
+}
+
+// Every value of the registers is valid
+func (mapper *Mapper001) CheckState(chunk state.Chunk) error {
+	return nil
+}
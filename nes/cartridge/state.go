@@ -0,0 +1,109 @@
+package cartridge
+
+import (
+	"fmt"
+	"gonesem/nes/state"
+)
+
+var (
+	ChunkID       = state.ChunkID{'C', 'A', 'R', 'T'}
+	MapperChunkID = state.ChunkID{'M', 'A', 'P', 'R'}
+)
+
+// Implemented by mappers with internal state such as bank registers or IRQ
+// counters, which is stored in its own chunk of the save state
+type StatefulMapper interface {
+	Mapper
+	SaveState(writer *state.Writer)
+	LoadState(chunk *state.Chunk) error
+
+	// Returns an error if LoadState would fail, without changing the mapper
+	CheckState(chunk state.Chunk) error
+}
+
+// Saves the cartridge's RAM followed by the mapper's state, if it has any
+func (cartridge *Cartridge) SaveState(writer *state.Writer) {
+	writer.BeginChunk(ChunkID, 1)
+
+	writer.Uint32(cartridge.crc32)
+	writer.Bytes32(cartridge.prgRAM)
+
+	if cartridge.chrRAM {
+		writer.Bytes32(cartridge.chrMemory)
+	} else {
+		writer.Bytes32(nil)
+	}
+
+	if mapper, ok := cartridge.mapper.(StatefulMapper); ok {
+		writer.BeginChunk(MapperChunkID, 1)
+		writer.Uint16(cartridge.info.Mapper)
+		mapper.SaveState(writer)
+	}
+}
+
+// Returns an error if the cartridge chunk was saved from a different ROM or
+// LoadState would otherwise fail, without changing the cartridge
+func (cartridge *Cartridge) CheckState(chunk state.Chunk) error {
+	if crc := chunk.Uint32(); crc != cartridge.crc32 {
+		return fmt.Errorf("save state is for a different ROM (CRC32 %08X, loaded ROM is %08X)", crc, cartridge.crc32)
+	}
+
+	if err := chunk.CheckBytes32(len(cartridge.prgRAM)); err != nil {
+		return fmt.Errorf("PRG RAM: %s", err)
+	}
+
+	if cartridge.chrRAM {
+		if err := chunk.CheckBytes32(len(cartridge.chrMemory)); err != nil {
+			return fmt.Errorf("CHR RAM: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Returns an error if LoadMapperState would fail, without changing the mapper
+func (cartridge *Cartridge) CheckMapperState(chunk state.Chunk) error {
+	mapper, ok := cartridge.mapper.(StatefulMapper)
+
+	if !ok {
+		return nil
+	}
+
+	if mapperID := chunk.Uint16(); mapperID != cartridge.info.Mapper {
+		return fmt.Errorf("save state is for mapper %d, cartridge uses mapper %d", mapperID, cartridge.info.Mapper)
+	}
+
+	return mapper.CheckState(chunk)
+}
+
+func (cartridge *Cartridge) LoadState(chunk *state.Chunk) error {
+	if crc := chunk.Uint32(); crc != cartridge.crc32 {
+		return fmt.Errorf("save state is for a different ROM (CRC32 %08X, loaded ROM is %08X)", crc, cartridge.crc32)
+	}
+
+	if err := chunk.Bytes32(cartridge.prgRAM); err != nil {
+		return fmt.Errorf("PRG RAM: %s", err)
+	}
+
+	if cartridge.chrRAM {
+		if err := chunk.Bytes32(cartridge.chrMemory); err != nil {
+			return fmt.Errorf("CHR RAM: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (cartridge *Cartridge) LoadMapperState(chunk *state.Chunk) error {
+	mapper, ok := cartridge.mapper.(StatefulMapper)
+
+	if !ok {
+		return nil
+	}
+
+	if mapperID := chunk.Uint16(); mapperID != cartridge.info.Mapper {
+		return fmt.Errorf("save state is for mapper %d, cartridge uses mapper %d", mapperID, cartridge.info.Mapper)
+	}
+
+	return mapper.LoadState(chunk)
+}
@@ -0,0 +1,176 @@
+package cheats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Game Genie code letters, each decoding to the nibble of its index
+const gameGenieLetters = "APZLGITYEOXUKSVN"
+
+// Prefixes naming the format of a code whose letters fit both
+const (
+	gameGeniePrefix       = "GG:"
+	proActionReplayPrefix = "PAR:"
+)
+
+type Cheat struct {
+	Code        string // Code as entered, normalised to upper case
+	Description string
+	Address     uint16
+	Value       uint8
+	Compare     uint8 // Only patch when the original value matches, if HasCompare is set
+	HasCompare  bool
+	Enabled     bool
+}
+
+// Returns whether the cheat patches reads from cartridge space, as opposed to
+// freezing a RAM address by rewriting it every frame
+func (cheat *Cheat) IsReadPatch() bool {
+	return cheat.Address >= 0x8000
+}
+
+/*
+*
+Decodes a cheat code in one of the following formats:
+* Game Genie, 6 letters (address, value) or 8 letters (address, value, compare)
+* Raw, "AAAA:VV" or "AAAA?CC:VV" with hex address, value and compare
+* Pro Action Replay, "AAAAVV" as 6 hex digits
+
+A and E are both Game Genie letters and hex digits, so a 6 character code
+made only of them is ambiguous and must be prefixed with "GG:" or "PAR:".
+Any other code's letters decide its format, the prefix is then optional.
+
+Codes targeting $8000-$FFFF patch cartridge reads, anything lower is treated
+as a RAM freeze.
+*
+*/
+func Decode(code string) (Cheat, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	cheat := Cheat{Code: code, Enabled: true}
+
+	switch {
+	case strings.HasPrefix(code, gameGeniePrefix):
+		return cheat, decodeGameGenie(&cheat, code[len(gameGeniePrefix):])
+	case strings.HasPrefix(code, proActionReplayPrefix):
+		return cheat, decodeProActionReplay(&cheat, code[len(proActionReplayPrefix):])
+	case strings.Contains(code, ":"):
+		return cheat, decodeRaw(&cheat)
+	}
+
+	gameGenie := (len(code) == 6 || len(code) == 8) && isMadeOf(code, gameGenieLetters)
+	proActionReplay := len(code) == 6 && isMadeOf(code, "0123456789ABCDEF")
+
+	switch {
+	case gameGenie && proActionReplay:
+		return cheat, fmt.Errorf("cheat code %q is valid as both Game Genie and Pro Action Replay, prefix it with %s or %s",
+			code, gameGeniePrefix, proActionReplayPrefix)
+	case gameGenie:
+		return cheat, decodeGameGenie(&cheat, code)
+	case proActionReplay:
+		return cheat, decodeProActionReplay(&cheat, code)
+	default:
+		return cheat, fmt.Errorf("unrecognised cheat code %q", code)
+	}
+}
+
+func isMadeOf(code string, letters string) bool {
+	for _, letter := range code {
+		if !strings.ContainsRune(letters, letter) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+*
+Game Genie codes scramble the bits of a 15-bit address, the value and the
+optional compare across the letters' nibbles. Bit 3 of the third letter is
+unused by the hardware but conventionally signals an 8 letter code.
+*
+*/
+func decodeGameGenie(cheat *Cheat, code string) error {
+	if (len(code) != 6 && len(code) != 8) || !isMadeOf(code, gameGenieLetters) {
+		return fmt.Errorf("invalid Game Genie code %q", code)
+	}
+
+	n := make([]uint16, len(code))
+
+	for i, letter := range code {
+		n[i] = uint16(strings.IndexRune(gameGenieLetters, letter))
+	}
+
+	cheat.Address = 0x8000 |
+		(n[3]&7)<<12 |
+		(n[5]&7)<<8 | (n[4]&8)<<8 |
+		(n[2]&7)<<4 | (n[1]&8)<<4 |
+		(n[4] & 7) | (n[3] & 8)
+
+	value := (n[1]&7)<<4 | (n[0]&8)<<4 | (n[0] & 7)
+
+	if len(n) == 6 {
+		cheat.Value = uint8(value | n[5]&8)
+
+		return nil
+	}
+
+	cheat.Value = uint8(value | n[7]&8)
+	cheat.Compare = uint8((n[7]&7)<<4 | (n[6]&8)<<4 | (n[6] & 7) | (n[5] & 8))
+	cheat.HasCompare = true
+
+	return nil
+}
+
+func decodeRaw(cheat *Cheat) error {
+	target, value, _ := strings.Cut(cheat.Code, ":")
+	address, compare, hasCompare := strings.Cut(target, "?")
+
+	parsedAddress, err := strconv.ParseUint(address, 16, 16)
+
+	if err != nil {
+		return fmt.Errorf("invalid cheat address %q: %s", address, err)
+	}
+
+	parsedValue, err := strconv.ParseUint(value, 16, 8)
+
+	if err != nil {
+		return fmt.Errorf("invalid cheat value %q: %s", value, err)
+	}
+
+	if hasCompare {
+		parsedCompare, err := strconv.ParseUint(compare, 16, 8)
+
+		if err != nil {
+			return fmt.Errorf("invalid cheat compare value %q: %s", compare, err)
+		}
+
+		cheat.Compare = uint8(parsedCompare)
+		cheat.HasCompare = true
+	}
+
+	cheat.Address = uint16(parsedAddress)
+	cheat.Value = uint8(parsedValue)
+
+	return nil
+}
+
+func decodeProActionReplay(cheat *Cheat, code string) error {
+	if len(code) != 6 {
+		return fmt.Errorf("invalid Pro Action Replay code %q: expected 6 hex digits", code)
+	}
+
+	parsed, err := strconv.ParseUint(code, 16, 32)
+
+	if err != nil {
+		return fmt.Errorf("invalid Pro Action Replay code %q: %s", code, err)
+	}
+
+	cheat.Address = uint16(parsed >> 8)
+	cheat.Value = uint8(parsed)
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package cheats
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Holds the active cheat list and applies it to the bus
+type Engine struct {
+	cheats      []Cheat
+	readPatches bool // At least one enabled cheat patches cartridge reads
+}
+
+func NewEngine() *Engine {
+	return &Engine{}
+}
+
+// Decodes and adds code to the cheat list enabled, replacing an existing
+// entry for the same code
+func (engine *Engine) Add(code string, description string) error {
+	cheat, err := Decode(code)
+
+	if err != nil {
+		return err
+	}
+
+	cheat.Description = description
+
+	engine.AddCheat(cheat)
+
+	return nil
+}
+
+// Adds an already decoded cheat to the cheat list, replacing an existing
+// entry for the same code
+func (engine *Engine) AddCheat(cheat Cheat) {
+	if i := engine.find(cheat.Code); i >= 0 {
+		engine.cheats[i] = cheat
+	} else {
+		engine.cheats = append(engine.cheats, cheat)
+	}
+
+	engine.update()
+}
+
+func (engine *Engine) Remove(code string) error {
+	i := engine.find(code)
+
+	if i < 0 {
+		return fmt.Errorf("cheat %q not found", code)
+	}
+
+	engine.cheats = append(engine.cheats[:i], engine.cheats[i+1:]...)
+	engine.update()
+
+	return nil
+}
+
+func (engine *Engine) SetEnabled(code string, enabled bool) error {
+	i := engine.find(code)
+
+	if i < 0 {
+		return fmt.Errorf("cheat %q not found", code)
+	}
+
+	engine.cheats[i].Enabled = enabled
+	engine.update()
+
+	return nil
+}
+
+func (engine *Engine) Clear() {
+	engine.cheats = nil
+	engine.update()
+}
+
+// Returns a copy of the cheat list
+func (engine *Engine) Cheats() []Cheat {
+	return append([]Cheat(nil), engine.cheats...)
+}
+
+// Returns the value a CPU read from cartridge space at addr should see, given
+// the value the cartridge returned
+func (engine *Engine) PatchRead(addr uint16, value uint8) uint8 {
+	if !engine.readPatches {
+		return value
+	}
+
+	for i := range engine.cheats {
+		cheat := &engine.cheats[i]
+
+		if !cheat.Enabled || cheat.Address != addr || !cheat.IsReadPatch() {
+			continue
+		}
+
+		if !cheat.HasCompare || cheat.Compare == value {
+			return cheat.Value
+		}
+	}
+
+	return value
+}
+
+// Rewrites every enabled RAM freeze cheat through write, called once per frame.
+// Compare values are checked through peek so checking one has no side effects.
+func (engine *Engine) ApplyFreezes(peek func(addr uint16) uint8, write func(addr uint16, value uint8)) {
+	for i := range engine.cheats {
+		cheat := &engine.cheats[i]
+
+		if !cheat.Enabled || cheat.IsReadPatch() {
+			continue
+		}
+
+		if !cheat.HasCompare || peek(cheat.Address) == cheat.Compare {
+			write(cheat.Address, cheat.Value)
+		}
+	}
+}
+
+func (engine *Engine) find(code string) int {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	for i := range engine.cheats {
+		if engine.cheats[i].Code == code {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (engine *Engine) update() {
+	engine.readPatches = false
+
+	for i := range engine.cheats {
+		if engine.cheats[i].Enabled && engine.cheats[i].IsReadPatch() {
+			engine.readPatches = true
+		}
+	}
+}
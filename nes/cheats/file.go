@@ -0,0 +1,116 @@
+package cheats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+*
+Cheat lists are stored one cheat per line, prefixed with "+" when enabled or
+"-" when disabled and followed by the code and an optional description:
+
+	# Super Mario Bros.
+	+ SXIOPO Infinite lives
+	- 0075:09
+
+Blank lines and lines starting with "#" are ignored.
+*
+*/
+
+// Returns the path of the cheat list kept for the ROM at romPath, sharing its base name
+func PathFor(romPath string) string {
+	return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".cht"
+}
+
+func Read(reader io.Reader) ([]Cheat, error) {
+	var list []Cheat
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		enabled := true
+
+		switch line[0] {
+		case '+':
+			line = line[1:]
+		case '-':
+			enabled = false
+			line = line[1:]
+		}
+
+		code, description, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+		cheat, err := Decode(code)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+
+		cheat.Description = strings.TrimSpace(description)
+		cheat.Enabled = enabled
+
+		list = append(list, cheat)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cheat list: %s", err)
+	}
+
+	return list, nil
+}
+
+func Write(writer io.Writer, list []Cheat) error {
+	for _, cheat := range list {
+		state := "+"
+
+		if !cheat.Enabled {
+			state = "-"
+		}
+
+		line := strings.TrimSpace(fmt.Sprintf("%s %s %s", state, cheat.Code, cheat.Description))
+
+		if _, err := fmt.Fprintln(writer, line); err != nil {
+			return fmt.Errorf("failed to write cheat list: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func Load(path string) ([]Cheat, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cheat file: %s", err)
+	}
+
+	defer file.Close()
+
+	return Read(file)
+}
+
+func Save(path string, list []Cheat) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return fmt.Errorf("failed to create cheat file: %s", err)
+	}
+
+	defer file.Close()
+
+	return Write(file, list)
+}
@@ -0,0 +1,76 @@
+package controller
+
+// Buttons held on a standard controller, one bit per button in the order
+// they are shifted out of the controller: A first and Right last
+type Buttons uint8
+
+const (
+	ButtonA Buttons = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+/*
+*
+Standard NES controller connected to $4016 (port 1) or $4017 (port 2)
+
+While strobe is set by writing 1 to bit 0 of $4016 the controller keeps
+reloading its shift register from the buttons, so reads keep returning A.
+Once strobe is cleared each read shifts out the next button, after all 8
+buttons an official controller returns 1.
+*
+*/
+type Controller struct {
+	buttons Buttons
+	shift   uint8
+	strobe  bool
+}
+
+// Sets the buttons currently held, used by frontends and movie playback
+func (controller *Controller) SetButtons(buttons Buttons) {
+	controller.buttons = buttons
+
+	if controller.strobe {
+		controller.shift = uint8(buttons)
+	}
+}
+
+func (controller *Controller) Buttons() Buttons {
+	return controller.buttons
+}
+
+// Handles a CPU write to $4016, which is shared by both controllers
+func (controller *Controller) Write(value uint8) {
+	controller.strobe = value&0x01 != 0
+
+	if controller.strobe {
+		controller.shift = uint8(controller.buttons)
+	}
+}
+
+// Handles a CPU read from the controller's port, only bit 0 is driven by
+// the controller and the upper bits are left as the open bus value $40
+func (controller *Controller) Read() uint8 {
+	if controller.strobe {
+		return 0x40 | uint8(controller.buttons&ButtonA)
+	}
+
+	value := controller.shift & 0x01
+	controller.shift = controller.shift>>1 | 0x80
+
+	return 0x40 | value
+}
+
+// Returns what Read would without shifting out the button
+func (controller *Controller) Peek() uint8 {
+	if controller.strobe {
+		return 0x40 | uint8(controller.buttons&ButtonA)
+	}
+
+	return 0x40 | controller.shift&0x01
+}
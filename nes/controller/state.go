@@ -0,0 +1,18 @@
+package controller
+
+import "gonesem/nes/state"
+
+// Both ports share one chunk, port 1 first
+var ChunkID = state.ChunkID{'C', 'T', 'R', 'L'}
+
+func (controller *Controller) SaveState(writer *state.Writer) {
+	writer.Uint8(uint8(controller.buttons))
+	writer.Uint8(controller.shift)
+	writer.Bool(controller.strobe)
+}
+
+func (controller *Controller) LoadState(chunk *state.Chunk) {
+	controller.buttons = Buttons(chunk.Uint8())
+	controller.shift = chunk.Uint8()
+	controller.strobe = chunk.Bool()
+}
@@ -24,6 +24,11 @@ const (
 	StackReset uint8  = 0x00FD
 )
 
+// Magic constant of the unstable XAA and LXA opcodes, it varies between chips and
+// with temperature. $EE is the value given by "No More Secrets", it hasn't been
+// checked against the SingleStepTests vectors for these opcodes.
+const DefaultUnstableMagic uint8 = 0xEE
+
 const (
 	ResetVector uint16 = 0xFFFC
 	IRQVector   uint16 = 0xFFFE
@@ -46,11 +51,17 @@ const (
 	AddressingModeIndirect                          // IND 10
 	AddressingModeIndirectX                         // IZX 11
 	AddressingModeIndirectY                         // IZY 12
+
+	// 65C02 only
+	AddressingModeZeroPageIndirect        // IZP 13
+	AddressingModeAbsoluteIndexedIndirect // IAX 14, JMP (abs,X)
+	AddressingModeZeroPageRelative        // ZPR 15, BBR and BBS test a zero page bit and branch
 )
 
 type OperationArgs struct {
 	addrMode AddressingMode
 	address  uint16
+	value    uint8 // Operand read from address by the cycles before the operation
 }
 
 type CPU struct {
@@ -61,20 +72,64 @@ type CPU struct {
 	SP uint8  // Statck pointer register
 	SR Status // Status register
 
-	cycles      uint8  // Cycles remaining for current instruction execution
 	TotalCycles uint64 // Total instruction cycles over lifetime of CPU
 
+	opcode       uint8  // Opcode of the instruction being executed
+	step         uint8  // Cycle of the current instruction, 0 between instructions
+	accessStep   uint8  // Cycle the operand is first accessed on, 0 while the address is calculated
+	address      uint16 // Effective address, built up over the addressing cycles
+	pointer      uint8  // Zero page pointer of the indirect addressing modes
+	value        uint8  // Operand latched between cycles
+	pageCross    bool   // Indexing carried into the high byte of address
+	branchTaken  bool   // Set by branch operations when the branch is taken
+	interrupting bool   // Running the interrupt sequence in place of an instruction
+
+	nmiPending      bool // An NMI edge was seen and the NMI hasn't been taken yet
+	irqLine         bool // Level of the IRQ line, held by devices until acknowledged
+	interruptPolled bool // An interrupt was pending when last polled
+	skipPoll        bool // Don't poll at the end of this cycle
+
+	halted       bool            // Jammed by a STP opcode until reset
+	haltAddress  uint16          // Address of the STP opcode that jammed the CPU
+	haltCallback func(pc uint16) // Called when the CPU jams
+
+	traceCallback func(cpu *CPU)                             // Called before each instruction
+	busCallback   func(addr uint16, value uint8, write bool) // Called after every bus access
+
+	waiting     bool   // Stopped by a 65C02 WAI opcode until an interrupt line is asserted
+	lastAddress uint16 // Address of the last read, repeated by the 65C02 on internal cycles
+
+	unstableMagic uint8 // Magic constant of the XAA and LXA opcodes
+
+	variant Variant
+	set     *instructionSet
+
 	memory memory.Memory
 }
 
+// Returns a 2A03 CPU, the NES' 6502
 func NewCPU(memory memory.Memory) *CPU {
+	return NewCPUVariant(memory, Variant2A03)
+}
+
+func NewCPUVariant(memory memory.Memory, variant Variant) *CPU {
+	cpu := &CPU{
+		memory:        memory,
+		unstableMagic: DefaultUnstableMagic,
+		variant:       variant,
+		set:           instructionSets[variant],
+	}
 
-	cpu := &CPU{memory: memory}
 	cpu.Reset()
 
 	return cpu
 }
 
+// Returns the chip the CPU emulates
+func (cpu *CPU) Variant() Variant {
+	return cpu.variant
+}
+
 func (cpu *CPU) Reset() {
 	// 6502 registers at reset
 	cpu.A = 0
@@ -84,155 +139,656 @@ func (cpu *CPU) Reset() {
 	cpu.SP = StackReset
 	cpu.SR = StatusUnused | StatusInterrupt
 
-	cpu.cycles = 0
+	cpu.step = 0
+	cpu.interrupting = false
+	cpu.nmiPending = false
+	cpu.interruptPolled = false
+	cpu.skipPoll = false
+	cpu.halted = false
+	cpu.waiting = false
 	cpu.TotalCycles = 0
 }
 
+// Sets the magic constant ORed into A by the XAA and LXA opcodes
+func (cpu *CPU) SetUnstableMagic(magic uint8) {
+	cpu.unstableMagic = magic
+}
+
+// Sets a function called with the address of the STP opcode when the CPU
+// jams, nil removes it
+func (cpu *CPU) SetHaltCallback(callback func(pc uint16)) {
+	cpu.haltCallback = callback
+}
+
+// Sets a function called before the first cycle of every instruction, with
+// the registers and TotalCycles as they are before it runs, nil removes it.
+// Interrupt sequences aren't instructions and don't call it.
+func (cpu *CPU) SetTraceCallback(callback func(cpu *CPU)) {
+	cpu.traceCallback = callback
+}
+
+// Sets a function called after every read or write the CPU makes, with the
+// value read or written, nil removes it
+func (cpu *CPU) SetBusCallback(callback func(addr uint16, value uint8, write bool)) {
+	cpu.busCallback = callback
+}
+
+// Returns true between instructions when the next cycle fetches an opcode,
+// false during an instruction, before an interrupt sequence and while the CPU
+// is jammed or waiting
+func (cpu *CPU) AtInstruction() bool {
+	return cpu.step == 0 && !cpu.interruptPolled && !cpu.halted && !cpu.waiting
+}
+
+// Returns the address of the STP opcode the CPU jammed on, and whether it is jammed
+func (cpu *CPU) Halted() (uint16, bool) {
+	return cpu.haltAddress, cpu.halted
+}
+
+/*
+*
+Runs a single CPU cycle, returning true if it was the last cycle of an instruction.
+
+Like the 6502 every cycle accesses the bus exactly once, so instructions make
+the same dummy reads as hardware while the CPU is busy internally, and
+read-modify-write instructions write the unmodified value back before writing
+the result. The first cycle of every instruction fetches the opcode and the
+rest are stepped through by the addressing mode, or by the instruction itself
+for those that sequence their own cycles.
+*
+*/
 func (cpu *CPU) Clock() bool {
-	if cpu.cycles > 0 {
-		cpu.cycles--
-		return cpu.cycles <= 0
+	// A jammed CPU keeps the address bus at $FFFF, every cycle ends an instruction
+	// so callers waiting for one don't wait forever
+	if cpu.halted {
+		cpu.TotalCycles++
+		cpu.Read(0xFFFF)
+		return true
 	}
 
-	opcode := cpu.Read(cpu.PC)
+	// WAI stops the CPU until an interrupt line is asserted, the interrupt is
+	// only taken if it isn't disabled, otherwise the next instruction runs
+	if cpu.waiting {
+		if !cpu.nmiPending && !cpu.irqLine {
+			cpu.TotalCycles++
+			cpu.Read(cpu.PC)
+			return true
+		}
 
-	instruction := Instructions[opcode]
+		cpu.waiting = false
+		cpu.poll()
+	}
 
-	address, pageCrosed := cpu.fetchOperandAddress(instruction.AddressingMode)
+	if cpu.step == 0 && !cpu.interruptPolled && cpu.traceCallback != nil {
+		cpu.traceCallback(cpu)
+	}
 
-	args := OperationArgs{
-		instruction.AddressingMode,
-		address,
+	cpu.TotalCycles++
+	cpu.step++
+
+	if cpu.step == 1 {
+		cpu.fetch()
+
+		if cpu.set.sequences[cpu.opcode] == sequenceSingleCycle && !cpu.interrupting {
+			cpu.step = 0
+			return true
+		}
+	} else if cpu.execute() {
+		cpu.step = 0
+		return true
 	}
 
-	cpu.cycles = instruction.Cycles
+	if cpu.skipPoll {
+		cpu.skipPoll = false
+	} else {
+		cpu.poll()
+	}
+
+	return false
+}
+
+/*
+*
+Interrupts are polled at the end of every cycle but the last of an instruction,
+so it's the lines on the second to last cycle that decide whether an interrupt
+is taken before the next one. This is why an IRQ is still taken straight after
+SEI, and only after the instruction following CLI or PLP, as the flag changes
+on their last cycle. RTI changes the flag earlier, so its effect is immediate.
+
+Taken branches that don't cross a page don't poll on their second cycle,
+delaying interrupts arriving then until after the next instruction.
+*
+*/
+func (cpu *CPU) poll() {
+	cpu.interruptPolled = cpu.nmiPending || cpu.irqLine && !cpu.getStatus(StatusInterrupt)
+}
+
+// Fetches the next opcode, unless an interrupt was polled in which case the
+// opcode is read and discarded and the interrupt sequence is run instead
+func (cpu *CPU) fetch() {
+	cpu.accessStep = 0
+	cpu.branchTaken = false
 
-	if pageCrosed {
-		cpu.cycles += instruction.AdditionalCycles
+	if cpu.interruptPolled {
+		cpu.interrupting = true
+		cpu.opcode = 0x00
+		cpu.Read(cpu.PC)
+
+		return
 	}
 
-	cpu.PC += uint16(instruction.Size)
+	cpu.opcode = cpu.fetchByte()
+}
 
-	instruction.operation(cpu, args)
+// Runs cycle cpu.step of the current instruction, returning true if it was the last
+func (cpu *CPU) execute() bool {
+	if cpu.interrupting {
+		return cpu.interruptStep()
+	}
 
-	cpu.TotalCycles += uint64(cpu.cycles)
+	instruction := cpu.set.instructions[cpu.opcode]
+
+	switch cpu.set.sequences[cpu.opcode] {
+	// Instructions without an operand in memory read the byte after the opcode and ignore it
+	case sequenceImplied:
+		cpu.Read(cpu.PC)
+		instruction.operation(cpu, OperationArgs{addrMode: instruction.AddressingMode})
+
+		return true
+
+	case sequenceBranch:
+		return cpu.branchStep(instruction, 2)
+	case sequenceBitBranch:
+		return cpu.bitBranchStep(instruction)
+	case sequenceInterrupt:
+		return cpu.interruptStep()
+	case sequenceJSR:
+		return cpu.jsrStep(instruction)
+	case sequenceRTS:
+		return cpu.rtsStep(instruction)
+	case sequenceRTI:
+		return cpu.rtiStep()
+	case sequenceJMP:
+		return cpu.jmpStep(instruction)
+	case sequencePush:
+		return cpu.pushStep(instruction)
+	case sequencePull:
+		return cpu.pullStep(instruction)
+	}
 
-	cpu.cycles--
+	if cpu.accessStep == 0 {
+		if cpu.addressingStep(instruction.AddressingMode, cpu.opcode) {
+			return false
+		}
 
-	return false
+		cpu.accessStep = cpu.step
+	}
+
+	return cpu.accessOperandStep(instruction)
 }
 
-func (cpu *CPU) fetchOperandAddress(addrMode AddressingMode) (uint16, bool) {
-	switch addrMode {
-	// Instruction's operand is implict to the intrustion or does not exist.
-	case AddressingModeImplied:
-		return 0, false
+// ---------------------- //
+// Addressing mode cycles //
+// ---------------------- //
 
-	// Instruction's operand is within the accumulator.
-	case AddressingModeAccumulator:
-		return 0, false
+/*
+*
+Runs a cycle of calculating the effective address into cpu.address, returning
+false once it is known and the cycle should access the operand instead.
 
-	// Address of instructions operand is immediately adjacent to the current program counter address.
+Indexed modes add the index to the low byte of the address first and fix the
+high byte a cycle later, reading from the unfixed address in between. If the
+index didn't cross a page that read is the operand for instructions that only
+read it, saving a cycle.
+
+Cycles spent busy internally still read from the bus, see dummyRead.
+*
+*/
+func (cpu *CPU) addressingStep(addrMode AddressingMode, opcode uint8) bool {
+	switch addrMode {
+	// Address of instructions operand is immediately adjacent to the opcode.
 	case AddressingModeImmediate:
-		return cpu.PC + 1, false
+		cpu.address = cpu.PC
+		cpu.PC++
+
+		return false
 
-	// Address of instructions operand is the 8-bit value in the address immediately adjacent to
-	// the current program counter address mapped to the 0th page.
+	// Address of instructions operand is the 8-bit value adjacent to the opcode mapped to the 0th page.
 	case AddressingModeZeroPage:
-		return uint16(cpu.Read(cpu.PC + 1)), false
-
-	// The same as zero page address but with X registers value applied as offset
-	// Mask applied to the 8 MSB in case of overflow due to offset.
-	case AddressingModeZeroPageX:
-		return uint16(cpu.Read(cpu.PC+1)+cpu.X) & 0x00FF, false
-
-	// The same as zero page address but with Y registers value applied as offset
-	// Mask applied to the 8 MSB in case of overflow due to offset.
-	case AddressingModeZeroPageY:
-		return uint16(cpu.Read(cpu.PC+1)+cpu.Y) & 0x00FF, false
-
-	// Special addressing mode for branching operations, the 8-bit value found at the address
-	// directly adjacent to the instructions operator is treated as a signed 2's compliment number
-	// (-128 to 127). This offset is then applied to the address following that to jump to an address
-	// within a 128 range around the address of the inital 8-bit value.
-	case AddressingModeRelative:
-		relAddr := uint16(cpu.Read(cpu.PC + 1))
-
-		if relAddr&0x80 != 0 {
-			relAddr |= 0xFF00
+		if cpu.step == 2 {
+			cpu.address = uint16(cpu.fetchByte())
+			return true
 		}
 
-		return cpu.PC + 2 + relAddr, false
+	// The same as zero page address but with an index register's value applied as offset,
+	// wrapping around within the 0th page.
+	case AddressingModeZeroPageX, AddressingModeZeroPageY:
+		switch cpu.step {
+		case 2:
+			cpu.address = uint16(cpu.fetchByte())
+			return true
+		case 3:
+			cpu.dummyRead(cpu.address)
+			cpu.address = uint16(uint8(cpu.address) + cpu.index(addrMode))
+
+			return true
+		}
 
-	// Reads the 2 bytes starting from the address directly adjacent to the operator and treats
-	// that 16-bit number as an absoulte address.
+	// Reads the 2 bytes adjacent to the opcode and treats that 16-bit number as an absoulte address.
 	case AddressingModeAbsolute:
-		return cpu.ReadWord(cpu.PC + 1), false
-
-	// Same as absolute but the 16-bit address has the contents of the X register applied to it
-	// as an offset.
-	case AddressingModeAbsoluteX:
-		address := cpu.ReadWord(cpu.PC+1) + uint16(cpu.X)
-		pageCrossed := cpu.pageCrossed(address-uint16(cpu.X), address)
-
-		return address, pageCrossed
-
-	// Same as absolute but the 16-bit address has the contents of the Y register applied to it
-	// as an offset.
-	case AddressingModeAbsoluteY:
-		address := cpu.ReadWord(cpu.PC+1) + uint16(cpu.Y)
-		pageCrossed := cpu.pageCrossed(address, address-uint16(cpu.Y))
-
-		return address, pageCrossed
-
-	/**
-		6502's implementation of pointers, 16-bit address read from address directly after opcode,
-		the value at this address is the address where the operand is acutally stored
-
-		NOTE. This address mode has a hardware bug on the 6502, if the pointer address
-		is on the last address of the page instead of the high byte of the address being read
-		from the 0th address of the next page the high byte wraps around to the 0th address of the
-		page the low byte is on, for example:
-
-		|----------------------------|
-		| Address | Value at address |
-		| 0x0200  | 0xFF             | <--- 3. Instead the read wraps around to the 0th address of
-		| ......  | ....             |      the low bytes current page making the operands address
-		| ......  | ....             |      0xFF29.
-		| ......  | ....             |
-		| 0x02FD  | 0x00             |
-		| 0x02FE  | 0x00             |
-		| 0x02FF  | 0x29             | <--- 1. Low byte of ptr address residing on page boundary.
-		| 0x0300  | 0x11             | <--- 2. Expected that high by will be read 0th address on
-		|----------------------------|      following page making operands address 0x1129.
-	**/
-	case AddressingModeIndirect:
-		ptrAddr := cpu.ReadWord(cpu.PC + 1)
-
-		return cpu.readWordbug(ptrAddr), false
+		switch cpu.step {
+		case 2:
+			cpu.address = uint16(cpu.fetchByte())
+			return true
+		case 3:
+			cpu.address |= uint16(cpu.fetchByte()) << 8
+			return true
+		}
 
-	case AddressingModeIndirectX:
-		ptrAddr := (uint16(cpu.Read(cpu.PC+1)) + uint16(cpu.X)) & 0x00FF
+	// Same as absolute but with an index register's contents applied as an offset.
+	case AddressingModeAbsoluteX, AddressingModeAbsoluteY:
+		switch cpu.step {
+		case 2:
+			cpu.address = uint16(cpu.fetchByte())
+			return true
+		case 3:
+			cpu.address |= uint16(cpu.fetchByte()) << 8
+			cpu.indexAddress(cpu.index(addrMode))
+
+			return true
+		case 4:
+			return cpu.readUnfixedAddress(opcode)
+		}
 
-		return cpu.readWordbug(ptrAddr), false
+	// The zero page pointer adjacent to the opcode, offset by X, holds the operand's address.
+	case AddressingModeIndirectX:
+		switch cpu.step {
+		case 2:
+			cpu.pointer = cpu.fetchByte()
+			return true
+		case 3:
+			cpu.dummyRead(uint16(cpu.pointer))
+			cpu.pointer += cpu.X
+
+			return true
+		case 4:
+			cpu.address = uint16(cpu.Read(uint16(cpu.pointer)))
+			return true
+		case 5:
+			cpu.address |= uint16(cpu.Read(uint16(cpu.pointer+1))) << 8
+			return true
+		}
 
+	// The zero page pointer adjacent to the opcode holds an address which is offset by Y.
 	case AddressingModeIndirectY:
-		ptrAddr := uint16(cpu.Read(cpu.PC + 1))
-
-		address := cpu.readWordbug(ptrAddr) + uint16(cpu.Y)
-		pageCrossed := cpu.pageCrossed(address, address-uint16(cpu.Y))
+		switch cpu.step {
+		case 2:
+			cpu.pointer = cpu.fetchByte()
+			return true
+		case 3:
+			cpu.address = uint16(cpu.Read(uint16(cpu.pointer)))
+			return true
+		case 4:
+			cpu.address |= uint16(cpu.Read(uint16(cpu.pointer+1))) << 8
+			cpu.indexAddress(cpu.Y)
+
+			return true
+		case 5:
+			return cpu.readUnfixedAddress(opcode)
+		}
 
-		return address, pageCrossed
+	// The zero page pointer adjacent to the opcode holds the operand's address.
+	case AddressingModeZeroPageIndirect:
+		switch cpu.step {
+		case 2:
+			cpu.pointer = cpu.fetchByte()
+			return true
+		case 3:
+			cpu.address = uint16(cpu.Read(uint16(cpu.pointer)))
+			return true
+		case 4:
+			cpu.address |= uint16(cpu.Read(uint16(cpu.pointer+1))) << 8
+			return true
+		}
 
 	default:
 		panic(fmt.Sprintf("Invalid addressing mode %d", addrMode))
 	}
+
+	return false
+}
+
+// Returns the index register used by an indexed addressing mode
+func (cpu *CPU) index(addrMode AddressingMode) uint8 {
+	if addrMode == AddressingModeZeroPageY || addrMode == AddressingModeAbsoluteY {
+		return cpu.Y
+	}
+
+	return cpu.X
+}
+
+// Offsets cpu.address by index, noting if the high byte needs fixing
+func (cpu *CPU) indexAddress(index uint8) {
+	indexed := cpu.address + uint16(index)
+	cpu.pageCross = cpu.pageCrossed(cpu.address, indexed)
+	cpu.address = indexed
+}
+
+// Reads from the address before its high byte was fixed, returning false when
+// that read is the operand itself
+func (cpu *CPU) readUnfixedAddress(opcode uint8) bool {
+	if !cpu.pageCross {
+		if cpu.set.fastIndexed[opcode] {
+			return false
+		}
+
+		cpu.dummyRead(cpu.address)
+
+		return true
+	}
+
+	cpu.dummyRead(cpu.address - 0x0100)
+
+	return true
+}
+
+// Reads from the bus on a cycle the CPU is busy internally. The NMOS chips read
+// from whatever address is being worked on while the 65C02 repeats its last read.
+func (cpu *CPU) dummyRead(addr uint16) {
+	if cpu.variant == Variant65C02 {
+		addr = cpu.lastAddress
+	}
+
+	cpu.Read(addr)
+}
+
+// Runs a cycle accessing the operand at cpu.address, returning true if it was the last
+func (cpu *CPU) accessOperandStep(instruction Instruction) bool {
+	args := OperationArgs{
+		instruction.AddressingMode,
+		cpu.address,
+		0,
+	}
+
+	switch cpu.set.accessKinds[cpu.opcode] {
+	case accessWrite:
+		instruction.operation(cpu, args)
+
+		return true
+
+	case accessReadModifyWrite:
+		switch cpu.step - cpu.accessStep {
+		case 0:
+			cpu.value = cpu.Read(cpu.address)
+			return false
+		case 1:
+			// The unmodified value is written back while the result is calculated,
+			// the 65C02 reads it again instead
+			if cpu.variant == Variant65C02 {
+				cpu.Read(cpu.address)
+			} else {
+				cpu.Write(cpu.address, cpu.value)
+			}
+
+			return false
+		}
+
+		args.value = cpu.value
+		instruction.operation(cpu, args)
+
+		return true
+
+	// The 65C02 takes a cycle to correct the result of decimal arithmetic
+	case accessReadDecimal:
+		if cpu.getStatus(StatusDecimal) {
+			if cpu.step == cpu.accessStep {
+				cpu.value = cpu.Read(cpu.address)
+				return false
+			}
+
+			cpu.dummyRead(cpu.address)
+		} else {
+			cpu.value = cpu.Read(cpu.address)
+		}
+
+		args.value = cpu.value
+		instruction.operation(cpu, args)
+
+		return true
+
+	default:
+		args.value = cpu.Read(cpu.address)
+		instruction.operation(cpu, args)
+
+		return true
+	}
 }
 
 func (cpu *CPU) pageCrossed(a, b uint16) bool {
 	return a&0xFF00 != b&0xFF00
 }
 
+// --------------------------- //
+// Self sequenced instructions //
+// --------------------------- //
+
+/*
+*
+Branches read the signed offset adjacent to the opcode (-128 to 127), which is
+applied to the address of the next instruction if the branch is taken.
+
+A taken branch adds a cycle reading the next opcode while the offset is added
+to the low byte of PC, and another reading from the unfixed PC if the high
+byte needs fixing.
+
+The offset is read on cycle first, the operation decides whether to branch
+from the status register or for BBR and BBS from the operand in cpu.value.
+*
+*/
+func (cpu *CPU) branchStep(instruction Instruction, first uint8) bool {
+	switch cpu.step - first {
+	case 0:
+		offset := cpu.fetchByte()
+		cpu.address = cpu.PC + uint16(int8(offset))
+
+		instruction.operation(cpu, OperationArgs{instruction.AddressingMode, cpu.address, cpu.value})
+
+		cpu.skipPoll = cpu.branchTaken && !cpu.pageCrossed(cpu.PC, cpu.address)
+
+		return !cpu.branchTaken
+	case 1:
+		cpu.Read(cpu.PC)
+
+		if !cpu.pageCrossed(cpu.PC, cpu.address) {
+			cpu.PC = cpu.address
+			return true
+		}
+
+		cpu.PC = cpu.PC&0xFF00 | cpu.address&0x00FF
+
+		return false
+	default:
+		cpu.Read(cpu.PC)
+		cpu.PC = cpu.address
+
+		return true
+	}
+}
+
+// BBR and BBS read the zero page operand and read it again before the branch offset
+func (cpu *CPU) bitBranchStep(instruction Instruction) bool {
+	switch cpu.step {
+	case 2:
+		cpu.pointer = cpu.fetchByte()
+	case 3:
+		cpu.value = cpu.Read(uint16(cpu.pointer))
+	case 4:
+		cpu.Read(uint16(cpu.pointer))
+	default:
+		return cpu.branchStep(instruction, 5)
+	}
+
+	return false
+}
+
+/*
+*
+Jumps take their target address from the 2 bytes adjacent to the opcode, or for
+indirect jumps from the address those bytes point to.
+
+NOTE. Indirect jumps have a hardware bug on the 6502, if the pointer address
+is on the last address of the page instead of the high byte of the address being read
+from the 0th address of the next page the high byte wraps around to the 0th address of the
+page the low byte is on, for example:
+
+|----------------------------|
+| Address | Value at address |
+| 0x0200  | 0xFF             | <--- 3. Instead the read wraps around to the 0th address of
+| ......  | ....             |      the low bytes current page making the operands address
+| ......  | ....             |      0xFF29.
+| ......  | ....             |
+| 0x02FD  | 0x00             |
+| 0x02FE  | 0x00             |
+| 0x02FF  | 0x29             | <--- 1. Low byte of ptr address residing on page boundary.
+| 0x0300  | 0x11             | <--- 2. Expected that high by will be read 0th address on
+|----------------------------|      following page making operands address 0x1129.
+
+The 65C02 fixes the bug at the cost of a cycle, which it also spends adding X
+to the pointer of its JMP (abs,X).
+*
+*/
+func (cpu *CPU) jmpStep(instruction Instruction) bool {
+	switch cpu.step {
+	case 2:
+		cpu.address = uint16(cpu.fetchByte())
+		return false
+	case 3:
+		cpu.address |= uint16(cpu.fetchByte()) << 8
+
+		if instruction.AddressingMode != AddressingModeAbsolute {
+			return false
+		}
+	case 4:
+		if cpu.variant == Variant65C02 {
+			cpu.dummyRead(cpu.address)
+
+			if instruction.AddressingMode == AddressingModeAbsoluteIndexedIndirect {
+				cpu.address += uint16(cpu.X)
+			}
+
+			return false
+		}
+
+		cpu.value = cpu.Read(cpu.address)
+
+		return false
+	case 5:
+		if cpu.variant == Variant65C02 {
+			cpu.value = cpu.Read(cpu.address)
+			return false
+		}
+
+		hi := cpu.Read(cpu.address&0xFF00 | uint16(uint8(cpu.address)+1))
+		cpu.address = uint16(hi)<<8 | uint16(cpu.value)
+	case 6:
+		cpu.address = uint16(cpu.Read(cpu.address+1))<<8 | uint16(cpu.value)
+	}
+
+	instruction.operation(cpu, OperationArgs{instruction.AddressingMode, cpu.address, 0})
+
+	return true
+}
+
+// JSR pushes the return address, less one, between reading the low and high
+// bytes of the target address
+func (cpu *CPU) jsrStep(instruction Instruction) bool {
+	switch cpu.step {
+	case 2:
+		cpu.value = cpu.fetchByte()
+	case 3:
+		cpu.Read(StackPage + uint16(cpu.SP))
+	case 4:
+		cpu.push(uint8(cpu.PC >> 8))
+	case 5:
+		cpu.push(uint8(cpu.PC))
+	case 6:
+		cpu.address = uint16(cpu.Read(cpu.PC))<<8 | uint16(cpu.value)
+		instruction.operation(cpu, OperationArgs{instruction.AddressingMode, cpu.address, 0})
+
+		return true
+	}
+
+	return false
+}
+
+func (cpu *CPU) rtsStep(instruction Instruction) bool {
+	switch cpu.step {
+	case 2:
+		cpu.Read(cpu.PC)
+	case 3:
+		cpu.Read(StackPage + uint16(cpu.SP))
+	case 4:
+		cpu.value = cpu.pop()
+	case 5:
+		cpu.PC = uint16(cpu.pop())<<8 | uint16(cpu.value)
+	case 6:
+		cpu.Read(cpu.PC)
+		instruction.operation(cpu, OperationArgs{addrMode: instruction.AddressingMode})
+
+		return true
+	}
+
+	return false
+}
+
+func (cpu *CPU) rtiStep() bool {
+	switch cpu.step {
+	case 2:
+		cpu.Read(cpu.PC)
+	case 3:
+		cpu.Read(StackPage + uint16(cpu.SP))
+	case 4:
+		cpu.SR = Status(cpu.pop())
+		cpu.setStatus(StatusBreak, false)
+		cpu.setStatus(StatusUnused, true)
+	case 5:
+		cpu.value = cpu.pop()
+	case 6:
+		cpu.PC = uint16(cpu.pop())<<8 | uint16(cpu.value)
+		return true
+	}
+
+	return false
+}
+
+// Pushes read the byte after the opcode before pushing
+func (cpu *CPU) pushStep(instruction Instruction) bool {
+	if cpu.step == 2 {
+		cpu.Read(cpu.PC)
+		return false
+	}
+
+	instruction.operation(cpu, OperationArgs{addrMode: instruction.AddressingMode})
+
+	return true
+}
+
+// Pulls read the byte after the opcode and the top of the stack before pulling
+func (cpu *CPU) pullStep(instruction Instruction) bool {
+	switch cpu.step {
+	case 2:
+		cpu.Read(cpu.PC)
+		return false
+	case 3:
+		cpu.Read(StackPage + uint16(cpu.SP))
+		return false
+	}
+
+	instruction.operation(cpu, OperationArgs{addrMode: instruction.AddressingMode})
+
+	return true
+}
+
 func (cpu *CPU) PrintCPUState(hexidecimal bool) {
 	cpu.PrintRegisters()
 	cpu.PrintProcessorStatus(hexidecimal)
@@ -282,12 +838,23 @@ Value: 0xFF29
 
 // Returns value from memory at address addr
 func (cpu *CPU) Read(addr uint16) uint8 {
-	return cpu.memory.Read(addr)
+	cpu.lastAddress = addr
+	value := cpu.memory.Read(addr)
+
+	if cpu.busCallback != nil {
+		cpu.busCallback(addr, value, false)
+	}
+
+	return value
 }
 
 // Writes value to address addr
 func (cpu *CPU) Write(addr uint16, value uint8) {
 	cpu.memory.Write(addr, value)
+
+	if cpu.busCallback != nil {
+		cpu.busCallback(addr, value, true)
+	}
 }
 
 // Returns 16 bit value from memory at address addr converting from little-endian order
@@ -298,16 +865,12 @@ func (cpu *CPU) ReadWord(addr uint16) uint16 {
 	return (hi << 8) | lo
 }
 
-// Returns 16 bit value from memory similar to ReadWord, emulating the 6502 hardware bug
-// where the high byte is read from the start of the low bytes page if the low byte is
-// on page boudary instead of the next page i.e. the low byte of the address passed in
-// is FF
-func (cpu *CPU) readWordbug(addr uint16) uint16 {
-	if addr&0x00FF == 0x00FF {
-		return uint16(cpu.Read(addr&0xFF00))<<8 | uint16(cpu.Read(addr))
-	} else {
-		return cpu.ReadWord(addr)
-	}
+// Reads the byte at PC and advances past it
+func (cpu *CPU) fetchByte() uint8 {
+	value := cpu.Read(cpu.PC)
+	cpu.PC++
+
+	return value
 }
 
 // Writes 16 bit value to address addr converting value to little-endian order
@@ -360,21 +923,6 @@ func (cpu *CPU) pop() uint8 {
 	return cpu.Read(StackPage + uint16(cpu.SP))
 }
 
-// Pushes 16-bit value onto the stack converting it to little-endian order
-func (cpu *CPU) pushWord(value uint16) {
-	hi := uint8(value >> 8)
-	lo := uint8(value & 0x00FF)
-	cpu.push(hi)
-	cpu.push(lo)
-}
-
-// Pops 16-bit value off the stack converting it from little-endian order before returning
-func (cpu *CPU) popWord() uint16 {
-	lo := uint16(cpu.pop())
-	hi := uint16(cpu.pop())
-	return hi<<8 | lo
-}
-
 func (cpu *CPU) setStatus(status Status, value bool) {
 	if value {
 		cpu.SR |= status
@@ -408,52 +956,83 @@ func (cpu *CPU) setZN(value uint8) {
 	cpu.setN(value)
 }
 
-func (cpu *CPU) branch(branch bool, address uint16) {
-	if branch {
-		cpu.cycles += 1
-
-		if cpu.pageCrossed(address, cpu.PC) {
-			cpu.cycles += 1
-		}
-
-		cpu.PC = address
-	}
+// Records whether a branch is taken, the cycles after the operand is read move PC
+func (cpu *CPU) branch(branch bool) {
+	cpu.branchTaken = branch
 }
 
 // ---------- //
 // Interrupts //
 // ---------- //
 
-func (cpu *CPU) IRQ() {
-	if !cpu.getStatus(StatusInterrupt) {
-		cpu.pushWord(cpu.PC)
+/*
+*
+BRK and interrupts share a sequence, pushing PC and the status register before
+loading PC from a vector. For interrupts the opcode fetch is discarded and PC
+isn't advanced, and the status is pushed with the break flag clear.
+
+An NMI that is pending by the time the status is pushed hijacks the sequence,
+loading the NMI vector instead. This applies to BRK as well, which keeps its
+break flag in the pushed status, so the BRK is lost unless the NMI handler
+checks for it. An NMI arriving later is polled on the second to last cycle
+and taken straight after the sequence.
+*
+*/
+func (cpu *CPU) interruptStep() bool {
+	switch cpu.step {
+	case 2:
+		cpu.Read(cpu.PC)
+
+		// BRK skips the byte after it
+		if !cpu.interrupting {
+			cpu.PC++
+		}
+	case 3:
+		cpu.push(uint8(cpu.PC >> 8))
+	case 4:
+		cpu.push(uint8(cpu.PC))
+	case 5:
+		status := cpu.SR | StatusBreak | StatusUnused
+
+		if cpu.interrupting {
+			status &^= StatusBreak
+		}
 
-		cpu.setStatus(StatusBreak, false)
+		cpu.push(uint8(status))
 		cpu.setStatus(StatusInterrupt, true)
-		cpu.setStatus(StatusUnused, true)
 
-		cpu.push(uint8(cpu.SR))
+		// The 65C02 also leaves decimal mode so handlers don't have to
+		if cpu.variant == Variant65C02 {
+			cpu.setStatus(StatusDecimal, false)
+		}
 
-		cpu.PC = cpu.ReadWord(IRQVector)
+		if cpu.nmiPending {
+			cpu.address = NMIVector
+			cpu.nmiPending = false
+		} else {
+			cpu.address = IRQVector
+		}
+	case 6:
+		cpu.value = cpu.Read(cpu.address)
+	case 7:
+		cpu.PC = uint16(cpu.Read(cpu.address+1))<<8 | uint16(cpu.value)
+		cpu.interrupting = false
 
-		cpu.cycles = 7
-		cpu.TotalCycles += uint64(cpu.cycles)
+		return true
 	}
-}
-
-func (cpu *CPU) NMI() {
-	cpu.pushWord(cpu.PC)
 
-	cpu.setStatus(StatusBreak, false)
-	cpu.setStatus(StatusInterrupt, true)
-	cpu.setStatus(StatusUnused, true)
-
-	cpu.push(uint8(cpu.SR))
+	return false
+}
 
-	cpu.PC = cpu.ReadWord(NMIVector)
+// Sets the level of the IRQ line, an IRQ is taken while it's asserted and the
+// interrupt disable flag is clear, until the device asserting it is acknowledged
+func (cpu *CPU) SetIRQ(asserted bool) {
+	cpu.irqLine = asserted
+}
 
-	cpu.cycles = 8
-	cpu.TotalCycles += uint64(cpu.cycles)
+// Signals an NMI edge, the NMI is taken once polled
+func (cpu *CPU) NMI() {
+	cpu.nmiPending = true
 }
 
 // --------------- //
@@ -466,7 +1045,7 @@ Add with carry
 *
 */
 func adc(cpu *CPU, args OperationArgs) {
-	operand := uint16(cpu.Read(args.address))
+	operand := uint16(args.value)
 	carryBit := uint16(util.Btou8(cpu.getStatus(StatusCarry)))
 
 	result := uint16(cpu.A) + operand + carryBit
@@ -489,7 +1068,7 @@ Logical And
 *
 */
 func and(cpu *CPU, args OperationArgs) {
-	cpu.A &= cpu.Read(args.address)
+	cpu.A &= args.value
 	cpu.setZN(cpu.A)
 }
 
@@ -512,7 +1091,7 @@ func asl(cpu *CPU, args OperationArgs) {
 		cpu.A <<= 1
 		cpu.setZN(cpu.A)
 	} else {
-		operand := cpu.Read(args.address)
+		operand := args.value
 		cpu.setStatus(StatusCarry, operand&0x80 != 0)
 		operand <<= 1
 		cpu.setZN(operand)
@@ -529,7 +1108,7 @@ register to the pre-calculated relative address in address argument.
 */
 func bcc(cpu *CPU, args OperationArgs) {
 	branched := !cpu.getStatus(StatusCarry)
-	cpu.branch(branched, args.address)
+	cpu.branch(branched)
 }
 
 /*
@@ -541,7 +1120,7 @@ register to the pre-calculated relative address in address argument.
 */
 func bcs(cpu *CPU, args OperationArgs) {
 	branched := cpu.getStatus(StatusCarry)
-	cpu.branch(branched, args.address)
+	cpu.branch(branched)
 }
 
 /*
@@ -553,7 +1132,7 @@ register to the pre-calculated relative address in address argument.
 */
 func beq(cpu *CPU, args OperationArgs) {
 	branched := cpu.getStatus(StatusZero)
-	cpu.branch(branched, args.address)
+	cpu.branch(branched)
 }
 
 /*
@@ -564,12 +1143,18 @@ Bit Test
 the zero status flag based on the result of that operation.
 * Values of bit 6 and 7 of operand are used to set the negative and overflow
 status flags respectively.
+* The 65C02's immediate mode only sets the zero flag.
 *
 */
 func bit(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address)
+	operand := args.value
 
 	cpu.setZ(cpu.A & operand)
+
+	if args.addrMode == AddressingModeImmediate {
+		return
+	}
+
 	cpu.setStatus(StatusOverflow, operand&(1<<6) != 0)
 	cpu.setStatus(StatusNegative, operand&(1<<7) != 0)
 }
@@ -583,7 +1168,7 @@ register to the pre-calculated relative address in address argument.
 */
 func bmi(cpu *CPU, args OperationArgs) {
 	branched := cpu.getStatus(StatusNegative)
-	cpu.branch(branched, args.address)
+	cpu.branch(branched)
 }
 
 /*
@@ -595,7 +1180,7 @@ register to the pre-calculated relative address in address argument.
 */
 func bne(cpu *CPU, args OperationArgs) {
 	branched := !cpu.getStatus(StatusZero)
-	cpu.branch(branched, args.address)
+	cpu.branch(branched)
 }
 
 /*
@@ -607,14 +1192,7 @@ register to the pre-calculated relative address in address argument.
 */
 func bpl(cpu *CPU, args OperationArgs) {
 	branched := !cpu.getStatus(StatusNegative)
-	cpu.branch(branched, args.address)
-}
-
-func brk(cpu *CPU, args OperationArgs) {
-	cpu.pushWord(cpu.PC)
-	cpu.push(uint8(cpu.SR | StatusBreak | StatusUnused))
-	cpu.setStatus(StatusInterrupt, true)
-	cpu.PC = cpu.ReadWord(0xFFFE)
+	cpu.branch(branched)
 }
 
 /*
@@ -626,7 +1204,7 @@ register to the pre-calculated relative address in address argument.
 */
 func bvc(cpu *CPU, args OperationArgs) {
 	branched := !cpu.getStatus(StatusOverflow)
-	cpu.branch(branched, args.address)
+	cpu.branch(branched)
 }
 
 /*
@@ -638,7 +1216,7 @@ register to the pre-calculated relative address in address argument.
 */
 func bvs(cpu *CPU, args OperationArgs) {
 	branched := cpu.getStatus(StatusOverflow)
-	cpu.branch(branched, args.address)
+	cpu.branch(branched)
 }
 
 func clc(cpu *CPU, args OperationArgs) {
@@ -667,7 +1245,7 @@ Compare
 *
 */
 func cmp(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address)
+	operand := args.value
 
 	cpu.setStatus(StatusCarry, cpu.A >= operand)
 	cpu.setZN(cpu.A - operand)
@@ -683,7 +1261,7 @@ Compare X Register
 *
 */
 func cpx(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address)
+	operand := args.value
 
 	cpu.setStatus(StatusCarry, cpu.X >= operand)
 	cpu.setZN(cpu.X - operand)
@@ -699,14 +1277,21 @@ Compare Y Register
 *
 */
 func cpy(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address)
+	operand := args.value
 
 	cpu.setStatus(StatusCarry, cpu.Y >= operand)
 	cpu.setZN(cpu.Y - operand)
 }
 
 func dec(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address) - 1
+	if args.addrMode == AddressingModeAccumulator {
+		cpu.A--
+		cpu.setZN(cpu.A)
+
+		return
+	}
+
+	operand := args.value - 1
 
 	cpu.Write(args.address, operand)
 	cpu.setZN(operand)
@@ -723,12 +1308,19 @@ func dey(cpu *CPU, args OperationArgs) {
 }
 
 func eor(cpu *CPU, args OperationArgs) {
-	cpu.A ^= cpu.Read(args.address)
+	cpu.A ^= args.value
 	cpu.setZN(cpu.A)
 }
 
 func inc(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address) + 1
+	if args.addrMode == AddressingModeAccumulator {
+		cpu.A++
+		cpu.setZN(cpu.A)
+
+		return
+	}
+
+	operand := args.value + 1
 
 	cpu.Write(args.address, operand)
 	cpu.setZN(operand)
@@ -748,23 +1340,23 @@ func jmp(cpu *CPU, args OperationArgs) {
 	cpu.PC = args.address
 }
 
+// The return address is pushed by the cycles before
 func jsr(cpu *CPU, args OperationArgs) {
-	cpu.pushWord(cpu.PC - 1)
 	cpu.PC = args.address
 }
 
 func lda(cpu *CPU, args OperationArgs) {
-	cpu.A = cpu.Read(args.address)
+	cpu.A = args.value
 	cpu.setZN(cpu.A)
 }
 
 func ldx(cpu *CPU, args OperationArgs) {
-	cpu.X = cpu.Read(args.address)
+	cpu.X = args.value
 	cpu.setZN(cpu.X)
 }
 
 func ldy(cpu *CPU, args OperationArgs) {
-	cpu.Y = cpu.Read(args.address)
+	cpu.Y = args.value
 	cpu.setZN(cpu.Y)
 }
 
@@ -774,7 +1366,7 @@ func lsr(cpu *CPU, args OperationArgs) {
 		cpu.A >>= 1
 		cpu.setZN(cpu.A)
 	} else {
-		operand := cpu.Read(args.address)
+		operand := args.value
 		cpu.setStatus(StatusCarry, operand&0x0001 != 0)
 		operand >>= 1
 		cpu.setZN(operand)
@@ -786,7 +1378,7 @@ func nop(cpu *CPU, args OperationArgs) {
 }
 
 func ora(cpu *CPU, args OperationArgs) {
-	cpu.A |= cpu.Read(args.address)
+	cpu.A |= args.value
 	cpu.setZN(cpu.A)
 }
 
@@ -817,7 +1409,7 @@ func rol(cpu *CPU, args OperationArgs) {
 		cpu.A = cpu.A<<1 | carryBit
 		cpu.setZN(cpu.A)
 	} else {
-		operand := cpu.Read(args.address)
+		operand := args.value
 		cpu.setStatus(StatusCarry, operand&0x80 != 0)
 		operand = operand<<1 | carryBit
 		cpu.setZN(operand)
@@ -833,7 +1425,7 @@ func ror(cpu *CPU, args OperationArgs) {
 		cpu.A = cpu.A>>1 | carryBit
 		cpu.setZN(cpu.A)
 	} else {
-		operand := cpu.Read(args.address)
+		operand := args.value
 		cpu.setStatus(StatusCarry, operand&0x0001 != 0)
 		operand = operand>>1 | carryBit
 		cpu.setZN(operand)
@@ -841,20 +1433,14 @@ func ror(cpu *CPU, args OperationArgs) {
 	}
 }
 
-func rti(cpu *CPU, args OperationArgs) {
-	cpu.SR = Status(cpu.pop())
-	cpu.setStatus(StatusBreak, false)
-	cpu.setStatus(StatusUnused, true)
-
-	cpu.PC = cpu.popWord()
-}
-
+// The return address is pulled by the cycles before, it points at the last
+// byte of the JSR
 func rts(cpu *CPU, args OperationArgs) {
-	cpu.PC = cpu.popWord() + 1
+	cpu.PC++
 }
 
 func sbc(cpu *CPU, args OperationArgs) {
-	operand := uint16(cpu.Read(args.address)) ^ 0x00FF
+	operand := uint16(args.value) ^ 0x00FF
 	carryBit := uint16(util.Btou8(cpu.getStatus(StatusCarry)))
 
 	result := uint16(cpu.A) + operand + carryBit
@@ -925,8 +1511,42 @@ func tya(cpu *CPU, args OperationArgs) {
 // Unoffical Opcodes //
 // ----------------- //
 
+/*
+*
+Unstable stores
+SHA (AHX), SHX, SHY and TAS store a register ANDed with the high byte of the
+unindexed address plus one, a side effect of the high byte being on the bus
+while the value is written. If indexing crossed a page the value written also
+becomes the high byte of the address written to, instead of the fixed one.
+
+On hardware a DMA stealing the write cycle drops the high byte from the AND.
+Only the DMC's DMA can do that, OAM DMA starts after the instruction writing
+$4014, and the DMC isn't emulated so it never happens here.
+
+This follows "NMOS 6510 Unintended Opcodes - No More Secrets" and hasn't been
+checked against the SingleStepTests vectors for these opcodes, see
+test/data/singlestep.
+*
+*/
+func (cpu *CPU) writeUnstable(address uint16, value uint8) {
+	// The fixed high byte is already the unindexed one plus one after a page cross
+	high := uint8(address >> 8)
+
+	if !cpu.pageCross {
+		high++
+	}
+
+	value &= high
+
+	if cpu.pageCross {
+		address = uint16(value)<<8 | address&0x00FF
+	}
+
+	cpu.Write(address, value)
+}
+
 func ahx(cpu *CPU, args OperationArgs) {
-	cpu.Write(args.address, cpu.A&cpu.X&(uint8(args.address>>8)+1))
+	cpu.writeUnstable(args.address, cpu.A&cpu.X)
 }
 
 /*
@@ -938,7 +1558,7 @@ Load Accumulator and Logical Shift Right
 *
 */
 func alr(cpu *CPU, args OperationArgs) {
-	cpu.A = cpu.Read(args.address)
+	cpu.A = args.value
 	cpu.setStatus(StatusCarry, cpu.A&0x0001 != 0)
 	cpu.A >>= 1
 	cpu.setZN(cpu.A)
@@ -953,7 +1573,7 @@ AND with Accumulator and Copy N to C
 *
 */
 func anc(cpu *CPU, arg OperationArgs) {
-	cpu.A &= cpu.Read(arg.address)
+	cpu.A &= arg.value
 	cpu.setZN(cpu.A)
 	cpu.setStatus(StatusCarry, cpu.getStatus(StatusNegative))
 }
@@ -969,7 +1589,7 @@ AND with Accumulator and Rotate Right
 *
 */
 func arr(cpu *CPU, args OperationArgs) {
-	cpu.A &= cpu.Read(args.address)
+	cpu.A &= args.value
 	cpu.A = cpu.A>>1 | cpu.A&0x0001<<7
 	cpu.setZN(cpu.A)
 
@@ -981,7 +1601,7 @@ func arr(cpu *CPU, args OperationArgs) {
 }
 
 func axs(cpu *CPU, args OperationArgs) {
-	operand := uint16(cpu.Read(args.address))
+	operand := uint16(args.value)
 	cpu.X &= cpu.A
 	result := uint16(cpu.X) - operand
 
@@ -993,7 +1613,7 @@ func axs(cpu *CPU, args OperationArgs) {
 }
 
 func dcp(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address) - 1
+	operand := args.value - 1
 	cpu.Write(args.address, operand)
 
 	cpu.setStatus(StatusCarry, cpu.A >= operand)
@@ -1001,7 +1621,7 @@ func dcp(cpu *CPU, args OperationArgs) {
 }
 
 func isc(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address) + 1
+	operand := args.value + 1
 	cpu.Write(args.address, operand)
 
 	subtrahend := uint16(operand) ^ 0x00FF
@@ -1019,20 +1639,35 @@ func isc(cpu *CPU, args OperationArgs) {
 }
 
 func las(cpu *CPU, args OperationArgs) {
-	cpu.SP &= cpu.Read(args.address)
+	cpu.SP &= args.value
 	cpu.A = cpu.SP
 	cpu.X = cpu.SP
+	cpu.setZN(cpu.SP)
 }
 
 func lax(cpu *CPU, args OperationArgs) {
-	cpu.A = cpu.Read(args.address)
+	cpu.A = args.value
+	cpu.X = cpu.A
+	cpu.setZN(cpu.A)
+}
+
+/*
+*
+Load Accumulator and X, unstable
+* ORs the accumulator with a magic constant, then ANDs it with the operand
+* Copies the result to the X register
+* Sets Zero and Negative bits in status registers based on result
+*
+*/
+func lxa(cpu *CPU, args OperationArgs) {
+	cpu.A = (cpu.A | cpu.unstableMagic) & args.value
 	cpu.X = cpu.A
 	cpu.setZN(cpu.A)
 }
 
 func rla(cpu *CPU, args OperationArgs) {
 	carryBit := util.Btou8(cpu.getStatus(StatusCarry))
-	operand := cpu.Read(args.address)
+	operand := args.value
 
 	cpu.setStatus(StatusCarry, operand&0x80 != 0)
 	operand = operand<<1 | carryBit
@@ -1044,7 +1679,7 @@ func rla(cpu *CPU, args OperationArgs) {
 
 func rra(cpu *CPU, args OperationArgs) {
 	carryBit := util.Btou8(cpu.getStatus(StatusCarry))
-	operand := cpu.Read(args.address)
+	operand := args.value
 
 	cpu.setStatus(StatusCarry, operand&0x01 != 0)
 	operand = operand>>1 | carryBit<<7
@@ -1066,15 +1701,15 @@ func sax(cpu *CPU, args OperationArgs) {
 }
 
 func shx(cpu *CPU, args OperationArgs) {
-	cpu.Write(args.address, cpu.X&(uint8(args.address>>8)+1))
+	cpu.writeUnstable(args.address, cpu.X)
 }
 
 func shy(cpu *CPU, args OperationArgs) {
-	cpu.Write(args.address, cpu.Y&(uint8(args.address>>8)+1))
+	cpu.writeUnstable(args.address, cpu.Y)
 }
 
 func slo(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address)
+	operand := args.value
 
 	cpu.setStatus(StatusCarry, operand&0x80 != 0)
 	operand <<= 1
@@ -1086,7 +1721,7 @@ func slo(cpu *CPU, args OperationArgs) {
 }
 
 func sre(cpu *CPU, args OperationArgs) {
-	operand := cpu.Read(args.address)
+	operand := args.value
 
 	cpu.setStatus(StatusCarry, operand&0x01 != 0)
 	operand >>= 1
@@ -1098,11 +1733,263 @@ func sre(cpu *CPU, args OperationArgs) {
 }
 
 func tas(cpu *CPU, args OperationArgs) {
-	cpu.SR = Status(cpu.A & cpu.X)
-	cpu.Write(args.address, uint8(cpu.SR)&(uint8(args.address>>8)+1))
+	cpu.SP = cpu.A & cpu.X
+	cpu.writeUnstable(args.address, cpu.SP)
+}
+
+/*
+*
+Transfer X to Accumulator and AND, unstable (ANE)
+* ORs the accumulator with a magic constant, then ANDs it with X and the operand
+* Sets Zero and Negative bits in status registers based on result
+*
+*/
+func xaa(cpu *CPU, args OperationArgs) {
+	cpu.A = (cpu.A | cpu.unstableMagic) & cpu.X & args.value
+	cpu.setZN(cpu.A)
+}
+
+/*
+*
+Jam
+* Halts the CPU, only a reset starts it again. Interrupts are ignored while jammed.
+*
+*/
+func stp(cpu *CPU, args OperationArgs) {
+	cpu.halted = true
+	cpu.haltAddress = cpu.PC - 1
+
+	if cpu.haltCallback != nil {
+		cpu.haltCallback(cpu.haltAddress)
+	}
+}
+
+// ------------ //
+// Decimal mode //
+// ------------ //
+
+/*
+*
+With the decimal flag set ADC and SBC treat the accumulator and operand as two
+digit BCD numbers. The 2A03 has this disconnected, the NMOS 6502 and 65C02 use
+these in place of the binary versions.
+
+Results for invalid BCD digits and the flags follow what the chips do rather
+than what's meaningful. On the NMOS 6502 only the carry is valid, N and V come
+from the result before the high digit is corrected and Z from the binary sum.
+The 65C02 sets N and Z from the decimal result. Results for valid digits are
+tested exhaustively, those for invalid digits and the NMOS 6502's N and V
+haven't been checked against the SingleStepTests 6502 and wdc65c02 vectors.
+*
+*/
+func (cpu *CPU) addDecimal(operand uint8) {
+	a, b := int(cpu.A), int(operand)
+	carryBit := int(util.Btou8(cpu.getStatus(StatusCarry)))
+
+	lo := a&0x0F + b&0x0F + carryBit
+
+	if lo >= 0x0A {
+		lo = (lo+0x06)&0x0F + 0x10
+	}
+
+	result := a&0xF0 + b&0xF0 + lo
+	signed := int(int8(a&0xF0)) + int(int8(b&0xF0)) + lo
+
+	if result >= 0xA0 {
+		result += 0x60
+	}
+
+	cpu.setStatus(StatusCarry, result >= 0x100)
+	cpu.setStatus(StatusOverflow, signed < -128 || signed > 127)
+
+	if cpu.variant == Variant65C02 {
+		cpu.setZN(uint8(result))
+	} else {
+		cpu.setZ(uint8(a + b + carryBit))
+		cpu.setN(uint8(signed))
+	}
+
+	cpu.A = uint8(result)
+}
+
+// Subtracts in BCD, all of the flags on the NMOS 6502 and the carry and overflow
+// on the 65C02 are those of binary subtraction
+func (cpu *CPU) subtractDecimal(operand uint8) {
+	a, b := int(cpu.A), int(operand)
+	borrow := 1 - int(util.Btou8(cpu.getStatus(StatusCarry)))
+
+	binary := a - b - borrow
+	lo := a&0x0F - b&0x0F - borrow
+
+	cpu.setStatus(StatusCarry, binary >= 0)
+	cpu.setStatus(StatusOverflow, (a^b)&(a^binary)&0x80 != 0)
+
+	var result int
+
+	if cpu.variant == Variant65C02 {
+		result = binary
+
+		if result < 0 {
+			result -= 0x60
+		}
+
+		if lo < 0 {
+			result -= 0x06
+		}
+
+		cpu.setZN(uint8(result))
+	} else {
+		if lo < 0 {
+			lo = (lo-0x06)&0x0F - 0x10
+		}
+
+		result = a&0xF0 - b&0xF0 + lo
+
+		if result < 0 {
+			result -= 0x60
+		}
+
+		cpu.setZN(uint8(binary))
+	}
+
+	cpu.A = uint8(result)
+}
+
+func adcDecimal(cpu *CPU, args OperationArgs) {
+	if !cpu.getStatus(StatusDecimal) {
+		adc(cpu, args)
+		return
+	}
+
+	cpu.addDecimal(args.value)
+}
+
+func sbcDecimal(cpu *CPU, args OperationArgs) {
+	if !cpu.getStatus(StatusDecimal) {
+		sbc(cpu, args)
+		return
+	}
+
+	cpu.subtractDecimal(args.value)
+}
+
+func iscDecimal(cpu *CPU, args OperationArgs) {
+	if !cpu.getStatus(StatusDecimal) {
+		isc(cpu, args)
+		return
+	}
+
+	operand := args.value + 1
+	cpu.Write(args.address, operand)
+
+	cpu.subtractDecimal(operand)
+}
+
+func rraDecimal(cpu *CPU, args OperationArgs) {
+	if !cpu.getStatus(StatusDecimal) {
+		rra(cpu, args)
+		return
+	}
+
+	carryBit := util.Btou8(cpu.getStatus(StatusCarry))
+	operand := args.value
+
+	cpu.setStatus(StatusCarry, operand&0x01 != 0)
+	operand = operand>>1 | carryBit<<7
+	cpu.Write(args.address, operand)
+
+	cpu.addDecimal(operand)
 }
 
-// Unimplemented operation function
-func xxx(cpu *CPU, args OperationArgs) {
+// ------------- //
+// 65C02 Opcodes //
+// ------------- //
+
+func bra(cpu *CPU, args OperationArgs) {
+	cpu.branch(true)
+}
+
+func phx(cpu *CPU, args OperationArgs) {
+	cpu.push(cpu.X)
+}
+
+func phy(cpu *CPU, args OperationArgs) {
+	cpu.push(cpu.Y)
+}
 
+func plx(cpu *CPU, args OperationArgs) {
+	cpu.X = cpu.pop()
+	cpu.setZN(cpu.X)
+}
+
+func ply(cpu *CPU, args OperationArgs) {
+	cpu.Y = cpu.pop()
+	cpu.setZN(cpu.Y)
+}
+
+func stz(cpu *CPU, args OperationArgs) {
+	cpu.Write(args.address, 0)
+}
+
+/*
+*
+Test and Set Bits
+* Sets the zero status if the accumulator ANDed with the operand is 0
+* Writes the operand with the bits set in the accumulator set
+*
+*/
+func tsb(cpu *CPU, args OperationArgs) {
+	cpu.setZ(cpu.A & args.value)
+	cpu.Write(args.address, args.value|cpu.A)
+}
+
+/*
+*
+Test and Reset Bits
+* Sets the zero status if the accumulator ANDed with the operand is 0
+* Writes the operand with the bits set in the accumulator cleared
+*
+*/
+func trb(cpu *CPU, args OperationArgs) {
+	cpu.setZ(cpu.A & args.value)
+	cpu.Write(args.address, args.value&^cpu.A)
+}
+
+// Returns the operation of RMB0 to RMB7, clearing a bit of a zero page operand
+func rmb(bit uint8) func(*CPU, OperationArgs) {
+	return func(cpu *CPU, args OperationArgs) {
+		cpu.Write(args.address, args.value&^(1<<bit))
+	}
+}
+
+// Returns the operation of SMB0 to SMB7, setting a bit of a zero page operand
+func smb(bit uint8) func(*CPU, OperationArgs) {
+	return func(cpu *CPU, args OperationArgs) {
+		cpu.Write(args.address, args.value|1<<bit)
+	}
+}
+
+// Returns the operation of BBR0 to BBR7, branching if a bit of a zero page operand is clear
+func bbr(bit uint8) func(*CPU, OperationArgs) {
+	return func(cpu *CPU, args OperationArgs) {
+		cpu.branch(args.value&(1<<bit) == 0)
+	}
+}
+
+// Returns the operation of BBS0 to BBS7, branching if a bit of a zero page operand is set
+func bbs(bit uint8) func(*CPU, OperationArgs) {
+	return func(cpu *CPU, args OperationArgs) {
+		cpu.branch(args.value&(1<<bit) != 0)
+	}
+}
+
+/*
+*
+Wait for Interrupt
+* Stops the CPU until an IRQ or NMI is signalled, without the latency of
+polling for it in a loop. See Clock.
+*
+*/
+func wai(cpu *CPU, args OperationArgs) {
+	cpu.waiting = true
 }
@@ -1,7 +1,7 @@
 package cpu
 
 type Instruction struct {
-	operation        func(*CPU, OperationArgs)
+	operation        func(*CPU, OperationArgs) // Runs on the last cycle, nil for BRK and RTI whose every cycle is sequenced by the CPU
 	Mnemonic         string
 	AddressingMode   AddressingMode
 	Size             uint8
@@ -10,9 +10,9 @@ type Instruction struct {
 }
 
 var Instructions = [256]Instruction{
-	{brk, "BRK", AddressingModeImplied, 1, 7, 0},     // 0x00
+	{nil, "BRK", AddressingModeImplied, 1, 7, 0},     // 0x00
 	{ora, "ORA", AddressingModeIndirectX, 2, 6, 0},   // 0x01
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x02
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x02
 	{slo, "SLO", AddressingModeIndirectX, 2, 8, 0},   // 0x03
 	{nop, "NOP", AddressingModeZeroPage, 2, 3, 0},    // 0x04
 	{ora, "ORA", AddressingModeZeroPage, 2, 3, 0},    // 0x05
@@ -28,7 +28,7 @@ var Instructions = [256]Instruction{
 	{slo, "SLO", AddressingModeAbsolute, 3, 6, 0},    // 0x0F
 	{bpl, "BPL", AddressingModeRelative, 2, 2, 0},    // 0x10
 	{ora, "ORA", AddressingModeIndirectY, 2, 5, 1},   // 0x11
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x12
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x12
 	{slo, "SLO", AddressingModeIndirectY, 2, 8, 0},   // 0x13
 	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},   // 0x14
 	{ora, "ORA", AddressingModeZeroPageX, 2, 4, 0},   // 0x15
@@ -44,7 +44,7 @@ var Instructions = [256]Instruction{
 	{slo, "SLO", AddressingModeAbsoluteX, 3, 7, 0},   // 0x1F
 	{jsr, "JSR", AddressingModeAbsolute, 3, 6, 0},    // 0x20
 	{and, "AND", AddressingModeIndirectX, 2, 6, 0},   // 0x21
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x22
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x22
 	{rla, "RLA", AddressingModeIndirectX, 2, 8, 0},   // 0x23
 	{bit, "BIT", AddressingModeZeroPage, 2, 3, 0},    // 0x24
 	{and, "AND", AddressingModeZeroPage, 2, 3, 0},    // 0x25
@@ -60,7 +60,7 @@ var Instructions = [256]Instruction{
 	{rla, "RLA", AddressingModeAbsolute, 3, 6, 0},    // 0x2F
 	{bmi, "BMI", AddressingModeRelative, 2, 2, 0},    // 0x30
 	{and, "AND", AddressingModeIndirectY, 2, 5, 1},   // 0x31
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x32
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x32
 	{rla, "RLA", AddressingModeIndirectY, 2, 8, 0},   // 0x33
 	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},   // 0x34
 	{and, "AND", AddressingModeZeroPageX, 2, 4, 0},   // 0x35
@@ -74,9 +74,9 @@ var Instructions = [256]Instruction{
 	{and, "AND", AddressingModeAbsoluteX, 3, 4, 1},   // 0x3D
 	{rol, "ROL", AddressingModeAbsoluteX, 3, 7, 0},   // 0x3E
 	{rla, "RLA", AddressingModeAbsoluteX, 3, 7, 0},   // 0x3F
-	{rti, "RTI", AddressingModeImplied, 1, 6, 0},     // 0x40
+	{nil, "RTI", AddressingModeImplied, 1, 6, 0},     // 0x40
 	{eor, "EOR", AddressingModeIndirectX, 2, 6, 0},   // 0x41
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x42
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x42
 	{sre, "SRE", AddressingModeIndirectX, 2, 8, 0},   // 0x43
 	{nop, "NOP", AddressingModeZeroPage, 2, 3, 0},    // 0x44
 	{eor, "EOR", AddressingModeZeroPage, 2, 3, 0},    // 0x45
@@ -92,7 +92,7 @@ var Instructions = [256]Instruction{
 	{sre, "SRE", AddressingModeAbsolute, 3, 6, 0},    // 0x4F
 	{bvc, "BVC", AddressingModeRelative, 2, 2, 0},    // 0x50
 	{eor, "EOR", AddressingModeIndirectY, 2, 5, 1},   // 0x51
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x52
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x52
 	{sre, "SRE", AddressingModeIndirectY, 2, 8, 0},   // 0x53
 	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},   // 0x54
 	{eor, "EOR", AddressingModeZeroPageX, 2, 4, 0},   // 0x55
@@ -108,7 +108,7 @@ var Instructions = [256]Instruction{
 	{sre, "SRE", AddressingModeAbsoluteX, 3, 7, 0},   // 0x5F
 	{rts, "RTS", AddressingModeImplied, 1, 6, 0},     // 0x60
 	{adc, "ADC", AddressingModeIndirectX, 2, 6, 0},   // 0x61
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x62
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x62
 	{rra, "RRA", AddressingModeIndirectX, 2, 8, 0},   // 0x63
 	{nop, "NOP", AddressingModeZeroPage, 2, 3, 0},    // 0x64
 	{adc, "ADC", AddressingModeZeroPage, 2, 3, 0},    // 0x65
@@ -124,7 +124,7 @@ var Instructions = [256]Instruction{
 	{rra, "RRA", AddressingModeAbsolute, 3, 6, 0},    // 0x6F
 	{bvs, "BVS", AddressingModeRelative, 2, 2, 0},    // 0x70
 	{adc, "ADC", AddressingModeIndirectY, 2, 5, 1},   // 0x71
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x72
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x72
 	{rra, "RRA", AddressingModeIndirectY, 2, 8, 0},   // 0x73
 	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},   // 0x74
 	{adc, "ADC", AddressingModeZeroPageX, 2, 4, 0},   // 0x75
@@ -149,14 +149,14 @@ var Instructions = [256]Instruction{
 	{dey, "DEY", AddressingModeImplied, 1, 2, 0},     // 0x88
 	{nop, "NOP", AddressingModeImmediate, 2, 2, 0},   // 0x89
 	{txa, "TXA", AddressingModeImplied, 1, 2, 0},     // 0x8A
-	{xxx, "XAA", AddressingModeImplied, 0, 0, 0},     // 0x8B Unimplemented
+	{xaa, "XAA", AddressingModeImmediate, 2, 2, 0},   // 0x8B
 	{sty, "STY", AddressingModeAbsolute, 3, 4, 0},    // 0x8C
 	{sta, "STA", AddressingModeAbsolute, 3, 4, 0},    // 0x8D
 	{stx, "STX", AddressingModeAbsolute, 3, 4, 0},    // 0x8E
 	{sax, "SAX", AddressingModeAbsolute, 3, 4, 0},    // 0x8F
 	{bcc, "BCC", AddressingModeRelative, 2, 2, 0},    // 0x90
 	{sta, "STA", AddressingModeIndirectY, 2, 6, 0},   // 0x91
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0x92
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0x92
 	{ahx, "AHX", AddressingModeIndirectY, 2, 6, 0},   // 0x93
 	{sty, "STY", AddressingModeZeroPageX, 2, 4, 0},   // 0x94
 	{sta, "STA", AddressingModeZeroPageX, 2, 4, 0},   // 0x95
@@ -181,14 +181,14 @@ var Instructions = [256]Instruction{
 	{tay, "TAY", AddressingModeImplied, 1, 2, 0},     // 0xA8
 	{lda, "LDA", AddressingModeImmediate, 2, 2, 0},   // 0xA9
 	{tax, "TAX", AddressingModeImplied, 1, 2, 0},     // 0xAA
-	{xxx, "LXA", AddressingModeImmediate, 2, 2, 0},   // 0xAB Unimplemented
+	{lxa, "LXA", AddressingModeImmediate, 2, 2, 0},   // 0xAB
 	{ldy, "LDY", AddressingModeAbsolute, 3, 4, 0},    // 0xAC
 	{lda, "LDA", AddressingModeAbsolute, 3, 4, 0},    // 0xAD
 	{ldx, "LDX", AddressingModeAbsolute, 3, 4, 0},    // 0xAE
 	{lax, "LAX", AddressingModeAbsolute, 3, 4, 0},    // 0xAF
 	{bcs, "BCS", AddressingModeRelative, 2, 2, 0},    // 0xB0
 	{lda, "LDA", AddressingModeIndirectY, 2, 5, 1},   // 0xB1
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0xB2
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0xB2
 	{lax, "LAX", AddressingModeIndirectY, 2, 5, 1},   // 0xB3
 	{ldy, "LDY", AddressingModeZeroPageX, 2, 4, 0},   // 0xB4
 	{lda, "LDA", AddressingModeZeroPageX, 2, 4, 0},   // 0xB5
@@ -220,7 +220,7 @@ var Instructions = [256]Instruction{
 	{dcp, "DCP", AddressingModeAbsolute, 3, 6, 0},    // 0xCF
 	{bne, "BNE", AddressingModeRelative, 2, 2, 0},    // 0xD0
 	{cmp, "CMP", AddressingModeIndirectY, 2, 5, 1},   // 0xD1
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0xD2
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0xD2
 	{dcp, "DCP", AddressingModeIndirectY, 2, 8, 0},   // 0xD3
 	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},   // 0xD4
 	{cmp, "CMP", AddressingModeZeroPageX, 2, 4, 0},   // 0xD5
@@ -252,7 +252,7 @@ var Instructions = [256]Instruction{
 	{isc, "ISC", AddressingModeAbsolute, 3, 6, 0},    // 0xEF
 	{beq, "BEQ", AddressingModeRelative, 2, 2, 0},    // 0xF0
 	{sbc, "SBC", AddressingModeIndirectY, 2, 5, 1},   // 0xF1
-	{nop, "STP", AddressingModeImplied, 1, 0, 0},     // 0xF2
+	{stp, "STP", AddressingModeImplied, 1, 2, 0},     // 0xF2
 	{isc, "ISC", AddressingModeIndirectY, 2, 8, 0},   // 0xF3
 	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},   // 0xF4
 	{sbc, "SBC", AddressingModeZeroPageX, 2, 4, 0},   // 0xF5
@@ -0,0 +1,272 @@
+package cpu
+
+/*
+*
+The WDC 65C02 replaces the NMOS 6502's unofficial opcodes with new instructions
+and NOPs of fixed sizes, the ones in columns 3 and B taking a single cycle.
+$5C takes 8 cycles on hardware, it is emulated as an absolute mode NOP.
+
+The cycle-by-cycle bus accesses of the added instructions, and of decimal mode,
+WAI and STP, follow the WDC datasheet and haven't been checked against the
+SingleStepTests wdc65c02 vectors. Their results, and the extra decimal cycle,
+are tested.
+*
+*/
+var Instructions65C02 = [256]Instruction{
+	{nil, "BRK", AddressingModeImplied, 1, 7, 0},                 // 0x00
+	{ora, "ORA", AddressingModeIndirectX, 2, 6, 0},               // 0x01
+	{nop, "NOP", AddressingModeImmediate, 2, 2, 0},               // 0x02
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x03
+	{tsb, "TSB", AddressingModeZeroPage, 2, 5, 0},                // 0x04
+	{ora, "ORA", AddressingModeZeroPage, 2, 3, 0},                // 0x05
+	{asl, "ASL", AddressingModeZeroPage, 2, 5, 0},                // 0x06
+	{rmb(0), "RMB0", AddressingModeZeroPage, 2, 5, 0},            // 0x07
+	{php, "PHP", AddressingModeImplied, 1, 3, 0},                 // 0x08
+	{ora, "ORA", AddressingModeImmediate, 2, 2, 0},               // 0x09
+	{asl, "ASL", AddressingModeAccumulator, 1, 2, 0},             // 0x0A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x0B
+	{tsb, "TSB", AddressingModeAbsolute, 3, 6, 0},                // 0x0C
+	{ora, "ORA", AddressingModeAbsolute, 3, 4, 0},                // 0x0D
+	{asl, "ASL", AddressingModeAbsolute, 3, 6, 0},                // 0x0E
+	{bbr(0), "BBR0", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x0F
+	{bpl, "BPL", AddressingModeRelative, 2, 2, 0},                // 0x10
+	{ora, "ORA", AddressingModeIndirectY, 2, 5, 1},               // 0x11
+	{ora, "ORA", AddressingModeZeroPageIndirect, 2, 5, 0},        // 0x12
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x13
+	{trb, "TRB", AddressingModeZeroPage, 2, 5, 0},                // 0x14
+	{ora, "ORA", AddressingModeZeroPageX, 2, 4, 0},               // 0x15
+	{asl, "ASL", AddressingModeZeroPageX, 2, 6, 0},               // 0x16
+	{rmb(1), "RMB1", AddressingModeZeroPage, 2, 5, 0},            // 0x17
+	{clc, "CLC", AddressingModeImplied, 1, 2, 0},                 // 0x18
+	{ora, "ORA", AddressingModeAbsoluteY, 3, 4, 1},               // 0x19
+	{inc, "INC", AddressingModeAccumulator, 1, 2, 0},             // 0x1A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x1B
+	{trb, "TRB", AddressingModeAbsolute, 3, 6, 0},                // 0x1C
+	{ora, "ORA", AddressingModeAbsoluteX, 3, 4, 1},               // 0x1D
+	{asl, "ASL", AddressingModeAbsoluteX, 3, 6, 1},               // 0x1E
+	{bbr(1), "BBR1", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x1F
+	{jsr, "JSR", AddressingModeAbsolute, 3, 6, 0},                // 0x20
+	{and, "AND", AddressingModeIndirectX, 2, 6, 0},               // 0x21
+	{nop, "NOP", AddressingModeImmediate, 2, 2, 0},               // 0x22
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x23
+	{bit, "BIT", AddressingModeZeroPage, 2, 3, 0},                // 0x24
+	{and, "AND", AddressingModeZeroPage, 2, 3, 0},                // 0x25
+	{rol, "ROL", AddressingModeZeroPage, 2, 5, 0},                // 0x26
+	{rmb(2), "RMB2", AddressingModeZeroPage, 2, 5, 0},            // 0x27
+	{plp, "PLP", AddressingModeImplied, 1, 4, 0},                 // 0x28
+	{and, "AND", AddressingModeImmediate, 2, 2, 0},               // 0x29
+	{rol, "ROL", AddressingModeAccumulator, 1, 2, 0},             // 0x2A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x2B
+	{bit, "BIT", AddressingModeAbsolute, 3, 4, 0},                // 0x2C
+	{and, "AND", AddressingModeAbsolute, 3, 4, 0},                // 0x2D
+	{rol, "ROL", AddressingModeAbsolute, 3, 6, 0},                // 0x2E
+	{bbr(2), "BBR2", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x2F
+	{bmi, "BMI", AddressingModeRelative, 2, 2, 0},                // 0x30
+	{and, "AND", AddressingModeIndirectY, 2, 5, 1},               // 0x31
+	{and, "AND", AddressingModeZeroPageIndirect, 2, 5, 0},        // 0x32
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x33
+	{bit, "BIT", AddressingModeZeroPageX, 2, 4, 0},               // 0x34
+	{and, "AND", AddressingModeZeroPageX, 2, 4, 0},               // 0x35
+	{rol, "ROL", AddressingModeZeroPageX, 2, 6, 0},               // 0x36
+	{rmb(3), "RMB3", AddressingModeZeroPage, 2, 5, 0},            // 0x37
+	{sec, "SEC", AddressingModeImplied, 1, 2, 0},                 // 0x38
+	{and, "AND", AddressingModeAbsoluteY, 3, 4, 1},               // 0x39
+	{dec, "DEC", AddressingModeAccumulator, 1, 2, 0},             // 0x3A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x3B
+	{bit, "BIT", AddressingModeAbsoluteX, 3, 4, 1},               // 0x3C
+	{and, "AND", AddressingModeAbsoluteX, 3, 4, 1},               // 0x3D
+	{rol, "ROL", AddressingModeAbsoluteX, 3, 6, 1},               // 0x3E
+	{bbr(3), "BBR3", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x3F
+	{nil, "RTI", AddressingModeImplied, 1, 6, 0},                 // 0x40
+	{eor, "EOR", AddressingModeIndirectX, 2, 6, 0},               // 0x41
+	{nop, "NOP", AddressingModeImmediate, 2, 2, 0},               // 0x42
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x43
+	{nop, "NOP", AddressingModeZeroPage, 2, 3, 0},                // 0x44
+	{eor, "EOR", AddressingModeZeroPage, 2, 3, 0},                // 0x45
+	{lsr, "LSR", AddressingModeZeroPage, 2, 5, 0},                // 0x46
+	{rmb(4), "RMB4", AddressingModeZeroPage, 2, 5, 0},            // 0x47
+	{pha, "PHA", AddressingModeImplied, 1, 3, 0},                 // 0x48
+	{eor, "EOR", AddressingModeImmediate, 2, 2, 0},               // 0x49
+	{lsr, "LSR", AddressingModeAccumulator, 1, 2, 0},             // 0x4A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x4B
+	{jmp, "JMP", AddressingModeAbsolute, 3, 3, 0},                // 0x4C
+	{eor, "EOR", AddressingModeAbsolute, 3, 4, 0},                // 0x4D
+	{lsr, "LSR", AddressingModeAbsolute, 3, 6, 0},                // 0x4E
+	{bbr(4), "BBR4", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x4F
+	{bvc, "BVC", AddressingModeRelative, 2, 2, 0},                // 0x50
+	{eor, "EOR", AddressingModeIndirectY, 2, 5, 1},               // 0x51
+	{eor, "EOR", AddressingModeZeroPageIndirect, 2, 5, 0},        // 0x52
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x53
+	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},               // 0x54
+	{eor, "EOR", AddressingModeZeroPageX, 2, 4, 0},               // 0x55
+	{lsr, "LSR", AddressingModeZeroPageX, 2, 6, 0},               // 0x56
+	{rmb(5), "RMB5", AddressingModeZeroPage, 2, 5, 0},            // 0x57
+	{cli, "CLI", AddressingModeImplied, 1, 2, 0},                 // 0x58
+	{eor, "EOR", AddressingModeAbsoluteY, 3, 4, 1},               // 0x59
+	{phy, "PHY", AddressingModeImplied, 1, 3, 0},                 // 0x5A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x5B
+	{nop, "NOP", AddressingModeAbsolute, 3, 8, 0},                // 0x5C
+	{eor, "EOR", AddressingModeAbsoluteX, 3, 4, 1},               // 0x5D
+	{lsr, "LSR", AddressingModeAbsoluteX, 3, 6, 1},               // 0x5E
+	{bbr(5), "BBR5", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x5F
+	{rts, "RTS", AddressingModeImplied, 1, 6, 0},                 // 0x60
+	{adcDecimal, "ADC", AddressingModeIndirectX, 2, 6, 0},        // 0x61
+	{nop, "NOP", AddressingModeImmediate, 2, 2, 0},               // 0x62
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x63
+	{stz, "STZ", AddressingModeZeroPage, 2, 3, 0},                // 0x64
+	{adcDecimal, "ADC", AddressingModeZeroPage, 2, 3, 0},         // 0x65
+	{ror, "ROR", AddressingModeZeroPage, 2, 5, 0},                // 0x66
+	{rmb(6), "RMB6", AddressingModeZeroPage, 2, 5, 0},            // 0x67
+	{pla, "PLA", AddressingModeImplied, 1, 4, 0},                 // 0x68
+	{adcDecimal, "ADC", AddressingModeImmediate, 2, 2, 0},        // 0x69
+	{ror, "ROR", AddressingModeAccumulator, 1, 2, 0},             // 0x6A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x6B
+	{jmp, "JMP", AddressingModeIndirect, 3, 6, 0},                // 0x6C
+	{adcDecimal, "ADC", AddressingModeAbsolute, 3, 4, 0},         // 0x6D
+	{ror, "ROR", AddressingModeAbsolute, 3, 6, 0},                // 0x6E
+	{bbr(6), "BBR6", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x6F
+	{bvs, "BVS", AddressingModeRelative, 2, 2, 0},                // 0x70
+	{adcDecimal, "ADC", AddressingModeIndirectY, 2, 5, 1},        // 0x71
+	{adcDecimal, "ADC", AddressingModeZeroPageIndirect, 2, 5, 0}, // 0x72
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x73
+	{stz, "STZ", AddressingModeZeroPageX, 2, 4, 0},               // 0x74
+	{adcDecimal, "ADC", AddressingModeZeroPageX, 2, 4, 0},        // 0x75
+	{ror, "ROR", AddressingModeZeroPageX, 2, 6, 0},               // 0x76
+	{rmb(7), "RMB7", AddressingModeZeroPage, 2, 5, 0},            // 0x77
+	{sei, "SEI", AddressingModeImplied, 1, 2, 0},                 // 0x78
+	{adcDecimal, "ADC", AddressingModeAbsoluteY, 3, 4, 1},        // 0x79
+	{ply, "PLY", AddressingModeImplied, 1, 4, 0},                 // 0x7A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x7B
+	{jmp, "JMP", AddressingModeAbsoluteIndexedIndirect, 3, 6, 0}, // 0x7C
+	{adcDecimal, "ADC", AddressingModeAbsoluteX, 3, 4, 1},        // 0x7D
+	{ror, "ROR", AddressingModeAbsoluteX, 3, 6, 1},               // 0x7E
+	{bbr(7), "BBR7", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x7F
+	{bra, "BRA", AddressingModeRelative, 2, 3, 1},                // 0x80
+	{sta, "STA", AddressingModeIndirectX, 2, 6, 0},               // 0x81
+	{nop, "NOP", AddressingModeImmediate, 2, 2, 0},               // 0x82
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x83
+	{sty, "STY", AddressingModeZeroPage, 2, 3, 0},                // 0x84
+	{sta, "STA", AddressingModeZeroPage, 2, 3, 0},                // 0x85
+	{stx, "STX", AddressingModeZeroPage, 2, 3, 0},                // 0x86
+	{smb(0), "SMB0", AddressingModeZeroPage, 2, 5, 0},            // 0x87
+	{dey, "DEY", AddressingModeImplied, 1, 2, 0},                 // 0x88
+	{bit, "BIT", AddressingModeImmediate, 2, 2, 0},               // 0x89
+	{txa, "TXA", AddressingModeImplied, 1, 2, 0},                 // 0x8A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x8B
+	{sty, "STY", AddressingModeAbsolute, 3, 4, 0},                // 0x8C
+	{sta, "STA", AddressingModeAbsolute, 3, 4, 0},                // 0x8D
+	{stx, "STX", AddressingModeAbsolute, 3, 4, 0},                // 0x8E
+	{bbs(0), "BBS0", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x8F
+	{bcc, "BCC", AddressingModeRelative, 2, 2, 0},                // 0x90
+	{sta, "STA", AddressingModeIndirectY, 2, 6, 0},               // 0x91
+	{sta, "STA", AddressingModeZeroPageIndirect, 2, 5, 0},        // 0x92
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x93
+	{sty, "STY", AddressingModeZeroPageX, 2, 4, 0},               // 0x94
+	{sta, "STA", AddressingModeZeroPageX, 2, 4, 0},               // 0x95
+	{stx, "STX", AddressingModeZeroPageY, 2, 4, 0},               // 0x96
+	{smb(1), "SMB1", AddressingModeZeroPage, 2, 5, 0},            // 0x97
+	{tya, "TYA", AddressingModeImplied, 1, 2, 0},                 // 0x98
+	{sta, "STA", AddressingModeAbsoluteY, 3, 5, 0},               // 0x99
+	{txs, "TXS", AddressingModeImplied, 1, 2, 0},                 // 0x9A
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0x9B
+	{stz, "STZ", AddressingModeAbsolute, 3, 4, 0},                // 0x9C
+	{sta, "STA", AddressingModeAbsoluteX, 3, 5, 0},               // 0x9D
+	{stz, "STZ", AddressingModeAbsoluteX, 3, 5, 0},               // 0x9E
+	{bbs(1), "BBS1", AddressingModeZeroPageRelative, 3, 5, 0},    // 0x9F
+	{ldy, "LDY", AddressingModeImmediate, 2, 2, 0},               // 0xA0
+	{lda, "LDA", AddressingModeIndirectX, 2, 6, 0},               // 0xA1
+	{ldx, "LDX", AddressingModeImmediate, 2, 2, 0},               // 0xA2
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xA3
+	{ldy, "LDY", AddressingModeZeroPage, 2, 3, 0},                // 0xA4
+	{lda, "LDA", AddressingModeZeroPage, 2, 3, 0},                // 0xA5
+	{ldx, "LDX", AddressingModeZeroPage, 2, 3, 0},                // 0xA6
+	{smb(2), "SMB2", AddressingModeZeroPage, 2, 5, 0},            // 0xA7
+	{tay, "TAY", AddressingModeImplied, 1, 2, 0},                 // 0xA8
+	{lda, "LDA", AddressingModeImmediate, 2, 2, 0},               // 0xA9
+	{tax, "TAX", AddressingModeImplied, 1, 2, 0},                 // 0xAA
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xAB
+	{ldy, "LDY", AddressingModeAbsolute, 3, 4, 0},                // 0xAC
+	{lda, "LDA", AddressingModeAbsolute, 3, 4, 0},                // 0xAD
+	{ldx, "LDX", AddressingModeAbsolute, 3, 4, 0},                // 0xAE
+	{bbs(2), "BBS2", AddressingModeZeroPageRelative, 3, 5, 0},    // 0xAF
+	{bcs, "BCS", AddressingModeRelative, 2, 2, 0},                // 0xB0
+	{lda, "LDA", AddressingModeIndirectY, 2, 5, 1},               // 0xB1
+	{lda, "LDA", AddressingModeZeroPageIndirect, 2, 5, 0},        // 0xB2
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xB3
+	{ldy, "LDY", AddressingModeZeroPageX, 2, 4, 0},               // 0xB4
+	{lda, "LDA", AddressingModeZeroPageX, 2, 4, 0},               // 0xB5
+	{ldx, "LDX", AddressingModeZeroPageY, 2, 4, 0},               // 0xB6
+	{smb(3), "SMB3", AddressingModeZeroPage, 2, 5, 0},            // 0xB7
+	{clv, "CLV", AddressingModeImplied, 1, 2, 0},                 // 0xB8
+	{lda, "LDA", AddressingModeAbsoluteY, 3, 4, 1},               // 0xB9
+	{tsx, "TSX", AddressingModeImplied, 1, 2, 0},                 // 0xBA
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xBB
+	{ldy, "LDY", AddressingModeAbsoluteX, 3, 4, 1},               // 0xBC
+	{lda, "LDA", AddressingModeAbsoluteX, 3, 4, 1},               // 0xBD
+	{ldx, "LDX", AddressingModeAbsoluteY, 3, 4, 1},               // 0xBE
+	{bbs(3), "BBS3", AddressingModeZeroPageRelative, 3, 5, 0},    // 0xBF
+	{cpy, "CPY", AddressingModeImmediate, 2, 2, 0},               // 0xC0
+	{cmp, "CMP", AddressingModeIndirectX, 2, 6, 0},               // 0xC1
+	{nop, "NOP", AddressingModeImmediate, 2, 2, 0},               // 0xC2
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xC3
+	{cpy, "CPY", AddressingModeZeroPage, 2, 3, 0},                // 0xC4
+	{cmp, "CMP", AddressingModeZeroPage, 2, 3, 0},                // 0xC5
+	{dec, "DEC", AddressingModeZeroPage, 2, 5, 0},                // 0xC6
+	{smb(4), "SMB4", AddressingModeZeroPage, 2, 5, 0},            // 0xC7
+	{iny, "INY", AddressingModeImplied, 1, 2, 0},                 // 0xC8
+	{cmp, "CMP", AddressingModeImmediate, 2, 2, 0},               // 0xC9
+	{dex, "DEX", AddressingModeImplied, 1, 2, 0},                 // 0xCA
+	{wai, "WAI", AddressingModeImplied, 1, 3, 0},                 // 0xCB
+	{cpy, "CPY", AddressingModeAbsolute, 3, 4, 0},                // 0xCC
+	{cmp, "CMP", AddressingModeAbsolute, 3, 4, 0},                // 0xCD
+	{dec, "DEC", AddressingModeAbsolute, 3, 6, 0},                // 0xCE
+	{bbs(4), "BBS4", AddressingModeZeroPageRelative, 3, 5, 0},    // 0xCF
+	{bne, "BNE", AddressingModeRelative, 2, 2, 0},                // 0xD0
+	{cmp, "CMP", AddressingModeIndirectY, 2, 5, 1},               // 0xD1
+	{cmp, "CMP", AddressingModeZeroPageIndirect, 2, 5, 0},        // 0xD2
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xD3
+	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},               // 0xD4
+	{cmp, "CMP", AddressingModeZeroPageX, 2, 4, 0},               // 0xD5
+	{dec, "DEC", AddressingModeZeroPageX, 2, 6, 0},               // 0xD6
+	{smb(5), "SMB5", AddressingModeZeroPage, 2, 5, 0},            // 0xD7
+	{cld, "CLD", AddressingModeImplied, 1, 2, 0},                 // 0xD8
+	{cmp, "CMP", AddressingModeAbsoluteY, 3, 4, 1},               // 0xD9
+	{phx, "PHX", AddressingModeImplied, 1, 3, 0},                 // 0xDA
+	{stp, "STP", AddressingModeImplied, 1, 3, 0},                 // 0xDB
+	{nop, "NOP", AddressingModeAbsolute, 3, 4, 0},                // 0xDC
+	{cmp, "CMP", AddressingModeAbsoluteX, 3, 4, 1},               // 0xDD
+	{dec, "DEC", AddressingModeAbsoluteX, 3, 7, 0},               // 0xDE
+	{bbs(5), "BBS5", AddressingModeZeroPageRelative, 3, 5, 0},    // 0xDF
+	{cpx, "CPX", AddressingModeImmediate, 2, 2, 0},               // 0xE0
+	{sbcDecimal, "SBC", AddressingModeIndirectX, 2, 6, 0},        // 0xE1
+	{nop, "NOP", AddressingModeImmediate, 2, 2, 0},               // 0xE2
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xE3
+	{cpx, "CPX", AddressingModeZeroPage, 2, 3, 0},                // 0xE4
+	{sbcDecimal, "SBC", AddressingModeZeroPage, 2, 3, 0},         // 0xE5
+	{inc, "INC", AddressingModeZeroPage, 2, 5, 0},                // 0xE6
+	{smb(6), "SMB6", AddressingModeZeroPage, 2, 5, 0},            // 0xE7
+	{inx, "INX", AddressingModeImplied, 1, 2, 0},                 // 0xE8
+	{sbcDecimal, "SBC", AddressingModeImmediate, 2, 2, 0},        // 0xE9
+	{nop, "NOP", AddressingModeImplied, 1, 2, 0},                 // 0xEA
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xEB
+	{cpx, "CPX", AddressingModeAbsolute, 3, 4, 0},                // 0xEC
+	{sbcDecimal, "SBC", AddressingModeAbsolute, 3, 4, 0},         // 0xED
+	{inc, "INC", AddressingModeAbsolute, 3, 6, 0},                // 0xEE
+	{bbs(6), "BBS6", AddressingModeZeroPageRelative, 3, 5, 0},    // 0xEF
+	{beq, "BEQ", AddressingModeRelative, 2, 2, 0},                // 0xF0
+	{sbcDecimal, "SBC", AddressingModeIndirectY, 2, 5, 1},        // 0xF1
+	{sbcDecimal, "SBC", AddressingModeZeroPageIndirect, 2, 5, 0}, // 0xF2
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xF3
+	{nop, "NOP", AddressingModeZeroPageX, 2, 4, 0},               // 0xF4
+	{sbcDecimal, "SBC", AddressingModeZeroPageX, 2, 4, 0},        // 0xF5
+	{inc, "INC", AddressingModeZeroPageX, 2, 6, 0},               // 0xF6
+	{smb(7), "SMB7", AddressingModeZeroPage, 2, 5, 0},            // 0xF7
+	{sed, "SED", AddressingModeImplied, 1, 2, 0},                 // 0xF8
+	{sbcDecimal, "SBC", AddressingModeAbsoluteY, 3, 4, 1},        // 0xF9
+	{plx, "PLX", AddressingModeImplied, 1, 4, 0},                 // 0xFA
+	{nop, "NOP", AddressingModeImplied, 1, 1, 0},                 // 0xFB
+	{nop, "NOP", AddressingModeAbsolute, 3, 4, 0},                // 0xFC
+	{sbcDecimal, "SBC", AddressingModeAbsoluteX, 3, 4, 1},        // 0xFD
+	{inc, "INC", AddressingModeAbsoluteX, 3, 7, 0},               // 0xFE
+	{bbs(7), "BBS7", AddressingModeZeroPageRelative, 3, 5, 0},    // 0xFF
+}
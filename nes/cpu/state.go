@@ -0,0 +1,71 @@
+package cpu
+
+import "gonesem/nes/state"
+
+var ChunkID = state.ChunkID{'C', 'P', 'U', ' '}
+
+func (cpu *CPU) SaveState(writer *state.Writer) {
+	writer.BeginChunk(ChunkID, 1)
+
+	writer.Uint8(cpu.A)
+	writer.Uint8(cpu.X)
+	writer.Uint8(cpu.Y)
+	writer.Uint16(cpu.PC)
+	writer.Uint8(cpu.SP)
+	writer.Uint8(uint8(cpu.SR))
+	writer.Uint64(cpu.TotalCycles)
+
+	writer.Uint8(cpu.opcode)
+	writer.Uint8(cpu.step)
+	writer.Uint8(cpu.accessStep)
+	writer.Uint16(cpu.address)
+	writer.Uint8(cpu.pointer)
+	writer.Uint8(cpu.value)
+	writer.Bool(cpu.pageCross)
+	writer.Bool(cpu.branchTaken)
+	writer.Bool(cpu.interrupting)
+	writer.Bool(cpu.nmiPending)
+	writer.Bool(cpu.irqLine)
+
+	writer.Bool(cpu.halted)
+	writer.Uint16(cpu.haltAddress)
+
+	writer.Bool(cpu.interruptPolled)
+	writer.Bool(cpu.skipPoll)
+
+	writer.Bool(cpu.waiting)
+	writer.Uint16(cpu.lastAddress)
+}
+
+func (cpu *CPU) LoadState(chunk *state.Chunk) error {
+	cpu.A = chunk.Uint8()
+	cpu.X = chunk.Uint8()
+	cpu.Y = chunk.Uint8()
+	cpu.PC = chunk.Uint16()
+	cpu.SP = chunk.Uint8()
+	cpu.SR = Status(chunk.Uint8())
+	cpu.TotalCycles = chunk.Uint64()
+
+	cpu.opcode = chunk.Uint8()
+	cpu.step = chunk.Uint8()
+	cpu.accessStep = chunk.Uint8()
+	cpu.address = chunk.Uint16()
+	cpu.pointer = chunk.Uint8()
+	cpu.value = chunk.Uint8()
+	cpu.pageCross = chunk.Bool()
+	cpu.branchTaken = chunk.Bool()
+	cpu.interrupting = chunk.Bool()
+	cpu.nmiPending = chunk.Bool()
+	cpu.irqLine = chunk.Bool()
+
+	cpu.halted = chunk.Bool()
+	cpu.haltAddress = chunk.Uint16()
+
+	cpu.interruptPolled = chunk.Bool()
+	cpu.skipPoll = chunk.Bool()
+
+	cpu.waiting = chunk.Bool()
+	cpu.lastAddress = chunk.Uint16()
+
+	return nil
+}
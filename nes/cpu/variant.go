@@ -0,0 +1,198 @@
+package cpu
+
+import "strings"
+
+// 6502 family chips the CPU can emulate
+type Variant uint8
+
+const (
+	Variant2A03  Variant = iota // The NES' RP2A03, an NMOS 6502 with decimal mode disconnected
+	VariantNMOS                 // NMOS 6502 with decimal mode
+	Variant65C02                // WDC 65C02 with its added opcodes and the Rockwell bit instructions
+)
+
+func (variant Variant) String() string {
+	switch variant {
+	case Variant2A03:
+		return "2A03"
+	case VariantNMOS:
+		return "6502"
+	case Variant65C02:
+		return "65C02"
+	default:
+		return "unknown"
+	}
+}
+
+// Returns the instruction table of the variant
+func (variant Variant) Instructions() *[256]Instruction {
+	return instructionSets[variant].instructions
+}
+
+// Returns whether the opcode is documented by the chip's manufacturer
+func (variant Variant) Official(opcode uint8) bool {
+	return instructionSets[variant].official[opcode]
+}
+
+var officialMnemonics = map[string]bool{
+	"ADC": true, "AND": true, "ASL": true, "BCC": true, "BCS": true, "BEQ": true, "BIT": true, "BMI": true,
+	"BNE": true, "BPL": true, "BRK": true, "BVC": true, "BVS": true, "CLC": true, "CLD": true, "CLI": true,
+	"CLV": true, "CMP": true, "CPX": true, "CPY": true, "DEC": true, "DEX": true, "DEY": true, "EOR": true,
+	"INC": true, "INX": true, "INY": true, "JMP": true, "JSR": true, "LDA": true, "LDX": true, "LDY": true,
+	"LSR": true, "NOP": true, "ORA": true, "PHA": true, "PHP": true, "PLA": true, "PLP": true, "ROL": true,
+	"ROR": true, "RTI": true, "RTS": true, "SBC": true, "SEC": true, "SED": true, "SEI": true, "STA": true,
+	"STX": true, "STY": true, "TAX": true, "TAY": true, "TSX": true, "TXA": true, "TXS": true, "TYA": true,
+}
+
+// Mnemonics added by the 65C02, besides RMB, SMB, BBR and BBS numbered by bit
+var officialMnemonics65C02 = map[string]bool{
+	"BRA": true, "PHX": true, "PHY": true, "PLX": true, "PLY": true, "STZ": true, "TSB": true, "TRB": true,
+	"WAI": true, "STP": true,
+}
+
+/*
+*
+The NMOS 6502 shares the 2A03's table, including its unofficial opcodes, with
+decimal mode handled by the instructions that add or subtract.
+*
+*/
+var InstructionsNMOS = func() [256]Instruction {
+	instructions := Instructions
+
+	for opcode := range instructions {
+		switch instructions[opcode].Mnemonic {
+		case "ADC":
+			instructions[opcode].operation = adcDecimal
+		case "SBC":
+			instructions[opcode].operation = sbcDecimal
+		case "ISC":
+			instructions[opcode].operation = iscDecimal
+		case "RRA":
+			instructions[opcode].operation = rraDecimal
+		}
+	}
+
+	return instructions
+}()
+
+// How the cycles of an instruction are sequenced
+type sequence uint8
+
+const (
+	sequenceOperand     sequence = iota // Addressing mode cycles followed by accessing the operand
+	sequenceImplied                     // A single cycle reading the byte after the opcode
+	sequenceSingleCycle                 // Nothing after the opcode fetch, the 65C02's undefined NOPs
+	sequenceBranch
+	sequenceBitBranch // The 65C02's BBR and BBS
+	sequenceInterrupt // BRK, shared with IRQs and NMIs
+	sequenceJSR
+	sequenceRTS
+	sequenceRTI
+	sequenceJMP
+	sequencePush
+	sequencePull
+)
+
+// How an instruction accesses its operand, which decides the cycles it takes
+type accessKind uint8
+
+const (
+	accessRead        accessKind = iota
+	accessReadDecimal            // Reads, taking an extra cycle in decimal mode on the 65C02
+	accessWrite
+	accessReadModifyWrite
+)
+
+// An instruction table along with how each of its opcodes is sequenced
+type instructionSet struct {
+	instructions *[256]Instruction
+	sequences    [256]sequence
+	accessKinds  [256]accessKind
+	fastIndexed  [256]bool // The cycle fixing the high byte of an indexed address is skipped without a page cross
+	official     [256]bool
+}
+
+var instructionSets = [...]*instructionSet{
+	Variant2A03:  newInstructionSet(&Instructions, Variant2A03),
+	VariantNMOS:  newInstructionSet(&InstructionsNMOS, VariantNMOS),
+	Variant65C02: newInstructionSet(&Instructions65C02, Variant65C02),
+}
+
+func newInstructionSet(instructions *[256]Instruction, variant Variant) *instructionSet {
+	set := &instructionSet{instructions: instructions}
+
+	for opcode, instruction := range instructions {
+		mnemonic := instruction.Mnemonic
+
+		switch {
+		case mnemonic == "BRK":
+			set.sequences[opcode] = sequenceInterrupt
+		case mnemonic == "JSR":
+			set.sequences[opcode] = sequenceJSR
+		case mnemonic == "RTS":
+			set.sequences[opcode] = sequenceRTS
+		case mnemonic == "RTI":
+			set.sequences[opcode] = sequenceRTI
+		case mnemonic == "JMP":
+			set.sequences[opcode] = sequenceJMP
+		case mnemonic == "PHA" || mnemonic == "PHP" || mnemonic == "PHX" || mnemonic == "PHY":
+			set.sequences[opcode] = sequencePush
+		case mnemonic == "PLA" || mnemonic == "PLP" || mnemonic == "PLX" || mnemonic == "PLY":
+			set.sequences[opcode] = sequencePull
+		case instruction.AddressingMode == AddressingModeRelative:
+			set.sequences[opcode] = sequenceBranch
+		case instruction.AddressingMode == AddressingModeZeroPageRelative:
+			set.sequences[opcode] = sequenceBitBranch
+		case instruction.Cycles == 1:
+			set.sequences[opcode] = sequenceSingleCycle
+		case instruction.AddressingMode == AddressingModeImplied || instruction.AddressingMode == AddressingModeAccumulator:
+			set.sequences[opcode] = sequenceImplied
+		}
+
+		switch mnemonic {
+		case "STA", "STX", "STY", "STZ", "SAX", "AHX", "SHX", "SHY", "TAS":
+			set.accessKinds[opcode] = accessWrite
+		case "ASL", "LSR", "ROL", "ROR", "INC", "DEC", "SLO", "SRE", "RLA", "RRA", "DCP", "ISC", "TSB", "TRB":
+			set.accessKinds[opcode] = accessReadModifyWrite
+		case "ADC", "SBC":
+			if variant == Variant65C02 {
+				set.accessKinds[opcode] = accessReadDecimal
+			}
+		}
+
+		if strings.HasPrefix(mnemonic, "RMB") || strings.HasPrefix(mnemonic, "SMB") {
+			set.accessKinds[opcode] = accessReadModifyWrite
+		}
+
+		switch set.accessKinds[opcode] {
+		case accessRead, accessReadDecimal:
+			set.fastIndexed[opcode] = true
+		case accessReadModifyWrite:
+			// The 65C02 only takes the extra cycle on shifts and rotates that cross a page
+			set.fastIndexed[opcode] = variant == Variant65C02 && mnemonic != "INC" && mnemonic != "DEC"
+		}
+
+		// Of the NOPs only $EA is documented, and $EB is an undocumented copy of SBC #
+		set.official[opcode] = (mnemonic != "NOP" || opcode == 0xEA) && opcode != 0xEB
+
+		if variant == Variant65C02 {
+			set.official[opcode] = set.official[opcode] &&
+				(officialMnemonics[mnemonic] || officialMnemonics65C02[mnemonic] || bitMnemonic(mnemonic))
+		} else {
+			set.official[opcode] = set.official[opcode] && officialMnemonics[mnemonic]
+		}
+	}
+
+	return set
+}
+
+// RMB, SMB, BBR and BBS are numbered by the bit they work on
+func bitMnemonic(mnemonic string) bool {
+	for _, prefix := range []string{"RMB", "SMB", "BBR", "BBS"} {
+		if strings.HasPrefix(mnemonic, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
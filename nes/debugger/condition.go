@@ -0,0 +1,164 @@
+package debugger
+
+import (
+	"fmt"
+	"gonesem/nes/cpu"
+	"strconv"
+	"strings"
+)
+
+// Registers conditions can compare
+var registers = map[string]func(cpuPtr *cpu.CPU) int{
+	"A":  func(cpuPtr *cpu.CPU) int { return int(cpuPtr.A) },
+	"X":  func(cpuPtr *cpu.CPU) int { return int(cpuPtr.X) },
+	"Y":  func(cpuPtr *cpu.CPU) int { return int(cpuPtr.Y) },
+	"SP": func(cpuPtr *cpu.CPU) int { return int(cpuPtr.SP) },
+	"PC": func(cpuPtr *cpu.CPU) int { return int(cpuPtr.PC) },
+	"P":  func(cpuPtr *cpu.CPU) int { return int(cpuPtr.SR) },
+}
+
+// Flags conditions can compare, as 0 or 1
+var flags = map[string]cpu.Status{
+	"C": cpu.StatusCarry,
+	"Z": cpu.StatusZero,
+	"I": cpu.StatusInterrupt,
+	"D": cpu.StatusDecimal,
+	"V": cpu.StatusOverflow,
+	"N": cpu.StatusNegative,
+}
+
+// Returns a function reading the register or flag called name
+func register(name string) (func(cpuPtr *cpu.CPU) int, bool) {
+	name = strings.ToUpper(name)
+
+	if read, ok := registers[name]; ok {
+		return read, true
+	}
+
+	status, ok := flags[name]
+
+	if !ok {
+		return nil, false
+	}
+
+	return func(cpuPtr *cpu.CPU) int {
+		if cpuPtr.SR&status != 0 {
+			return 1
+		}
+
+		return 0
+	}, true
+}
+
+// Comparison operators, two character ones first so they're matched before their prefixes
+var comparisons = []struct {
+	operator string
+	compare  func(a int, b int) bool
+}{
+	{"==", func(a int, b int) bool { return a == b }},
+	{"!=", func(a int, b int) bool { return a != b }},
+	{"<=", func(a int, b int) bool { return a <= b }},
+	{">=", func(a int, b int) bool { return a >= b }},
+	{"<", func(a int, b int) bool { return a < b }},
+	{">", func(a int, b int) bool { return a > b }},
+	{"=", func(a int, b int) bool { return a == b }},
+}
+
+type comparison struct {
+	register func(cpuPtr *cpu.CPU) int
+	compare  func(a int, b int) bool
+	value    int
+}
+
+// Comparisons of registers with values that must all hold, such as "A == $10 && C == 1"
+type Condition struct {
+	text        string
+	comparisons []comparison
+}
+
+/*
+*
+Parses a condition made of comparisons joined by &&. Each compares one of the
+registers A, X, Y, SP, PC and P, or one of the flags C, Z, I, D, V and N, with
+a number in decimal, hex ($FF) or binary (%1010), using one of the operators
+== != < <= > >=.
+*
+*/
+func ParseCondition(text string) (*Condition, error) {
+	condition := &Condition{text: strings.TrimSpace(text)}
+
+	for _, term := range strings.Split(text, "&&") {
+		comparison, err := parseComparison(strings.TrimSpace(term))
+
+		if err != nil {
+			return nil, err
+		}
+
+		condition.comparisons = append(condition.comparisons, comparison)
+	}
+
+	return condition, nil
+}
+
+func parseComparison(term string) (comparison, error) {
+	for _, candidate := range comparisons {
+		name, valueText, ok := strings.Cut(term, candidate.operator)
+
+		if !ok {
+			continue
+		}
+
+		read, ok := register(strings.TrimSpace(name))
+
+		if !ok {
+			return comparison{}, fmt.Errorf("unknown register %q in %q", strings.TrimSpace(name), term)
+		}
+
+		value, err := ParseNumber(strings.TrimSpace(valueText))
+
+		if err != nil {
+			return comparison{}, fmt.Errorf("invalid value in %q: %s", term, err)
+		}
+
+		return comparison{register: read, compare: candidate.compare, value: value}, nil
+	}
+
+	return comparison{}, fmt.Errorf("no comparison in %q", term)
+}
+
+// Returns whether every comparison holds for the CPU's registers
+func (condition *Condition) Holds(cpuPtr *cpu.CPU) bool {
+	for _, comparison := range condition.comparisons {
+		if !comparison.compare(comparison.register(cpuPtr), comparison.value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (condition *Condition) String() string {
+	return condition.text
+}
+
+// Parses a number in decimal, hex ($FF or 0xFF) or binary (%1010)
+func ParseNumber(text string) (int, error) {
+	base := 10
+
+	switch {
+	case strings.HasPrefix(text, "$"):
+		text, base = text[1:], 16
+	case strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X"):
+		text, base = text[2:], 16
+	case strings.HasPrefix(text, "%"):
+		text, base = text[1:], 2
+	}
+
+	value, err := strconv.ParseInt(text, base, 32)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", text)
+	}
+
+	return int(value), nil
+}
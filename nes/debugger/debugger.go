@@ -0,0 +1,487 @@
+package debugger
+
+import (
+	"fmt"
+	"gonesem/nes"
+	"gonesem/nes/cpu"
+	"strings"
+	"sync/atomic"
+)
+
+// Bus a watchpoint watches
+type Bus uint8
+
+const (
+	BusCPU Bus = iota // The CPU's address space
+	BusPPU            // Video memory, as accessed through PPUDATA
+)
+
+func (bus Bus) String() string {
+	if bus == BusPPU {
+		return "PPU"
+	}
+
+	return "CPU"
+}
+
+// Accesses a watchpoint stops on
+type Access uint8
+
+const (
+	AccessRead Access = 1 << iota
+	AccessWrite
+
+	AccessReadWrite = AccessRead | AccessWrite
+)
+
+func (access Access) String() string {
+	switch access {
+	case AccessRead:
+		return "r"
+	case AccessWrite:
+		return "w"
+	}
+
+	return "rw"
+}
+
+// Stops before the instruction at Address, when Condition is nil or holds
+type Breakpoint struct {
+	ID        int
+	Address   uint16
+	Condition *Condition
+	Enabled   bool
+	Hits      int
+}
+
+// Stops after the instruction that accesses an address from Low to High inclusive
+type Watchpoint struct {
+	ID      int
+	Bus     Bus
+	Low     uint16
+	High    uint16
+	Access  Access
+	Enabled bool
+	Hits    int
+}
+
+// Why the console stopped
+type Reason uint8
+
+const (
+	ReasonStep       Reason = iota // A step or run to scanline or frame finished
+	ReasonBreakpoint               // Breakpoint is set
+	ReasonWatchpoint               // Watchpoint is set, along with the access
+	ReasonInterrupt                // Interrupt was called
+	ReasonJammed                   // The CPU jammed, it never reaches another instruction
+)
+
+type Stop struct {
+	Reason     Reason
+	Breakpoint *Breakpoint
+	Watchpoint *Watchpoint
+
+	// The access that hit Watchpoint, or the opcode the CPU jammed on
+	Address uint16
+	Value   uint8
+	Write   bool
+}
+
+func (stop Stop) String() string {
+	switch stop.Reason {
+	case ReasonBreakpoint:
+		return fmt.Sprintf("breakpoint %d at $%04X", stop.Breakpoint.ID, stop.Breakpoint.Address)
+	case ReasonWatchpoint:
+		access := "read"
+
+		if stop.Write {
+			access = "write"
+		}
+
+		return fmt.Sprintf("watchpoint %d, %s %s of $%02X at $%04X", stop.Watchpoint.ID, stop.Watchpoint.Bus, access, stop.Value, stop.Address)
+	case ReasonInterrupt:
+		return "interrupted"
+	case ReasonJammed:
+		return fmt.Sprintf("CPU jammed at $%04X", stop.Address)
+	}
+
+	return "stepped"
+}
+
+/*
+*
+Pauses a console between instructions to inspect and edit it.
+
+The console only runs when one of the run methods is called, each running it
+until the next instruction that a breakpoint, watchpoint or the method's own
+target stops it before. Watchpoints stop after the instruction making the
+access finishes. The instruction the console is paused before is never
+stopped on again, so running from a breakpoint carries on past it.
+*
+*/
+type Debugger struct {
+	console *nes.NES
+
+	breakpoints []*Breakpoint
+	watchpoints []*Watchpoint
+	nextID      int
+
+	target      func() bool // Checked before every instruction while running, stops when true
+	stop        *Stop
+	interrupted atomic.Bool
+
+	previous uint8 // Opcode of the last instruction run
+	next     uint8 // Opcode of the instruction the console is paused before
+}
+
+// Attaches a debugger to console, replacing its instruction callback and its
+// CPU's and PPU's bus callbacks
+func NewDebugger(console *nes.NES) *Debugger {
+	debugger := &Debugger{console: console, nextID: 1}
+
+	console.SetInstructionCallback(debugger.instruction)
+	console.CPU().SetBusCallback(func(addr uint16, value uint8, write bool) {
+		debugger.access(BusCPU, addr, value, write)
+	})
+	console.PPU().SetBusCallback(func(addr uint16, value uint8, write bool) {
+		debugger.access(BusPPU, addr, value, write)
+	})
+
+	return debugger
+}
+
+// Removes the debugger's callbacks from the console
+func (debugger *Debugger) Detach() {
+	debugger.console.SetInstructionCallback(nil)
+	debugger.console.CPU().SetBusCallback(nil)
+	debugger.console.PPU().SetBusCallback(nil)
+}
+
+func (debugger *Debugger) Console() *nes.NES {
+	return debugger.console
+}
+
+// --------------------------- //
+// Breakpoints and watchpoints //
+// --------------------------- //
+
+// Adds an enabled breakpoint at address, condition can be nil
+func (debugger *Debugger) AddBreakpoint(address uint16, condition *Condition) *Breakpoint {
+	breakpoint := &Breakpoint{ID: debugger.nextID, Address: address, Condition: condition, Enabled: true}
+
+	debugger.nextID++
+	debugger.breakpoints = append(debugger.breakpoints, breakpoint)
+
+	return breakpoint
+}
+
+// Adds an enabled watchpoint on the addresses from low to high inclusive
+func (debugger *Debugger) AddWatchpoint(bus Bus, low uint16, high uint16, access Access) *Watchpoint {
+	watchpoint := &Watchpoint{ID: debugger.nextID, Bus: bus, Low: low, High: high, Access: access, Enabled: true}
+
+	debugger.nextID++
+	debugger.watchpoints = append(debugger.watchpoints, watchpoint)
+
+	return watchpoint
+}
+
+// Removes the breakpoint or watchpoint with id
+func (debugger *Debugger) Remove(id int) error {
+	for i, breakpoint := range debugger.breakpoints {
+		if breakpoint.ID == id {
+			debugger.breakpoints = append(debugger.breakpoints[:i], debugger.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+
+	for i, watchpoint := range debugger.watchpoints {
+		if watchpoint.ID == id {
+			debugger.watchpoints = append(debugger.watchpoints[:i], debugger.watchpoints[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+// Enables or disables the breakpoint or watchpoint with id
+func (debugger *Debugger) SetEnabled(id int, enabled bool) error {
+	for _, breakpoint := range debugger.breakpoints {
+		if breakpoint.ID == id {
+			breakpoint.Enabled = enabled
+			return nil
+		}
+	}
+
+	for _, watchpoint := range debugger.watchpoints {
+		if watchpoint.ID == id {
+			watchpoint.Enabled = enabled
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+func (debugger *Debugger) Breakpoints() []*Breakpoint {
+	return debugger.breakpoints
+}
+
+func (debugger *Debugger) Watchpoints() []*Watchpoint {
+	return debugger.watchpoints
+}
+
+// ------- //
+// Editing //
+// ------- //
+
+// Sets one of the registers or flags conditions can compare, by name
+func (debugger *Debugger) SetRegister(name string, value int) error {
+	cpuPtr := debugger.console.CPU()
+	name = strings.ToUpper(name)
+
+	if _, ok := register(name); !ok {
+		return fmt.Errorf("unknown register %q", name)
+	}
+
+	if name == "PC" {
+		if value < 0 || value > 0xFFFF {
+			return fmt.Errorf("$%X doesn't fit in PC", value)
+		}
+
+		cpuPtr.PC = uint16(value)
+
+		return nil
+	}
+
+	if value < 0 || value > 0xFF {
+		return fmt.Errorf("$%X doesn't fit in %s", value, name)
+	}
+
+	switch name {
+	case "A":
+		cpuPtr.A = uint8(value)
+	case "X":
+		cpuPtr.X = uint8(value)
+	case "Y":
+		cpuPtr.Y = uint8(value)
+	case "SP":
+		cpuPtr.SP = uint8(value)
+	case "P":
+		cpuPtr.SR = cpu.Status(value)
+	default:
+		status := flags[name]
+
+		if value > 1 {
+			return fmt.Errorf("flag %s can only be 0 or 1", name)
+		}
+
+		cpuPtr.SR &^= status
+
+		if value == 1 {
+			cpuPtr.SR |= status
+		}
+	}
+
+	return nil
+}
+
+// Reads count bytes of the CPU's address space from address, peeking so
+// hardware registers are left as they were
+func (debugger *Debugger) ReadMemory(address uint16, count int) []uint8 {
+	values := make([]uint8, count)
+
+	for i := range values {
+		values[i] = debugger.console.Peek(address + uint16(i))
+	}
+
+	return values
+}
+
+// Writes values to the CPU's address space from address, through the bus
+func (debugger *Debugger) WriteMemory(address uint16, values []uint8) {
+	for i, value := range values {
+		debugger.console.Write(address+uint16(i), value)
+	}
+}
+
+// ------- //
+// Running //
+// ------- //
+
+// Runs until a breakpoint or watchpoint stops the console
+func (debugger *Debugger) Continue() Stop {
+	return debugger.run(nil)
+}
+
+// Runs a single instruction, including any interrupt sequence before the next
+func (debugger *Debugger) StepInto() Stop {
+	return debugger.run(func() bool { return true })
+}
+
+// Runs a single instruction, a JSR is run until the subroutine returns
+func (debugger *Debugger) StepOver() Stop {
+	cpuPtr := debugger.console.CPU()
+
+	if debugger.mnemonic(debugger.console.Peek(cpuPtr.PC)) != "JSR" {
+		return debugger.StepInto()
+	}
+
+	returnAddress := cpuPtr.PC + 3
+	sp := cpuPtr.SP
+
+	return debugger.run(func() bool {
+		return cpuPtr.PC == returnAddress && cpuPtr.SP == sp
+	})
+}
+
+// Runs until the subroutine or interrupt handler being run returns, which is
+// the first RTS or RTI leaving the stack above where it is now
+func (debugger *Debugger) StepOut() Stop {
+	cpuPtr := debugger.console.CPU()
+	sp := cpuPtr.SP
+
+	return debugger.run(func() bool {
+		mnemonic := debugger.mnemonic(debugger.previous)
+
+		return (mnemonic == "RTS" || mnemonic == "RTI") && cpuPtr.SP > sp
+	})
+}
+
+// Runs until the first instruction on scanline, -1 being the pre-render
+// scanline, after the PPU next moves onto it
+func (debugger *Debugger) RunToScanline(scanline int) Stop {
+	ppu := debugger.console.PPU()
+	current, _ := ppu.Position()
+	left := current != scanline
+
+	return debugger.run(func() bool {
+		current, _ := ppu.Position()
+
+		if current != scanline {
+			left = true
+			return false
+		}
+
+		return left
+	})
+}
+
+// Runs until the first instruction after frame frames have completed, see
+// nes.NES.FrameCount
+func (debugger *Debugger) RunToFrame(frame uint64) Stop {
+	return debugger.run(func() bool {
+		return debugger.console.FrameCount() >= frame
+	})
+}
+
+// Stops the console at the next instruction, safe to call from another
+// goroutine. Called while the console is paused, the next run stops after the
+// first instruction so an interrupt sent just before a run starts isn't lost.
+func (debugger *Debugger) Interrupt() {
+	debugger.interrupted.Store(true)
+}
+
+// Drops an interrupt no run has stopped for yet, so it doesn't stop the next
+func (debugger *Debugger) CancelInterrupt() {
+	debugger.interrupted.Store(false)
+}
+
+func (debugger *Debugger) run(target func() bool) Stop {
+	debugger.target = target
+	debugger.stop = nil
+	debugger.next = debugger.console.Peek(debugger.console.CPU().PC)
+
+	defer func() {
+		debugger.target = nil
+	}()
+
+	for {
+		// The frame is taken so the next one runs, like the headless runner does
+		if debugger.console.RunFrame() {
+			debugger.console.GetFrame()
+		}
+
+		if debugger.stop != nil {
+			return *debugger.stop
+		}
+
+		if address, halted := debugger.console.Halted(); halted {
+			return Stop{Reason: ReasonJammed, Address: address}
+		}
+
+		if debugger.interrupted.Swap(false) {
+			return Stop{Reason: ReasonInterrupt}
+		}
+	}
+}
+
+// Checks for stops before every instruction
+func (debugger *Debugger) instruction() {
+	cpuPtr := debugger.console.CPU()
+
+	debugger.previous = debugger.next
+	debugger.next = debugger.console.Peek(cpuPtr.PC)
+
+	if debugger.stop == nil {
+		debugger.stop = debugger.checkBreakpoints(cpuPtr)
+	}
+
+	if debugger.stop == nil && debugger.interrupted.Swap(false) {
+		debugger.stop = &Stop{Reason: ReasonInterrupt}
+	}
+
+	if debugger.stop == nil && debugger.target != nil && debugger.target() {
+		debugger.stop = &Stop{Reason: ReasonStep}
+	}
+
+	if debugger.stop != nil {
+		debugger.console.Break()
+	}
+}
+
+func (debugger *Debugger) checkBreakpoints(cpuPtr *cpu.CPU) *Stop {
+	for _, breakpoint := range debugger.breakpoints {
+		if !breakpoint.Enabled || breakpoint.Address != cpuPtr.PC {
+			continue
+		}
+
+		if breakpoint.Condition != nil && !breakpoint.Condition.Holds(cpuPtr) {
+			continue
+		}
+
+		breakpoint.Hits++
+
+		return &Stop{Reason: ReasonBreakpoint, Breakpoint: breakpoint}
+	}
+
+	return nil
+}
+
+// Records the first access hitting a watchpoint, the console stops before the next instruction
+func (debugger *Debugger) access(bus Bus, addr uint16, value uint8, write bool) {
+	if debugger.stop != nil || len(debugger.watchpoints) == 0 {
+		return
+	}
+
+	access := AccessRead
+
+	if write {
+		access = AccessWrite
+	}
+
+	for _, watchpoint := range debugger.watchpoints {
+		if !watchpoint.Enabled || watchpoint.Bus != bus || watchpoint.Access&access == 0 || addr < watchpoint.Low || addr > watchpoint.High {
+			continue
+		}
+
+		watchpoint.Hits++
+		debugger.stop = &Stop{Reason: ReasonWatchpoint, Watchpoint: watchpoint, Address: addr, Value: value, Write: write}
+
+		return
+	}
+}
+
+func (debugger *Debugger) mnemonic(opcode uint8) string {
+	return debugger.console.CPU().Variant().Instructions()[opcode].Mnemonic
+}
@@ -0,0 +1,429 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"gonesem/nes/disasm"
+	"gonesem/nes/trace"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `Commands, addresses are in hex and other numbers in decimal, or hex with $:
+  c, continue                  run until a breakpoint or watchpoint
+  s, step [COUNT]              run COUNT instructions, 1 by default
+  n, next                      step over subroutine calls
+  o, out                       run until the current subroutine returns
+  scanline LINE                run to the start of a scanline, -1 for pre-render
+  frame COUNT                  run until COUNT frames have completed
+  b, break ADDR [if COND]      break before the instruction at ADDR, e.g. b C000 if A == $10 && C == 1
+  w, watch [cpu|ppu] ADDR[-ADDR] [r|w|rw]
+                               stop after an instruction accessing an address, CPU bus and rw by default
+  l, list                      list breakpoints and watchpoints
+  d, delete ID                 delete a breakpoint or watchpoint
+  enable ID, disable ID        enable or disable a breakpoint or watchpoint
+  r, regs                      show the registers and the next instruction
+  set REG VALUE                set A, X, Y, SP, PC, P or a flag C, Z, I, D, V, N
+  m, mem ADDR [COUNT]          dump COUNT bytes of memory, 64 by default
+  poke ADDR VALUE...           write bytes to memory
+  dis [ADDR] [COUNT]           disassemble COUNT instructions from ADDR or PC, 10 by default
+  q, quit                      exit
+`
+
+/*
+*
+Reads debugger commands from input a line at a time until EOF or quit,
+writing the results to output. An empty line repeats the last command.
+*
+*/
+func (debugger *Debugger) RunREPL(input io.Reader, output io.Writer) error {
+	scanner := bufio.NewScanner(input)
+	last := ""
+
+	fmt.Fprintln(output, debugger.location())
+
+	for {
+		fmt.Fprint(output, "> ")
+
+		if !scanner.Scan() {
+			fmt.Fprintln(output)
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			line = last
+		}
+
+		last = line
+
+		if line == "" {
+			continue
+		}
+
+		quit, err := debugger.command(line, output)
+
+		if err != nil {
+			fmt.Fprintf(output, "Error: %s\n", err)
+		}
+
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Runs a command, returning true if it was quit
+func (debugger *Debugger) command(line string, output io.Writer) (bool, error) {
+	fields := strings.Fields(line)
+	arguments := fields[1:]
+
+	switch strings.ToLower(fields[0]) {
+	case "h", "help":
+		fmt.Fprint(output, replHelp)
+	case "q", "quit":
+		return true, nil
+
+	case "c", "continue":
+		debugger.report(debugger.Continue(), output)
+	case "s", "step":
+		count := 1
+
+		if len(arguments) > 0 {
+			value, err := ParseNumber(arguments[0])
+
+			if err != nil || value < 1 {
+				return false, fmt.Errorf("invalid step count %q", arguments[0])
+			}
+
+			count = value
+		}
+
+		for i := 0; i < count; i++ {
+			if stop := debugger.StepInto(); stop.Reason != ReasonStep || i == count-1 {
+				debugger.report(stop, output)
+				break
+			}
+		}
+	case "n", "next":
+		debugger.report(debugger.StepOver(), output)
+	case "o", "out":
+		debugger.report(debugger.StepOut(), output)
+	case "scanline":
+		if len(arguments) != 1 {
+			return false, fmt.Errorf("usage: scanline LINE")
+		}
+
+		scanline, err := ParseNumber(arguments[0])
+
+		if err != nil || scanline < -1 || scanline > 260 {
+			return false, fmt.Errorf("invalid scanline %q", arguments[0])
+		}
+
+		debugger.report(debugger.RunToScanline(scanline), output)
+	case "frame":
+		if len(arguments) != 1 {
+			return false, fmt.Errorf("usage: frame COUNT")
+		}
+
+		frame, err := ParseNumber(arguments[0])
+
+		if err != nil || frame < 0 {
+			return false, fmt.Errorf("invalid frame %q", arguments[0])
+		}
+
+		debugger.report(debugger.RunToFrame(uint64(frame)), output)
+
+	case "b", "break":
+		return false, debugger.breakCommand(arguments, output)
+	case "w", "watch":
+		return false, debugger.watchCommand(arguments, output)
+	case "l", "list":
+		debugger.list(output)
+	case "d", "delete", "enable", "disable":
+		if len(arguments) != 1 {
+			return false, fmt.Errorf("usage: %s ID", fields[0])
+		}
+
+		id, err := strconv.Atoi(arguments[0])
+
+		if err != nil {
+			return false, fmt.Errorf("invalid ID %q", arguments[0])
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "enable":
+			return false, debugger.SetEnabled(id, true)
+		case "disable":
+			return false, debugger.SetEnabled(id, false)
+		}
+
+		return false, debugger.Remove(id)
+
+	case "r", "regs":
+		fmt.Fprintln(output, debugger.location())
+	case "set":
+		if len(arguments) != 2 {
+			return false, fmt.Errorf("usage: set REG VALUE")
+		}
+
+		value, err := ParseNumber(arguments[1])
+
+		if err != nil {
+			return false, err
+		}
+
+		if err := debugger.SetRegister(arguments[0], value); err != nil {
+			return false, err
+		}
+
+		fmt.Fprintln(output, debugger.location())
+	case "m", "mem":
+		return false, debugger.memCommand(arguments, output)
+	case "poke":
+		if len(arguments) < 2 {
+			return false, fmt.Errorf("usage: poke ADDR VALUE...")
+		}
+
+		address, err := parseAddress(arguments[0])
+
+		if err != nil {
+			return false, err
+		}
+
+		var values []uint8
+
+		for _, argument := range arguments[1:] {
+			value, err := ParseNumber(argument)
+
+			if err != nil || value < 0 || value > 0xFF {
+				return false, fmt.Errorf("invalid byte %q", argument)
+			}
+
+			values = append(values, uint8(value))
+		}
+
+		debugger.WriteMemory(address, values)
+	case "dis":
+		return false, debugger.disasmCommand(arguments, output)
+
+	default:
+		return false, fmt.Errorf("unknown command %q, try help", fields[0])
+	}
+
+	return false, nil
+}
+
+func (debugger *Debugger) breakCommand(arguments []string, output io.Writer) error {
+	if len(arguments) == 0 {
+		return fmt.Errorf("usage: break ADDR [if COND]")
+	}
+
+	address, err := parseAddress(arguments[0])
+
+	if err != nil {
+		return err
+	}
+
+	var condition *Condition
+
+	if len(arguments) > 1 {
+		if strings.ToLower(arguments[1]) != "if" || len(arguments) == 2 {
+			return fmt.Errorf("usage: break ADDR [if COND]")
+		}
+
+		condition, err = ParseCondition(strings.Join(arguments[2:], " "))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	breakpoint := debugger.AddBreakpoint(address, condition)
+
+	fmt.Fprintf(output, "Breakpoint %d at $%04X\n", breakpoint.ID, breakpoint.Address)
+
+	return nil
+}
+
+func (debugger *Debugger) watchCommand(arguments []string, output io.Writer) error {
+	bus := BusCPU
+	access := AccessReadWrite
+
+	if len(arguments) > 0 {
+		switch strings.ToLower(arguments[0]) {
+		case "cpu":
+			arguments = arguments[1:]
+		case "ppu":
+			bus = BusPPU
+			arguments = arguments[1:]
+		}
+	}
+
+	if len(arguments) == 0 || len(arguments) > 2 {
+		return fmt.Errorf("usage: watch [cpu|ppu] ADDR[-ADDR] [r|w|rw]")
+	}
+
+	if len(arguments) == 2 {
+		switch strings.ToLower(arguments[1]) {
+		case "r":
+			access = AccessRead
+		case "w":
+			access = AccessWrite
+		case "rw":
+			access = AccessReadWrite
+		default:
+			return fmt.Errorf("invalid access %q, expected r, w or rw", arguments[1])
+		}
+	}
+
+	lowText, highText, isRange := strings.Cut(arguments[0], "-")
+
+	if !isRange {
+		highText = lowText
+	}
+
+	low, err := parseAddress(lowText)
+
+	if err != nil {
+		return err
+	}
+
+	high, err := parseAddress(highText)
+
+	if err != nil {
+		return err
+	}
+
+	if high < low {
+		return fmt.Errorf("invalid address range %q", arguments[0])
+	}
+
+	watchpoint := debugger.AddWatchpoint(bus, low, high, access)
+
+	fmt.Fprintf(output, "Watchpoint %d on %s $%04X-$%04X %s\n", watchpoint.ID, watchpoint.Bus, watchpoint.Low, watchpoint.High, watchpoint.Access)
+
+	return nil
+}
+
+func (debugger *Debugger) list(output io.Writer) {
+	if len(debugger.breakpoints) == 0 && len(debugger.watchpoints) == 0 {
+		fmt.Fprintln(output, "No breakpoints or watchpoints")
+		return
+	}
+
+	enabled := map[bool]string{true: "", false: " (disabled)"}
+
+	for _, breakpoint := range debugger.breakpoints {
+		condition := ""
+
+		if breakpoint.Condition != nil {
+			condition = " if " + breakpoint.Condition.String()
+		}
+
+		fmt.Fprintf(output, "%d: break $%04X%s, %d hits%s\n", breakpoint.ID, breakpoint.Address, condition, breakpoint.Hits, enabled[breakpoint.Enabled])
+	}
+
+	for _, watchpoint := range debugger.watchpoints {
+		fmt.Fprintf(output, "%d: watch %s $%04X-$%04X %s, %d hits%s\n", watchpoint.ID, watchpoint.Bus, watchpoint.Low, watchpoint.High, watchpoint.Access, watchpoint.Hits, enabled[watchpoint.Enabled])
+	}
+}
+
+func (debugger *Debugger) memCommand(arguments []string, output io.Writer) error {
+	if len(arguments) == 0 || len(arguments) > 2 {
+		return fmt.Errorf("usage: mem ADDR [COUNT]")
+	}
+
+	address, err := parseAddress(arguments[0])
+
+	if err != nil {
+		return err
+	}
+
+	count := 64
+
+	if len(arguments) == 2 {
+		if count, err = ParseNumber(arguments[1]); err != nil || count < 1 || count > 0x10000 {
+			return fmt.Errorf("invalid count %q", arguments[1])
+		}
+	}
+
+	values := debugger.ReadMemory(address, count)
+
+	for row := 0; row < len(values); row += 16 {
+		end := min(row+16, len(values))
+
+		fmt.Fprintf(output, "%04X  % X\n", address+uint16(row), values[row:end])
+	}
+
+	return nil
+}
+
+func (debugger *Debugger) disasmCommand(arguments []string, output io.Writer) error {
+	if len(arguments) > 2 {
+		return fmt.Errorf("usage: dis [ADDR] [COUNT]")
+	}
+
+	address := debugger.console.CPU().PC
+	count := 10
+
+	if len(arguments) > 0 {
+		value, err := parseAddress(arguments[0])
+
+		if err != nil {
+			return err
+		}
+
+		address = value
+	}
+
+	if len(arguments) == 2 {
+		value, err := ParseNumber(arguments[1])
+
+		if err != nil || value < 1 {
+			return fmt.Errorf("invalid count %q", arguments[1])
+		}
+
+		count = value
+	}
+
+	disassembler := disasm.NewDisassembler(debugger.console.CPU().Variant())
+
+	for _, instruction := range disassembler.Disassemble(debugger.console, address, count) {
+		code := fmt.Sprintf("% X", instruction.Bytes)
+
+		fmt.Fprintf(output, "%04X  %-9s %s\n", instruction.Address, code, instruction.String())
+	}
+
+	return nil
+}
+
+// Writes why the console stopped, unless a step finished, and where it is
+func (debugger *Debugger) report(stop Stop, output io.Writer) {
+	if stop.Reason != ReasonStep {
+		fmt.Fprintf(output, "Stopped: %s\n", stop)
+	}
+
+	fmt.Fprintln(output, debugger.location())
+}
+
+// Returns the registers and the next instruction as a Nintendulator trace line
+func (debugger *Debugger) location() string {
+	disassembler := disasm.NewDisassembler(debugger.console.CPU().Variant())
+	state := debugger.console.TraceState()
+
+	return trace.Nintendulator(disassembler.Decode(debugger.console, state.PC), state)
+}
+
+// Parses a hex address, with or without a leading $
+func parseAddress(text string) (uint16, error) {
+	value, err := strconv.ParseUint(strings.TrimPrefix(text, "$"), 16, 16)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", text)
+	}
+
+	return uint16(value), nil
+}
@@ -0,0 +1,266 @@
+package disasm
+
+import (
+	"fmt"
+	"gonesem/nes/cpu"
+	"gonesem/nes/memory"
+	"strings"
+)
+
+// Names of addresses, used in place of the address in operands
+type Symbols map[uint16]string
+
+type Instruction struct {
+	Address   uint16
+	Opcode    uint8
+	Bytes     []uint8 // Opcode followed by the operand
+	Mnemonic  string
+	Mode      cpu.AddressingMode
+	Operand   uint16 // Operand bytes as a little-endian value
+	Target    uint16 // Address the operand refers to before indexing, or where a branch goes
+	HasTarget bool   // Target is set, false for implied, accumulator and immediate operands
+	Official  bool   // The opcode is documented, see cpu.Variant.Official
+}
+
+// Returns the size of the instruction in bytes
+func (instruction Instruction) Length() int {
+	return len(instruction.Bytes)
+}
+
+// Formats the instruction without symbols, e.g. "LDA ($80),Y"
+func (instruction Instruction) String() string {
+	return formatDefault(instruction, nil)
+}
+
+type Disassembler struct {
+	variant cpu.Variant
+	symbols Symbols
+}
+
+func NewDisassembler(variant cpu.Variant) *Disassembler {
+	return &Disassembler{variant: variant}
+}
+
+// Sets the names substituted for addresses when formatting, nil removes them
+func (disassembler *Disassembler) SetSymbols(symbols Symbols) {
+	disassembler.symbols = symbols
+}
+
+/*
+*
+Decodes the instruction at address.
+
+Memory is peeked rather than read, so disassembling over hardware registers
+has no side effects.
+*
+*/
+func (disassembler *Disassembler) Decode(memory memory.Peeker, address uint16) Instruction {
+	opcode := memory.Peek(address)
+	size := disassembler.variant.Instructions()[opcode].Size
+
+	code := make([]uint8, size)
+	code[0] = opcode
+
+	for i := uint16(1); i < uint16(size); i++ {
+		code[i] = memory.Peek(address + i)
+	}
+
+	return disassembler.decode(code, address)
+}
+
+// Decodes the instruction at the start of code, which is loaded at address
+func (disassembler *Disassembler) DecodeBytes(code []uint8, address uint16) (Instruction, error) {
+	if len(code) == 0 {
+		return Instruction{}, fmt.Errorf("no code at $%04X", address)
+	}
+
+	size := int(disassembler.variant.Instructions()[code[0]].Size)
+
+	if len(code) < size {
+		return Instruction{}, fmt.Errorf("instruction at $%04X needs %d bytes, only %d left", address, size, len(code))
+	}
+
+	return disassembler.decode(code[:size:size], address), nil
+}
+
+// Decodes the instructions starting at address until count have been decoded
+func (disassembler *Disassembler) Disassemble(memory memory.Peeker, address uint16, count int) []Instruction {
+	instructions := make([]Instruction, 0, count)
+
+	for i := 0; i < count; i++ {
+		instruction := disassembler.Decode(memory, address)
+		instructions = append(instructions, instruction)
+		address += uint16(instruction.Length())
+	}
+
+	return instructions
+}
+
+func (disassembler *Disassembler) decode(code []uint8, address uint16) Instruction {
+	opcode := code[0]
+	definition := disassembler.variant.Instructions()[opcode]
+
+	instruction := Instruction{
+		Address:  address,
+		Opcode:   opcode,
+		Bytes:    code,
+		Mnemonic: definition.Mnemonic,
+		Mode:     definition.AddressingMode,
+		Official: disassembler.variant.Official(opcode),
+	}
+
+	for i := len(code) - 1; i > 0; i-- {
+		instruction.Operand = instruction.Operand<<8 | uint16(code[i])
+	}
+
+	switch instruction.Mode {
+	case cpu.AddressingModeImplied, cpu.AddressingModeAccumulator, cpu.AddressingModeImmediate:
+		return instruction
+
+	// Branches are relative to the address of the next instruction
+	case cpu.AddressingModeRelative:
+		instruction.Target = address + 2 + uint16(int8(code[1]))
+	case cpu.AddressingModeZeroPageRelative:
+		instruction.Target = address + 3 + uint16(int8(code[2]))
+	default:
+		instruction.Target = instruction.Operand
+	}
+
+	instruction.HasTarget = true
+
+	return instruction
+}
+
+// Formats the instruction in upper case as in Nintendulator logs, with symbols
+// in place of the addresses they name
+func (disassembler *Disassembler) Format(instruction Instruction) string {
+	return formatDefault(instruction, disassembler.symbols)
+}
+
+func formatDefault(instruction Instruction, symbols Symbols) string {
+	operand := formatOperand(instruction, symbols, false)
+
+	if operand == "" {
+		return instruction.Mnemonic
+	}
+
+	return instruction.Mnemonic + " " + operand
+}
+
+/*
+*
+Formats the operand in the given syntax, ca65's differing in a few ways:
+* Absolute operands below $100 are forced to absolute with "a:", as ca65 would
+otherwise pick the zero page mode
+* Registers are in lower case
+*
+*/
+func formatOperand(instruction Instruction, symbols Symbols, ca65 bool) string {
+	zeroPage := func(value uint16) string {
+		if name, ok := symbols[value]; ok {
+			return name
+		}
+
+		return fmt.Sprintf("$%02X", value)
+	}
+
+	absolute := func(value uint16) string {
+		if name, ok := symbols[value]; ok {
+			if ca65 && value < 0x0100 {
+				return "a:" + name
+			}
+
+			return name
+		}
+
+		if ca65 && value < 0x0100 {
+			return fmt.Sprintf("a:$%04X", value)
+		}
+
+		return fmt.Sprintf("$%04X", value)
+	}
+
+	// Branch targets are never forced to absolute
+	target := func(value uint16) string {
+		if name, ok := symbols[value]; ok {
+			return name
+		}
+
+		return fmt.Sprintf("$%04X", value)
+	}
+
+	x, y, a := ",X", ",Y", "A"
+
+	if ca65 {
+		x, y, a = ",x", ",y", "a"
+	}
+
+	zp := uint16(instruction.Operand & 0x00FF)
+
+	switch instruction.Mode {
+	case cpu.AddressingModeAccumulator:
+		return a
+	case cpu.AddressingModeImmediate:
+		return fmt.Sprintf("#$%02X", zp)
+	case cpu.AddressingModeZeroPage:
+		return zeroPage(zp)
+	case cpu.AddressingModeZeroPageX:
+		return zeroPage(zp) + x
+	case cpu.AddressingModeZeroPageY:
+		return zeroPage(zp) + y
+	case cpu.AddressingModeRelative:
+		return target(instruction.Target)
+	case cpu.AddressingModeAbsolute:
+		return absolute(instruction.Operand)
+	case cpu.AddressingModeAbsoluteX:
+		return absolute(instruction.Operand) + x
+	case cpu.AddressingModeAbsoluteY:
+		return absolute(instruction.Operand) + y
+	case cpu.AddressingModeIndirect:
+		return "(" + target(instruction.Operand) + ")"
+	case cpu.AddressingModeIndirectX:
+		return "(" + zeroPage(zp) + x + ")"
+	case cpu.AddressingModeIndirectY:
+		return "(" + zeroPage(zp) + ")" + y
+	case cpu.AddressingModeZeroPageIndirect:
+		return "(" + zeroPage(zp) + ")"
+	case cpu.AddressingModeAbsoluteIndexedIndirect:
+		return "(" + target(instruction.Operand) + x + ")"
+	case cpu.AddressingModeZeroPageRelative:
+		return zeroPage(zp) + ", " + target(instruction.Target)
+	}
+
+	return ""
+}
+
+// Formats the instruction as a line of ca65 source, see WriteCA65
+func (disassembler *Disassembler) FormatCA65(instruction Instruction) string {
+	if !disassembler.assemblable(instruction) {
+		bytes := make([]string, len(instruction.Bytes))
+
+		for i, value := range instruction.Bytes {
+			bytes[i] = fmt.Sprintf("$%02X", value)
+		}
+
+		return fmt.Sprintf(".byte %s ; %s", strings.Join(bytes, ", "), strings.ToLower(formatDefault(instruction, nil)))
+	}
+
+	mnemonic := strings.ToLower(instruction.Mnemonic)
+	operand := formatOperand(instruction, disassembler.symbols, true)
+
+	if operand == "" {
+		return mnemonic
+	}
+
+	return mnemonic + " " + operand
+}
+
+// Returns whether ca65 assembles the instruction back into the same bytes,
+// undocumented opcodes and the 65C02's WAI and STP are written as data instead
+func (disassembler *Disassembler) assemblable(instruction Instruction) bool {
+	if !instruction.Official {
+		return false
+	}
+
+	return instruction.Mnemonic != "WAI" && instruction.Mnemonic != "STP"
+}
@@ -0,0 +1,92 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"gonesem/nes/cpu"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*
+*
+Writes code loaded at origin as ca65 source which assembles back to the same
+bytes, for example:
+
+	.setcpu "6502"
+	vector = $FFFC
+	.org $C000
+	reset:
+		sei
+		jmp (vector)
+
+Symbols naming the start of an instruction are written as labels and the
+rest as constants. Bytes left over after the last whole instruction are
+written as data.
+*
+*/
+func (disassembler *Disassembler) WriteCA65(writer io.Writer, code []uint8, origin uint16) error {
+	var instructions []Instruction
+
+	starts := make(map[uint16]bool)
+	offset := 0
+
+	for offset < len(code) {
+		instruction, err := disassembler.DecodeBytes(code[offset:], origin+uint16(offset))
+
+		if err != nil {
+			break
+		}
+
+		instructions = append(instructions, instruction)
+		starts[instruction.Address] = true
+		offset += instruction.Length()
+	}
+
+	output := bufio.NewWriter(writer)
+
+	cpuName := "6502"
+
+	if disassembler.variant == cpu.Variant65C02 {
+		cpuName = "65C02"
+	}
+
+	fmt.Fprintf(output, ".setcpu \"%s\"\n", cpuName)
+
+	addresses := make([]int, 0, len(disassembler.symbols))
+
+	for address := range disassembler.symbols {
+		addresses = append(addresses, int(address))
+	}
+
+	sort.Ints(addresses)
+
+	for _, address := range addresses {
+		if !starts[uint16(address)] {
+			fmt.Fprintf(output, "%s = $%04X\n", disassembler.symbols[uint16(address)], address)
+		}
+	}
+
+	fmt.Fprintf(output, ".org $%04X\n", origin)
+
+	for _, instruction := range instructions {
+		if name, ok := disassembler.symbols[instruction.Address]; ok {
+			fmt.Fprintf(output, "%s:\n", name)
+		}
+
+		fmt.Fprintf(output, "\t%s\n", disassembler.FormatCA65(instruction))
+	}
+
+	if offset < len(code) {
+		bytes := make([]string, 0, len(code)-offset)
+
+		for _, value := range code[offset:] {
+			bytes = append(bytes, fmt.Sprintf("$%02X", value))
+		}
+
+		fmt.Fprintf(output, "\t.byte %s\n", strings.Join(bytes, ", "))
+	}
+
+	return output.Flush()
+}
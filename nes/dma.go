@@ -0,0 +1,45 @@
+package nes
+
+/*
+*
+OAM DMA, started by writing a page number to $4014
+
+The DMA halts the CPU for a cycle, then copies the 256 bytes of the page to
+the PPU's OAM through $2004, reading on even CPU cycles and writing on odd
+ones. Starting on an odd cycle costs an extra alignment cycle, so the CPU is
+stalled for 513 or 514 cycles.
+*
+*/
+type oamDMA struct {
+	active bool
+	page   uint8
+	halted bool   // The halt cycle has run
+	read   bool   // value holds the byte to write on the next cycle
+	offset uint16 // Bytes of the page copied so far
+	value  uint8
+}
+
+func (dma *oamDMA) start(page uint8) {
+	*dma = oamDMA{active: true, page: page}
+}
+
+// Runs a cycle of the transfer in place of a CPU cycle, which the CPU's cycle
+// count includes as it's stalled rather than stopped
+func (nes *NES) clockDMA() {
+	dma := &nes.dma
+
+	switch {
+	case !dma.halted:
+		dma.halted = true
+	case dma.read:
+		nes.ppu.Write(0x0004, dma.value)
+		dma.read = false
+		dma.offset++
+		dma.active = dma.offset < 256
+	case nes.cpu.TotalCycles%2 == 0:
+		dma.value = nes.Read(uint16(dma.page)<<8 | dma.offset)
+		dma.read = true
+	}
+
+	nes.cpu.TotalCycles++
+}
@@ -0,0 +1,234 @@
+package gdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gonesem/nes/debugger"
+	"io"
+	"log"
+	"net"
+	"strings"
+)
+
+/*
+*
+Serves a subset of GDB's remote serial protocol for the CPU of a console, so
+6502 code can be debugged from GDB and other tools speaking the protocol:
+
+	?                     Stop reason
+	g, G, p, P            Read and write registers
+	m, M                  Read and write memory
+	c, s, vCont           Continue and step, optionally from an address
+	Z0-Z4, z0-z4          Add and remove breakpoints and watchpoints
+	qSupported, qXfer     Features and the target description
+	QStartNoAckMode       Stop acknowledging packets
+	D, k                  Detach and kill, both end the session
+	Ctrl+C                Interrupt a continue
+
+Unsupported packets get the empty reply, as the protocol requires.
+
+Registers are numbered A, X, Y, P, SP as bytes followed by PC as two bytes
+little-endian, as described in the target description. Memory is the CPU's
+address space. Reading it is a peek without side effects, while writes go
+through the bus like the CPU's would.
+Software and hardware breakpoints are the same thing, and watchpoints only
+watch the CPU bus.
+*
+*/
+type Server struct {
+	debugger *debugger.Debugger
+}
+
+func NewServer(debugger *debugger.Debugger) *Server {
+	return &Server{debugger: debugger}
+}
+
+// Listens on address, e.g. "localhost:6502", and serves sessions one at a
+// time until the listener fails
+func (server *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+
+	if err != nil {
+		return err
+	}
+
+	defer listener.Close()
+
+	return server.Serve(listener)
+}
+
+// Serves a session for every connection accepted on listener in turn
+func (server *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return err
+		}
+
+		if err := server.ServeConn(conn); err != nil {
+			log.Printf("GDB session ended: %s\n", err)
+		}
+
+		conn.Close()
+	}
+}
+
+// Serves a single session on conn until the client detaches, kills the
+// console or disconnects, conn is left open for the caller to close
+func (server *Server) ServeConn(conn io.ReadWriter) error {
+	session := &session{
+		debugger:    server.debugger,
+		writer:      bufio.NewWriter(conn),
+		acknowledge: true,
+		points:      make(map[point]int),
+	}
+
+	packets := make(chan packet)
+	readErr := make(chan error, 1)
+	quit := make(chan struct{})
+
+	defer close(quit)
+
+	go func() {
+		err := session.readPackets(bufio.NewReader(conn), packets, quit)
+
+		// A client that disconnects while the console runs can't send Ctrl+C,
+		// so the run is stopped for the session to end. Once the session has
+		// ended the caller closing conn is expected.
+		if err != nil {
+			select {
+			case <-quit:
+			default:
+				session.debugger.Interrupt()
+			}
+		}
+
+		readErr <- err
+		close(packets)
+	}()
+
+	for packet := range packets {
+		if session.acknowledge {
+			if !packet.valid {
+				session.writer.WriteByte('-')
+				session.writer.Flush()
+
+				continue
+			}
+
+			session.writer.WriteByte('+')
+		}
+
+		done := session.handle(packet.data)
+
+		if err := session.writer.Flush(); err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+	}
+
+	// The reader has stopped, drop its interrupt if nothing was running
+	session.debugger.CancelInterrupt()
+
+	if err := <-readErr; err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+type packet struct {
+	data  string
+	valid bool // The checksum matched
+}
+
+// Reads packets from reader until it fails or quit is closed, interrupting the
+// debugger straight away on Ctrl+C as it's sent while the console is running
+func (session *session) readPackets(reader *bufio.Reader, packets chan<- packet, quit <-chan struct{}) error {
+	for {
+		char, err := reader.ReadByte()
+
+		if err != nil {
+			return err
+		}
+
+		switch char {
+		case 0x03:
+			session.debugger.Interrupt()
+		case '$':
+			data, err := reader.ReadString('#')
+
+			if err != nil {
+				return err
+			}
+
+			data = data[:len(data)-1]
+
+			checksum := make([]byte, 2)
+
+			if _, err := io.ReadFull(reader, checksum); err != nil {
+				return err
+			}
+
+			select {
+			case packets <- packet{data: unescape(data), valid: fmt.Sprintf("%02x", sum(data)) == strings.ToLower(string(checksum))}:
+			case <-quit:
+				return nil
+			}
+		}
+
+		// Acknowledgements are ignored, packets are never resent
+	}
+}
+
+// Writes a packet, escaping the characters the protocol reserves
+func (session *session) send(data string) {
+	var escaped strings.Builder
+
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '#', '$', '}', '*':
+			escaped.WriteByte('}')
+			escaped.WriteByte(data[i] ^ 0x20)
+		default:
+			escaped.WriteByte(data[i])
+		}
+	}
+
+	fmt.Fprintf(session.writer, "$%s#%02x", escaped.String(), sum(escaped.String()))
+}
+
+func sum(data string) uint8 {
+	var checksum uint8
+
+	for i := 0; i < len(data); i++ {
+		checksum += data[i]
+	}
+
+	return checksum
+}
+
+// Removes the escaping of binary data from a packet
+func unescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+
+	var unescaped strings.Builder
+
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			unescaped.WriteByte(data[i] ^ 0x20)
+		} else {
+			unescaped.WriteByte(data[i])
+		}
+	}
+
+	return unescaped.String()
+}
@@ -0,0 +1,425 @@
+package gdb
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"gonesem/nes/debugger"
+	"strconv"
+	"strings"
+)
+
+const targetDescription = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gonesem.6502">
+    <reg name="a" bitsize="8" regnum="0"/>
+    <reg name="x" bitsize="8"/>
+    <reg name="y" bitsize="8"/>
+    <reg name="p" bitsize="8"/>
+    <reg name="sp" bitsize="8"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+  </feature>
+</target>
+`
+
+// Names of the registers by number, for debugger.Debugger.SetRegister
+var registerNames = []string{"A", "X", "Y", "P", "SP", "PC"}
+
+// Signals reported in stop replies
+const (
+	signalInterrupt = 0x02 // SIGINT
+	signalIllegal   = 0x04 // SIGILL, the CPU jammed
+	signalTrap      = 0x05 // SIGTRAP, stepped or hit a breakpoint or watchpoint
+)
+
+// A breakpoint or watchpoint as GDB identifies it
+type point struct {
+	kind    byte // '0' to '4' as in the Z packets
+	address uint16
+	length  int
+}
+
+type session struct {
+	debugger    *debugger.Debugger
+	writer      *bufio.Writer
+	acknowledge bool
+	points      map[point]int // Debugger IDs of the points GDB added
+	last        string        // Reply to the last stop, for ?
+}
+
+// Replies to a packet, returning true once the session is over
+func (session *session) handle(data string) bool {
+	if data == "" {
+		session.send("")
+		return false
+	}
+
+	arguments := data[1:]
+
+	switch data[0] {
+	case '?':
+		if session.last == "" {
+			session.last = fmt.Sprintf("S%02x", signalTrap)
+		}
+
+		session.send(session.last)
+	case 'g':
+		session.send(hex.EncodeToString(session.registers()))
+	case 'G':
+		session.reply(session.writeRegisters(arguments))
+	case 'p':
+		session.readRegister(arguments)
+	case 'P':
+		session.reply(session.writeRegister(arguments))
+	case 'm':
+		session.readMemory(arguments)
+	case 'M':
+		session.reply(session.writeMemory(arguments))
+	case 'c', 's':
+		session.resume(data[0], arguments)
+	case 'v':
+		session.handleV(arguments)
+	case 'Z', 'z':
+		session.reply(session.setPoint(data[0] == 'Z', arguments))
+	case 'H':
+		session.send("OK")
+	case 'q':
+		session.query(arguments)
+	case 'Q':
+		if arguments == "StartNoAckMode" {
+			session.send("OK")
+			session.acknowledge = false
+		} else {
+			session.send("")
+		}
+	case 'D':
+		session.send("OK")
+		return true
+	case 'k':
+		return true
+	default:
+		session.send("")
+	}
+
+	return false
+}
+
+// Sends OK, or an error reply
+func (session *session) reply(err error) {
+	if err != nil {
+		session.send("E01")
+		return
+	}
+
+	session.send("OK")
+}
+
+func (session *session) query(arguments string) {
+	switch {
+	case strings.HasPrefix(arguments, "Supported"):
+		session.send("PacketSize=4000;qXfer:features:read+;QStartNoAckMode+;swbreak+;hwbreak+")
+	case strings.HasPrefix(arguments, "Xfer:features:read:target.xml:"):
+		session.transfer(strings.TrimPrefix(arguments, "Xfer:features:read:target.xml:"))
+	case arguments == "Attached":
+		session.send("1")
+	case arguments == "C":
+		session.send("QC1")
+	case arguments == "fThreadInfo":
+		session.send("m1")
+	case arguments == "sThreadInfo":
+		session.send("l")
+	default:
+		session.send("")
+	}
+}
+
+// Sends the part of the target description asked for by "offset,length"
+func (session *session) transfer(arguments string) {
+	offset, length, err := parseRange(arguments)
+
+	if err != nil {
+		session.send("E01")
+		return
+	}
+
+	if offset >= len(targetDescription) {
+		session.send("l")
+		return
+	}
+
+	end := min(offset+length, len(targetDescription))
+
+	if end == len(targetDescription) {
+		session.send("l" + targetDescription[offset:end])
+	} else {
+		session.send("m" + targetDescription[offset:end])
+	}
+}
+
+func (session *session) handleV(arguments string) {
+	switch {
+	case arguments == "Cont?":
+		session.send("vCont;c;s")
+	case strings.HasPrefix(arguments, "Cont;"):
+		// Only one thread, so the first action applies
+		action, _, _ := strings.Cut(strings.TrimPrefix(arguments, "Cont;"), ";")
+		action, _, _ = strings.Cut(action, ":")
+
+		switch {
+		case strings.HasPrefix(action, "c"):
+			session.resume('c', "")
+		case strings.HasPrefix(action, "s"):
+			session.resume('s', "")
+		default:
+			session.send("E01")
+		}
+	default:
+		session.send("")
+	}
+}
+
+// -------------------- //
+// Registers and memory //
+// -------------------- //
+
+func (session *session) registers() []byte {
+	cpuPtr := session.debugger.Console().CPU()
+
+	return []byte{cpuPtr.A, cpuPtr.X, cpuPtr.Y, uint8(cpuPtr.SR), cpuPtr.SP, uint8(cpuPtr.PC), uint8(cpuPtr.PC >> 8)}
+}
+
+func (session *session) writeRegisters(arguments string) error {
+	values, err := hex.DecodeString(arguments)
+
+	if err != nil || len(values) != 7 {
+		return fmt.Errorf("invalid registers %q", arguments)
+	}
+
+	for i, name := range registerNames[:5] {
+		if err := session.debugger.SetRegister(name, int(values[i])); err != nil {
+			return err
+		}
+	}
+
+	return session.debugger.SetRegister("PC", int(values[5])|int(values[6])<<8)
+}
+
+func (session *session) readRegister(arguments string) {
+	number, err := strconv.ParseUint(arguments, 16, 8)
+
+	if err != nil || int(number) >= len(registerNames) {
+		session.send("E01")
+		return
+	}
+
+	registers := session.registers()
+
+	if number == 5 {
+		session.send(hex.EncodeToString(registers[5:7]))
+	} else {
+		session.send(hex.EncodeToString(registers[number : number+1]))
+	}
+}
+
+func (session *session) writeRegister(arguments string) error {
+	numberText, valueText, ok := strings.Cut(arguments, "=")
+
+	if !ok {
+		return fmt.Errorf("invalid register write %q", arguments)
+	}
+
+	number, err := strconv.ParseUint(numberText, 16, 8)
+
+	if err != nil || int(number) >= len(registerNames) {
+		return fmt.Errorf("invalid register %q", numberText)
+	}
+
+	values, err := hex.DecodeString(valueText)
+
+	if err != nil || len(values) == 0 || len(values) > 2 {
+		return fmt.Errorf("invalid register value %q", valueText)
+	}
+
+	// Values are little-endian
+	value := int(values[0])
+
+	if len(values) == 2 {
+		value |= int(values[1]) << 8
+	}
+
+	return session.debugger.SetRegister(registerNames[number], value)
+}
+
+func (session *session) readMemory(arguments string) {
+	address, length, err := parseRange(arguments)
+
+	if err != nil || address > 0xFFFF || length > 0x10000 {
+		session.send("E01")
+		return
+	}
+
+	values := make([]byte, length)
+
+	for i := range values {
+		values[i] = session.debugger.Console().Peek(uint16(address + i))
+	}
+
+	session.send(hex.EncodeToString(values))
+}
+
+func (session *session) writeMemory(arguments string) error {
+	rangeText, data, ok := strings.Cut(arguments, ":")
+
+	if !ok {
+		return fmt.Errorf("invalid memory write %q", arguments)
+	}
+
+	address, length, err := parseRange(rangeText)
+
+	if err != nil || address > 0xFFFF {
+		return fmt.Errorf("invalid memory range %q", rangeText)
+	}
+
+	values, err := hex.DecodeString(data)
+
+	if err != nil || len(values) != length {
+		return fmt.Errorf("invalid memory data %q", data)
+	}
+
+	session.debugger.WriteMemory(uint16(address), values)
+
+	return nil
+}
+
+// Parses "address,length" in hex
+func parseRange(text string) (int, int, error) {
+	addressText, lengthText, ok := strings.Cut(text, ",")
+
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid range %q", text)
+	}
+
+	address, err := strconv.ParseUint(addressText, 16, 32)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address %q", addressText)
+	}
+
+	length, err := strconv.ParseUint(lengthText, 16, 32)
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid length %q", lengthText)
+	}
+
+	return int(address), int(length), nil
+}
+
+// ------------------------------------ //
+// Running, breakpoints and watchpoints //
+// ------------------------------------ //
+
+// Continues or steps, from the address in arguments if there is one, and
+// replies when the console stops
+func (session *session) resume(action byte, arguments string) {
+	if arguments != "" {
+		address, err := strconv.ParseUint(arguments, 16, 16)
+
+		if err != nil {
+			session.send("E01")
+			return
+		}
+
+		session.debugger.Console().CPU().PC = uint16(address)
+	}
+
+	var stop debugger.Stop
+
+	if action == 'c' {
+		stop = session.debugger.Continue()
+	} else {
+		stop = session.debugger.StepInto()
+	}
+
+	session.last = session.stopReply(stop)
+	session.send(session.last)
+}
+
+func (session *session) stopReply(stop debugger.Stop) string {
+	switch stop.Reason {
+	case debugger.ReasonBreakpoint:
+		for point, id := range session.points {
+			if id == stop.Breakpoint.ID && point.kind == '1' {
+				return fmt.Sprintf("T%02xhwbreak:;", signalTrap)
+			}
+		}
+
+		return fmt.Sprintf("T%02xswbreak:;", signalTrap)
+	case debugger.ReasonWatchpoint:
+		kind := "awatch"
+
+		switch stop.Watchpoint.Access {
+		case debugger.AccessWrite:
+			kind = "watch"
+		case debugger.AccessRead:
+			kind = "rwatch"
+		}
+
+		return fmt.Sprintf("T%02x%s:%04x;", signalTrap, kind, stop.Address)
+	case debugger.ReasonInterrupt:
+		return fmt.Sprintf("S%02x", signalInterrupt)
+	case debugger.ReasonJammed:
+		return fmt.Sprintf("S%02x", signalIllegal)
+	}
+
+	return fmt.Sprintf("S%02x", signalTrap)
+}
+
+// Adds or removes the breakpoint or watchpoint in a Z or z packet, "type,address,kind"
+func (session *session) setPoint(add bool, arguments string) error {
+	fields := strings.Split(arguments, ",")
+
+	if len(fields) != 3 || len(fields[0]) != 1 || fields[0][0] < '0' || fields[0][0] > '4' {
+		return fmt.Errorf("invalid breakpoint %q", arguments)
+	}
+
+	address, length, err := parseRange(fields[1] + "," + fields[2])
+
+	if err != nil || address > 0xFFFF {
+		return fmt.Errorf("invalid breakpoint %q", arguments)
+	}
+
+	key := point{kind: fields[0][0], address: uint16(address), length: length}
+	id, exists := session.points[key]
+
+	if !add {
+		if !exists {
+			return fmt.Errorf("no breakpoint %q", arguments)
+		}
+
+		delete(session.points, key)
+
+		return session.debugger.Remove(id)
+	}
+
+	if exists {
+		return nil
+	}
+
+	// Breakpoint kinds are the size of the instruction, watchpoints give a length
+	if key.kind == '0' || key.kind == '1' {
+		session.points[key] = session.debugger.AddBreakpoint(key.address, nil).ID
+		return nil
+	}
+
+	if length == 0 || address+length > 0x10000 {
+		return fmt.Errorf("invalid watchpoint length %d", length)
+	}
+
+	access := map[byte]debugger.Access{'2': debugger.AccessWrite, '3': debugger.AccessRead, '4': debugger.AccessReadWrite}[key.kind]
+	watchpoint := session.debugger.AddWatchpoint(debugger.BusCPU, key.address, uint16(address+length-1), access)
+
+	session.points[key] = watchpoint.ID
+
+	return nil
+}
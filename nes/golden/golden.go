@@ -0,0 +1,305 @@
+package golden
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"gonesem/nes"
+	"gonesem/nes/movie"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+*
+Golden tests run a ROM for a number of frames, optionally driven by a
+movie, and compare a hash against a checked-in value. Hashes are kept in a
+text file of "name sha1" lines.
+
+Until the PPU renders the background and sprites the picture is placeholder
+static that only depends on how many dots ran, so the hash covers the state
+the emulator does produce on every frame instead, see RunState, and PPU
+rendering regressions aren't caught yet. Once rendering lands the final frame
+is also compared with CompareFrame against the expected frame kept as
+name.png next to the hashes, so mismatches can be shown as images:
+
+	name.actual.png     The frame that was rendered
+	name.expected.png   The golden frame
+	name.diff.png       The golden frame dimmed, with differing pixels in red
+*
+*/
+
+// Returns the hex SHA-1 of a frame's pixels
+func Hash(frame *image.RGBA) string {
+	return fmt.Sprintf("%x", sha1.Sum(frame.Pix))
+}
+
+// Runs console for frames frames taking input from script, which may be nil,
+// and returns a copy of the final frame
+func Run(console *nes.NES, frames int, script *movie.Movie) (*image.RGBA, error) {
+	if err := run(console, frames, script, func() {}); err != nil {
+		return nil, err
+	}
+
+	frame := console.GetFrame()
+	result := image.NewRGBA(frame.Rect)
+	copy(result.Pix, frame.Pix)
+
+	return result, nil
+}
+
+/*
+*
+Runs console like Run and returns the hex SHA-1 of its state after every
+frame: the CPU's registers and cycle count, internal RAM, the PPU's
+registers, nametables and palette, and cartridge RAM. Unlike the picture
+this changes with the program's behaviour, so it catches CPU, input and
+mapper regressions.
+*
+*/
+func RunState(console *nes.NES, frames int, script *movie.Movie) (string, error) {
+	hash := sha1.New()
+
+	err := run(console, frames, script, func() {
+		writeState(hash, console)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func writeState(writer io.Writer, console *nes.NES) {
+	cpu := console.CPU()
+	ctrl, mask, status := console.PPU().Registers()
+	ram := console.RAM()
+
+	binary.Write(writer, binary.LittleEndian, struct {
+		A, X, Y     uint8
+		PC          uint16
+		SP, SR      uint8
+		TotalCycles uint64
+	}{cpu.A, cpu.X, cpu.Y, cpu.PC, cpu.SP, uint8(cpu.SR), cpu.TotalCycles})
+
+	writer.Write(ram[:])
+	writer.Write([]byte{uint8(ctrl), uint8(mask), uint8(status)})
+
+	for addr := uint16(0x2000); addr < 0x3000; addr++ {
+		writer.Write([]byte{console.PPU().PeekMemory(addr)})
+	}
+
+	for addr := uint16(0x3F00); addr < 0x3F20; addr++ {
+		writer.Write([]byte{console.PPU().PeekMemory(addr)})
+	}
+
+	for addr := 0x6000; addr < 0x8000; addr++ {
+		writer.Write([]byte{console.Peek(uint16(addr))})
+	}
+}
+
+// Runs frames frames, calling afterFrame after each
+func run(console *nes.NES, frames int, script *movie.Movie, afterFrame func()) error {
+	var session *movie.Session
+
+	if script != nil {
+		var err error
+
+		if session, err = movie.Play(console, script, movie.ModeReadOnly); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < frames; i++ {
+		if session != nil {
+			if err := session.NextFrame(); err != nil {
+				return err
+			}
+		} else {
+			console.NextFrame()
+			console.GetFrame()
+		}
+
+		afterFrame()
+	}
+
+	return nil
+}
+
+// Golden hashes by test name
+type Hashes map[string]string
+
+// Loads a hash file, a missing file holds no hashes
+func LoadHashes(path string) (Hashes, error) {
+	hashes := Hashes{}
+
+	file, err := os.Open(path)
+
+	if os.IsNotExist(err) {
+		return hashes, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open golden hashes: %s", err)
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, hash, ok := strings.Cut(line, " ")
+
+		if !ok {
+			return nil, fmt.Errorf("invalid golden hash line %q", line)
+		}
+
+		hashes[name] = strings.TrimSpace(hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read golden hashes: %s", err)
+	}
+
+	return hashes, nil
+}
+
+// Writes the hashes sorted by name so updates give small diffs
+func (hashes Hashes) Save(path string) error {
+	names := make([]string, 0, len(hashes))
+
+	for name := range hashes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var contents strings.Builder
+
+	for _, name := range names {
+		fmt.Fprintf(&contents, "%s %s\n", name, hashes[name])
+	}
+
+	if err := os.WriteFile(path, []byte(contents.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write golden hashes: %s", err)
+	}
+
+	return nil
+}
+
+// Returns expected dimmed to a third of its brightness, with every pixel
+// that differs in actual drawn in red
+func Diff(expected *image.RGBA, actual *image.RGBA) *image.RGBA {
+	diff := image.NewRGBA(expected.Rect.Union(actual.Rect))
+
+	for y := diff.Rect.Min.Y; y < diff.Rect.Max.Y; y++ {
+		for x := diff.Rect.Min.X; x < diff.Rect.Max.X; x++ {
+			expectedColor := expected.RGBAAt(x, y)
+
+			if expectedColor != actual.RGBAAt(x, y) {
+				diff.SetRGBA(x, y, color.RGBA{R: 0xFF, A: 0xFF})
+			} else {
+				diff.SetRGBA(x, y, color.RGBA{R: expectedColor.R / 3, G: expectedColor.G / 3, B: expectedColor.B / 3, A: 0xFF})
+			}
+		}
+	}
+
+	return diff
+}
+
+func ReadPNG(path string) (*image.RGBA, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	decoded, err := png.Decode(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+
+	rgba := image.NewRGBA(decoded.Bounds())
+	draw.Draw(rgba, rgba.Rect, decoded, decoded.Bounds().Min, draw.Src)
+
+	return rgba, nil
+}
+
+func WritePNG(path string, frame image.Image) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	if err := png.Encode(file, frame); err != nil {
+		return fmt.Errorf("failed to encode %s: %s", path, err)
+	}
+
+	return file.Close()
+}
+
+// Compares frame against the golden frame dir/name.png. On a mismatch, or
+// when there is no golden frame, the images are written to outDir with
+// WriteMismatch and the error says where.
+func CompareFrame(dir string, name string, frame *image.RGBA, outDir string) error {
+	expected, err := ReadPNG(filepath.Join(dir, name+".png"))
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if expected != nil && Hash(expected) == Hash(frame) {
+		return nil
+	}
+
+	if err := WriteMismatch(outDir, name, expected, frame); err != nil {
+		return fmt.Errorf("failed to write mismatch images: %s", err)
+	}
+
+	if expected == nil {
+		return fmt.Errorf("no golden frame %s.png, the frame was written to %s", name, outDir)
+	}
+
+	return fmt.Errorf("frame %s does not match golden %s, images written to %s", Hash(frame), Hash(expected), outDir)
+}
+
+// Writes the actual, expected and diff images of a mismatch to dir, expected
+// may be nil when no golden image is available
+func WriteMismatch(dir string, name string, expected *image.RGBA, actual *image.RGBA) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := WritePNG(filepath.Join(dir, name+".actual.png"), actual); err != nil {
+		return err
+	}
+
+	if expected == nil {
+		return nil
+	}
+
+	if err := WritePNG(filepath.Join(dir, name+".expected.png"), expected); err != nil {
+		return err
+	}
+
+	return WritePNG(filepath.Join(dir, name+".diff.png"), Diff(expected, actual))
+}
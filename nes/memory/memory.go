@@ -32,3 +32,9 @@ type Memory interface {
 	Read(addr uint16) uint8
 	Write(addr uint16, value uint8)
 }
+
+// Memory that can be inspected without the side effects a read can have on
+// hardware registers, used by debuggers, tracers and other tooling
+type Peeker interface {
+	Peek(addr uint16) uint8
+}
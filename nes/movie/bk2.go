@@ -0,0 +1,377 @@
+package movie
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"gonesem/nes/controller"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+*
+BizHawk .bk2 movies are zip archives of text files. Header.txt holds "key
+value" lines, Comments.txt free text and Input Log.txt the input between
+[Input] and [/Input]:
+
+	LogKey:#Reset|Power|#P1 Up|P1 Down|P1 Left|P1 Right|P1 Start|P1 Select|P1 B|P1 A|
+	|..|U......A|
+
+LogKey names the button behind each character of the input lines, split
+into groups by '#' the same way input lines are split by '|'. Buttons are
+held when their character is anything but '.', so logs with other
+controller layouts are read by name and unknown buttons are ignored.
+
+BizHawk save states can't be loaded, so movies starting from one are rejected.
+Movies gonesem records from a save state keep it in a "gonesem State.bin"
+file, which BizHawk ignores and will play such movies from power on.
+*
+*/
+
+const (
+	bk2Header   = "Header.txt"
+	bk2Comments = "Comments.txt"
+	bk2InputLog = "Input Log.txt"
+	bk2State    = "gonesem State.bin"
+
+	bk2LogKey = "#Reset|Power|#P1 Up|P1 Down|P1 Left|P1 Right|P1 Start|P1 Select|P1 B|P1 A|" +
+		"#P2 Up|P2 Down|P2 Left|P2 Right|P2 Start|P2 Select|P2 B|P2 A|"
+)
+
+type bk2File struct {
+	name     string
+	contents []byte
+}
+
+var bk2Buttons = map[string]controller.Buttons{
+	"Up":     controller.ButtonUp,
+	"Down":   controller.ButtonDown,
+	"Left":   controller.ButtonLeft,
+	"Right":  controller.ButtonRight,
+	"Start":  controller.ButtonStart,
+	"Select": controller.ButtonSelect,
+	"B":      controller.ButtonB,
+	"A":      controller.ButtonA,
+}
+
+var bk2Mnemonics = map[string]byte{
+	"Reset":  'r',
+	"Power":  'P',
+	"Up":     'U',
+	"Down":   'D',
+	"Left":   'L',
+	"Right":  'R',
+	"Start":  'S',
+	"Select": 's',
+	"B":      'B',
+	"A":      'A',
+}
+
+func ReadBK2(reader io.Reader) (*Movie, error) {
+	data, err := io.ReadAll(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read movie: %s", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open movie archive: %s", err)
+	}
+
+	movie := &Movie{}
+	startsFromState := false
+	hasInputLog := false
+
+	for _, file := range archive.File {
+		contents, err := readZipFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch file.Name {
+		case bk2Header:
+			if startsFromState, err = movie.readBK2Header(contents); err != nil {
+				return nil, err
+			}
+		case bk2Comments:
+			for _, line := range strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n") {
+				if line != "" {
+					movie.Comments = append(movie.Comments, line)
+				}
+			}
+		case bk2InputLog:
+			if movie.Frames, err = readBK2InputLog(contents); err != nil {
+				return nil, err
+			}
+
+			hasInputLog = true
+		case bk2State:
+			movie.StartState = contents
+		}
+	}
+
+	if !hasInputLog {
+		return nil, fmt.Errorf("movie archive has no %s", bk2InputLog)
+	}
+
+	if startsFromState && movie.StartState == nil {
+		return nil, fmt.Errorf("movies starting from a BizHawk save state are not supported")
+	}
+
+	return movie, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in movie archive: %s", file.Name, err)
+	}
+
+	defer reader.Close()
+
+	contents, err := io.ReadAll(reader)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from movie archive: %s", file.Name, err)
+	}
+
+	return contents, nil
+}
+
+// Reads the header into movie, returning whether the movie starts from a save state
+func (movie *Movie) readBK2Header(contents []byte) (bool, error) {
+	startsFromState := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(strings.TrimRight(scanner.Text(), "\r"), " ")
+
+		var err error
+
+		switch strings.ToLower(key) {
+		case "platform":
+			if value != "NES" {
+				return false, fmt.Errorf("movie is for the %s platform, not NES", value)
+			}
+		case "gamename":
+			movie.ROMName = value
+		case "sha1":
+			var checksum []byte
+
+			if checksum, err = hex.DecodeString(value); err == nil && len(checksum) != len(movie.SHA1) {
+				err = fmt.Errorf("expected %d bytes, got %d", len(movie.SHA1), len(checksum))
+			}
+
+			copy(movie.SHA1[:], checksum)
+		case "author":
+			movie.Author = value
+		case "rerecordcount":
+			var rerecords uint64
+
+			rerecords, err = strconv.ParseUint(value, 10, 32)
+			movie.Rerecords = uint32(rerecords)
+		case "startsfromsavestate":
+			startsFromState = strings.EqualFold(value, "True")
+		case "pal":
+			if strings.EqualFold(value, "True") {
+				return false, fmt.Errorf("PAL movies are not supported")
+			}
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("invalid %s in movie header: %s", key, err)
+		}
+	}
+
+	return startsFromState, nil
+}
+
+func readBK2InputLog(contents []byte) ([]Frame, error) {
+	var frames []Frame
+	var logKey [][]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if key, ok := strings.CutPrefix(line, "LogKey:"); ok {
+			logKey = parseBK2LogKey(key)
+
+			continue
+		}
+
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+
+		if logKey == nil {
+			return nil, fmt.Errorf("%s line %d: input before LogKey", bk2InputLog, lineNumber)
+		}
+
+		frame, err := parseBK2Frame(line, logKey)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %s", bk2InputLog, lineNumber, err)
+		}
+
+		frames = append(frames, frame)
+	}
+
+	return frames, nil
+}
+
+// Splits a LogKey into the button names of each input group
+func parseBK2LogKey(key string) [][]string {
+	var groups [][]string
+
+	for _, group := range strings.Split(key, "#") {
+		if group == "" {
+			continue
+		}
+
+		groups = append(groups, strings.FieldsFunc(group, func(r rune) bool { return r == '|' }))
+	}
+
+	return groups
+}
+
+func parseBK2Frame(line string, logKey [][]string) (Frame, error) {
+	frame := Frame{}
+
+	fields := strings.Split(strings.Trim(line, "|"), "|")
+
+	if len(fields) != len(logKey) {
+		return frame, fmt.Errorf("expected %d input groups, got %d", len(logKey), len(fields))
+	}
+
+	for i, field := range fields {
+		if len(field) != len(logKey[i]) {
+			return frame, fmt.Errorf("expected %d buttons in group %d, got %d", len(logKey[i]), i+1, len(field))
+		}
+
+		for j, name := range logKey[i] {
+			if field[j] == '.' {
+				continue
+			}
+
+			switch name {
+			case "Reset":
+				frame.Commands |= CommandReset
+			case "Power":
+				frame.Commands |= CommandPower
+			}
+
+			player, button, _ := strings.Cut(name, " ")
+
+			switch player {
+			case "P1":
+				frame.Buttons[0] |= bk2Buttons[button]
+			case "P2":
+				frame.Buttons[1] |= bk2Buttons[button]
+			}
+		}
+	}
+
+	return frame, nil
+}
+
+func WriteBK2(writer io.Writer, movie *Movie) error {
+	archive := zip.NewWriter(writer)
+
+	var header strings.Builder
+
+	fmt.Fprintf(&header, "MovieVersion BizHawk v2.0.0\n")
+	fmt.Fprintf(&header, "Author %s\n", movie.Author)
+	fmt.Fprintf(&header, "emuVersion gonesem\n")
+	fmt.Fprintf(&header, "Platform NES\n")
+	fmt.Fprintf(&header, "GameName %s\n", movie.ROMName)
+	fmt.Fprintf(&header, "SHA1 %X\n", movie.SHA1)
+	fmt.Fprintf(&header, "Core NesHawk\n")
+	fmt.Fprintf(&header, "rerecordCount %d\n", movie.Rerecords)
+
+	var inputLog strings.Builder
+
+	logKey := parseBK2LogKey(bk2LogKey)
+
+	fmt.Fprintf(&inputLog, "[Input]\n")
+	fmt.Fprintf(&inputLog, "LogKey:%s\n", bk2LogKey)
+
+	for _, frame := range movie.Frames {
+		inputLog.WriteString(formatBK2Frame(frame, logKey))
+	}
+
+	fmt.Fprintf(&inputLog, "[/Input]\n")
+
+	files := []bk2File{
+		{bk2Header, []byte(header.String())},
+		{bk2Comments, []byte(strings.Join(movie.Comments, "\n"))},
+		{bk2InputLog, []byte(inputLog.String())},
+	}
+
+	if movie.StartState != nil {
+		files = append(files, bk2File{bk2State, movie.StartState})
+	}
+
+	for _, file := range files {
+		fileWriter, err := archive.Create(file.name)
+
+		if err != nil {
+			return fmt.Errorf("failed to add %s to movie archive: %s", file.name, err)
+		}
+
+		if _, err := fileWriter.Write(file.contents); err != nil {
+			return fmt.Errorf("failed to write %s to movie archive: %s", file.name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write movie archive: %s", err)
+	}
+
+	return nil
+}
+
+func formatBK2Frame(frame Frame, logKey [][]string) string {
+	line := []byte{'|'}
+
+	for _, group := range logKey {
+		for _, name := range group {
+			held := false
+
+			switch player, button, _ := strings.Cut(name, " "); player {
+			case "P1":
+				held = frame.Buttons[0]&bk2Buttons[button] != 0
+			case "P2":
+				held = frame.Buttons[1]&bk2Buttons[button] != 0
+			case "Reset":
+				held = frame.Commands&CommandReset != 0
+			case "Power":
+				held = frame.Commands&CommandPower != 0
+			}
+
+			if held {
+				button := name[strings.LastIndex(name, " ")+1:]
+				line = append(line, bk2Mnemonics[button])
+			} else {
+				line = append(line, '.')
+			}
+		}
+
+		line = append(line, '|')
+	}
+
+	return string(append(line, '\n'))
+}
@@ -0,0 +1,52 @@
+package movie
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Loads the .fm2 or .bk2 movie at path, picking the format by extension
+func Load(path string) (*Movie, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open movie file: %s", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".fm2":
+		return ReadFM2(bytes.NewReader(data))
+	case ".bk2":
+		return ReadBK2(bytes.NewReader(data))
+	}
+
+	return nil, fmt.Errorf("unknown movie format %q, expected .fm2 or .bk2", filepath.Ext(path))
+}
+
+// Saves movie to path as .fm2 or .bk2, picking the format by extension
+func Save(path string, movie *Movie) error {
+	var buf bytes.Buffer
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".fm2":
+		err = WriteFM2(&buf, movie)
+	case ".bk2":
+		err = WriteBK2(&buf, movie)
+	default:
+		return fmt.Errorf("unknown movie format %q, expected .fm2 or .bk2", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write movie file: %s", err)
+	}
+
+	return nil
+}
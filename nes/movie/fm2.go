@@ -0,0 +1,240 @@
+package movie
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"gonesem/nes/controller"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+*
+FCEUX .fm2 movies are a text header of "key value" lines followed by one
+input line per frame:
+
+	version 3
+	romFilename Super Mario Bros.
+	romChecksum base64:jjYwGG411HcjG/j9UOVM3Q==
+	|0|R..UT..A|........||
+
+The first field holds the frame's commands as a decimal bitfield and each of
+the following fields the buttons of one port in the order RLDUTSBA, where
+any character other than '.' or ' ' marks the button as held.
+
+FCEUX save states can't be loaded, so movies starting from one are rejected.
+Movies gonesem records from a save state keep it in a gonesemState line,
+FCEUX ignores the line and will play such movies from power on.
+*
+*/
+
+const fm2Buttons = "RLDUTSBA"
+
+var fm2ButtonBits = [8]controller.Buttons{
+	controller.ButtonRight,
+	controller.ButtonLeft,
+	controller.ButtonDown,
+	controller.ButtonUp,
+	controller.ButtonStart,
+	controller.ButtonSelect,
+	controller.ButtonB,
+	controller.ButtonA,
+}
+
+func ReadFM2(reader io.Reader) (*Movie, error) {
+	movie := &Movie{}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 16<<20) // Embedded save states make for long lines
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if strings.HasPrefix(line, "|") {
+			frame, err := parseFM2Frame(line)
+
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+			}
+
+			movie.Frames = append(movie.Frames, frame)
+
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+
+		if err := movie.setFM2Header(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read movie: %s", err)
+	}
+
+	return movie, nil
+}
+
+func (movie *Movie) setFM2Header(key string, value string) error {
+	var err error
+
+	switch key {
+	case "binary":
+		if value != "0" {
+			return fmt.Errorf("binary input logs are not supported")
+		}
+	case "palFlag":
+		if value != "0" {
+			return fmt.Errorf("PAL movies are not supported")
+		}
+	case "fourscore":
+		if value != "0" {
+			return fmt.Errorf("Four Score movies are not supported")
+		}
+	case "savestate":
+		return fmt.Errorf("movies starting from an FCEUX save state are not supported")
+	case "romFilename":
+		movie.ROMName = value
+	case "romChecksum":
+		var checksum []byte
+
+		if checksum, err = decodeFM2Binary(value); err == nil && len(checksum) != len(movie.MD5) {
+			err = fmt.Errorf("expected %d bytes, got %d", len(movie.MD5), len(checksum))
+		}
+
+		copy(movie.MD5[:], checksum)
+	case "guid":
+		movie.GUID = value
+	case "rerecordCount":
+		var rerecords uint64
+
+		rerecords, err = strconv.ParseUint(value, 10, 32)
+		movie.Rerecords = uint32(rerecords)
+	case "comment":
+		if author, ok := strings.CutPrefix(value, "author "); ok {
+			movie.Author = author
+		} else {
+			movie.Comments = append(movie.Comments, value)
+		}
+	case "gonesemState":
+		movie.StartState, err = decodeFM2Binary(value)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s: %s", key, err)
+	}
+
+	return nil
+}
+
+// FCEUX writes binary values as base64 with a "base64:" prefix or as hex with a "0x" prefix
+func decodeFM2Binary(value string) ([]byte, error) {
+	if encoded, ok := strings.CutPrefix(value, "base64:"); ok {
+		return base64.StdEncoding.DecodeString(encoded)
+	}
+
+	if encoded, ok := strings.CutPrefix(value, "0x"); ok {
+		return hex.DecodeString(encoded)
+	}
+
+	return nil, fmt.Errorf("unknown binary encoding %q", value)
+}
+
+func parseFM2Frame(line string) (Frame, error) {
+	frame := Frame{}
+
+	fields := strings.Split(line, "|")
+
+	// A leading empty field, the commands and at least the port 1 input
+	if len(fields) < 3 {
+		return frame, fmt.Errorf("invalid input line %q", line)
+	}
+
+	commands, err := strconv.ParseUint(fields[1], 10, 8)
+
+	if err != nil {
+		return frame, fmt.Errorf("invalid commands %q", fields[1])
+	}
+
+	frame.Commands = Command(commands)
+
+	for port := 0; port < len(frame.Buttons) && port+2 < len(fields); port++ {
+		input := fields[port+2]
+
+		if input == "" {
+			continue
+		}
+
+		if len(input) != len(fm2Buttons) {
+			return frame, fmt.Errorf("invalid port %d input %q", port, input)
+		}
+
+		for i := 0; i < len(input); i++ {
+			if input[i] != '.' && input[i] != ' ' {
+				frame.Buttons[port] |= fm2ButtonBits[i]
+			}
+		}
+	}
+
+	return frame, nil
+}
+
+func WriteFM2(writer io.Writer, movie *Movie) error {
+	buffered := bufio.NewWriter(writer)
+
+	fmt.Fprintf(buffered, "version 3\n")
+	fmt.Fprintf(buffered, "emuVersion 22020\n")
+	fmt.Fprintf(buffered, "rerecordCount %d\n", movie.Rerecords)
+	fmt.Fprintf(buffered, "palFlag 0\n")
+	fmt.Fprintf(buffered, "romFilename %s\n", movie.ROMName)
+	fmt.Fprintf(buffered, "romChecksum base64:%s\n", base64.StdEncoding.EncodeToString(movie.MD5[:]))
+	fmt.Fprintf(buffered, "guid %s\n", movie.GUID)
+	fmt.Fprintf(buffered, "fourscore 0\n")
+	fmt.Fprintf(buffered, "microphone 0\n")
+	fmt.Fprintf(buffered, "port0 1\n")
+	fmt.Fprintf(buffered, "port1 1\n")
+	fmt.Fprintf(buffered, "port2 0\n")
+	fmt.Fprintf(buffered, "FDS 0\n")
+	fmt.Fprintf(buffered, "NewPPU 0\n")
+
+	if movie.Author != "" {
+		fmt.Fprintf(buffered, "comment author %s\n", movie.Author)
+	}
+
+	for _, comment := range movie.Comments {
+		fmt.Fprintf(buffered, "comment %s\n", comment)
+	}
+
+	if movie.StartState != nil {
+		fmt.Fprintf(buffered, "gonesemState base64:%s\n", base64.StdEncoding.EncodeToString(movie.StartState))
+	}
+
+	for _, frame := range movie.Frames {
+		fmt.Fprintf(buffered, "|%d|%s|%s||\n", frame.Commands, formatFM2Buttons(frame.Buttons[0]), formatFM2Buttons(frame.Buttons[1]))
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write movie: %s", err)
+	}
+
+	return nil
+}
+
+func formatFM2Buttons(buttons controller.Buttons) string {
+	input := []byte(fm2Buttons)
+
+	for i, bit := range fm2ButtonBits {
+		if buttons&bit == 0 {
+			input[i] = '.'
+		}
+	}
+
+	return string(input)
+}
@@ -0,0 +1,71 @@
+package movie
+
+import (
+	"crypto/rand"
+	"fmt"
+	"gonesem/nes"
+	"gonesem/nes/controller"
+)
+
+// Commands issued on a frame besides controller input, using the same bits as FCEUX
+type Command uint8
+
+const (
+	CommandReset Command = 1 << iota
+	CommandPower
+)
+
+type Frame struct {
+	Buttons  [2]controller.Buttons // Buttons held on ports 1 and 2
+	Commands Command               // Performed before the frame is emulated
+}
+
+/*
+*
+A movie is the controller input for every frame since it started, either
+from power on or from a save state. Emulation is deterministic so playing
+the input back reproduces the same run.
+
+Movies are stored as FCEUX .fm2 or BizHawk .bk2 files, see fm2.go and bk2.go.
+*
+*/
+type Movie struct {
+	ROMName    string
+	MD5        [16]byte // MD5 of the PRG and CHR ROM, all zero when unknown
+	SHA1       [20]byte // SHA-1 of the PRG and CHR ROM, all zero when unknown
+	GUID       string
+	Author     string
+	Comments   []string
+	Rerecords  uint32 // Times recording resumed from an earlier save state
+	StartState []byte // Save state the movie starts from, nil when it starts at power on
+	Frames     []Frame
+}
+
+// Returns an error if the movie was recorded on a different ROM than the console's, hashes
+// missing from the movie file aren't checked
+func (movie *Movie) CheckROM(console *nes.NES) error {
+	cartridge := console.Cartridge()
+
+	if movie.MD5 != ([16]byte{}) && movie.MD5 != cartridge.MD5() {
+		return fmt.Errorf("movie was recorded on a different ROM (MD5 %X, loaded ROM is %X)", movie.MD5, cartridge.MD5())
+	}
+
+	if movie.SHA1 != ([20]byte{}) && movie.SHA1 != cartridge.SHA1() {
+		return fmt.Errorf("movie was recorded on a different ROM (SHA-1 %X, loaded ROM is %X)", movie.SHA1, cartridge.SHA1())
+	}
+
+	return nil
+}
+
+// Returns a random version 4 UUID identifying a new movie, FCEUX uses it to
+// match save states with the movie they were made during
+func newGUID() string {
+	var uuid [16]byte
+
+	rand.Read(uuid[:])
+
+	uuid[6] = uuid[6]&0x0F | 0x40
+	uuid[8] = uuid[8]&0x3F | 0x80
+
+	return fmt.Sprintf("%X-%X-%X-%X-%X", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
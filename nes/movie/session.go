@@ -0,0 +1,197 @@
+package movie
+
+import (
+	"fmt"
+	"gonesem/nes"
+	"gonesem/nes/controller"
+)
+
+type Mode uint8
+
+const (
+	// Input held on the console is appended to the movie each frame
+	ModeRecord Mode = iota
+	// Input comes from the movie, loading a save state only seeks within it
+	ModeReadOnly
+	// Input comes from the movie, loading a save state truncates the movie at
+	// the state's frame and resumes recording from there, counting a rerecord
+	ModeReadWrite
+	// Read-only playback ran past the last frame, input is left to the user
+	ModeFinished
+)
+
+// Drives a console from a movie, or records one, a frame at a time
+type Session struct {
+	console    *nes.NES
+	movie      *Movie
+	mode       Mode
+	startFrame uint64 // Console frame count at the start of the movie
+	commands   Command
+}
+
+// Starts recording a new movie on console. Movies from power on need a console
+// that hasn't run yet, otherwise the movie starts from the console's current state.
+func Record(console *nes.NES, fromPowerOn bool) (*Session, error) {
+	if fromPowerOn && console.FrameCount() != 0 {
+		return nil, fmt.Errorf("console has already run %d frames, record from a save state instead", console.FrameCount())
+	}
+
+	movie := &Movie{
+		MD5:  console.Cartridge().MD5(),
+		SHA1: console.Cartridge().SHA1(),
+		GUID: newGUID(),
+	}
+
+	if !fromPowerOn {
+		movie.StartState = console.AppendState(nil)
+	}
+
+	session := &Session{
+		console:    console,
+		movie:      movie,
+		mode:       ModeRecord,
+		startFrame: console.FrameCount(),
+	}
+
+	return session, nil
+}
+
+// Starts playing movie back on console in ModeReadOnly or ModeReadWrite, loading
+// its start state if it has one
+func Play(console *nes.NES, movie *Movie, mode Mode) (*Session, error) {
+	if mode != ModeReadOnly && mode != ModeReadWrite {
+		return nil, fmt.Errorf("movies can only be played back read-only or read-write")
+	}
+
+	if err := movie.CheckROM(console); err != nil {
+		return nil, err
+	}
+
+	if movie.StartState != nil {
+		if err := console.LoadStateBytes(movie.StartState); err != nil {
+			return nil, fmt.Errorf("failed to load movie start state: %s", err)
+		}
+	} else if console.FrameCount() != 0 {
+		return nil, fmt.Errorf("movie starts at power on but the console has already run %d frames", console.FrameCount())
+	}
+
+	session := &Session{
+		console:    console,
+		movie:      movie,
+		mode:       mode,
+		startFrame: console.FrameCount(),
+	}
+
+	session.checkEnd()
+
+	return session, nil
+}
+
+func (session *Session) Movie() *Movie {
+	return session.movie
+}
+
+func (session *Session) Mode() Mode {
+	return session.mode
+}
+
+// Returns the index of the next frame into the movie
+func (session *Session) Frame() int {
+	return int(session.console.FrameCount() - session.startFrame)
+}
+
+// Presses reset at the start of the next frame when recording
+func (session *Session) Reset() {
+	session.commands |= CommandReset
+}
+
+// Emulates the next frame, taking its input from or adding it to the movie
+func (session *Session) NextFrame() error {
+	frame := session.Frame()
+
+	session.checkEnd()
+
+	switch session.mode {
+	case ModeRecord:
+		session.movie.Frames = append(session.movie.Frames, Frame{
+			Buttons:  [2]controller.Buttons{session.console.Buttons(0), session.console.Buttons(1)},
+			Commands: session.commands,
+		})
+
+		session.commands = 0
+	case ModeReadOnly, ModeReadWrite:
+		input := session.movie.Frames[frame]
+
+		session.console.SetButtons(0, input.Buttons[0])
+		session.console.SetButtons(1, input.Buttons[1])
+	}
+
+	if session.mode != ModeFinished {
+		if err := session.perform(session.movie.Frames[frame].Commands); err != nil {
+			return fmt.Errorf("frame %d: %s", frame, err)
+		}
+	}
+
+	session.console.NextFrame()
+	session.console.GetFrame()
+
+	session.checkEnd()
+
+	return nil
+}
+
+// Leaves playback once the last frame of the movie has been played
+func (session *Session) checkEnd() {
+	if session.Frame() < len(session.movie.Frames) {
+		return
+	}
+
+	switch session.mode {
+	case ModeReadOnly:
+		session.mode = ModeFinished
+	case ModeReadWrite:
+		session.mode = ModeRecord
+	}
+}
+
+func (session *Session) perform(commands Command) error {
+	if commands&CommandPower != 0 {
+		return fmt.Errorf("power cycling during a movie is not supported")
+	}
+
+	if commands&CommandReset != 0 {
+		session.console.Reset()
+	}
+
+	return nil
+}
+
+// Loads a save state made during the movie. Outside of read-only playback the
+// movie is truncated at the state's frame and recording continues from there.
+func (session *Session) LoadState(data []byte) error {
+	previous := session.console.AppendState(nil)
+
+	if err := session.console.LoadStateBytes(data); err != nil {
+		return err
+	}
+
+	if session.console.FrameCount() < session.startFrame || session.Frame() > len(session.movie.Frames) {
+		// The previous state was saved from this console, so it always loads
+		session.console.LoadStateBytes(previous)
+
+		return fmt.Errorf("save state is not within the movie")
+	}
+
+	switch session.mode {
+	case ModeReadOnly, ModeFinished:
+		session.mode = ModeReadOnly
+	case ModeRecord, ModeReadWrite:
+		session.movie.Frames = session.movie.Frames[:session.Frame()]
+		session.movie.Rerecords++
+		session.mode = ModeRecord
+	}
+
+	session.checkEnd()
+
+	return nil
+}
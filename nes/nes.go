@@ -1,9 +1,15 @@
 package nes
 
 import (
+	"fmt"
+	"gonesem/nes/apu"
 	"gonesem/nes/cartridge"
+	"gonesem/nes/cheats"
+	"gonesem/nes/controller"
 	"gonesem/nes/cpu"
 	"gonesem/nes/ppu"
+	"gonesem/nes/state"
+	"gonesem/nes/trace"
 	"image"
 	"image/color"
 )
@@ -11,15 +17,32 @@ import (
 type NES struct {
 	cpu       *cpu.CPU
 	ppu       *ppu.PPU
+	apu       apu.APU
 	cartridge *cartridge.Cartridge
+	cheats    *cheats.Engine
 
-	ram [2048]uint8
+	ram         [2048]uint8
+	controllers [2]controller.Controller
+	dma         oamDMA
+	nmiLine     bool // Level of the PPU's NMI output when the CPU last sampled it
+
+	stateWriter state.Writer // Reused to take snapshots without allocating
+	stateChunk  state.Chunk
+
+	region cartridge.Region // Timing the console runs with, taken from the cartridge when it's created
 
 	TotalCycles uint64
+	frameCount  uint64 // Frames completed since power on
+
+	instructionCallback func() // Called when the CPU is about to start an instruction
+	breakRequested      bool   // Break was called, RunFrame returns at the end of the master cycle
 }
 
+// Creates a console with the timing of the cartridge's region, see
+// cartridge.Cartridge.SetRegion to override it
 func NewNES(cartridge *cartridge.Cartridge, colorPalette [64]color.RGBA) *NES {
-	nes := &NES{cartridge: cartridge, TotalCycles: 0}
+	nes := &NES{cartridge: cartridge, cheats: cheats.NewEngine(), TotalCycles: 0}
+	nes.setRegion(cartridge.Info().Region)
 
 	cpu := cpu.NewCPU(nes)
 	ppu := ppu.NewPPU(cartridge, colorPalette)
@@ -30,14 +53,54 @@ func NewNES(cartridge *cartridge.Cartridge, colorPalette [64]color.RGBA) *NES {
 	return nes
 }
 
+// Returns an independent console in the same state, with its own copy of the
+// cartridge's RAM. The cheat list is shared so changes apply to both consoles.
+func (nes *NES) Clone() *NES {
+	clone := NewNES(nes.cartridge.Clone(), nes.ppu.ColorPalette())
+	clone.cheats = nes.cheats
+
+	// A state saved from the same ROM always loads
+	if err := clone.LoadStateBytes(nes.AppendState(nil)); err != nil {
+		panic(fmt.Sprintf("Failed to clone console: %s", err))
+	}
+
+	return clone
+}
+
 func (nes *NES) Read(addr uint16) uint8 {
 	switch {
 	case addr <= 0x1FFF:
 		return nes.ram[addr%0x0800]
 	case addr >= 0x2000 && addr <= 0x3FFF:
 		return nes.ppu.Read(addr % 0x0008)
+	case addr == 0x4015:
+		return nes.apu.Read(addr)
+	case addr == 0x4016 || addr == 0x4017:
+		return nes.controllers[addr-0x4016].Read()
+	default:
+		return nes.cheats.PatchRead(addr, nes.cartridge.PRGRead(addr))
+	}
+}
+
+/*
+*
+Returns what Read would for addr without side effects, reading the PPU's
+registers, the APU's status, the controllers or the cartridge changes nothing.
+Used by tooling such as the debugger and tracer to inspect memory while it runs.
+*
+*/
+func (nes *NES) Peek(addr uint16) uint8 {
+	switch {
+	case addr <= 0x1FFF:
+		return nes.ram[addr%0x0800]
+	case addr >= 0x2000 && addr <= 0x3FFF:
+		return nes.ppu.Peek(addr % 0x0008)
+	case addr == 0x4015:
+		return nes.apu.Peek(addr)
+	case addr == 0x4016 || addr == 0x4017:
+		return nes.controllers[addr-0x4016].Peek()
 	default:
-		return nes.cartridge.PRGRead(addr)
+		return nes.cheats.PatchRead(addr, nes.cartridge.PRGPeek(addr))
 	}
 }
 
@@ -47,6 +110,13 @@ func (nes *NES) Write(addr uint16, value uint8) {
 		nes.ram[addr%0x0800] = value
 	case addr >= 0x2000 && addr <= 0x3FFF:
 		nes.ppu.Write(addr%0x0008, value)
+	case addr == 0x4014:
+		nes.dma.start(value)
+	case addr == 0x4016:
+		nes.controllers[0].Write(value)
+		nes.controllers[1].Write(value)
+	case addr >= 0x4000 && addr <= 0x4017:
+		nes.apu.Write(addr, value)
 	default:
 		nes.cartridge.PRGWrite(addr, value)
 	}
@@ -55,24 +125,255 @@ func (nes *NES) Write(addr uint16, value uint8) {
 func (nes *NES) Clock() {
 	nes.ppu.Clock()
 
-	if nes.TotalCycles%3 == 0 {
-		nes.cpu.Clock()
+	if nes.cpuCycle() {
+		nes.clockCPU()
 	}
 
-	if nes.ppu.EmitNMI {
+	nes.TotalCycles++
+}
+
+// Returns whether the CPU runs on the current PPU dot, every third on NTSC and
+// Dendy consoles and 5 of every 16 on PAL ones
+func (nes *NES) cpuCycle() bool {
+	if nes.region == cartridge.RegionPAL {
+		return nes.TotalCycles*5%16 < 5
+	}
+
+	return nes.TotalCycles%3 == 0
+}
+
+// Runs a CPU cycle, which OAM DMA takes from the CPU while it copies
+func (nes *NES) clockCPU() {
+	if nes.dma.active {
+		nes.clockDMA()
+	} else if nes.cpu.Clock() && nes.instructionCallback != nil && nes.cpu.AtInstruction() {
+		nes.instructionCallback()
+	}
+
+	nes.apu.Clock()
+	nes.cpu.SetIRQ(nes.apu.IRQ())
+
+	// The CPU samples the PPU's NMI output once a cycle and takes an NMI on a
+	// rising edge, so the NMI can still be suppressed for the dots in between
+	nmi := nes.ppu.NMI()
+
+	if nmi && !nes.nmiLine {
 		nes.cpu.NMI()
-		nes.ppu.EmitNMI = false
 	}
 
-	nes.TotalCycles++
+	nes.nmiLine = nmi
 }
 
+// Runs until the frame completes, ignoring Break
 func (nes *NES) NextFrame() {
+	for !nes.RunFrame() {
+	}
+}
+
+/*
+*
+Runs until the frame completes, returning true, or until Break is called,
+returning false at the end of the master cycle it was called in. The next
+call carries on with the same frame.
+
+Like NextFrame, the frame must be taken with GetFrame before the next one runs.
+*
+*/
+func (nes *NES) RunFrame() bool {
 	for !nes.ppu.IsFrameComplete() {
 		nes.Clock()
+
+		if nes.breakRequested {
+			nes.breakRequested = false
+			return false
+		}
 	}
+
+	nes.cheats.ApplyFreezes(nes.Peek, nes.Write)
+	nes.frameCount++
+
+	return true
+}
+
+// Stops RunFrame at the end of the current master cycle, for callbacks to
+// pause the console
+func (nes *NES) Break() {
+	nes.breakRequested = true
+}
+
+// Sets a function called when the CPU has finished an instruction or interrupt
+// sequence and is about to start an instruction, nil removes it. Calling Break
+// from it pauses the console before the instruction.
+func (nes *NES) SetInstructionCallback(callback func()) {
+	nes.instructionCallback = callback
+}
+
+// Returns the number of frames completed since power on
+func (nes *NES) FrameCount() uint64 {
+	return nes.frameCount
+}
+
+// Sets a function called with the address of the opcode when the CPU jams,
+// nil removes it
+func (nes *NES) SetHaltCallback(callback func(pc uint16)) {
+	nes.cpu.SetHaltCallback(callback)
+}
+
+// Returns the address of the opcode the CPU jammed on, and whether it is
+// jammed, only a reset or loading a state clears it
+func (nes *NES) Halted() (uint16, bool) {
+	return nes.cpu.Halted()
+}
+
+/*
+*
+Traces every instruction the CPU runs to tracer, along with the PPU's position
+and the frame count, nil stops tracing.
+
+Instructions are decoded through the bus like the CPU reads them.
+*
+*/
+func (nes *NES) SetTracer(tracer *trace.Tracer) {
+	if tracer == nil {
+		nes.cpu.SetTraceCallback(nil)
+		return
+	}
+
+	nes.cpu.SetTraceCallback(func(cpuPtr *cpu.CPU) {
+		tracer.Trace(nes, nes.TraceState())
+	})
+}
+
+// Returns the CPU's registers, the PPU's position and the frame count
+func (nes *NES) TraceState() trace.State {
+	state := trace.StateOf(nes.cpu)
+	state.HasPPU = true
+	state.Scanline, state.Dot = nes.ppu.Position()
+	state.Frame = nes.frameCount
+
+	return state
+}
+
+// Presses the reset button, RAM and cartridge RAM keep their contents
+func (nes *NES) Reset() {
+	nes.cpu.Reset()
+	nes.ppu.Reset()
+	nes.apu.Reset()
+	nes.dma = oamDMA{}
+	nes.nmiLine = false
 }
 
 func (nes *NES) GetFrame() *image.RGBA {
 	return nes.ppu.GetFrame()
 }
+
+func (nes *NES) Cartridge() *cartridge.Cartridge {
+	return nes.cartridge
+}
+
+func (nes *NES) CPU() *cpu.CPU {
+	return nes.cpu
+}
+
+func (nes *NES) PPU() *ppu.PPU {
+	return nes.ppu
+}
+
+// Returns a copy of the 2KB of internal RAM
+func (nes *NES) RAM() [2048]uint8 {
+	return nes.ram
+}
+
+// ------ //
+// Region //
+// ------ //
+
+// Frames per second of each region's console
+const (
+	FrameRateNTSC = 60.0988
+	FrameRatePAL  = 50.0070
+)
+
+// Cartridges that run on either region get NTSC timing
+func (nes *NES) setRegion(region cartridge.Region) {
+	if region == cartridge.RegionMultiple {
+		region = cartridge.RegionNTSC
+	}
+
+	nes.region = region
+	nes.apu.SetPAL(region == cartridge.RegionPAL)
+}
+
+// Returns the region whose timing the console runs with, NTSC, PAL or Dendy
+func (nes *NES) Region() cartridge.Region {
+	return nes.region
+}
+
+// Returns the frames per second the console runs at, for frontends to pace
+// frames with. Dendy consoles run at the PAL rate.
+func (nes *NES) FrameRate() float64 {
+	if nes.region == cartridge.RegionNTSC {
+		return FrameRateNTSC
+	}
+
+	return FrameRatePAL
+}
+
+// ----------- //
+// Controllers //
+// ----------- //
+
+// Sets the buttons held on the controller in port 0 or 1
+func (nes *NES) SetButtons(port int, buttons controller.Buttons) {
+	nes.controllers[port].SetButtons(buttons)
+}
+
+func (nes *NES) Buttons(port int) controller.Buttons {
+	return nes.controllers[port].Buttons()
+}
+
+// ------ //
+// Cheats //
+// ------ //
+
+// Adds a Game Genie, raw or Pro Action Replay cheat code, enabled
+func (nes *NES) AddCheat(code string, description string) error {
+	return nes.cheats.Add(code, description)
+}
+
+func (nes *NES) RemoveCheat(code string) error {
+	return nes.cheats.Remove(code)
+}
+
+func (nes *NES) EnableCheat(code string) error {
+	return nes.cheats.SetEnabled(code, true)
+}
+
+func (nes *NES) DisableCheat(code string) error {
+	return nes.cheats.SetEnabled(code, false)
+}
+
+func (nes *NES) Cheats() []cheats.Cheat {
+	return nes.cheats.Cheats()
+}
+
+// Replaces the cheat list with the one stored in the cheat file at path
+func (nes *NES) LoadCheats(path string) error {
+	list, err := cheats.Load(path)
+
+	if err != nil {
+		return err
+	}
+
+	nes.cheats.Clear()
+
+	for _, cheat := range list {
+		nes.cheats.AddCheat(cheat)
+	}
+
+	return nil
+}
+
+func (nes *NES) SaveCheats(path string) error {
+	return cheats.Save(path, nes.cheats.Cheats())
+}
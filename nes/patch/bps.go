@@ -0,0 +1,153 @@
+package patch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+var bpsMagic = []byte("BPS1")
+
+const (
+	bpsSourceRead = iota // Copy from source at the current output offset
+	bpsTargetRead        // Copy literal bytes stored in the patch
+	bpsSourceCopy        // Copy from a relative offset into the source
+	bpsTargetCopy        // Copy from a relative offset into the already written output
+)
+
+/*
+*
+BPS patches store the source, target and metadata sizes followed by a list of
+actions that build the target file. The low 2 bits of each action select the
+command and the remaining bits hold the length minus one.
+
+A footer holds CRC32s of the source, target and patch, all three are verified.
+*
+*/
+func ApplyBPS(rom []byte, patch []byte) ([]byte, error) {
+	if len(patch) < len(bpsMagic)+12 {
+		return nil, fmt.Errorf("BPS patch is too small")
+	}
+
+	footer := patch[len(patch)-12:]
+	sourceCRC := binary.LittleEndian.Uint32(footer[0:4])
+	targetCRC := binary.LittleEndian.Uint32(footer[4:8])
+	patchCRC := binary.LittleEndian.Uint32(footer[8:12])
+
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != patchCRC {
+		return nil, fmt.Errorf("BPS patch checksum mismatch, patch is corrupt")
+	}
+
+	if romCRC := crc32.ChecksumIEEE(rom); romCRC != sourceCRC {
+		return nil, fmt.Errorf("ROM checksum %08X does not match BPS patch source %08X", romCRC, sourceCRC)
+	}
+
+	offset := len(bpsMagic)
+
+	var header [3]uint64
+
+	for i := range header {
+		value, err := decodeNumber(patch, &offset)
+
+		if err != nil {
+			return nil, err
+		}
+
+		header[i] = value
+	}
+
+	sourceSize, targetSize, metadataSize := header[0], header[1], header[2]
+
+	if sourceSize != uint64(len(rom)) {
+		return nil, fmt.Errorf("ROM size %d does not match BPS patch source size %d", len(rom), sourceSize)
+	}
+
+	if targetSize > MaxROMSize {
+		return nil, fmt.Errorf("BPS patch target size %d is larger than the %d byte limit", targetSize, MaxROMSize)
+	}
+
+	if metadataSize > uint64(len(patch)-offset) {
+		return nil, fmt.Errorf("BPS patch metadata size %d runs past end of patch", metadataSize)
+	}
+
+	offset += int(metadataSize)
+
+	output := make([]byte, targetSize)
+	outputOffset := uint64(0)
+	sourceRelative := int64(0)
+	targetRelative := int64(0)
+
+	for offset < len(patch)-12 {
+		action, err := decodeNumber(patch, &offset)
+
+		if err != nil {
+			return nil, err
+		}
+
+		command := action & 0x03
+		length := action>>2 + 1
+
+		if outputOffset+length > targetSize {
+			return nil, fmt.Errorf("BPS action writes past end of target")
+		}
+
+		switch command {
+		case bpsSourceRead:
+			if outputOffset+length > sourceSize {
+				return nil, fmt.Errorf("BPS source read past end of source")
+			}
+
+			copy(output[outputOffset:], rom[outputOffset:outputOffset+length])
+		case bpsTargetRead:
+			if offset+int(length) > len(patch)-12 {
+				return nil, fmt.Errorf("BPS target read past end of patch")
+			}
+
+			copy(output[outputOffset:], patch[offset:offset+int(length)])
+			offset += int(length)
+		case bpsSourceCopy, bpsTargetCopy:
+			data, err := decodeNumber(patch, &offset)
+
+			if err != nil {
+				return nil, err
+			}
+
+			relative := int64(data >> 1)
+
+			if data&0x01 != 0 {
+				relative = -relative
+			}
+
+			if command == bpsSourceCopy {
+				sourceRelative += relative
+
+				if sourceRelative < 0 || uint64(sourceRelative)+length > sourceSize {
+					return nil, fmt.Errorf("BPS source copy out of range")
+				}
+
+				copy(output[outputOffset:], rom[sourceRelative:uint64(sourceRelative)+length])
+				sourceRelative += int64(length)
+			} else {
+				targetRelative += relative
+
+				if targetRelative < 0 || uint64(targetRelative) >= outputOffset {
+					return nil, fmt.Errorf("BPS target copy out of range")
+				}
+
+				// Copied byte by byte as the source and destination may overlap
+				for i := uint64(0); i < length; i++ {
+					output[outputOffset+i] = output[targetRelative]
+					targetRelative++
+				}
+			}
+		}
+
+		outputOffset += length
+	}
+
+	if crc32.ChecksumIEEE(output) != targetCRC {
+		return nil, fmt.Errorf("patched ROM checksum does not match BPS patch target %08X", targetCRC)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,94 @@
+package patch
+
+import "fmt"
+
+var (
+	ipsMagic = []byte("PATCH")
+	ipsEOF   = []byte("EOF")
+)
+
+/*
+*
+IPS patches are a list of records each starting with a 24-bit big-endian
+offset and a 16-bit size followed by that many bytes to write at the offset.
+
+A size of zero marks a RLE record, in which case a 16-bit run length and a
+single byte to repeat follow instead.
+
+The patch ends with the ASCII "EOF" marker, which may be followed by the
+unofficial truncate extension: a 24-bit length to cut the patched file to.
+*
+*/
+func ApplyIPS(rom []byte, patch []byte) ([]byte, error) {
+	output := append([]byte(nil), rom...)
+	offset := len(ipsMagic)
+
+	read := func(size int) ([]byte, error) {
+		if offset+size > len(patch) {
+			return nil, fmt.Errorf("unexpected end of IPS patch at offset %d", offset)
+		}
+
+		data := patch[offset : offset+size]
+		offset += size
+
+		return data, nil
+	}
+
+	for {
+		record, err := read(3)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if string(record) == string(ipsEOF) {
+			break
+		}
+
+		address := int(record[0])<<16 | int(record[1])<<8 | int(record[2])
+
+		sizeBytes, err := read(2)
+
+		if err != nil {
+			return nil, err
+		}
+
+		size := int(sizeBytes[0])<<8 | int(sizeBytes[1])
+
+		var data []byte
+
+		if size == 0 {
+			rle, err := read(3)
+
+			if err != nil {
+				return nil, err
+			}
+
+			size = int(rle[0])<<8 | int(rle[1])
+			data = make([]byte, size)
+
+			for i := range data {
+				data[i] = rle[2]
+			}
+		} else if data, err = read(size); err != nil {
+			return nil, err
+		}
+
+		if address+size > len(output) {
+			output = append(output, make([]byte, address+size-len(output))...)
+		}
+
+		copy(output[address:], data)
+	}
+
+	// Truncate extension
+	if len(patch)-offset >= 3 {
+		length := int(patch[offset])<<16 | int(patch[offset+1])<<8 | int(patch[offset+2])
+
+		if length < len(output) {
+			output = output[:length]
+		}
+	}
+
+	return output, nil
+}
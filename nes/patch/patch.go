@@ -0,0 +1,96 @@
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File extensions of the supported soft-patch formats, in the order they
+// are searched for when looking for patches next to a ROM.
+var Extensions = []string{".ips", ".ups", ".bps"}
+
+// Largest ROM a UPS or BPS patch may produce or a header may describe, well
+// beyond any real cartridge, so corrupt or crafted input can't make us
+// allocate an arbitrary amount
+const MaxROMSize = 64 << 20
+
+// Applies patch to rom returning the patched image, the patch format is
+// detected from its header. rom is never modified in place.
+func Apply(rom []byte, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, ipsMagic):
+		return ApplyIPS(rom, patch)
+	case bytes.HasPrefix(patch, upsMagic):
+		return ApplyUPS(rom, patch)
+	case bytes.HasPrefix(patch, bpsMagic):
+		return ApplyBPS(rom, patch)
+	default:
+		return nil, fmt.Errorf("unrecognised patch format")
+	}
+}
+
+// Reads and applies each patch file in patchPaths to rom in order.
+func ApplyFiles(rom []byte, patchPaths ...string) ([]byte, error) {
+	for _, patchPath := range patchPaths {
+		patch, err := os.ReadFile(patchPath)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read patch file %s: %s", patchPath, err)
+		}
+
+		rom, err = Apply(rom, patch)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply patch %s: %s", patchPath, err)
+		}
+	}
+
+	return rom, nil
+}
+
+// Returns the paths of patch files sharing romPath's base name that sit in
+// the same directory as the ROM, e.g. "Game.ips" for "Game.nes" or "Game.zip".
+func Find(romPath string) []string {
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+
+	var patchPaths []string
+
+	for _, extension := range Extensions {
+		for _, candidate := range []string{base + extension, base + strings.ToUpper(extension)} {
+			if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+				patchPaths = append(patchPaths, candidate)
+				break
+			}
+		}
+	}
+
+	return patchPaths
+}
+
+// Decodes the variable length integers used by the UPS and BPS formats, each
+// byte holds 7 bits of the value with the high bit set on the final byte.
+func decodeNumber(patch []byte, offset *int) (uint64, error) {
+	var value uint64
+	var shift uint64 = 1
+
+	for {
+		if *offset >= len(patch) {
+			return 0, fmt.Errorf("unexpected end of patch data")
+		}
+
+		x := patch[*offset]
+		*offset++
+
+		value += uint64(x&0x7F) * shift
+
+		if x&0x80 != 0 {
+			return value, nil
+		}
+
+		shift <<= 7
+		value += shift
+	}
+}
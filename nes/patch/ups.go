@@ -0,0 +1,104 @@
+package patch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+var upsMagic = []byte("UPS1")
+
+/*
+*
+UPS patches store the input and output sizes followed by a series of hunks,
+each made up of a relative offset to skip and bytes to XOR onto the file
+terminated by a zero byte. A footer holds CRC32s of the input, output and
+patch itself.
+
+As the patch is an XOR of the two files it can be applied in either direction,
+the direction is chosen by matching the ROM against the input and output CRC32s.
+*
+*/
+func ApplyUPS(rom []byte, patch []byte) ([]byte, error) {
+	if len(patch) < len(upsMagic)+12 {
+		return nil, fmt.Errorf("UPS patch is too small")
+	}
+
+	footer := patch[len(patch)-12:]
+	inputCRC := binary.LittleEndian.Uint32(footer[0:4])
+	outputCRC := binary.LittleEndian.Uint32(footer[4:8])
+	patchCRC := binary.LittleEndian.Uint32(footer[8:12])
+
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != patchCRC {
+		return nil, fmt.Errorf("UPS patch checksum mismatch, patch is corrupt")
+	}
+
+	offset := len(upsMagic)
+
+	inputSize, err := decodeNumber(patch, &offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	outputSize, err := decodeNumber(patch, &offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	romCRC := crc32.ChecksumIEEE(rom)
+
+	switch {
+	case uint64(len(rom)) == inputSize && romCRC == inputCRC:
+	case uint64(len(rom)) == outputSize && romCRC == outputCRC:
+		inputSize, outputSize = outputSize, inputSize
+		inputCRC, outputCRC = outputCRC, inputCRC
+	default:
+		return nil, fmt.Errorf("ROM checksum %08X does not match UPS patch source %08X", romCRC, inputCRC)
+	}
+
+	if outputSize > MaxROMSize {
+		return nil, fmt.Errorf("UPS patch output size %d is larger than the %d byte limit", outputSize, MaxROMSize)
+	}
+
+	output := make([]byte, outputSize)
+	copy(output, rom)
+
+	position := uint64(0)
+
+	for offset < len(patch)-12 {
+		skip, err := decodeNumber(patch, &offset)
+
+		if err != nil {
+			return nil, err
+		}
+
+		position += skip
+
+		for {
+			if offset >= len(patch)-12 {
+				return nil, fmt.Errorf("unexpected end of UPS patch hunk")
+			}
+
+			x := patch[offset]
+			offset++
+
+			if position < outputSize {
+				output[position] ^= x
+			}
+
+			position++
+
+			if x == 0 {
+				break
+			}
+		}
+	}
+
+	if crc32.ChecksumIEEE(output) != outputCRC {
+		return nil, fmt.Errorf("patched ROM checksum does not match UPS patch target %08X", outputCRC)
+	}
+
+	return output, nil
+}
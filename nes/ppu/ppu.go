@@ -4,7 +4,6 @@ import (
 	"gonesem/nes/cartridge"
 	"image"
 	"image/color"
-	"math/rand"
 )
 
 type PPU struct {
@@ -20,7 +19,10 @@ type PPU struct {
 
 	dataBuffer uint8 // Temporary databuffer used in 1 CPU cycle PPU data read delay
 
-	EmitNMI bool
+	suppressVBlank bool // PPUSTATUS was read the dot before vertical blank starts, which keeps it from starting this frame
+
+	oam        [256]uint8 // Object attribute memory, 64 sprites of 4 bytes
+	oamAddress uint8
 
 	nameTable    [2048]uint8
 	paletteTable [32]uint8
@@ -29,15 +31,42 @@ type PPU struct {
 
 	frame         *image.RGBA
 	frameComplete bool
+
+	lastScanline   int16 // Scanline before the pre-render scanline, 260 on NTSC and 310 on PAL and Dendy
+	vblankScanline int16 // Scanline vertical blank starts on, 241 except on Dendy where it's 291
+
+	noise uint32 // Xorshift state for the placeholder static until rendering is implemented
+
+	busCallback func(addr uint16, value uint8, write bool) // Called after every access to video memory
 }
 
+// Creates a PPU with the frame timing of the cartridge's region, cartridges
+// that run on either region get NTSC timing
 func NewPPU(cartridge *cartridge.Cartridge, colorPalette [64]color.RGBA) *PPU {
-	return &PPU{
+	ppu := &PPU{
 		cartridge:     cartridge,
 		colorPalette:  colorPalette,
 		addressLatch:  false,
 		frameComplete: false,
 		frame:         image.NewRGBA(image.Rect(0, 0, 256, 240)),
+		noise:         0x2A03,
+	}
+
+	ppu.setRegion(cartridge.Info().Region)
+
+	return ppu
+}
+
+// PAL and Dendy PPUs draw 312 scanlines, the Dendy's with the 50 extra lines
+// before vertical blank rather than during it
+func (ppu *PPU) setRegion(region cartridge.Region) {
+	ppu.lastScanline, ppu.vblankScanline = 260, 241
+
+	switch region {
+	case cartridge.RegionPAL:
+		ppu.lastScanline = 310
+	case cartridge.RegionDendy:
+		ppu.lastScanline, ppu.vblankScanline = 310, 291
 	}
 }
 
@@ -62,12 +91,18 @@ func (ppu *PPU) Read(addr uint16) uint8 {
 	case 0x0002: // Status
 		value = (uint8(ppu.status) & 0xE0) | (ppu.dataBuffer & 0x1F)
 
+		// Reading the dot before the flag is set races with setting it, the
+		// flag reads clear and stays clear for the rest of the frame
+		if ppu.scanline == ppu.vblankScanline && ppu.cycle == 1 {
+			ppu.suppressVBlank = true
+		}
+
 		ppu.setStatus(StatusVerticalBlank, false)
 		ppu.addressLatch = false
 	case 0x0003: // OAM Address
 		break
 	case 0x0004: // OAM Data
-		break
+		value = ppu.readOAM()
 	case 0x0005: // Scroll
 		break
 	case 0x0006: // PPU Address
@@ -86,6 +121,25 @@ func (ppu *PPU) Read(addr uint16) uint8 {
 	return value
 }
 
+// Returns what Read would for addr without changing the PPU's state, so
+// peeking the status register leaves vertical blank and the latch alone
+func (ppu *PPU) Peek(addr uint16) uint8 {
+	switch addr {
+	case 0x0002: // Status
+		return (uint8(ppu.status) & 0xE0) | (ppu.dataBuffer & 0x1F)
+	case 0x0004: // OAM Data
+		return ppu.readOAM()
+	case 0x0007: // PPU Data
+		if ppu.memoryAddress >= 0x3F00 {
+			return ppu.PeekMemory(ppu.memoryAddress)
+		}
+
+		return ppu.dataBuffer
+	}
+
+	return 0
+}
+
 /*
 *
 Used by the CPU to write information to the PPU's registers or memory
@@ -100,9 +154,10 @@ func (ppu *PPU) Write(addr uint16, value uint8) {
 	case 0x0002: // Status
 		break
 	case 0x0003: // OAM Address
-		break
+		ppu.oamAddress = value
 	case 0x0004: // OAM Data
-		break
+		ppu.oam[ppu.oamAddress] = value
+		ppu.oamAddress++
 	case 0x0005: // Scroll
 		break
 	case 0x0006: // PPU Address
@@ -119,12 +174,35 @@ func (ppu *PPU) Write(addr uint16, value uint8) {
 	}
 }
 
+// Sprite attribute bytes have no storage for bits 2-4, which read back as 0.
+// Reads don't increment the address.
+func (ppu *PPU) readOAM() uint8 {
+	value := ppu.oam[ppu.oamAddress]
+
+	if ppu.oamAddress&0x03 == 0x02 {
+		value &= 0xE3
+	}
+
+	return value
+}
+
 /*
 *
 Used for reading from PPU's internal video memory, used in conjunction with
 writeMemory method to represent the PPU's internal bus and the memory available on that.
 */
 func (ppu *PPU) readMemory(addr uint16) uint8 {
+	value := ppu.readBus(addr)
+
+	if ppu.busCallback != nil {
+		ppu.busCallback(addr, value, false)
+	}
+
+	return value
+}
+
+// Reads addr without calling the bus callback
+func (ppu *PPU) readBus(addr uint16) uint8 {
 	switch {
 	// Pattern memory address space, i.e. CHR memory found on cartidge
 	case addr <= 0x1FFF:
@@ -146,12 +224,31 @@ func (ppu *PPU) readMemory(addr uint16) uint8 {
 	return 0
 }
 
+// Reads addr from video memory without calling the bus callback or any side
+// effects of the mapper's CHR reads
+func (ppu *PPU) PeekMemory(addr uint16) uint8 {
+	if addr <= 0x1FFF {
+		return ppu.cartridge.CHRPeek(addr)
+	}
+
+	return ppu.readBus(addr)
+}
+
 /*
 *
 Used for writing to PPU's internal video memory, used in conjunction with
 readMemory method to represent the PPU's internal bus and the memory available on that.
 */
 func (ppu *PPU) writeMemory(addr uint16, value uint8) {
+	ppu.writeBus(addr, value)
+
+	if ppu.busCallback != nil {
+		ppu.busCallback(addr, value, true)
+	}
+}
+
+// Writes addr without calling the bus callback
+func (ppu *PPU) writeBus(addr uint16, value uint8) {
 	switch {
 	// Pattern memory address space, i.e. CHR memory found on cartidge
 	// NOTE. Generally the cartridge contains ROM, however writes can be done
@@ -175,7 +272,11 @@ func (ppu *PPU) writeMemory(addr uint16, value uint8) {
 
 func (ppu *PPU) Clock() {
 	if (ppu.scanline >= 0 && ppu.scanline < 240) && (ppu.cycle >= 1 || ppu.cycle <= 256) {
-		ppu.frame.Set(int(ppu.cycle), int(ppu.scanline), ppu.colorPalette[rand.Intn(len(ppu.colorPalette))])
+		ppu.noise ^= ppu.noise << 13
+		ppu.noise ^= ppu.noise >> 17
+		ppu.noise ^= ppu.noise << 5
+
+		ppu.frame.SetRGBA(int(ppu.cycle), int(ppu.scanline), ppu.colorPalette[ppu.noise%uint32(len(ppu.colorPalette))])
 	}
 
 	// ------------------- //
@@ -196,12 +297,9 @@ func (ppu *PPU) Clock() {
 	// Post-render scanlines //
 	// --------------------- //
 
-	if ppu.scanline == 241 && ppu.cycle == 1 {
-		ppu.setStatus(StatusVerticalBlank, true)
-
-		if ppu.getCtrl(CtrlGenerateNMI) {
-			ppu.EmitNMI = true
-		}
+	if ppu.scanline == ppu.vblankScanline && ppu.cycle == 1 {
+		ppu.setStatus(StatusVerticalBlank, !ppu.suppressVBlank)
+		ppu.suppressVBlank = false
 	}
 
 	ppu.cycle++
@@ -211,13 +309,58 @@ func (ppu *PPU) Clock() {
 
 		ppu.scanline++
 
-		if ppu.scanline >= 261 {
+		if ppu.scanline > ppu.lastScanline {
 			ppu.scanline = -1
 			ppu.frameComplete = true
 		}
 	}
 }
 
+// Puts the PPU in its state after the reset button is pressed, VRAM is left untouched
+func (ppu *PPU) Reset() {
+	ppu.ctrl = 0
+	ppu.mask = 0
+	ppu.addressLatch = false
+	ppu.dataBuffer = 0
+	ppu.scanline = 0
+	ppu.cycle = 0
+	ppu.suppressVBlank = false
+}
+
+// Sets a function called after every read or write of video memory, with the
+// value read or written, nil removes it
+func (ppu *PPU) SetBusCallback(callback func(addr uint16, value uint8, write bool)) {
+	ppu.busCallback = callback
+}
+
+// Returns the level of the PPU's NMI output, asserted while in vertical blank
+// with NMIs enabled. The CPU takes an NMI on each rising edge, so enabling
+// NMIs during vertical blank causes one and reading PPUSTATUS before the CPU
+// sees the edge suppresses it.
+func (ppu *PPU) NMI() bool {
+	return ppu.status&StatusVerticalBlank != 0 && ppu.getCtrl(CtrlGenerateNMI)
+}
+
+// Returns the control, mask and status registers without side effects
+func (ppu *PPU) Registers() (Ctrl, Mask, Status) {
+	return ppu.ctrl, ppu.mask, ppu.status
+}
+
+// Returns a copy of the object attribute memory
+func (ppu *PPU) OAM() [256]uint8 {
+	return ppu.oam
+}
+
+// Returns the scanline being drawn, -1 for the pre-render scanline, and the
+// dot within it
+func (ppu *PPU) Position() (int, int) {
+	return int(ppu.scanline), int(ppu.cycle)
+}
+
+func (ppu *PPU) ColorPalette() [64]color.RGBA {
+	return ppu.colorPalette
+}
+
 func (ppu *PPU) IsFrameComplete() bool {
 	return ppu.frameComplete
 }
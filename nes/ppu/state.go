@@ -0,0 +1,97 @@
+package ppu
+
+import (
+	"fmt"
+	"gonesem/nes/state"
+)
+
+var ChunkID = state.ChunkID{'P', 'P', 'U', ' '}
+
+func (ppu *PPU) SaveState(writer *state.Writer) {
+	writer.BeginChunk(ChunkID, 1)
+
+	writer.Uint8(uint8(ppu.ctrl))
+	writer.Uint8(uint8(ppu.mask))
+	writer.Uint8(uint8(ppu.status))
+	writer.Int16(ppu.scanline)
+	writer.Int16(ppu.cycle)
+	writer.Uint16(ppu.memoryAddress)
+	writer.Bool(ppu.addressLatch)
+	writer.Uint8(ppu.dataBuffer)
+	writer.Bool(false) // Formerly the pending NMI, now derived from the registers, see NMI
+	writer.Bytes32(ppu.nameTable[:])
+	writer.Bytes32(ppu.paletteTable[:])
+	writer.Bytes32(ppu.frame.Pix)
+	writer.Bool(ppu.frameComplete)
+	writer.Uint32(ppu.noise)
+	writer.Bytes32(ppu.oam[:])
+	writer.Uint8(ppu.oamAddress)
+	writer.Bool(ppu.suppressVBlank)
+}
+
+// Returns an error if LoadState would fail, without changing the PPU
+func (ppu *PPU) CheckState(chunk state.Chunk) error {
+	// ctrl, mask, status, scanline, cycle, memoryAddress, addressLatch,
+	// dataBuffer and the former pending NMI precede the memories
+	chunk.Skip(12)
+
+	if err := chunk.CheckBytes32(len(ppu.nameTable)); err != nil {
+		return fmt.Errorf("nametables: %s", err)
+	}
+
+	if err := chunk.CheckBytes32(len(ppu.paletteTable)); err != nil {
+		return fmt.Errorf("palette: %s", err)
+	}
+
+	if err := chunk.CheckBytes32(len(ppu.frame.Pix)); err != nil {
+		return fmt.Errorf("frame buffer: %s", err)
+	}
+
+	// frameComplete and noise
+	chunk.Skip(5)
+
+	if err := chunk.CheckBytes32(len(ppu.oam)); err != nil {
+		return fmt.Errorf("OAM: %s", err)
+	}
+
+	return nil
+}
+
+func (ppu *PPU) LoadState(chunk *state.Chunk) error {
+	ppu.ctrl = Ctrl(chunk.Uint8())
+	ppu.mask = Mask(chunk.Uint8())
+	ppu.status = Status(chunk.Uint8())
+	ppu.scanline = chunk.Int16()
+	ppu.cycle = chunk.Int16()
+	ppu.memoryAddress = chunk.Uint16()
+	ppu.addressLatch = chunk.Bool()
+	ppu.dataBuffer = chunk.Uint8()
+	chunk.Skip(1)
+
+	if err := chunk.Bytes32(ppu.nameTable[:]); err != nil {
+		return fmt.Errorf("nametables: %s", err)
+	}
+
+	if err := chunk.Bytes32(ppu.paletteTable[:]); err != nil {
+		return fmt.Errorf("palette: %s", err)
+	}
+
+	if err := chunk.Bytes32(ppu.frame.Pix); err != nil {
+		return fmt.Errorf("frame buffer: %s", err)
+	}
+
+	ppu.frameComplete = chunk.Bool()
+
+	if noise := chunk.Uint32(); noise != 0 {
+		ppu.noise = noise
+	}
+
+	if err := chunk.Bytes32(ppu.oam[:]); err != nil {
+		return fmt.Errorf("OAM: %s", err)
+	}
+
+	ppu.oamAddress = chunk.Uint8()
+	ppu.suppressVBlank = chunk.Bool()
+
+	return nil
+}
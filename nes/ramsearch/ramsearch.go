@@ -0,0 +1,200 @@
+package ramsearch
+
+import "fmt"
+
+const ramSize = 2048
+
+type Size uint8
+
+const (
+	Size8  Size = 1 // Single byte values
+	Size16 Size = 2 // Little-endian 16-bit values
+)
+
+type Comparison uint8
+
+const (
+	Equal Comparison = iota
+	NotEqual
+	Greater
+	Less
+	GreaterOrEqual
+	LessOrEqual
+	ChangedBy // Value changed by exactly N since the previous snapshot
+)
+
+var comparisonNames = map[string]Comparison{
+	"eq":         Equal,
+	"ne":         NotEqual,
+	"gt":         Greater,
+	"lt":         Less,
+	"ge":         GreaterOrEqual,
+	"le":         LessOrEqual,
+	"changed-by": ChangedBy,
+}
+
+// Parses the short comparison names used by tooling, e.g. "eq", "gt" or "changed-by"
+func ParseComparison(name string) (Comparison, error) {
+	comparison, ok := comparisonNames[name]
+
+	if !ok {
+		return 0, fmt.Errorf("unknown comparison %q", name)
+	}
+
+	return comparison, nil
+}
+
+type Candidate struct {
+	Address  uint16
+	Value    int // Value in the latest snapshot
+	Previous int // Value in the snapshot before it
+}
+
+/*
+*
+Narrows down the RAM addresses holding a value by repeatedly snapshotting
+RAM and discarding addresses whose value doesn't satisfy a comparison.
+
+Each filter compares either against the previous snapshot, e.g. "the value is
+less than it was" after losing a life, or against a known value.
+*
+*/
+type Search struct {
+	size       Size
+	signed     bool
+	previous   [ramSize]uint8
+	current    [ramSize]uint8
+	candidates []uint16
+}
+
+// Starts a search over every address of ram for values of size and signedness
+func New(ram [ramSize]uint8, size Size, signed bool) *Search {
+	search := &Search{size: size, signed: signed}
+	search.Reset(ram)
+
+	return search
+}
+
+// Restarts the search with every address as a candidate
+func (search *Search) Reset(ram [ramSize]uint8) {
+	search.previous = ram
+	search.current = ram
+	search.candidates = search.candidates[:0]
+
+	for addr := 0; addr+int(search.size) <= ramSize; addr++ {
+		search.candidates = append(search.candidates, uint16(addr))
+	}
+}
+
+// Changes the value size and signedness, restarting the search from ram
+func (search *Search) SetSize(ram [ramSize]uint8, size Size, signed bool) {
+	search.size = size
+	search.signed = signed
+	search.Reset(ram)
+}
+
+// Takes a new snapshot and keeps the candidates whose new value compares to
+// their previous value, for ChangedBy n is the expected difference
+func (search *Search) FilterPrevious(ram [ramSize]uint8, comparison Comparison, n int) {
+	search.snapshot(ram)
+
+	search.filter(func(addr uint16) bool {
+		value := search.value(&search.current, addr)
+		previous := search.value(&search.previous, addr)
+
+		// Differences wrap like the values do, so $01 to $FF is a change by -2
+		if comparison == ChangedBy {
+			return (value-previous-n)&(1<<(8*search.size)-1) == 0
+		}
+
+		return compare(value, previous, comparison)
+	})
+}
+
+// Takes a new snapshot and keeps the candidates whose new value compares to value
+func (search *Search) FilterValue(ram [ramSize]uint8, comparison Comparison, value int) error {
+	if comparison == ChangedBy {
+		return fmt.Errorf("changed-by compares against the previous snapshot, not a value")
+	}
+
+	search.snapshot(ram)
+
+	search.filter(func(addr uint16) bool {
+		return compare(search.value(&search.current, addr), value, comparison)
+	})
+
+	return nil
+}
+
+func (search *Search) Count() int {
+	return len(search.candidates)
+}
+
+// Returns the remaining candidates in address order
+func (search *Search) Candidates() []Candidate {
+	candidates := make([]Candidate, len(search.candidates))
+
+	for i, addr := range search.candidates {
+		candidates[i] = Candidate{
+			Address:  addr,
+			Value:    search.value(&search.current, addr),
+			Previous: search.value(&search.previous, addr),
+		}
+	}
+
+	return candidates
+}
+
+func (search *Search) snapshot(ram [ramSize]uint8) {
+	search.previous = search.current
+	search.current = ram
+}
+
+func (search *Search) filter(keep func(addr uint16) bool) {
+	remaining := search.candidates[:0]
+
+	for _, addr := range search.candidates {
+		if keep(addr) {
+			remaining = append(remaining, addr)
+		}
+	}
+
+	search.candidates = remaining
+}
+
+func (search *Search) value(ram *[ramSize]uint8, addr uint16) int {
+	if search.size == Size16 {
+		value := uint16(ram[addr]) | uint16(ram[addr+1])<<8
+
+		if search.signed {
+			return int(int16(value))
+		}
+
+		return int(value)
+	}
+
+	if search.signed {
+		return int(int8(ram[addr]))
+	}
+
+	return int(ram[addr])
+}
+
+func compare(a int, b int, comparison Comparison) bool {
+	switch comparison {
+	case Equal:
+		return a == b
+	case NotEqual:
+		return a != b
+	case Greater:
+		return a > b
+	case Less:
+		return a < b
+	case GreaterOrEqual:
+		return a >= b
+	case LessOrEqual:
+		return a <= b
+	default:
+		return false
+	}
+}
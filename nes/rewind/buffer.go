@@ -0,0 +1,190 @@
+package rewind
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+/*
+*
+History of save states kept as compressed deltas to bound memory use.
+
+Only the newest state is held in full. Each older state is stored as the XOR
+of itself with the state that followed it, which is mostly zeros between
+neighbouring frames and so compresses well:
+
+	oldest                                           newest
+	| delta 0 | delta 1 | ... | delta n-1 |  current (full) |
+
+Popping XORs the newest delta onto the current state to recover the one
+before it. Deltas are only ever needed newest first, so when the memory limit
+is reached the oldest deltas are simply dropped.
+*
+*/
+type Buffer struct {
+	memoryLimit int
+
+	current []byte
+	deltas  []delta // Ring of deltas, oldest at head
+	head    int
+	count   int
+	size    int // Bytes held by current and all deltas
+
+	scratch    []byte
+	compressed bytes.Buffer
+	compressor *flate.Writer
+	inflater   io.ReadCloser
+}
+
+type delta struct {
+	length int    // Length of the older state
+	data   []byte // Compressed XOR of the older state and the state after it
+}
+
+// Returns a buffer holding at most memoryLimit bytes of state history
+func NewBuffer(memoryLimit int) *Buffer {
+	compressor, _ := flate.NewWriter(nil, flate.BestSpeed)
+
+	return &Buffer{
+		memoryLimit: memoryLimit,
+		compressor:  compressor,
+		inflater:    flate.NewReader(nil),
+	}
+}
+
+// Returns the number of states that can currently be popped
+func (buffer *Buffer) Len() int {
+	return buffer.count
+}
+
+// Returns the bytes held by the buffer
+func (buffer *Buffer) Size() int {
+	return buffer.size
+}
+
+// Returns the newest state, nil if nothing has been pushed
+func (buffer *Buffer) Current() []byte {
+	return buffer.current
+}
+
+// Adds state as the newest state, state is copied and may be reused by the caller
+func (buffer *Buffer) Push(state []byte) {
+	if buffer.current != nil {
+		buffer.pushDelta(buffer.xor(buffer.current, state), len(buffer.current))
+	}
+
+	buffer.size += len(state) - len(buffer.current)
+	buffer.current = append(buffer.current[:0], state...)
+
+	for buffer.size > buffer.memoryLimit && buffer.count > 0 {
+		buffer.dropOldest()
+	}
+}
+
+// Discards the newest state and returns the one before it, ok is false when
+// there is no older state. The returned slice is only valid until the next call.
+func (buffer *Buffer) Pop() (state []byte, ok bool, err error) {
+	if buffer.count == 0 {
+		return nil, false, nil
+	}
+
+	index := (buffer.head + buffer.count - 1) % len(buffer.deltas)
+	entry := buffer.deltas[index]
+
+	buffer.inflater.(flate.Resetter).Reset(bytes.NewReader(entry.data), nil)
+
+	buffer.scratch = resize(buffer.scratch, max(len(buffer.current), entry.length))
+
+	if _, err := io.ReadFull(buffer.inflater, buffer.scratch); err != nil {
+		return nil, false, fmt.Errorf("failed to decompress rewind state: %s", err)
+	}
+
+	older := buffer.scratch
+
+	for i := range buffer.current {
+		older[i] ^= buffer.current[i]
+	}
+
+	buffer.deltas[index] = delta{}
+	buffer.count--
+	buffer.size -= len(entry.data) + len(buffer.current) - entry.length
+
+	buffer.current = append(buffer.current[:0], older[:entry.length]...)
+
+	return buffer.current, true, nil
+}
+
+// Drops every state
+func (buffer *Buffer) Clear() {
+	for i := range buffer.deltas {
+		buffer.deltas[i] = delta{}
+	}
+
+	buffer.current = nil
+	buffer.head = 0
+	buffer.count = 0
+	buffer.size = 0
+}
+
+// XORs a and b into the scratch buffer, padding the shorter with zeros
+func (buffer *Buffer) xor(a []byte, b []byte) []byte {
+	buffer.scratch = resize(buffer.scratch, max(len(a), len(b)))
+
+	copy(buffer.scratch, a)
+
+	for i := range b {
+		buffer.scratch[i] ^= b[i]
+	}
+
+	return buffer.scratch
+}
+
+func (buffer *Buffer) pushDelta(xored []byte, length int) {
+	buffer.compressed.Reset()
+	buffer.compressor.Reset(&buffer.compressed)
+
+	buffer.compressor.Write(xored)
+	buffer.compressor.Close()
+
+	if buffer.count == len(buffer.deltas) {
+		buffer.grow()
+	}
+
+	data := append([]byte(nil), buffer.compressed.Bytes()...)
+
+	buffer.deltas[(buffer.head+buffer.count)%len(buffer.deltas)] = delta{length: length, data: data}
+	buffer.count++
+	buffer.size += len(data)
+}
+
+func (buffer *Buffer) dropOldest() {
+	buffer.size -= len(buffer.deltas[buffer.head].data)
+	buffer.deltas[buffer.head] = delta{}
+	buffer.head = (buffer.head + 1) % len(buffer.deltas)
+	buffer.count--
+}
+
+func (buffer *Buffer) grow() {
+	deltas := make([]delta, max(16, len(buffer.deltas)*2))
+
+	for i := 0; i < buffer.count; i++ {
+		deltas[i] = buffer.deltas[(buffer.head+i)%len(buffer.deltas)]
+	}
+
+	buffer.deltas = deltas
+	buffer.head = 0
+}
+
+// Returns buf resized to n zeroed bytes, reusing its storage when large enough
+func resize(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+
+	buf = buf[:n]
+	clear(buf)
+
+	return buf
+}
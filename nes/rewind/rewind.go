@@ -0,0 +1,88 @@
+package rewind
+
+import (
+	"fmt"
+	"gonesem/nes"
+)
+
+type Config struct {
+	Interval    int // Frames between snapshots, 1 rewinds frame by frame
+	MemoryLimit int // Bytes of compressed history to keep
+}
+
+var DefaultConfig = Config{
+	Interval:    1,
+	MemoryLimit: 64 << 20,
+}
+
+// Records the state of a console as it runs so it can be stepped backwards,
+// independent of any frontend
+type Rewinder struct {
+	console       *nes.NES
+	config        Config
+	buffer        *Buffer
+	sinceSnapshot int
+	snapshot      []byte
+}
+
+func New(console *nes.NES, config Config) *Rewinder {
+	if config.Interval < 1 {
+		config.Interval = 1
+	}
+
+	return &Rewinder{
+		console: console,
+		config:  config,
+		buffer:  NewBuffer(config.MemoryLimit),
+	}
+}
+
+// Snapshots the console every Interval frames, call once after each emulated frame
+func (rewinder *Rewinder) Frame() {
+	rewinder.sinceSnapshot++
+
+	if rewinder.buffer.Current() != nil && rewinder.sinceSnapshot < rewinder.config.Interval {
+		return
+	}
+
+	rewinder.snapshot = rewinder.console.AppendState(rewinder.snapshot[:0])
+	rewinder.buffer.Push(rewinder.snapshot)
+	rewinder.sinceSnapshot = 0
+}
+
+// Steps the console back one snapshot, returning false once the history is exhausted
+func (rewinder *Rewinder) Rewind() (bool, error) {
+	// Return to the newest snapshot first if the console has run past it
+	if rewinder.sinceSnapshot > 0 && rewinder.buffer.Current() != nil {
+		rewinder.sinceSnapshot = 0
+
+		return true, rewinder.load(rewinder.buffer.Current())
+	}
+
+	state, ok, err := rewinder.buffer.Pop()
+
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, rewinder.load(state)
+}
+
+// Drops the recorded history, e.g. after loading a save state or resetting
+func (rewinder *Rewinder) Clear() {
+	rewinder.buffer.Clear()
+	rewinder.sinceSnapshot = 0
+}
+
+// Returns the number of snapshots that can be rewound and the bytes they occupy
+func (rewinder *Rewinder) Stats() (snapshots int, size int) {
+	return rewinder.buffer.Len(), rewinder.buffer.Size()
+}
+
+func (rewinder *Rewinder) load(state []byte) error {
+	if err := rewinder.console.LoadStateBytes(state); err != nil {
+		return fmt.Errorf("failed to restore rewind state: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package runahead
+
+import (
+	"fmt"
+	"gonesem/nes"
+	"image"
+)
+
+type Mode uint8
+
+const (
+	// The console saves its state, runs ahead and restores itself every frame
+	ModeSingleInstance Mode = iota
+	// A second console is synced to the first every frame and runs ahead in
+	// its place, so the first console's own emulation is never rewound
+	ModeSecondInstance
+)
+
+/*
+*
+Run-ahead hides the input lag games build in by emulating frames past the
+current one with the current input and presenting the last of them. Games
+that react to input a frame or more later then appear to react immediately.
+
+In single instance mode each frame is:
+ 1. Emulate the real frame.
+ 2. Save state.
+ 3. Emulate Frames more frames, keeping the last picture.
+ 4. Restore the state saved in 2.
+
+Second instance mode instead loads the real console's state into a shadow
+console for steps 3 and 4, which leaves the real console's own emulation
+running continuously.
+
+Neither mode suppresses audio from the frames run ahead yet: the APU doesn't
+produce samples, so there is nothing to suppress. Once it does, the samples of
+the frames thrown away in step 3 must be discarded in both modes.
+
+Both modes reuse their snapshot buffer and frame so no allocations happen per frame.
+*
+*/
+type RunAhead struct {
+	console  *nes.NES
+	shadow   *nes.NES
+	frames   int
+	mode     Mode
+	snapshot []byte
+	frame    *image.RGBA
+}
+
+// Returns a run-ahead wrapper around console emulating frames ahead, 0 disables run-ahead
+func New(console *nes.NES, frames int, mode Mode) *RunAhead {
+	runAhead := &RunAhead{
+		console: console,
+		mode:    mode,
+		frame:   image.NewRGBA(image.Rect(0, 0, 256, 240)),
+	}
+
+	runAhead.SetFrames(frames)
+
+	return runAhead
+}
+
+// Changes how many frames are emulated ahead, 0 disables run-ahead
+func (runAhead *RunAhead) SetFrames(frames int) {
+	runAhead.frames = max(frames, 0)
+
+	if runAhead.frames > 0 && runAhead.mode == ModeSecondInstance && runAhead.shadow == nil {
+		runAhead.shadow = runAhead.console.Clone()
+	}
+}
+
+func (runAhead *RunAhead) Frames() int {
+	return runAhead.frames
+}
+
+// Emulates the next real frame and returns the picture to present, which is
+// only valid until the next call
+func (runAhead *RunAhead) NextFrame() (*image.RGBA, error) {
+	runAhead.console.NextFrame()
+
+	if runAhead.frames == 0 {
+		return runAhead.console.GetFrame(), nil
+	}
+
+	// Reset the frame complete flag before the snapshot so restored consoles run the next frame
+	runAhead.console.GetFrame()
+	runAhead.snapshot = runAhead.console.AppendState(runAhead.snapshot[:0])
+
+	speculative := runAhead.console
+
+	if runAhead.mode == ModeSecondInstance {
+		speculative = runAhead.shadow
+
+		if err := speculative.LoadStateBytes(runAhead.snapshot); err != nil {
+			return nil, fmt.Errorf("failed to sync run-ahead console: %s", err)
+		}
+	}
+
+	for i := 0; i < runAhead.frames; i++ {
+		speculative.NextFrame()
+		copy(runAhead.frame.Pix, speculative.GetFrame().Pix)
+	}
+
+	if runAhead.mode == ModeSingleInstance {
+		if err := runAhead.console.LoadStateBytes(runAhead.snapshot); err != nil {
+			return nil, fmt.Errorf("failed to restore console after run-ahead: %s", err)
+		}
+	}
+
+	return runAhead.frame, nil
+}
@@ -0,0 +1,186 @@
+package nes
+
+import (
+	"fmt"
+	"gonesem/nes/apu"
+	"gonesem/nes/cartridge"
+	"gonesem/nes/controller"
+	"gonesem/nes/cpu"
+	"gonesem/nes/ppu"
+	"gonesem/nes/state"
+	"io"
+)
+
+var (
+	chunkID    = state.ChunkID{'N', 'E', 'S', ' '}
+	ramChunkID = state.ChunkID{'R', 'A', 'M', ' '}
+)
+
+/*
+*
+Save states capture the whole machine: CPU registers and cycle counters,
+OAM DMA progress, internal RAM, PPU registers, latches, VRAM, OAM and frame
+buffer, the APU frame counter, controller shift registers, and cartridge RAM
+plus mapper registers. See the state package for the format and its
+compatibility rules.
+*
+*/
+
+// Writes a save state of the whole machine to writer
+func (nes *NES) SaveState(writer io.Writer) error {
+	if _, err := writer.Write(nes.AppendState(nil)); err != nil {
+		return fmt.Errorf("failed to write save state: %s", err)
+	}
+
+	return nil
+}
+
+// Restores the machine from a save state read from reader until EOF
+func (nes *NES) LoadState(reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+
+	if err != nil {
+		return fmt.Errorf("failed to read save state: %s", err)
+	}
+
+	return nes.LoadStateBytes(data)
+}
+
+// Appends a save state of the whole machine to buf, passing a reused buffer
+// truncated to zero length takes the snapshot without allocating
+func (nes *NES) AppendState(buf []byte) []byte {
+	// The writer lives in the console as passing it through the mapper
+	// interface would otherwise move it to the heap on every call
+	writer := &nes.stateWriter
+	writer.Reset(buf)
+
+	writer.BeginChunk(chunkID, 1)
+	writer.Uint64(nes.TotalCycles)
+	writer.Uint64(nes.frameCount)
+	writer.Bool(nes.dma.active)
+	writer.Uint8(nes.dma.page)
+	writer.Bool(nes.dma.halted)
+	writer.Bool(nes.dma.read)
+	writer.Uint16(nes.dma.offset)
+	writer.Uint8(nes.dma.value)
+	writer.Bool(nes.nmiLine)
+
+	writer.BeginChunk(ramChunkID, 1)
+	writer.Bytes32(nes.ram[:])
+
+	writer.BeginChunk(controller.ChunkID, 1)
+	nes.controllers[0].SaveState(writer)
+	nes.controllers[1].SaveState(writer)
+
+	nes.cpu.SaveState(writer)
+	nes.ppu.SaveState(writer)
+	nes.apu.SaveState(writer)
+	nes.cartridge.SaveState(writer)
+
+	writer.EndChunk()
+
+	buf = writer.Bytes()
+	*writer = state.Writer{}
+
+	return buf
+}
+
+// Restores the machine from an in-memory save state
+//
+// Every chunk is checked before anything is restored, e.g. that it was saved
+// from the same ROM and its memories have the right sizes, so an invalid
+// state leaves the machine untouched without snapshotting it first.
+func (nes *NES) LoadStateBytes(data []byte) error {
+	reader, err := state.NewReader(data)
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		id, chunk, ok, err := reader.Next()
+
+		if err != nil {
+			return fmt.Errorf("invalid save state: %s", err)
+		}
+
+		if !ok {
+			break
+		}
+
+		if err := nes.checkChunk(id, chunk); err != nil {
+			return fmt.Errorf("failed to load %q save state chunk: %s", id, err)
+		}
+	}
+
+	return nes.restoreState(data)
+}
+
+// Returns an error if loadChunk would fail, without changing the machine
+func (nes *NES) checkChunk(id state.ChunkID, chunk state.Chunk) error {
+	switch id {
+	case ramChunkID:
+		return chunk.CheckBytes32(len(nes.ram))
+	case ppu.ChunkID:
+		return nes.ppu.CheckState(chunk)
+	case cartridge.ChunkID:
+		return nes.cartridge.CheckState(chunk)
+	case cartridge.MapperChunkID:
+		return nes.cartridge.CheckMapperState(chunk)
+	}
+
+	// The remaining chunks hold only fixed size fields, which always load
+	return nil
+}
+
+// Loads every chunk of a state that has already been checked
+func (nes *NES) restoreState(data []byte) error {
+	reader, _ := state.NewReader(data)
+
+	for {
+		id, chunk, ok, _ := reader.Next()
+
+		if !ok {
+			return nil
+		}
+
+		nes.stateChunk = chunk
+
+		if err := nes.loadChunk(id, &nes.stateChunk); err != nil {
+			return fmt.Errorf("failed to load %q save state chunk: %s", id, err)
+		}
+	}
+}
+
+func (nes *NES) loadChunk(id state.ChunkID, chunk *state.Chunk) error {
+	switch id {
+	case chunkID:
+		nes.TotalCycles = chunk.Uint64()
+		nes.frameCount = chunk.Uint64()
+		nes.dma.active = chunk.Bool()
+		nes.dma.page = chunk.Uint8()
+		nes.dma.halted = chunk.Bool()
+		nes.dma.read = chunk.Bool()
+		nes.dma.offset = chunk.Uint16() % 256
+		nes.dma.value = chunk.Uint8()
+		nes.nmiLine = chunk.Bool()
+	case ramChunkID:
+		return chunk.Bytes32(nes.ram[:])
+	case controller.ChunkID:
+		nes.controllers[0].LoadState(chunk)
+		nes.controllers[1].LoadState(chunk)
+	case cpu.ChunkID:
+		return nes.cpu.LoadState(chunk)
+	case ppu.ChunkID:
+		return nes.ppu.LoadState(chunk)
+	case apu.ChunkID:
+		nes.apu.LoadState(chunk)
+	case cartridge.ChunkID:
+		return nes.cartridge.LoadState(chunk)
+	case cartridge.MapperChunkID:
+		return nes.cartridge.LoadMapperState(chunk)
+	}
+
+	// Chunks from newer versions are skipped
+	return nil
+}
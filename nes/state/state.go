@@ -0,0 +1,307 @@
+package state
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+*
+Save states are a small header followed by a list of chunks, one per
+component of the machine:
+
+	|---------------------------------------------|
+	| "GNSS" | Format version (uint16)            |
+	|---------------------------------------------|
+	| Chunk ID (4 bytes) | Version | Length       |
+	| Payload (Length bytes)                      |
+	|---------------------------------------------|
+	| ...                                         |
+	|---------------------------------------------|
+
+All values are little-endian. Compatibility across upgrades rests on three rules:
+* Loaders skip chunks with IDs they don't know, so components can be added.
+* New fields are only ever appended to a chunk, reading past the end of a
+  payload returns zero values so old states load with new fields defaulted.
+* Incompatible changes to a chunk bump its version, letting its loader
+  migrate older layouts.
+
+Writing and reading avoid allocations when the caller reuses the buffer so
+states can be taken every frame, e.g. for rewind or run-ahead.
+*
+*/
+
+const Version uint16 = 1
+
+var magic = [4]byte{'G', 'N', 'S', 'S'}
+
+const (
+	headerSize      = 6
+	chunkHeaderSize = 10
+)
+
+type ChunkID [4]byte
+
+func (id ChunkID) String() string {
+	return string(id[:])
+}
+
+// ------ //
+// Writer //
+// ------ //
+
+type Writer struct {
+	buf        []byte
+	chunkStart int
+}
+
+// Returns a writer appending a save state to buf, which may be a previously
+// used buffer truncated to zero length to avoid allocating
+func NewWriter(buf []byte) Writer {
+	writer := Writer{}
+	writer.Reset(buf)
+
+	return writer
+}
+
+// Starts a new save state appended to buf, letting a long lived writer be reused
+func (writer *Writer) Reset(buf []byte) {
+	buf = append(buf, magic[:]...)
+	buf = binary.LittleEndian.AppendUint16(buf, Version)
+
+	writer.buf = buf
+	writer.chunkStart = -1
+}
+
+func (writer *Writer) Bytes() []byte {
+	return writer.buf
+}
+
+// Starts a new chunk, ending the previous one if still open
+func (writer *Writer) BeginChunk(id ChunkID, version uint16) {
+	writer.EndChunk()
+
+	writer.chunkStart = len(writer.buf)
+	writer.buf = append(writer.buf, id[:]...)
+	writer.buf = binary.LittleEndian.AppendUint16(writer.buf, version)
+	writer.buf = binary.LittleEndian.AppendUint32(writer.buf, 0)
+}
+
+// Ends the current chunk, filling in its length
+func (writer *Writer) EndChunk() {
+	if writer.chunkStart < 0 {
+		return
+	}
+
+	length := len(writer.buf) - writer.chunkStart - chunkHeaderSize
+	binary.LittleEndian.PutUint32(writer.buf[writer.chunkStart+6:], uint32(length))
+
+	writer.chunkStart = -1
+}
+
+func (writer *Writer) Uint8(value uint8) {
+	writer.buf = append(writer.buf, value)
+}
+
+func (writer *Writer) Bool(value bool) {
+	if value {
+		writer.Uint8(1)
+	} else {
+		writer.Uint8(0)
+	}
+}
+
+func (writer *Writer) Uint16(value uint16) {
+	writer.buf = binary.LittleEndian.AppendUint16(writer.buf, value)
+}
+
+func (writer *Writer) Int16(value int16) {
+	writer.Uint16(uint16(value))
+}
+
+func (writer *Writer) Uint32(value uint32) {
+	writer.buf = binary.LittleEndian.AppendUint32(writer.buf, value)
+}
+
+func (writer *Writer) Uint64(value uint64) {
+	writer.buf = binary.LittleEndian.AppendUint64(writer.buf, value)
+}
+
+// Writes a length prefixed byte slice
+func (writer *Writer) Bytes32(data []byte) {
+	writer.Uint32(uint32(len(data)))
+	writer.buf = append(writer.buf, data...)
+}
+
+// ------ //
+// Reader //
+// ------ //
+
+type Reader struct {
+	data    []byte
+	offset  int
+	version uint16
+}
+
+// Validates the header of a save state and prepares to read its chunks
+func NewReader(data []byte) (Reader, error) {
+	if len(data) < headerSize || [4]byte(data[0:4]) != magic {
+		return Reader{}, fmt.Errorf("not a save state")
+	}
+
+	version := binary.LittleEndian.Uint16(data[4:6])
+
+	if version > Version {
+		return Reader{}, fmt.Errorf("save state format version %d is newer than supported version %d", version, Version)
+	}
+
+	return Reader{data: data, offset: headerSize, version: version}, nil
+}
+
+// Returns the format version the state was written with
+func (reader *Reader) Version() uint16 {
+	return reader.version
+}
+
+// Returns the next chunk, ok is false once every chunk has been read
+func (reader *Reader) Next() (id ChunkID, chunk Chunk, ok bool, err error) {
+	if reader.offset >= len(reader.data) {
+		return id, chunk, false, nil
+	}
+
+	if len(reader.data)-reader.offset < chunkHeaderSize {
+		return id, chunk, false, fmt.Errorf("truncated chunk header at offset %d", reader.offset)
+	}
+
+	header := reader.data[reader.offset : reader.offset+chunkHeaderSize]
+	id = ChunkID(header[0:4])
+	version := binary.LittleEndian.Uint16(header[4:6])
+	length := int(binary.LittleEndian.Uint32(header[6:10]))
+
+	start := reader.offset + chunkHeaderSize
+
+	if length > len(reader.data)-start {
+		return id, chunk, false, fmt.Errorf("truncated %q chunk", id)
+	}
+
+	reader.offset = start + length
+
+	return id, Chunk{data: reader.data[start:reader.offset], version: version}, true, nil
+}
+
+// ----- //
+// Chunk //
+// ----- //
+
+// Payload of a single chunk, reads past its end return zero values
+type Chunk struct {
+	data    []byte
+	offset  int
+	version uint16
+}
+
+func (chunk *Chunk) Version() uint16 {
+	return chunk.version
+}
+
+func (chunk *Chunk) take(size int) []byte {
+	if chunk.offset+size > len(chunk.data) {
+		chunk.offset = len(chunk.data)
+		return nil
+	}
+
+	data := chunk.data[chunk.offset : chunk.offset+size]
+	chunk.offset += size
+
+	return data
+}
+
+func (chunk *Chunk) Uint8() uint8 {
+	if data := chunk.take(1); data != nil {
+		return data[0]
+	}
+
+	return 0
+}
+
+func (chunk *Chunk) Bool() bool {
+	return chunk.Uint8() != 0
+}
+
+func (chunk *Chunk) Uint16() uint16 {
+	if data := chunk.take(2); data != nil {
+		return binary.LittleEndian.Uint16(data)
+	}
+
+	return 0
+}
+
+func (chunk *Chunk) Int16() int16 {
+	return int16(chunk.Uint16())
+}
+
+func (chunk *Chunk) Uint32() uint32 {
+	if data := chunk.take(4); data != nil {
+		return binary.LittleEndian.Uint32(data)
+	}
+
+	return 0
+}
+
+func (chunk *Chunk) Uint64() uint64 {
+	if data := chunk.take(8); data != nil {
+		return binary.LittleEndian.Uint64(data)
+	}
+
+	return 0
+}
+
+// Skips size bytes of fields the caller doesn't need
+func (chunk *Chunk) Skip(size int) {
+	chunk.take(size)
+}
+
+// Checks that the next length prefixed byte slice is exactly size bytes and
+// skips it, the counterpart of Bytes32 for checking a state before loading it
+func (chunk *Chunk) CheckBytes32(size int) error {
+	if chunk.offset >= len(chunk.data) {
+		return nil
+	}
+
+	length := int(chunk.Uint32())
+
+	if length != size {
+		return fmt.Errorf("stored size %d does not match expected size %d", length, size)
+	}
+
+	if chunk.take(length) == nil && length > 0 {
+		return fmt.Errorf("truncated data")
+	}
+
+	return nil
+}
+
+// Reads a length prefixed byte slice into dst, which must be exactly the
+// stored length as component memories have fixed sizes. dst is left as is
+// when the chunk ends before the field, i.e. it was added after the state was saved.
+func (chunk *Chunk) Bytes32(dst []byte) error {
+	if chunk.offset >= len(chunk.data) {
+		return nil
+	}
+
+	length := int(chunk.Uint32())
+
+	if length != len(dst) {
+		return fmt.Errorf("stored size %d does not match expected size %d", length, len(dst))
+	}
+
+	data := chunk.take(length)
+
+	if data == nil && length > 0 {
+		return fmt.Errorf("truncated data")
+	}
+
+	copy(dst, data)
+
+	return nil
+}
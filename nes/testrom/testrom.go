@@ -0,0 +1,138 @@
+package testrom
+
+import (
+	"bytes"
+	"fmt"
+	"gonesem/nes"
+	"gonesem/nes/cartridge"
+	"gonesem/nes/color"
+)
+
+/*
+*
+Runs accuracy test ROMs that follow blargg's status protocol in PRG RAM:
+
+	$6000       Status, $80 while running, $81 to request a reset and
+	            the result code once done, 0 meaning passed
+	$6001-$6003 The signature $DE $B0 $61 once the status is valid
+	$6004-      Zero terminated text output
+
+A ROM requesting a reset expects at least 100ms to pass before it is
+pressed, after which it continues the test from its PRG RAM.
+*
+*/
+
+const (
+	StatusPassed       = 0x00
+	StatusRunning      = 0x80
+	StatusResetRequest = 0x81
+)
+
+var signature = []byte{0xDE, 0xB0, 0x61}
+
+type Options struct {
+	MaxFrames   int // Frames to wait for a result before giving up
+	ResetFrames int // Frames to wait after a reset request before pressing reset
+}
+
+var DefaultOptions = Options{
+	MaxFrames:   60 * 60,
+	ResetFrames: 6,
+}
+
+type Result struct {
+	Status  uint8  // Result code written to $6000
+	Message string // Text written from $6004
+	Frames  int    // Frames run until the result was written
+}
+
+func (result Result) Passed() bool {
+	return result.Status == StatusPassed
+}
+
+// Loads rom, runs it headless with options and returns its result
+func RunROM(rom []byte, options Options) (Result, error) {
+	cart, err := cartridge.NewCartridgeFromBytes(rom)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Run(nes.NewNES(cart, color.DefaultPalette), options)
+}
+
+// Runs console until the test ROM in it writes a result, returning an error if
+// none is written within options.MaxFrames
+func Run(console *nes.NES, options Options) (Result, error) {
+	resetCountdown := -1
+	resetPressed := false
+
+	for frame := 1; frame <= options.MaxFrames; frame++ {
+		console.NextFrame()
+		console.GetFrame()
+
+		if pc, halted := console.Halted(); halted {
+			return Result{}, fmt.Errorf("CPU jammed at $%04X after %d frames: %q", pc, frame, readMessage(console))
+		}
+
+		if !hasSignature(console) {
+			continue
+		}
+
+		switch status := console.Peek(0x6000); status {
+		case StatusResetRequest:
+			// Once pressed the request stands until the ROM starts running again
+			if resetPressed {
+				continue
+			}
+
+			if resetCountdown < 0 {
+				resetCountdown = options.ResetFrames
+			}
+
+			if resetCountdown == 0 {
+				console.Reset()
+				resetPressed = true
+			}
+
+			resetCountdown--
+		case StatusRunning:
+			resetCountdown = -1
+			resetPressed = false
+		default:
+			return Result{Status: status, Message: readMessage(console), Frames: frame}, nil
+		}
+	}
+
+	if !hasSignature(console) {
+		return Result{}, fmt.Errorf("no status signature at $6001 after %d frames, the ROM may not use the $6000 protocol", options.MaxFrames)
+	}
+
+	return Result{}, fmt.Errorf("test still running after %d frames: %q", options.MaxFrames, readMessage(console))
+}
+
+func hasSignature(console *nes.NES) bool {
+	for i, value := range signature {
+		if console.Peek(0x6001+uint16(i)) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func readMessage(console *nes.NES) string {
+	var message bytes.Buffer
+
+	for addr := uint16(0x6004); addr < 0x8000; addr++ {
+		value := console.Peek(addr)
+
+		if value == 0 {
+			break
+		}
+
+		message.WriteByte(value)
+	}
+
+	return message.String()
+}
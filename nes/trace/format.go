@@ -0,0 +1,142 @@
+package trace
+
+import (
+	"fmt"
+	"gonesem/nes/cpu"
+	"gonesem/nes/disasm"
+	"strings"
+)
+
+// Formats the line traced for an instruction, without the newline
+type Format func(instruction disasm.Instruction, state State) string
+
+// Formats by name, as accepted by ParseFormat
+var Formats = map[string]Format{
+	"nintendulator": Nintendulator,
+	"mesen":         Mesen,
+	"fceux":         FCEUX,
+}
+
+func ParseFormat(name string) (Format, error) {
+	format, ok := Formats[strings.ToLower(name)]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown trace format %q, expected nintendulator, mesen or fceux", name)
+	}
+
+	return format, nil
+}
+
+/*
+*
+Formats a line like Nintendulator's logs, the format of nestest.log:
+
+	C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+
+The PPU column is left out when tracing a CPU on its own.
+*
+*/
+func Nintendulator(instruction disasm.Instruction, state State) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("%04X  ", state.PC))
+
+	for _, value := range instruction.Bytes {
+		sb.WriteString(fmt.Sprintf("%02X ", value))
+	}
+
+	pad(&sb, 16)
+	sb.WriteString(instruction.String())
+	pad(&sb, 47)
+
+	sb.WriteString(fmt.Sprintf(" A:%02X X:%02X Y:%02X P:%02X SP:%02X", state.A, state.X, state.Y, uint8(state.SR), state.SP))
+
+	if state.HasPPU {
+		sb.WriteString(fmt.Sprintf(" PPU:%3d,%3d", state.Scanline, state.Dot))
+	}
+
+	sb.WriteString(fmt.Sprintf(" CYC:%d", state.Cycles))
+
+	return sb.String()
+}
+
+/*
+*
+Formats a line like Mesen's default trace log:
+
+	C000  $4C $F5 $C5  JMP $C5F5                     A:00 X:00 Y:00 P:24 SP:FD CYC:21  SL:0   FC:0 CPU Cycle:7
+
+The PPU and frame columns are left out when tracing a CPU on its own.
+*
+*/
+func Mesen(instruction disasm.Instruction, state State) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("%04X  ", state.PC))
+
+	for _, value := range instruction.Bytes {
+		sb.WriteString(fmt.Sprintf("$%02X ", value))
+	}
+
+	pad(&sb, 19)
+	sb.WriteString(instruction.String())
+	pad(&sb, 49)
+
+	sb.WriteString(fmt.Sprintf("A:%02X X:%02X Y:%02X P:%02X SP:%02X", state.A, state.X, state.Y, uint8(state.SR), state.SP))
+
+	if state.HasPPU {
+		sb.WriteString(fmt.Sprintf(" CYC:%-3d SL:%-3d FC:%d", state.Dot, state.Scanline, state.Frame))
+	}
+
+	sb.WriteString(fmt.Sprintf(" CPU Cycle:%d", state.Cycles))
+
+	return sb.String()
+}
+
+/*
+*
+Formats a line like FCEUX's trace logger with the frame and cycle counts
+enabled, and status flags in letters, upper case when set:
+
+	f0     c7         A:00 X:00 Y:00 S:FD P:nvUbdIzc  $C000:4C F5 C5  JMP $C5F5
+
+FCEUX doesn't log the PPU's position.
+*
+*/
+func FCEUX(instruction disasm.Instruction, state State) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("f%-6d c%-10d ", state.Frame, state.Cycles))
+	sb.WriteString(fmt.Sprintf("A:%02X X:%02X Y:%02X S:%02X P:%s  ", state.A, state.X, state.Y, state.SP, flags(state.SR)))
+	sb.WriteString(fmt.Sprintf("$%04X:", state.PC))
+
+	var code []string
+
+	for _, value := range instruction.Bytes {
+		code = append(code, fmt.Sprintf("%02X", value))
+	}
+
+	sb.WriteString(fmt.Sprintf("%-9s %s", strings.Join(code, " "), instruction.String()))
+
+	return sb.String()
+}
+
+// Pads sb with spaces to width
+func pad(sb *strings.Builder, width int) {
+	if sb.Len() < width {
+		sb.WriteString(strings.Repeat(" ", width-sb.Len()))
+	}
+}
+
+// Returns the status flags as letters from N to C, upper case when set
+func flags(status cpu.Status) string {
+	letters := []byte("nvubdizc")
+
+	for i := range letters {
+		if status&(1<<(7-i)) != 0 {
+			letters[i] -= 'a' - 'A'
+		}
+	}
+
+	return string(letters)
+}
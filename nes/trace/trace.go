@@ -0,0 +1,167 @@
+package trace
+
+import (
+	"gonesem/nes/cpu"
+	"gonesem/nes/disasm"
+	"gonesem/nes/memory"
+	"io"
+)
+
+// The console before an instruction runs
+type State struct {
+	PC uint16
+	A  uint8
+	X  uint8
+	Y  uint8
+	SP uint8
+	SR cpu.Status
+
+	Cycles uint64 // CPU cycles run before the instruction
+
+	HasPPU   bool // Scanline and Dot are set, false when tracing a CPU on its own
+	Scanline int  // -1 for the pre-render scanline
+	Dot      int
+
+	Frame uint64 // Frames completed before the instruction
+}
+
+// Returns the registers and cycle count of a CPU without a PPU
+func StateOf(cpuPtr *cpu.CPU) State {
+	return State{
+		PC:     cpuPtr.PC,
+		A:      cpuPtr.A,
+		X:      cpuPtr.X,
+		Y:      cpuPtr.Y,
+		SP:     cpuPtr.SP,
+		SR:     cpuPtr.SR,
+		Cycles: cpuPtr.TotalCycles,
+	}
+}
+
+// Decides when tracing starts or stops
+type Trigger func(state State) bool
+
+// Fires on an instruction at an address from low to high inclusive
+func PCRange(low uint16, high uint16) Trigger {
+	return func(state State) bool {
+		return state.PC >= low && state.PC <= high
+	}
+}
+
+// Fires on every instruction once frame frames have completed
+func FromFrame(frame uint64) Trigger {
+	return func(state State) bool {
+		return state.Frame >= frame
+	}
+}
+
+// Fires when all of triggers fire
+func All(triggers ...Trigger) Trigger {
+	return func(state State) bool {
+		for _, trigger := range triggers {
+			if !trigger(state) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+/*
+*
+Writes a line for every instruction traced to a writer in a format, so traces
+can be diffed against other emulators'.
+
+Without a start trigger tracing starts with the first instruction, otherwise
+with the first instruction the start trigger fires on. It ends before the
+first instruction after that the stop trigger fires on, and doesn't start
+again.
+
+Instructions are decoded from the memory they're traced with, which like
+disasm.Disassembler.Decode reads through the bus.
+*
+*/
+type Tracer struct {
+	writer       io.Writer
+	format       Format
+	disassembler *disasm.Disassembler
+
+	start Trigger
+	stop  Trigger
+
+	tracing bool
+	stopped bool
+	lines   uint64
+	err     error
+}
+
+func NewTracer(writer io.Writer, format Format, variant cpu.Variant) *Tracer {
+	return &Tracer{writer: writer, format: format, disassembler: disasm.NewDisassembler(variant)}
+}
+
+// Sets the trigger starting the trace, nil starts it with the first instruction
+func (tracer *Tracer) SetStart(trigger Trigger) {
+	tracer.start = trigger
+}
+
+// Sets the trigger stopping the trace, nil never stops it
+func (tracer *Tracer) SetStop(trigger Trigger) {
+	tracer.stop = trigger
+}
+
+// Traces the instruction at state.PC, returning false once writing has failed
+func (tracer *Tracer) Trace(memory memory.Peeker, state State) bool {
+	if tracer.err != nil {
+		return false
+	}
+
+	switch {
+	case tracer.stopped:
+		return true
+	case tracer.tracing:
+		if tracer.stop != nil && tracer.stop(state) {
+			tracer.tracing = false
+			tracer.stopped = true
+
+			return true
+		}
+	default:
+		if tracer.start != nil && !tracer.start(state) {
+			return true
+		}
+
+		tracer.tracing = true
+	}
+
+	line := tracer.format(tracer.disassembler.Decode(memory, state.PC), state)
+
+	if _, err := io.WriteString(tracer.writer, line+"\n"); err != nil {
+		tracer.err = err
+		return false
+	}
+
+	tracer.lines++
+
+	return true
+}
+
+// Returns whether the trace has started and hasn't stopped yet
+func (tracer *Tracer) Tracing() bool {
+	return tracer.tracing
+}
+
+// Returns whether the stop trigger has ended the trace
+func (tracer *Tracer) Stopped() bool {
+	return tracer.stopped
+}
+
+// Returns the number of lines written
+func (tracer *Tracer) Lines() uint64 {
+	return tracer.lines
+}
+
+// Returns the error writing stopped on, if any
+func (tracer *Tracer) Err() error {
+	return tracer.err
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"gonesem/nes"
+	"gonesem/nes/cartridge"
+	"gonesem/nes/controller"
+	"gonesem/nes/movie"
+	"gonesem/nes/ramsearch"
+	"image/color"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const help = `Commands:
+  frames N                 Run N frames
+  hold [BUTTONS]           Hold BUTTONS on controller 1 while frames run,
+                           release everything when BUTTONS is omitted
+                           BUTTONS joins a, b, select, start, up, down, left
+                           and right with +, e.g. right+a
+  press BUTTONS [N]        Hold BUTTONS for N frames (default 1), then go
+                           back to the held buttons
+  movie PATH               Take input from the .fm2 or .bk2 movie at PATH
+                           until it ends, movies from power on must be
+                           started before any frames are run
+  size 8|16 [signed]       Set value size and signedness, restarts the search
+  reset                    Restart the search from the current RAM
+  filter OP [VALUE]        Keep candidates comparing OP to VALUE, or to the
+                           previous snapshot when VALUE is omitted
+                           OP is one of eq, ne, gt, lt, ge, le, changed-by
+  list [N]                 List up to N candidates (default 20)
+  peek ADDR                Print the byte at hex address ADDR
+  help                     Print this message
+  quit                     Exit`
+
+func main() {
+	romPath := flag.String("rom", "", "path to the ROM to search")
+	flag.Parse()
+
+	if *romPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cart, err := cartridge.NewCartridge(*romPath)
+
+	if err != nil {
+		log.Fatalf("Failed to load cartridge: %s\n", err)
+	}
+
+	// Frames are never displayed, so any palette will do
+	console := nes.NewNES(cart, [64]color.RGBA{})
+
+	repl(console, os.Stdin, os.Stdout)
+}
+
+// Controller button names accepted by hold and press
+var buttonNames = map[string]controller.Buttons{
+	"a":      controller.ButtonA,
+	"b":      controller.ButtonB,
+	"select": controller.ButtonSelect,
+	"start":  controller.ButtonStart,
+	"up":     controller.ButtonUp,
+	"down":   controller.ButtonDown,
+	"left":   controller.ButtonLeft,
+	"right":  controller.ButtonRight,
+}
+
+// State of a search session, the console is driven by held buttons unless a
+// movie is playing
+type session struct {
+	console *nes.NES
+	search  *ramsearch.Search
+	held    controller.Buttons
+	movie   *movie.Session
+}
+
+func repl(console *nes.NES, input io.Reader, output io.Writer) {
+	state := &session{
+		console: console,
+		search:  ramsearch.New(console.RAM(), ramsearch.Size8, false),
+	}
+
+	scanner := bufio.NewScanner(input)
+
+	fmt.Fprintf(output, "%d candidates, type help for commands\n> ", state.search.Count())
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) > 0 {
+			if fields[0] == "quit" || fields[0] == "exit" {
+				return
+			}
+
+			if err := state.runCommand(fields, output); err != nil {
+				fmt.Fprintf(output, "error: %s\n", err)
+			}
+		}
+
+		fmt.Fprint(output, "> ")
+	}
+}
+
+// Parses buttons joined with +, e.g. "right+a"
+func parseButtons(names string) (controller.Buttons, error) {
+	var buttons controller.Buttons
+
+	for _, name := range strings.Split(names, "+") {
+		button, ok := buttonNames[strings.ToLower(name)]
+
+		if !ok {
+			return 0, fmt.Errorf("unknown button %q", name)
+		}
+
+		buttons |= button
+	}
+
+	return buttons, nil
+}
+
+// Runs frames frames, taking input from the movie while it lasts and from the
+// buttons held otherwise
+func (state *session) runFrames(frames int, buttons controller.Buttons) error {
+	for i := 0; i < frames; i++ {
+		if state.movie != nil && state.movie.Mode() == movie.ModeFinished {
+			state.movie = nil
+		}
+
+		if state.movie != nil {
+			if err := state.movie.NextFrame(); err != nil {
+				state.movie = nil
+
+				return fmt.Errorf("movie playback stopped: %s", err)
+			}
+
+			continue
+		}
+
+		state.console.SetButtons(0, buttons)
+
+		// GetFrame clears the frame complete flag, without it the next frame wouldn't run
+		state.console.NextFrame()
+		state.console.GetFrame()
+	}
+
+	return nil
+}
+
+func (state *session) runCommand(fields []string, output io.Writer) error {
+	console, search := state.console, state.search
+
+	switch fields[0] {
+	case "frames":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: frames N")
+		}
+
+		frames, err := strconv.Atoi(fields[1])
+
+		if err != nil {
+			return fmt.Errorf("invalid frame count %q", fields[1])
+		}
+
+		return state.runFrames(frames, state.held)
+	case "hold":
+		if len(fields) > 2 {
+			return fmt.Errorf("usage: hold [BUTTONS]")
+		}
+
+		state.held = 0
+
+		if len(fields) == 2 {
+			buttons, err := parseButtons(fields[1])
+
+			if err != nil {
+				return err
+			}
+
+			state.held = buttons
+		}
+	case "press":
+		if len(fields) < 2 || len(fields) > 3 {
+			return fmt.Errorf("usage: press BUTTONS [N]")
+		}
+
+		if state.movie != nil {
+			return fmt.Errorf("input comes from the movie until it ends")
+		}
+
+		buttons, err := parseButtons(fields[1])
+
+		if err != nil {
+			return err
+		}
+
+		frames := 1
+
+		if len(fields) == 3 {
+			if frames, err = strconv.Atoi(fields[2]); err != nil || frames <= 0 {
+				return fmt.Errorf("usage: press BUTTONS [N], N must be a positive number of frames, got %q", fields[2])
+			}
+		}
+
+		return state.runFrames(frames, buttons)
+	case "movie":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: movie PATH")
+		}
+
+		inputMovie, err := movie.Load(fields[1])
+
+		if err != nil {
+			return err
+		}
+
+		playback, err := movie.Play(console, inputMovie, movie.ModeReadOnly)
+
+		if err != nil {
+			return err
+		}
+
+		state.movie = playback
+		fmt.Fprintf(output, "playing %d frames\n", len(inputMovie.Frames))
+	case "size":
+		if len(fields) < 2 {
+			return fmt.Errorf("usage: size 8|16 [signed]")
+		}
+
+		size := ramsearch.Size8
+
+		switch fields[1] {
+		case "8":
+		case "16":
+			size = ramsearch.Size16
+		default:
+			return fmt.Errorf("invalid size %q", fields[1])
+		}
+
+		search.SetSize(console.RAM(), size, len(fields) > 2 && fields[2] == "signed")
+		fmt.Fprintf(output, "%d candidates\n", search.Count())
+	case "reset":
+		search.Reset(console.RAM())
+		fmt.Fprintf(output, "%d candidates\n", search.Count())
+	case "filter":
+		if len(fields) < 2 {
+			return fmt.Errorf("usage: filter OP [VALUE]")
+		}
+
+		comparison, err := ramsearch.ParseComparison(fields[1])
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case comparison == ramsearch.ChangedBy:
+			if len(fields) != 3 {
+				return fmt.Errorf("usage: filter changed-by N")
+			}
+
+			n, err := strconv.Atoi(fields[2])
+
+			if err != nil {
+				return fmt.Errorf("invalid difference %q", fields[2])
+			}
+
+			search.FilterPrevious(console.RAM(), comparison, n)
+		case len(fields) == 3:
+			value, err := strconv.ParseInt(fields[2], 0, 32)
+
+			if err != nil {
+				return fmt.Errorf("invalid value %q", fields[2])
+			}
+
+			if err := search.FilterValue(console.RAM(), comparison, int(value)); err != nil {
+				return err
+			}
+		default:
+			search.FilterPrevious(console.RAM(), comparison, 0)
+		}
+
+		fmt.Fprintf(output, "%d candidates\n", search.Count())
+	case "list":
+		limit := 20
+
+		if len(fields) > 2 {
+			return fmt.Errorf("usage: list [N]")
+		}
+
+		if len(fields) == 2 {
+			n, err := strconv.Atoi(fields[1])
+
+			if err != nil || n <= 0 {
+				return fmt.Errorf("usage: list [N], N must be a positive number of candidates, got %q", fields[1])
+			}
+
+			limit = n
+		}
+
+		for i, candidate := range search.Candidates() {
+			if i >= limit {
+				fmt.Fprintf(output, "... %d more\n", search.Count()-limit)
+				break
+			}
+
+			fmt.Fprintf(output, "$%04X  %6d  (was %d)\n", candidate.Address, candidate.Value, candidate.Previous)
+		}
+	case "peek":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: peek ADDR")
+		}
+
+		addr, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "$"), 16, 16)
+
+		if err != nil || addr >= 0x0800 {
+			return fmt.Errorf("invalid RAM address %q", fields[1])
+		}
+
+		ram := console.RAM()
+		fmt.Fprintf(output, "$%04X = $%02X (%d)\n", addr, ram[addr], ram[addr])
+	case "help":
+		fmt.Fprintln(output, help)
+	default:
+		return fmt.Errorf("unknown command %q, type help for commands", fields[0])
+	}
+
+	return nil
+}
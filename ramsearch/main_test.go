@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"gonesem/nes"
+	"gonesem/nes/cartridge"
+	"gonesem/nes/controller"
+	"gonesem/nes/movie"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newNestest(t *testing.T) *nes.NES {
+	cart, err := cartridge.NewCartridge(filepath.Join("..", "test", "data", "nestest.nes"))
+
+	if err != nil {
+		t.Fatalf("Failed to load cartridge: %s", err)
+	}
+
+	return nes.NewNES(cart, [64]color.RGBA{})
+}
+
+// nestest keeps its menu cursor at $00D7, which only moves when down is pressed
+func TestREPLFindsCursorWithPress(t *testing.T) {
+	var output bytes.Buffer
+
+	repl(newNestest(t), strings.NewReader(`frames 60
+reset
+frames 10
+filter eq
+press down
+frames 10
+filter changed-by 1
+list
+`), &output)
+
+	if !strings.Contains(output.String(), "1 candidates\n> $00D7       1  (was 0)\n") {
+		t.Fatalf("Cursor at $00D7 was not the only candidate:\n%s", output.String())
+	}
+}
+
+func TestREPLHold(t *testing.T) {
+	var output bytes.Buffer
+
+	repl(newNestest(t), strings.NewReader(`frames 60
+hold down+a
+frames 1
+hold
+frames 10
+peek 00D7
+hold sideways
+`), &output)
+
+	if !strings.Contains(output.String(), "$00D7 = $01 (1)\n") {
+		t.Fatalf("Holding down did not move the cursor:\n%s", output.String())
+	}
+
+	if !strings.Contains(output.String(), `error: unknown button "sideways"`) {
+		t.Fatalf("Unknown button was not rejected:\n%s", output.String())
+	}
+}
+
+func TestREPLMovie(t *testing.T) {
+	input := &movie.Movie{Frames: make([]movie.Frame, 71)}
+	input.Frames[70].Buttons[0] = controller.ButtonDown
+
+	path := filepath.Join(t.TempDir(), "down.fm2")
+
+	if err := movie.Save(path, input); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+
+	repl(newNestest(t), strings.NewReader("movie "+path+"\nframes 80\npeek 00D7\n"), &output)
+
+	if !strings.Contains(output.String(), "playing 71 frames\n") || !strings.Contains(output.String(), "$00D7 = $01 (1)\n") {
+		t.Fatalf("Movie input did not move the cursor:\n%s", output.String())
+	}
+}
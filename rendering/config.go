@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gonesem/nes/cartridge"
+	"gonesem/nes/rewind"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+*
+Settings come from, in increasing priority:
+ 1. The defaults below.
+ 2. A JSON config file, given with -config or found at
+    <user config dir>/gonesem/config.json.
+ 3. The config file's entry in "games" for the loaded ROM, keyed by the
+    CRC32 or SHA-1 of its PRG and CHR ROM in hex.
+ 4. Command line flags.
+
+A config file setting only some values leaves the rest as they were:
+
+	{
+		"palette": "pals/NESdev.pal",
+		"scale": 4,
+		"keys": {"a": "X", "b": "Z", "rewind": "Backspace"},
+		"audio": {"volume": 50},
+		"rewind": {"interval": 2, "memory": 128},
+		"games": {
+			"3FA2B1C0": {"runAhead": 2, "region": "pal"}
+		}
+	}
+
+*
+*/
+type Config struct {
+	ROM        string            `json:"rom"`
+	Palette    string            `json:"palette"` // .pal file, the built-in palette is used when empty
+	Scale      int               `json:"scale"`   // Window size as a multiple of 256x240
+	Fullscreen bool              `json:"fullscreen"`
+	VSync      bool              `json:"vsync"`
+	Region     string            `json:"region"`   // Timing the console runs with, "auto" keeps the header's or game database's region, otherwise ntsc, pal or dendy
+	SaveDir    string            `json:"saveDir"`  // Where save states go, next to the ROM when empty
+	RunAhead   int               `json:"runAhead"` // Frames of run-ahead, 0 disables it
+	Keys       map[string]string `json:"keys"`     // Action to key name, see keys.go, "" unbinds an action
+	Audio      AudioConfig       `json:"audio"`
+	Rewind     RewindConfig      `json:"rewind"`
+
+	Games map[string]json.RawMessage `json:"games"` // Per-game overrides of the settings above
+}
+
+// Reserved sound output settings. The APU has no sound channels yet so these
+// have no effect, they're accepted and validated so config files can already
+// set them.
+type AudioConfig struct {
+	Mute       bool `json:"mute"`
+	Volume     int  `json:"volume"`     // Percentage of full volume, 0 to 100
+	SampleRate int  `json:"sampleRate"` // Output rate in Hz
+	Latency    int  `json:"latency"`    // Milliseconds of audio buffered ahead of playback
+}
+
+// History kept for the rewind key, which steps back one snapshot per frame held
+type RewindConfig struct {
+	Interval int `json:"interval"` // Frames between snapshots, 1 rewinds frame by frame
+	Memory   int `json:"memory"`   // Megabytes of compressed history to keep
+}
+
+// Regions accepted by the region setting besides "auto"
+var regions = map[string]cartridge.Region{
+	"ntsc":  cartridge.RegionNTSC,
+	"pal":   cartridge.RegionPAL,
+	"dendy": cartridge.RegionDendy,
+}
+
+var defaultConfig = Config{
+	Scale:    3,
+	VSync:    true,
+	Region:   "auto",
+	RunAhead: 1,
+	Keys: map[string]string{
+		"a":         "X",
+		"b":         "Z",
+		"select":    "RightShift",
+		"start":     "Enter",
+		"up":        "Up",
+		"down":      "Down",
+		"left":      "Left",
+		"right":     "Right",
+		"rewind":    "Backspace",
+		"saveState": "F5",
+		"loadState": "F7",
+		"slot0":     "0",
+		"slot1":     "1",
+		"slot2":     "2",
+		"slot3":     "3",
+		"slot4":     "4",
+		"slot5":     "5",
+		"slot6":     "6",
+		"slot7":     "7",
+		"slot8":     "8",
+		"slot9":     "9",
+	},
+	Audio: AudioConfig{
+		Volume:     100,
+		SampleRate: 48000,
+		Latency:    50,
+	},
+	Rewind: RewindConfig{
+		Interval: rewind.DefaultConfig.Interval,
+		Memory:   rewind.DefaultConfig.MemoryLimit >> 20,
+	},
+}
+
+// Returns the default config file path, an empty string if there's no user config directory
+func defaultConfigPath() string {
+	configDir, err := os.UserConfigDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(configDir, "gonesem", "config.json")
+}
+
+// Parses the command line and loads the config file it names, returning a
+// function that applies the flags given, to be called after any game override
+func loadConfig(args []string) (Config, func(*Config), error) {
+	config := defaultConfig
+	config.Keys = maps.Clone(defaultConfig.Keys)
+
+	flags := flag.NewFlagSet("gonesem", flag.ContinueOnError)
+
+	configPath := flags.String("config", "", "path to a JSON config file (default "+defaultConfigPath()+")")
+	flagValues := Config{}
+
+	flags.StringVar(&flagValues.ROM, "rom", "", "path to the ROM to run")
+	flags.StringVar(&flagValues.Palette, "palette", "", "path to a .pal file")
+	flags.IntVar(&flagValues.Scale, "scale", 0, "window size as a multiple of 256x240")
+	flags.BoolVar(&flagValues.Fullscreen, "fullscreen", false, "run fullscreen on the primary monitor")
+	flags.BoolVar(&flagValues.VSync, "vsync", false, "synchronise buffer swaps to the display")
+	flags.StringVar(&flagValues.Region, "region", "", "console region setting the frame rate and CPU and PPU timing, auto, ntsc, pal or dendy")
+	flags.StringVar(&flagValues.SaveDir, "savedir", "", "directory for save states")
+	flags.IntVar(&flagValues.RunAhead, "runahead", 0, "frames of run-ahead, 0 disables it")
+	flags.IntVar(&flagValues.Rewind.Interval, "rewindinterval", 0, "frames between rewind snapshots")
+	flags.IntVar(&flagValues.Rewind.Memory, "rewindmemory", 0, "megabytes of rewind history to keep")
+	flags.BoolVar(&flagValues.Audio.Mute, "mute", false, "mute sound output (reserved, there is no sound output yet)")
+	flags.IntVar(&flagValues.Audio.Volume, "volume", 0, "sound volume as a percentage (reserved, there is no sound output yet)")
+
+	if err := flags.Parse(args); err != nil {
+		return config, nil, err
+	}
+
+	if flags.NArg() == 1 {
+		flagValues.ROM = flags.Arg(0)
+	} else if flags.NArg() > 1 {
+		return config, nil, fmt.Errorf("expected a single ROM path, got %d arguments", flags.NArg())
+	}
+
+	path, required := *configPath, true
+
+	if path == "" {
+		path, required = defaultConfigPath(), false
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &config); err != nil {
+				return config, nil, fmt.Errorf("failed to parse config file %s: %s", path, err)
+			}
+		case required || !os.IsNotExist(err):
+			return config, nil, fmt.Errorf("failed to read config file: %s", err)
+		}
+	}
+
+	applyFlags := func(config *Config) {
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "rom":
+				config.ROM = flagValues.ROM
+			case "palette":
+				config.Palette = flagValues.Palette
+			case "scale":
+				config.Scale = flagValues.Scale
+			case "fullscreen":
+				config.Fullscreen = flagValues.Fullscreen
+			case "vsync":
+				config.VSync = flagValues.VSync
+			case "region":
+				config.Region = flagValues.Region
+			case "savedir":
+				config.SaveDir = flagValues.SaveDir
+			case "runahead":
+				config.RunAhead = flagValues.RunAhead
+			case "rewindinterval":
+				config.Rewind.Interval = flagValues.Rewind.Interval
+			case "rewindmemory":
+				config.Rewind.Memory = flagValues.Rewind.Memory
+			case "mute":
+				config.Audio.Mute = flagValues.Audio.Mute
+			case "volume":
+				config.Audio.Volume = flagValues.Audio.Volume
+			}
+		})
+
+		// A positional ROM path counts as a flag
+		if flagValues.ROM != "" {
+			config.ROM = flagValues.ROM
+		}
+	}
+
+	applyFlags(&config)
+
+	return config, applyFlags, nil
+}
+
+// Returns the config with the override for the ROM with the given hashes applied,
+// overrides only replace the settings they contain
+func (config Config) forGame(hashes ...string) (Config, error) {
+	for key, override := range config.Games {
+		for _, hash := range hashes {
+			if !strings.EqualFold(key, hash) {
+				continue
+			}
+
+			gameConfig := config
+			gameConfig.Keys = maps.Clone(config.Keys)
+
+			if err := json.Unmarshal(override, &gameConfig); err != nil {
+				return config, fmt.Errorf("failed to parse config for game %s: %s", key, err)
+			}
+
+			return gameConfig, nil
+		}
+	}
+
+	return config, nil
+}
+
+func (config Config) validate() error {
+	if config.ROM == "" {
+		return fmt.Errorf("no ROM given, pass one with -rom or set rom in the config file")
+	}
+
+	if config.Scale < 1 {
+		return fmt.Errorf("scale must be at least 1, got %d", config.Scale)
+	}
+
+	if _, ok := regions[strings.ToLower(config.Region)]; !ok && !strings.EqualFold(config.Region, "auto") {
+		return fmt.Errorf("unknown region %q, expected auto, ntsc, pal or dendy", config.Region)
+	}
+
+	if config.Rewind.Interval < 1 {
+		return fmt.Errorf("rewind interval must be at least 1 frame, got %d", config.Rewind.Interval)
+	}
+
+	if config.Rewind.Memory < 1 || config.Rewind.Memory > 4096 {
+		return fmt.Errorf("rewind memory must be between 1 and 4096 MB, got %d", config.Rewind.Memory)
+	}
+
+	if config.Audio.Volume < 0 || config.Audio.Volume > 100 {
+		return fmt.Errorf("audio volume must be between 0 and 100, got %d", config.Audio.Volume)
+	}
+
+	if config.Audio.SampleRate < 8000 || config.Audio.SampleRate > 192000 {
+		return fmt.Errorf("audio sample rate must be between 8000 and 192000 Hz, got %d", config.Audio.SampleRate)
+	}
+
+	if config.Audio.Latency < 1 {
+		return fmt.Errorf("audio latency must be at least 1ms, got %d", config.Audio.Latency)
+	}
+
+	for action, key := range config.Keys {
+		if _, ok := actions[action]; !ok {
+			return fmt.Errorf("unknown key binding action %q", action)
+		}
+
+		if _, ok := keyNames[strings.ToLower(key)]; !ok && key != "" {
+			return fmt.Errorf("unknown key %q bound to %s", key, action)
+		}
+	}
+
+	return nil
+}
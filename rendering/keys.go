@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"gonesem/nes/controller"
+	"strings"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+)
+
+// Actions that can be bound to a key in the config file, controller buttons
+// apply to the controller in port 1 and slotN selects save state slot N
+var actions = map[string]controller.Buttons{
+	"a":         controller.ButtonA,
+	"b":         controller.ButtonB,
+	"select":    controller.ButtonSelect,
+	"start":     controller.ButtonStart,
+	"up":        controller.ButtonUp,
+	"down":      controller.ButtonDown,
+	"left":      controller.ButtonLeft,
+	"right":     controller.ButtonRight,
+	"rewind":    0,
+	"saveState": 0,
+	"loadState": 0,
+	"slot0":     0,
+	"slot1":     0,
+	"slot2":     0,
+	"slot3":     0,
+	"slot4":     0,
+	"slot5":     0,
+	"slot6":     0,
+	"slot7":     0,
+	"slot8":     0,
+	"slot9":     0,
+}
+
+// Key names accepted in the config file, matched case-insensitively
+var keyNames = func() map[string]glfw.Key {
+	names := map[string]glfw.Key{
+		"space":        glfw.KeySpace,
+		"enter":        glfw.KeyEnter,
+		"tab":          glfw.KeyTab,
+		"backspace":    glfw.KeyBackspace,
+		"escape":       glfw.KeyEscape,
+		"insert":       glfw.KeyInsert,
+		"delete":       glfw.KeyDelete,
+		"home":         glfw.KeyHome,
+		"end":          glfw.KeyEnd,
+		"pageup":       glfw.KeyPageUp,
+		"pagedown":     glfw.KeyPageDown,
+		"up":           glfw.KeyUp,
+		"down":         glfw.KeyDown,
+		"left":         glfw.KeyLeft,
+		"right":        glfw.KeyRight,
+		"leftshift":    glfw.KeyLeftShift,
+		"rightshift":   glfw.KeyRightShift,
+		"leftcontrol":  glfw.KeyLeftControl,
+		"rightcontrol": glfw.KeyRightControl,
+		"leftalt":      glfw.KeyLeftAlt,
+		"rightalt":     glfw.KeyRightAlt,
+		"kpenter":      glfw.KeyKPEnter,
+	}
+
+	// GLFW numbers letters, digits and function keys consecutively
+	for i := 0; i < 26; i++ {
+		names[strings.ToLower(string(rune('A'+i)))] = glfw.KeyA + glfw.Key(i)
+	}
+
+	for i := 0; i < 10; i++ {
+		names[fmt.Sprint(i)] = glfw.Key0 + glfw.Key(i)
+		names[fmt.Sprintf("kp%d", i)] = glfw.KeyKP0 + glfw.Key(i)
+	}
+
+	for i := 0; i < 12; i++ {
+		names[fmt.Sprintf("f%d", i+1)] = glfw.KeyF1 + glfw.Key(i)
+	}
+
+	return names
+}()
+
+type keyBindings struct {
+	buttons   map[glfw.Key]controller.Buttons
+	slots     map[glfw.Key]int
+	rewind    glfw.Key
+	saveState glfw.Key
+	loadState glfw.Key
+}
+
+// Resolves the key names of a validated config
+func newKeyBindings(keys map[string]string) keyBindings {
+	bindings := keyBindings{
+		buttons:   map[glfw.Key]controller.Buttons{},
+		slots:     map[glfw.Key]int{},
+		rewind:    glfw.KeyUnknown,
+		saveState: glfw.KeyUnknown,
+		loadState: glfw.KeyUnknown,
+	}
+
+	for action, name := range keys {
+		key, ok := keyNames[strings.ToLower(name)]
+
+		if !ok {
+			continue
+		}
+
+		switch action {
+		case "rewind":
+			bindings.rewind = key
+		case "saveState":
+			bindings.saveState = key
+		case "loadState":
+			bindings.loadState = key
+		case "slot0", "slot1", "slot2", "slot3", "slot4", "slot5", "slot6", "slot7", "slot8", "slot9":
+			bindings.slots[key] = int(action[4] - '0')
+		default:
+			bindings.buttons[key] |= actions[action]
+		}
+	}
+
+	return bindings
+}
+
+func (bindings keyBindings) heldButtons(window *glfw.Window) controller.Buttons {
+	var buttons controller.Buttons
+
+	for key, button := range bindings.buttons {
+		if window.GetKey(key) == glfw.Press {
+			buttons |= button
+		}
+	}
+
+	return buttons
+}
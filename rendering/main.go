@@ -1,13 +1,18 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"gonesem/nes"
 	"gonesem/nes/cartridge"
+	"gonesem/nes/cheats"
 	"gonesem/nes/color"
+	"gonesem/nes/rewind"
+	"gonesem/nes/runahead"
 	"image"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"unsafe"
@@ -16,9 +21,13 @@ import (
 	"github.com/go-gl/glfw/v3.3/glfw"
 )
 
-const width, height, scale = 256, 240, 3
+const width, height = 256, 240
 const title = "NES"
-const fps float64 = (1.0 / 60.0)
+
+// Save state slot selected with the slot0-slot9 keys, saved to and loaded with the saveState and loadState keys
+var stateSlot = 0
+
+const runAheadMode = runahead.ModeSecondInstance
 
 const vertexShaderSource = `
 	#version 460
@@ -80,7 +89,17 @@ func init() {
 }
 
 func main() {
-	nes, err := nesInit()
+	config, err := configInit()
+
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatalf("Failed to load configuration: %s\n", err)
+
+		os.Exit(1)
+	}
+
+	nes, err := nesInit(config)
 
 	if err != nil {
 		log.Fatalf("Failed to initialize NES console: %s\n", err)
@@ -88,7 +107,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	window, err := glfwInit()
+	bindings := newKeyBindings(config.Keys)
+
+	window, err := glfwInit(config)
 
 	if err != nil {
 		log.Fatalf("Failed to initialize GLFW: %s\n", err)
@@ -98,6 +119,16 @@ func main() {
 
 	defer glfw.Terminate()
 
+	rewinder := rewind.New(nes, rewind.Config{Interval: config.Rewind.Interval, MemoryLimit: config.Rewind.Memory << 20})
+
+	window.SetKeyCallback(func(window *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+		handleKey(nes, rewinder, config, bindings, key, action)
+	})
+
+	nes.SetHaltCallback(func(pc uint16) {
+		log.Printf("CPU jammed at $%04X, rewind or load a state to continue\n", pc)
+	})
+
 	program, err := glInit()
 
 	if err != nil {
@@ -108,11 +139,18 @@ func main() {
 
 	gl.UseProgram(program)
 
+	setViewport(window)
+
 	vao := createVao(quad, indices)
 	texture := createTexture()
 
 	gl.ClearColor(0, 0, 0, 1)
 
+	runAhead := runahead.New(nes, config.RunAhead, runAheadMode)
+
+	// Frames are paced at the rate of the console's region, e.g. 50 per second on PAL
+	frameTime := 1.0 / nes.FrameRate()
+
 	timestamp := glfw.GetTime()
 	residualTime := 0.0
 
@@ -122,16 +160,30 @@ func main() {
 		if residualTime > 0 {
 			residualTime -= deltaTime
 		} else {
-			residualTime += fps - deltaTime
+			residualTime += frameTime - deltaTime
 
 			gl.Clear(gl.COLOR_BUFFER_BIT)
 
-			nes.NextFrame()
+			frame := nes.GetFrame()
+
+			nes.SetButtons(0, bindings.heldButtons(window))
+
+			if bindings.rewind != glfw.KeyUnknown && window.GetKey(bindings.rewind) == glfw.Press {
+				if _, err := rewinder.Rewind(); err != nil {
+					log.Printf("Failed to rewind: %s\n", err)
+				}
+			} else if frame, err = runAhead.NextFrame(); err != nil {
+				log.Printf("Failed to run ahead: %s\n", err)
+
+				frame = nes.GetFrame()
+			} else {
+				rewinder.Frame()
+			}
 
 			gl.ActiveTexture(gl.TEXTURE0)
 			gl.BindTexture(gl.TEXTURE_2D, texture)
 
-			setFrameTexture(nes.GetFrame())
+			setFrameTexture(frame)
 
 			gl.BindVertexArray(vao)
 			gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, unsafe.Pointer(nil))
@@ -145,25 +197,145 @@ func main() {
 	}
 }
 
-func nesInit() (*nes.NES, error) {
-	cartridge, err := cartridge.NewCartridge("../test/data/roms/Donkey Kong.nes")
+// Loads the config file and flags, applying the loaded ROM's per-game overrides
+func configInit() (Config, error) {
+	config, applyFlags, err := loadConfig(os.Args[1:])
 
 	if err != nil {
-		return nil, err
+		return config, err
+	}
+
+	if err := config.validate(); err != nil {
+		return config, err
+	}
+
+	// The cartridge is only opened here to identify the game, nesInit loads it again
+	cartridge, err := cartridge.NewCartridge(config.ROM)
+
+	if err != nil {
+		return config, err
 	}
 
-	colorPalette, err := color.NewColorPalette("../test/data/pals/NESdev.pal")
+	config, err = config.forGame(fmt.Sprintf("%08X", cartridge.CRC32()), fmt.Sprintf("%X", cartridge.SHA1()))
+
+	if err != nil {
+		return config, err
+	}
+
+	applyFlags(&config)
+
+	return config, config.validate()
+}
+
+func nesInit(config Config) (*nes.NES, error) {
+	cartridge, err := cartridge.NewCartridge(config.ROM)
 
 	if err != nil {
 		return nil, err
 	}
 
+	colorPalette := color.DefaultPalette
+
+	if config.Palette != "" {
+		colorPalette, err = color.NewColorPalette(config.Palette)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if region, ok := regions[strings.ToLower(config.Region)]; ok {
+		cartridge.SetRegion(region)
+	}
+
 	nes := nes.NewNES(cartridge, colorPalette)
 
+	// The cheat list kept next to the ROM is loaded when there is one
+	cheatPath := cheats.PathFor(config.ROM)
+
+	if _, err := os.Stat(cheatPath); err == nil {
+		if err := nes.LoadCheats(cheatPath); err != nil {
+			return nil, err
+		}
+	}
+
 	return nes, nil
 }
 
-func glfwInit() (*glfw.Window, error) {
+func handleKey(nes *nes.NES, rewinder *rewind.Rewinder, config Config, bindings keyBindings, key glfw.Key, action glfw.Action) {
+	if action != glfw.Press || key == glfw.KeyUnknown {
+		return
+	}
+
+	if slot, ok := bindings.slots[key]; ok {
+		stateSlot = slot
+		log.Printf("Selected save state slot %d\n", stateSlot)
+
+		return
+	}
+
+	switch key {
+	case bindings.saveState:
+		if err := saveState(nes, config, stateSlot); err != nil {
+			log.Printf("Failed to save state to slot %d: %s\n", stateSlot, err)
+		} else {
+			log.Printf("Saved state to slot %d\n", stateSlot)
+		}
+	case bindings.loadState:
+		if err := loadState(nes, config, stateSlot); err != nil {
+			log.Printf("Failed to load state from slot %d: %s\n", stateSlot, err)
+		} else {
+			// The history belongs to the timeline left behind, rewinding
+			// must not jump back into it
+			rewinder.Clear()
+
+			log.Printf("Loaded state from slot %d\n", stateSlot)
+		}
+	}
+}
+
+// Save states are kept in the save directory or next to the ROM, e.g. "Donkey Kong.ss0" for slot 0
+func statePath(config Config, slot int) string {
+	base := strings.TrimSuffix(config.ROM, filepath.Ext(config.ROM))
+
+	if config.SaveDir != "" {
+		base = filepath.Join(config.SaveDir, filepath.Base(base))
+	}
+
+	return fmt.Sprintf("%s.ss%d", base, slot)
+}
+
+func saveState(nes *nes.NES, config Config, slot int) error {
+	if config.SaveDir != "" {
+		if err := os.MkdirAll(config.SaveDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(statePath(config, slot))
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return nes.SaveState(file)
+}
+
+func loadState(nes *nes.NES, config Config, slot int) error {
+	file, err := os.Open(statePath(config, slot))
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return nes.LoadState(file)
+}
+
+func glfwInit(config Config) (*glfw.Window, error) {
 	if err := glfw.Init(); err != nil {
 		return nil, err
 	}
@@ -173,7 +345,19 @@ func glfwInit() (*glfw.Window, error) {
 	glfw.WindowHint(glfw.ContextVersionMinor, 6)
 	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
 
-	window, err := glfw.CreateWindow(width*scale, height*scale, title, nil, nil)
+	var monitor *glfw.Monitor
+
+	windowWidth, windowHeight := width*config.Scale, height*config.Scale
+
+	if config.Fullscreen {
+		monitor = glfw.GetPrimaryMonitor()
+		mode := monitor.GetVideoMode()
+		windowWidth, windowHeight = mode.Width, mode.Height
+	}
+
+	windowTitle := fmt.Sprintf("%s - %s", title, strings.TrimSuffix(filepath.Base(config.ROM), filepath.Ext(config.ROM)))
+
+	window, err := glfw.CreateWindow(windowWidth, windowHeight, windowTitle, monitor, nil)
 
 	if err != nil {
 		return nil, err
@@ -181,6 +365,12 @@ func glfwInit() (*glfw.Window, error) {
 
 	window.MakeContextCurrent()
 
+	if config.VSync {
+		glfw.SwapInterval(1)
+	} else {
+		glfw.SwapInterval(0)
+	}
+
 	return window, nil
 }
 
@@ -227,6 +417,17 @@ func glInit() (uint32, error) {
 	return program, nil
 }
 
+// Fits the largest 256x240 area into the window's framebuffer, letterboxing
+// fullscreen windows whose aspect ratio differs
+func setViewport(window *glfw.Window) {
+	framebufferWidth, framebufferHeight := window.GetFramebufferSize()
+
+	viewportScale := min(float64(framebufferWidth)/width, float64(framebufferHeight)/height)
+	viewportWidth, viewportHeight := int32(width*viewportScale), int32(height*viewportScale)
+
+	gl.Viewport((int32(framebufferWidth)-viewportWidth)/2, (int32(framebufferHeight)-viewportHeight)/2, viewportWidth, viewportHeight)
+}
+
 func createVao(vertices []float32, indices []uint32) uint32 {
 	var vao uint32
 	gl.GenVertexArrays(1, &vao)
@@ -0,0 +1,116 @@
+package nes_test
+
+import (
+	"fmt"
+	"testing"
+
+	"gonesem/nes/cartridge"
+)
+
+// Sets the frame counter from $4017 and counts frame IRQs at $10, keeping the
+// last $4015 read by the handler at $11
+const frameIRQProgram = `
+	.org $C000
+reset:  sei
+        ldx #$FF
+        txs
+        lda #%s
+        sta $4017
+        lda #$00
+        sta $10
+        cli
+loop:   jmp loop
+irq:    inc $10
+        lda $4015
+        sta $11
+        rti
+
+	.org $FFFE
+	.word irq
+`
+
+func TestFrameIRQ(t *testing.T) {
+	tests := []struct {
+		name       string
+		frameMode  uint8
+		interrupts bool
+	}{
+		{"4-step", 0x00, true},
+		{"inhibited", 0x40, false},
+		{"5-step", 0x80, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consoleDebugger, _ := newDebugger(t, fmt.Sprintf(frameIRQProgram, fmt.Sprintf("$%02X", test.frameMode)))
+			console := consoleDebugger.Console()
+
+			consoleDebugger.RunToFrame(10)
+
+			if irqs := console.Peek(0x10); (irqs > 0) != test.interrupts {
+				t.Errorf("Took %d IRQs in 10 frames", irqs)
+			}
+
+			if test.interrupts && console.Peek(0x11) != 0x40 {
+				t.Errorf("Handler read $%02X from $4015, expected the frame interrupt flag", console.Peek(0x11))
+			}
+		})
+	}
+}
+
+// The handler acknowledges each IRQ long before the next, so they're taken a
+// 4-step sequence apart, give or take the JMP each one waits for
+func TestFrameIRQPeriod(t *testing.T) {
+	tests := []struct {
+		region cartridge.Region
+		period uint64
+	}{
+		{cartridge.RegionNTSC, 29830},
+		{cartridge.RegionPAL, 33254},
+		{cartridge.RegionDendy, 29830},
+	}
+
+	for _, test := range tests {
+		consoleDebugger, symbols := newRegionDebugger(t, fmt.Sprintf(frameIRQProgram, "$00"), test.region)
+		cpuPtr := consoleDebugger.Console().CPU()
+
+		consoleDebugger.AddBreakpoint(symbols["irq"], nil)
+		consoleDebugger.Continue()
+		first := cpuPtr.TotalCycles
+
+		consoleDebugger.Continue()
+
+		if period := cpuPtr.TotalCycles - first; period < test.period-2 || period > test.period+2 {
+			t.Errorf("Region %d took IRQs %d cycles apart, expected %d", test.region, period, test.period)
+		}
+	}
+}
+
+// Reading $4015 acknowledges the frame interrupt, peeking it doesn't. The
+// program leaves interrupts disabled so the flag stays set.
+func TestFrameIRQAcknowledge(t *testing.T) {
+	consoleDebugger, _ := newDebugger(t, `
+	.org $C000
+reset:  sei
+        lda #$00
+        sta $4017
+loop:   jmp loop
+`)
+	console := consoleDebugger.Console()
+
+	consoleDebugger.RunToFrame(2)
+
+	for i := 0; i < 2; i++ {
+		if status := console.Peek(0x4015); status != 0x40 {
+			t.Fatalf("Peek %d of $4015 $%02X, expected the frame interrupt flag", i, status)
+		}
+	}
+
+	if status := console.Read(0x4015); status != 0x40 {
+		t.Errorf("Read $4015 $%02X, expected the frame interrupt flag", status)
+	}
+
+	if status := console.Peek(0x4015); status != 0 {
+		t.Errorf("Peeked $4015 $%02X after reading it, expected the flag cleared", status)
+	}
+}
@@ -0,0 +1,142 @@
+package nes_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gonesem/nes/asm"
+	"gonesem/nes/cpu"
+	"gonesem/nes/disasm"
+)
+
+func TestAssemble(t *testing.T) {
+	source := `
+		PPUSTATUS = $2002
+		.org $C000
+		reset:  sei             ; Comments are ignored
+		@vblank:
+		        bit PPUSTATUS
+		        bpl @vblank
+		        lda #<(vectors + 2)
+		        ldx z:$10,y     ; Forced to zero page as there's no zero page LDX addr,Y
+		        sta a:$10
+		        jmp (vectors + 2)
+		nmi:
+		@vblank:
+		        rti
+		vectors:
+		        .word reset, nmi
+		        .byte "OK", 'A' + 1
+		        .res 2, $FF
+	`
+
+	program, err := asm.NewAssembler(cpu.Variant2A03).Assemble(source, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint8{
+		0x78,
+		0x2C, 0x02, 0x20,
+		0x10, 0xFB,
+		0xA9, 0x13,
+		0xB6, 0x10,
+		0x8D, 0x10, 0x00,
+		0x6C, 0x13, 0xC0,
+		0x40,
+		0x00, 0xC0, 0x10, 0xC0,
+		'O', 'K', 'B',
+		0xFF, 0xFF,
+	}
+
+	if len(program.Segments) != 1 || program.Segments[0].Address != 0xC000 {
+		t.Fatalf("Assembled %d segments, expected one at $C000", len(program.Segments))
+	}
+
+	if !bytes.Equal(program.Segments[0].Bytes, expected) {
+		t.Errorf("Assembled % X\nexpected  % X", program.Segments[0].Bytes, expected)
+	}
+
+	symbols := map[string]uint16{"reset": 0xC000, "reset@vblank": 0xC001, "nmi": 0xC010, "nmi@vblank": 0xC010, "vectors": 0xC011}
+
+	for name, address := range symbols {
+		if program.Symbols[name] != address {
+			t.Errorf("%s = $%04X, expected $%04X", name, program.Symbols[name], address)
+		}
+	}
+
+	if _, ok := program.Symbols["PPUSTATUS"]; !ok {
+		t.Error("Constant missing from symbols")
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{"lda", "line 1: LDA doesn't take operand"},
+		{"foo $10", `line 1: unknown instruction "FOO"`},
+		{"nop\nbne far\n.res 200\nfar:", "line 2: branch to $00CB is out of range"},
+		{"lda missing", `line 1: undefined symbol "missing"`},
+		{"a:\na:", `line 2: "a" is already defined`},
+		{"lda #$100", "line 1: immediate value $100 doesn't fit in a byte"},
+		{"stx $1234,y", "line 1: $1234 isn't a zero page address"},
+	}
+
+	assembler := asm.NewAssembler(cpu.Variant2A03)
+
+	for _, test := range tests {
+		_, err := assembler.Assemble(test.source, 0)
+
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("Assembling %q returned error %v, expected %q", test.source, err, test.err)
+		}
+	}
+}
+
+// Assembles the ca65 disassembly of every opcode, which must give back the same bytes
+func TestAssembleDisassembly(t *testing.T) {
+	for _, variant := range []cpu.Variant{cpu.Variant2A03, cpu.Variant65C02} {
+		assembler := asm.NewAssembler(variant)
+		disassembler := disasm.NewDisassembler(variant)
+
+		for opcode := 0; opcode < 256; opcode++ {
+			code := []uint8{uint8(opcode), 0x34, 0x12}[:variant.Instructions()[opcode].Size]
+
+			instruction, err := disassembler.DecodeBytes(code, 0xC000)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			source := disassembler.FormatCA65(instruction)
+			program, err := assembler.Assemble(source, 0xC000)
+
+			if err != nil {
+				t.Errorf("%s: %q: %s", variant, source, err)
+				continue
+			}
+
+			if !bytes.Equal(program.Segments[0].Bytes, code) {
+				t.Errorf("%s: %q assembled to % X, expected % X", variant, source, program.Segments[0].Bytes, code)
+			}
+		}
+	}
+}
+
+func TestAssembleUnofficial(t *testing.T) {
+	program, err := asm.NewAssembler(cpu.Variant2A03).Assemble("lax ($10),y\nisb $1234\ndcp $10\nnop #$00\nnop", 0x8000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []uint8{0xB3, 0x10, 0xEF, 0x34, 0x12, 0xC7, 0x10, 0x80, 0x00, 0xEA}
+
+	if !bytes.Equal(program.Segments[0].Bytes, expected) {
+		t.Errorf("Assembled % X, expected % X", program.Segments[0].Bytes, expected)
+	}
+}
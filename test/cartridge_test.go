@@ -0,0 +1,284 @@
+package nes_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"gonesem/nes/cartridge"
+	"gonesem/nes/patch"
+)
+
+func zipROM(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+
+	writer := zip.NewWriter(&buffer)
+
+	for name, data := range files {
+		file, err := writer.Create(name)
+
+		if err != nil {
+			t.Fatalf("Failed to create %s in zip archive: %s", name, err)
+		}
+
+		file.Write(data)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close zip archive: %s", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func gzipROM(t *testing.T, data []byte) []byte {
+	var buffer bytes.Buffer
+
+	writer := gzip.NewWriter(&buffer)
+	writer.Write(data)
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close gzip archive: %s", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestCartridgeLoading(t *testing.T) {
+	rom := loadNestest()
+
+	sources := map[string]func() (*cartridge.Cartridge, error){
+		"bytes": func() (*cartridge.Cartridge, error) {
+			return cartridge.NewCartridgeFromBytes(rom)
+		},
+		"reader": func() (*cartridge.Cartridge, error) {
+			return cartridge.NewCartridgeFromReader(bytes.NewReader(rom))
+		},
+		"path": func() (*cartridge.Cartridge, error) {
+			return cartridge.NewCartridge("./data/nestest.nes")
+		},
+		"zip": func() (*cartridge.Cartridge, error) {
+			return cartridge.NewCartridgeFromBytes(zipROM(t, map[string][]byte{"readme.txt": {}, "nestest.NES": rom}))
+		},
+		"gzip": func() (*cartridge.Cartridge, error) {
+			return cartridge.NewCartridgeFromBytes(gzipROM(t, rom))
+		},
+	}
+
+	for name, source := range sources {
+		cart, err := source()
+
+		if err != nil {
+			t.Fatalf("Failed to load cartridge from %s: %s", name, err)
+		}
+
+		if cart.PRGRead(0xC000) != rom[0x10] || cart.PRGRead(0xFFFC) != rom[0x10+0x3FFC] {
+			t.Errorf("PRG ROM loaded from %s does not match nestest.nes", name)
+		}
+	}
+}
+
+func TestCartridgeLoadingRejectsAmbiguousZip(t *testing.T) {
+	rom := loadNestest()
+
+	if _, err := cartridge.NewCartridgeFromBytes(zipROM(t, map[string][]byte{"a.nes": rom, "b.nes": rom})); err == nil {
+		t.Errorf("Expected zip archive with two .nes files to be rejected")
+	}
+
+	if _, err := cartridge.NewCartridgeFromBytes(zipROM(t, map[string][]byte{"readme.txt": rom})); err == nil {
+		t.Errorf("Expected zip archive without a .nes file to be rejected")
+	}
+}
+
+// Archives holding more than the size limit are rejected as they decompress
+func TestCartridgeLoadingRejectsArchiveBomb(t *testing.T) {
+	zeros := bytes.Repeat([]byte{0}, 1<<20)
+
+	var zipBuffer, gzipBuffer bytes.Buffer
+	zipWriter := zip.NewWriter(&zipBuffer)
+	file, _ := zipWriter.Create("bomb.nes")
+	gzipWriter := gzip.NewWriter(&gzipBuffer)
+
+	for written := 0; written <= patch.MaxROMSize; written += len(zeros) {
+		file.Write(zeros)
+		gzipWriter.Write(zeros)
+	}
+
+	zipWriter.Close()
+	gzipWriter.Close()
+
+	for name, archive := range map[string][]byte{"zip": zipBuffer.Bytes(), "gzip": gzipBuffer.Bytes()} {
+		if _, err := cartridge.NewCartridgeFromBytes(archive); err == nil || !strings.Contains(err.Error(), "decompresses to more than") {
+			t.Errorf("Expected the %s archive to be rejected past the size limit, got %v", name, err)
+		}
+	}
+}
+
+func TestCartridgeDatabaseCorrectsHeader(t *testing.T) {
+	rom := append([]byte(nil), loadNestest()...)
+
+	// Claim mapper 4 with vertical mirroring, the sample database knows better
+	rom[6] = 0x41
+
+	cart, err := cartridge.NewCartridgeFromBytes(rom)
+
+	if err != nil {
+		t.Fatalf("Failed to load cartridge: %s", err)
+	}
+
+	if info := cart.Info(); !info.InDatabase || info.Mapper != 0 || info.Mirroring != cartridge.MirrorHorizontal {
+		t.Fatalf("Game database did not correct header: %+v", info)
+	}
+}
+
+func TestCartridgeDatabaseOverride(t *testing.T) {
+	rom := append([]byte(nil), loadNestest()...)
+
+	rom[6] = 0x01
+
+	builtin := cartridge.GetDatabase()
+	t.Cleanup(func() { cartridge.SetDatabase(builtin) })
+
+	// A database that doesn't list the dump leaves the header as it is
+	db, err := cartridge.ParseDatabase(strings.NewReader("<nes20db></nes20db>"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cartridge.SetDatabase(db)
+
+	cart, err := cartridge.NewCartridgeFromBytes(rom)
+
+	if err != nil {
+		t.Fatalf("Failed to load cartridge: %s", err)
+	}
+
+	if info := cart.Info(); info.InDatabase || info.Mirroring != cartridge.MirrorVertical {
+		t.Fatalf("Header changed by a database without the dump: %+v", info)
+	}
+}
+
+func TestCartridgeRejectsOversizedHeader(t *testing.T) {
+	rom := append([]byte(nil), loadNestest()...)
+
+	// NES 2.0 header with an exponent PRG ROM size of 2^27 * 7 bytes
+	rom[7] = 0x08
+	rom[4] = 27<<2 | 0x03
+	rom[9] = 0x0F
+
+	if _, err := cartridge.NewCartridgeFromBytes(rom); err == nil {
+		t.Errorf("Expected a header claiming 939MB of PRG ROM to be rejected")
+	}
+
+	// A plain bank count larger than the data that follows
+	rom = append([]byte(nil), loadNestest()...)
+	rom[4] = 0xFF
+
+	if _, err := cartridge.NewCartridgeFromBytes(rom); err == nil {
+		t.Errorf("Expected a header claiming more PRG ROM than the file holds to be rejected")
+	}
+}
+
+func TestCartridgeCleansDiskDudeHeader(t *testing.T) {
+	rom := append([]byte(nil), loadNestest()...)
+
+	copy(rom[7:16], "DiskDude!")
+
+	// Modify PRG so the dump is no longer found in the game database
+	rom[0x10+0x100] ^= 0xFF
+
+	cart, err := cartridge.NewCartridgeFromBytes(rom)
+
+	if err != nil {
+		t.Fatalf("Failed to load cartridge: %s", err)
+	}
+
+	info := cart.Info()
+
+	if info.InDatabase || !info.Cleaned || info.Mapper != 0 {
+		t.Fatalf("DiskDude! header was not cleaned: %+v", info)
+	}
+}
+
+// Returns an MMC1 image with 8 16KB PRG banks, each filled with its number, and CHR RAM
+func buildMMC1() []byte {
+	rom := make([]byte, 16+8*16384)
+	copy(rom, "NES\x1A\x08\x00\x10")
+
+	for bank := 0; bank < 8; bank++ {
+		prg := rom[16+bank*16384 : 16+(bank+1)*16384]
+
+		for i := range prg {
+			prg[i] = uint8(bank)
+		}
+	}
+
+	return rom
+}
+
+// Writes value to an MMC1 register a bit at a time through the shift register
+func writeMMC1(cart *cartridge.Cartridge, addr uint16, value uint8) {
+	for i := 0; i < 5; i++ {
+		cart.PRGWrite(addr, value>>i&0x01)
+	}
+}
+
+func TestMapper001(t *testing.T) {
+	cart, err := cartridge.NewCartridgeFromBytes(buildMMC1())
+
+	if err != nil {
+		t.Fatalf("Failed to load cartridge: %s", err)
+	}
+
+	expectBanks := func(name string, low uint8, high uint8) {
+		t.Helper()
+
+		if cart.PRGRead(0x8000) != low || cart.PRGRead(0xFFFF) != high {
+			t.Errorf("%s: banks %d and %d mapped, expected %d and %d", name, cart.PRGRead(0x8000), cart.PRGRead(0xFFFF), low, high)
+		}
+	}
+
+	expectBanks("power on", 0, 7)
+
+	writeMMC1(cart, 0xE000, 3)
+	expectBanks("last bank fixed", 3, 7)
+
+	writeMMC1(cart, 0x8000, 0x08)
+	expectBanks("first bank fixed", 0, 3)
+
+	writeMMC1(cart, 0x8000, 0x00)
+	writeMMC1(cart, 0xE000, 5)
+	expectBanks("32KB mode", 4, 5)
+
+	// A write with bit 7 set resets the shift register and fixes the last bank
+	cart.PRGWrite(0x8000, 0x01)
+	cart.PRGWrite(0x8000, 0x80)
+	writeMMC1(cart, 0xE000, 2)
+	expectBanks("reset", 2, 7)
+
+	cart.PRGWrite(0x6000, 0x42)
+	writeMMC1(cart, 0xE000, 0x12)
+
+	if cart.PRGRead(0x6000) != 0 {
+		t.Errorf("PRG RAM readable while disabled")
+	}
+
+	writeMMC1(cart, 0xE000, 0x02)
+
+	if cart.PRGRead(0x6000) != 0x42 {
+		t.Errorf("PRG RAM lost its contents while disabled")
+	}
+
+	// In 4KB mode both halves of CHR RAM can map the same bank
+	writeMMC1(cart, 0x8000, 0x1C)
+	writeMMC1(cart, 0xA000, 1)
+	writeMMC1(cart, 0xC000, 1)
+	cart.CHRWrite(0x0005, 0x99)
+
+	if cart.CHRRead(0x1005) != 0x99 {
+		t.Errorf("CHR banks 0 and 1 don't map the same 4KB bank")
+	}
+}
@@ -0,0 +1,94 @@
+package nes_test
+
+import (
+	"strings"
+	"testing"
+
+	"gonesem/nes/cheats"
+)
+
+func TestCheatDecoding(t *testing.T) {
+	tests := []struct {
+		code       string
+		address    uint16
+		value      uint8
+		compare    uint8
+		hasCompare bool
+	}{
+		{"GOSSIP", 0xD1DD, 0x14, 0x00, false},
+		{"sxiopo", 0x91D9, 0xAD, 0x00, false},
+		{"ZEXPYGLA", 0x94A7, 0x02, 0x03, true},
+		{"0075:09", 0x0075, 0x09, 0x00, false},
+		{"C000?20:EA", 0xC000, 0xEA, 0x20, true},
+		{"07F0FF", 0x07F0, 0xFF, 0x00, false},
+		{"GG:AEAEAE", 0x8088, 0x08, 0x00, false},
+		{"par:AEAEAE", 0xAEAE, 0xAE, 0x00, false},
+		{"PAR:07F0FF", 0x07F0, 0xFF, 0x00, false},
+	}
+
+	for _, test := range tests {
+		cheat, err := cheats.Decode(test.code)
+
+		if err != nil {
+			t.Fatalf("Failed to decode %s: %s", test.code, err)
+		}
+
+		if cheat.Address != test.address || cheat.Value != test.value || cheat.Compare != test.compare || cheat.HasCompare != test.hasCompare {
+			t.Errorf("%s decoded to %04X:%02X?%02X (%t), expected %04X:%02X?%02X (%t)",
+				test.code, cheat.Address, cheat.Value, cheat.Compare, cheat.HasCompare,
+				test.address, test.value, test.compare, test.hasCompare)
+		}
+	}
+}
+
+// Codes whose letters fit more than one format need a prefix, as do codes
+// that are invalid in the format their prefix names
+func TestCheatDecodingRejectsAmbiguousCodes(t *testing.T) {
+	for _, code := range []string{"AEAEAE", "AAAAAA", "GG:07F0FF", "PAR:GOSSIP", "PAR:07F0", "GG:ZEXPY"} {
+		if cheat, err := cheats.Decode(code); err == nil {
+			t.Errorf("%s decoded to %04X:%02X, expected an error", code, cheat.Address, cheat.Value)
+		}
+	}
+}
+
+func TestCheatEngine(t *testing.T) {
+	engine := cheats.NewEngine()
+
+	if err := engine.Add("C000?20:EA", "Skip JSR"); err != nil {
+		t.Fatalf("Failed to add cheat: %s", err)
+	}
+
+	if engine.PatchRead(0xC000, 0x20) != 0xEA || engine.PatchRead(0xC000, 0x4C) != 0x4C {
+		t.Errorf("Compare cheat not applied correctly")
+	}
+
+	engine.SetEnabled("c000?20:ea", false)
+
+	if engine.PatchRead(0xC000, 0x20) != 0x20 {
+		t.Errorf("Disabled cheat still applied")
+	}
+
+	ram := map[uint16]uint8{}
+	engine.Add("0075:09", "Lives")
+	engine.ApplyFreezes(func(addr uint16) uint8 { return ram[addr] }, func(addr uint16, value uint8) { ram[addr] = value })
+
+	if ram[0x0075] != 0x09 {
+		t.Errorf("RAM freeze not applied")
+	}
+
+	var sb strings.Builder
+
+	if err := cheats.Write(&sb, engine.Cheats()); err != nil {
+		t.Fatalf("Failed to write cheat list: %s", err)
+	}
+
+	list, err := cheats.Read(strings.NewReader(sb.String()))
+
+	if err != nil {
+		t.Fatalf("Failed to read cheat list: %s", err)
+	}
+
+	if len(list) != 2 || list[0].Enabled || list[0].Description != "Skip JSR" || !list[1].Enabled {
+		t.Errorf("Cheat list did not round trip: %+v", list)
+	}
+}
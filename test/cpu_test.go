@@ -6,108 +6,34 @@ import (
 	"io"
 	"log"
 	"os"
-	"strings"
+	"path/filepath"
 	"testing"
 
 	"gonesem/nes/cpu"
+	"gonesem/nes/disasm"
+	"gonesem/nes/trace"
 )
 
 type TestMemory struct {
-	RAM [65535]uint8
+	RAM [0x10000]uint8
 }
 
 func (memory *TestMemory) Read(addr uint16) uint8 {
 	return memory.RAM[addr]
 }
 
-func (memory *TestMemory) Write(addr uint16, value uint8) {
-	memory.RAM[addr] = value
+func (memory *TestMemory) Peek(addr uint16) uint8 {
+	return memory.RAM[addr]
 }
 
-func nintendulatorDisassemble(cpuPtr *cpu.CPU) string {
-	var sb strings.Builder
-
-	opcode := cpuPtr.Read(cpuPtr.PC)
-
-	instruction := cpu.Instructions[opcode]
-
-	instructionSize := instruction.Size
-
-	sb.WriteString(fmt.Sprintf("%04X  ", cpuPtr.PC))
-
-	for i := 0; i < int(instructionSize); i++ {
-		address := cpuPtr.PC + uint16(i)
-		sb.WriteString(fmt.Sprintf("%02X ", cpuPtr.Read(address)))
-	}
-
-	sb.WriteString(strings.Repeat(" ", 16-sb.Len()))
-
-	disassembledInstruction := disassembleCPUInstruction(cpuPtr)
-	sb.WriteString(disassembledInstruction)
-
-	sb.WriteString(strings.Repeat(" ", 47-sb.Len()))
-
-	sb.WriteString(fmt.Sprintf(" A:%02X", cpuPtr.A))
-	sb.WriteString(fmt.Sprintf(" X:%02X", cpuPtr.X))
-	sb.WriteString(fmt.Sprintf(" Y:%02X", cpuPtr.Y))
-	sb.WriteString(fmt.Sprintf(" P:%02X", cpuPtr.SR))
-	sb.WriteString(fmt.Sprintf(" SP:%02X", cpuPtr.SP))
-
-	sb.WriteString(fmt.Sprintf(" CYC:%d", cpuPtr.TotalCycles))
-
-	return sb.String()
+func (memory *TestMemory) Write(addr uint16, value uint8) {
+	memory.RAM[addr] = value
 }
 
-func disassembleCPUInstruction(cpuPtr *cpu.CPU) string {
-	opcode := cpuPtr.Read(cpuPtr.PC)
-
-	instruction := cpu.Instructions[opcode]
-
-	var sb strings.Builder
-	var instructionArg uint16
-
-	if instruction.Size == 2 {
-		instructionArg = uint16(cpuPtr.Read(cpuPtr.PC + 1))
-	} else if instruction.Size == 3 {
-		instructionArg = cpuPtr.ReadWord(cpuPtr.PC + 1)
-	}
-
-	sb.WriteString(fmt.Sprintf("%s ", instruction.Mnemonic))
-
-	switch instruction.AddressingMode {
-	case cpu.AddressingModeImplied:
-		break
-	case cpu.AddressingModeAccumulator:
-		sb.WriteString("A")
-	case cpu.AddressingModeImmediate:
-		sb.WriteString(fmt.Sprintf("#$%02X", instructionArg))
-	case cpu.AddressingModeZeroPage:
-		sb.WriteString(fmt.Sprintf("$%02X", instructionArg))
-	case cpu.AddressingModeZeroPageX:
-		sb.WriteString(fmt.Sprintf("$%02X,X", instructionArg))
-	case cpu.AddressingModeZeroPageY:
-		sb.WriteString(fmt.Sprintf("$%02X,Y", instructionArg))
-	case cpu.AddressingModeRelative:
-		if instructionArg&0x80 != 0 {
-			instructionArg |= 0xFF00
-		}
-
-		sb.WriteString(fmt.Sprintf("$%02X", instructionArg+cpuPtr.PC+2))
-	case cpu.AddressingModeAbsolute:
-		sb.WriteString(fmt.Sprintf("$%04X", instructionArg))
-	case cpu.AddressingModeAbsoluteX:
-		sb.WriteString(fmt.Sprintf("$%04X,X", instructionArg))
-	case cpu.AddressingModeAbsoluteY:
-		sb.WriteString(fmt.Sprintf("$%04X,Y", instructionArg))
-	case cpu.AddressingModeIndirect:
-		sb.WriteString(fmt.Sprintf("($%04X)", instructionArg))
-	case cpu.AddressingModeIndirectX:
-		sb.WriteString(fmt.Sprintf("($%02X,X)", instructionArg))
-	case cpu.AddressingModeIndirectY:
-		sb.WriteString(fmt.Sprintf("($%02X),Y", instructionArg))
-	}
+func nintendulatorDisassemble(memory *TestMemory, cpuPtr *cpu.CPU) string {
+	instruction := disasm.NewDisassembler(cpu.Variant2A03).Decode(memory, cpuPtr.PC)
 
-	return sb.String()
+	return trace.Nintendulator(instruction, trace.StateOf(cpuPtr))
 }
 
 func loadNestest() []byte {
@@ -199,7 +125,7 @@ func TestNestestNintendulatorLog(t *testing.T) {
 		}
 
 		expected := scanner.Text()
-		actual := nintendulatorDisassemble(testCPU)
+		actual := nintendulatorDisassemble(memory, testCPU)
 
 		if expected != actual {
 			t.Fatalf("CPU disassembly did not match nestest.log\n Expected:\t%s\n Actual:\t%s\n", expected, actual)
@@ -212,3 +138,586 @@ func TestNestestNintendulatorLog(t *testing.T) {
 		}
 	}
 }
+
+// Clocks the CPU to the end of the current instruction, returning the cycles taken
+func finishInstruction(cpuPtr *cpu.CPU) int {
+	cycles := 1
+
+	for !cpuPtr.Clock() {
+		cycles++
+	}
+
+	return cycles
+}
+
+func TestNMIWaitsForInstruction(t *testing.T) {
+	memory := &TestMemory{}
+
+	// LDA $12F0,X crossing a page, then the NMI handler at $9000
+	copy(memory.RAM[0x8000:], []uint8{0xBD, 0xF0, 0x12})
+	memory.RAM[0xFFFA] = 0x00
+	memory.RAM[0xFFFB] = 0x90
+
+	testCPU := cpu.NewCPU(memory)
+
+	testCPU.PC = 0x8000
+	testCPU.X = 0x20
+	testCPU.SR = cpu.StatusUnused
+
+	testCPU.Clock()
+	testCPU.NMI()
+
+	if cycles := 1 + finishInstruction(testCPU); cycles != 5 || testCPU.PC != 0x8003 {
+		t.Fatalf("NMI interrupted the instruction, took %d cycles and left PC at $%04X", cycles, testCPU.PC)
+	}
+
+	if cycles := finishInstruction(testCPU); cycles != 7 {
+		t.Errorf("NMI took %d cycles, expected 7", cycles)
+	}
+
+	if testCPU.PC != 0x9000 {
+		t.Errorf("PC = $%04X after NMI, expected $9000", testCPU.PC)
+	}
+
+	if pushed := cpu.Status(memory.RAM[0x01FB]); pushed&cpu.StatusBreak != 0 {
+		t.Errorf("NMI pushed status $%02X, expected the break flag clear", pushed)
+	}
+
+	if memory.RAM[0x01FD] != 0x80 || memory.RAM[0x01FC] != 0x03 {
+		t.Errorf("NMI pushed return address $%02X%02X, expected $8003", memory.RAM[0x01FD], memory.RAM[0x01FC])
+	}
+}
+
+func TestJamHaltsUntilReset(t *testing.T) {
+	memory := &TestMemory{}
+
+	// INX, JAM, INX with the reset vector at $8000
+	copy(memory.RAM[0x8000:], []uint8{0xE8, 0x02, 0xE8})
+	memory.RAM[0xFFFC] = 0x00
+	memory.RAM[0xFFFD] = 0x80
+
+	testCPU := cpu.NewCPU(memory)
+
+	var jammedAt []uint16
+
+	testCPU.SetHaltCallback(func(pc uint16) {
+		jammedAt = append(jammedAt, pc)
+	})
+
+	for i := 0; i < 20; i++ {
+		finishInstruction(testCPU)
+
+		if i == 5 {
+			testCPU.NMI()
+		}
+	}
+
+	if pc, halted := testCPU.Halted(); !halted || pc != 0x8001 {
+		t.Fatalf("Halted() = $%04X, %t, expected $8001, true", pc, halted)
+	}
+
+	if len(jammedAt) != 1 || jammedAt[0] != 0x8001 {
+		t.Errorf("Halt callback called with %v, expected once with $8001", jammedAt)
+	}
+
+	if testCPU.X != 1 || testCPU.PC != 0x8002 {
+		t.Errorf("Jammed CPU kept running, X = %d and PC = $%04X", testCPU.X, testCPU.PC)
+	}
+
+	testCPU.Reset()
+
+	if _, halted := testCPU.Halted(); halted || testCPU.PC != 0x8000 {
+		t.Errorf("Reset didn't restart the CPU")
+	}
+}
+
+func TestUnstableMagic(t *testing.T) {
+	for _, magic := range []uint8{0x00, 0xEE, 0xFF} {
+		memory := &TestMemory{}
+
+		// LXA #$F5, XAA #$F5
+		copy(memory.RAM[0x8000:], []uint8{0xAB, 0xF5, 0x8B, 0xF5})
+
+		testCPU := cpu.NewCPU(memory)
+		testCPU.SetUnstableMagic(magic)
+
+		testCPU.PC = 0x8000
+		testCPU.A = 0x12
+
+		finishInstruction(testCPU)
+
+		if expected := (0x12 | magic) & 0xF5; testCPU.A != expected || testCPU.X != expected {
+			t.Errorf("LXA with magic $%02X gave A = $%02X, X = $%02X, expected $%02X", magic, testCPU.A, testCPU.X, expected)
+		}
+
+		testCPU.A, testCPU.X = 0x21, 0x3C
+
+		finishInstruction(testCPU)
+
+		if expected := (0x21 | magic) & 0x3C & 0xF5; testCPU.A != expected {
+			t.Errorf("XAA with magic $%02X gave A = $%02X, expected $%02X", magic, testCPU.A, expected)
+		}
+	}
+}
+
+// SHA, SHX, SHY and TAS store a register ANDed with the high byte of the base
+// address plus one. Crossing a page, that value also replaces the high byte
+// of the address written to.
+func TestUnstableStores(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		a, x, y uint8
+		address uint16
+		value   uint8
+		sp      uint8
+	}{
+		{"sha abs,y", []uint8{0x9F, 0xF0, 0x12}, 0xFF, 0xF7, 0x05, 0x12F5, 0x13, 0xFD},
+		{"sha abs,y page cross", []uint8{0x9F, 0xF0, 0x12}, 0xFF, 0x0F, 0x20, 0x0310, 0x03, 0xFD},
+		{"sha (zp),y", []uint8{0x93, 0x40}, 0xFF, 0xFF, 0x05, 0x12F5, 0x13, 0xFD},
+		{"sha (zp),y page cross", []uint8{0x93, 0x40}, 0x0F, 0xFF, 0x20, 0x0310, 0x03, 0xFD},
+		{"shx abs,y", []uint8{0x9E, 0xF0, 0x12}, 0x00, 0xFF, 0x05, 0x12F5, 0x13, 0xFD},
+		{"shx abs,y page cross", []uint8{0x9E, 0xF0, 0x12}, 0x00, 0x0F, 0x20, 0x0310, 0x03, 0xFD},
+		{"shy abs,x", []uint8{0x9C, 0xF0, 0x12}, 0x00, 0x05, 0xFF, 0x12F5, 0x13, 0xFD},
+		{"shy abs,x page cross", []uint8{0x9C, 0xF0, 0x12}, 0x00, 0x20, 0x0F, 0x0310, 0x03, 0xFD},
+		{"tas abs,y", []uint8{0x9B, 0xF0, 0x12}, 0xF3, 0xBF, 0x05, 0x12F5, 0x13, 0xB3},
+		{"tas abs,y page cross", []uint8{0x9B, 0xF0, 0x12}, 0xF3, 0x0F, 0x20, 0x0310, 0x03, 0x03},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memory := &TestMemory{}
+
+			copy(memory.RAM[0x8000:], test.program)
+			memory.RAM[0x40], memory.RAM[0x41] = 0xF0, 0x12
+
+			testCPU := cpu.NewCPU(memory)
+
+			testCPU.PC = 0x8000
+			testCPU.SP = 0xFD
+			testCPU.A, testCPU.X, testCPU.Y = test.a, test.x, test.y
+
+			finishInstruction(testCPU)
+
+			if memory.RAM[test.address] != test.value {
+				t.Errorf("$%04X = $%02X, expected $%02X", test.address, memory.RAM[test.address], test.value)
+			}
+
+			if testCPU.SP != test.sp {
+				t.Errorf("SP = $%02X, expected $%02X", testCPU.SP, test.sp)
+			}
+		})
+	}
+}
+
+// The cases blargg's branch_timing_tests measure, which only report on screen
+// so TestBlarggROMs can't read them
+func TestBranchTiming(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin uint16
+		opcode uint8
+		offset uint8
+		status cpu.Status
+		cycles int
+		pc     uint16
+	}{
+		{"not taken", 0x8000, 0x90, 0x10, cpu.StatusCarry, 2, 0x8002},
+		{"forward", 0x8000, 0x90, 0x10, 0, 3, 0x8012},
+		{"backward", 0x8080, 0x90, 0xF0, 0, 3, 0x8072},
+		{"forward across page", 0x80F0, 0x90, 0x20, 0, 4, 0x8112},
+		{"backward across page", 0x8010, 0x90, 0xE0, 0, 4, 0x7FF2},
+		{"to next page", 0x80FD, 0xB0, 0x01, cpu.StatusCarry, 4, 0x8100},
+		{"beq taken", 0x8000, 0xF0, 0x7F, cpu.StatusZero, 3, 0x8081},
+		{"bmi across page not taken", 0x80FE, 0x30, 0x10, 0, 2, 0x8100},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memory := &TestMemory{}
+
+			memory.RAM[test.origin], memory.RAM[test.origin+1] = test.opcode, test.offset
+
+			testCPU := cpu.NewCPU(memory)
+
+			testCPU.PC = test.origin
+			testCPU.SR = cpu.StatusUnused | test.status
+
+			if cycles := finishInstruction(testCPU); cycles != test.cycles {
+				t.Errorf("Took %d cycles, expected %d", cycles, test.cycles)
+			}
+
+			if testCPU.PC != test.pc {
+				t.Errorf("PC = $%04X, expected $%04X", testCPU.PC, test.pc)
+			}
+		})
+	}
+}
+
+func TestInterruptPolling(t *testing.T) {
+	const irqHandler, nmiHandler = 0x9000, 0xA000
+
+	tests := []struct {
+		name        string
+		program     map[uint16][]uint8
+		status      cpu.Status
+		irqAt       int // Cycle before which the IRQ line is asserted, 0 for never
+		nmiAt       int // Cycle before which an NMI is signalled, 0 for never
+		handler     uint16
+		returnAddr  uint16
+		breakPushed bool
+	}{
+		// CLI changes the flag on its last cycle, after interrupts were polled
+		{"cli latency", map[uint16][]uint8{0x8000: {0x58, 0xE8, 0xE8}}, cpu.StatusInterrupt, 1, 0, irqHandler, 0x8002, false},
+		// SEI is interrupted as the flag was clear when polled
+		{"sei", map[uint16][]uint8{0x8000: {0xEA, 0x78, 0xE8}}, 0, 2, 0, irqHandler, 0x8002, false},
+		{"branch delays irq", map[uint16][]uint8{0x8000: {0x90, 0x00, 0xE8, 0xE8}}, 0, 2, 0, irqHandler, 0x8003, false},
+		{"branch across page", map[uint16][]uint8{0x80F0: {0x90, 0x20}, 0x8112: {0xE8}}, 0, 2, 0, irqHandler, 0x8112, false},
+		{"nmi hijacks brk", map[uint16][]uint8{0x8000: {0x00, 0x00}}, 0, 0, 3, nmiHandler, 0x8002, true},
+		{"nmi hijacks irq", map[uint16][]uint8{0x8000: {0xEA}}, 0, 1, 5, nmiHandler, 0x8001, false},
+		// Too late to hijack, the NMI is taken before the BRK handler's first instruction
+		{"nmi after brk", map[uint16][]uint8{0x8000: {0x00, 0x00}}, 0, 0, 6, nmiHandler, irqHandler, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memory := &TestMemory{}
+
+			origin := uint16(0xFFFF)
+
+			for addr, code := range test.program {
+				copy(memory.RAM[addr:], code)
+				origin = min(origin, addr)
+			}
+
+			memory.RAM[0xFFFA], memory.RAM[0xFFFB] = uint8(nmiHandler&0xFF), uint8(nmiHandler>>8)
+			memory.RAM[0xFFFE], memory.RAM[0xFFFF] = uint8(irqHandler&0xFF), uint8(irqHandler>>8)
+
+			testCPU := cpu.NewCPU(memory)
+
+			testCPU.PC = origin
+			testCPU.SR = cpu.StatusUnused | test.status
+
+			for cycle := 1; ; cycle++ {
+				if cycle == test.irqAt {
+					testCPU.SetIRQ(true)
+				}
+
+				if cycle == test.nmiAt {
+					testCPU.NMI()
+				}
+
+				if testCPU.Clock() && testCPU.PC == test.handler {
+					break
+				}
+
+				if cycle > 40 {
+					t.Fatalf("Never reached handler $%04X, PC = $%04X", test.handler, testCPU.PC)
+				}
+			}
+
+			stack := memory.RAM[0x0100+uint16(testCPU.SP)+1:]
+			returnAddr := uint16(stack[2])<<8 | uint16(stack[1])
+
+			if returnAddr != test.returnAddr {
+				t.Errorf("Return address $%04X, expected $%04X", returnAddr, test.returnAddr)
+			}
+
+			if breakPushed := cpu.Status(stack[0])&cpu.StatusBreak != 0; breakPushed != test.breakPushed {
+				t.Errorf("Pushed break flag %t, expected %t", breakPushed, test.breakPushed)
+			}
+		})
+	}
+}
+
+func TestDecimalMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		variant  cpu.Variant
+		opcode   uint8
+		a        uint8
+		operand  uint8
+		carry    bool
+		expected uint8
+		status   cpu.Status // Only carry, zero and negative are checked
+	}{
+		// N comes from the result before the high digit is corrected on the NMOS 6502
+		{"adc", cpu.VariantNMOS, 0x69, 0x58, 0x46, true, 0x05, cpu.StatusCarry | cpu.StatusNegative},
+		{"adc 65c02", cpu.Variant65C02, 0x69, 0x58, 0x46, true, 0x05, cpu.StatusCarry},
+		{"adc no carry", cpu.VariantNMOS, 0x69, 0x12, 0x34, false, 0x46, 0},
+		// Z comes from the binary sum $100 on the NMOS 6502, the decimal result on the 65C02
+		{"adc nmos zero", cpu.VariantNMOS, 0x69, 0x99, 0x67, false, 0x66, cpu.StatusCarry | cpu.StatusZero},
+		{"adc 65c02 zero", cpu.Variant65C02, 0x69, 0x99, 0x01, false, 0x00, cpu.StatusCarry | cpu.StatusZero},
+		{"sbc", cpu.VariantNMOS, 0xE9, 0x46, 0x12, true, 0x34, cpu.StatusCarry},
+		{"sbc borrow", cpu.Variant65C02, 0xE9, 0x12, 0x21, true, 0x91, cpu.StatusNegative},
+		{"2a03 binary", cpu.Variant2A03, 0x69, 0x58, 0x46, true, 0x9F, cpu.StatusNegative},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memory := &TestMemory{}
+
+			copy(memory.RAM[0x8000:], []uint8{test.opcode, test.operand})
+
+			testCPU := cpu.NewCPUVariant(memory, test.variant)
+
+			testCPU.PC = 0x8000
+			testCPU.A = test.a
+			testCPU.SR = cpu.StatusUnused | cpu.StatusDecimal
+
+			if test.carry {
+				testCPU.SR |= cpu.StatusCarry
+			}
+
+			finishInstruction(testCPU)
+
+			if testCPU.A != test.expected {
+				t.Errorf("A = $%02X, expected $%02X", testCPU.A, test.expected)
+			}
+
+			checked := cpu.StatusCarry | cpu.StatusZero | cpu.StatusNegative
+
+			if testCPU.SR&checked != test.status {
+				t.Errorf("Status = %08b, expected %08b", testCPU.SR&checked, test.status)
+			}
+		})
+	}
+}
+
+// Every pair of valid BCD operands, with and without carry, against decimal
+// arithmetic. The carry is valid on both chips and N and Z only on the 65C02,
+// which also takes a cycle to correct the result.
+func TestDecimalArithmetic(t *testing.T) {
+	toBCD := func(n int) uint8 { return uint8(n/10<<4 | n%10) }
+
+	for _, variant := range []cpu.Variant{cpu.VariantNMOS, cpu.Variant65C02} {
+		for _, opcode := range []uint8{0x69, 0xE9} {
+			memory := &TestMemory{}
+
+			for a := 0; a < 100; a++ {
+				for b := 0; b < 100; b++ {
+					for carry := 0; carry < 2; carry++ {
+						copy(memory.RAM[0x8000:], []uint8{opcode, toBCD(b)})
+
+						testCPU := cpu.NewCPUVariant(memory, variant)
+
+						testCPU.PC = 0x8000
+						testCPU.A = toBCD(a)
+						testCPU.SR = cpu.StatusUnused | cpu.StatusDecimal | cpu.Status(carry)*cpu.StatusCarry
+
+						cycles := finishInstruction(testCPU)
+
+						sum, carryOut := a+b+carry, false
+
+						if opcode == 0xE9 {
+							sum = a - b - (1 - carry)
+							carryOut = sum >= 0
+							sum = (sum + 100) % 100
+						} else {
+							carryOut = sum >= 100
+							sum %= 100
+						}
+
+						expected := toBCD(sum)
+						name := fmt.Sprintf("%s $%02X with A = $%02X, $%02X and carry %d", variant, opcode, toBCD(a), toBCD(b), carry)
+
+						if testCPU.A != expected || testCPU.SR&cpu.StatusCarry != 0 != carryOut {
+							t.Fatalf("%s: A = $%02X and carry %t, expected $%02X and %t", name, testCPU.A, testCPU.SR&cpu.StatusCarry != 0, expected, carryOut)
+						}
+
+						if variant != cpu.Variant65C02 {
+							if cycles != 2 {
+								t.Fatalf("%s: took %d cycles, expected 2", name, cycles)
+							}
+
+							continue
+						}
+
+						if zero := testCPU.SR&cpu.StatusZero != 0; zero != (expected == 0) {
+							t.Fatalf("%s: zero flag %t", name, zero)
+						}
+
+						if negative := testCPU.SR&cpu.StatusNegative != 0; negative != (expected&0x80 != 0) {
+							t.Fatalf("%s: negative flag %t", name, negative)
+						}
+
+						if cycles != 3 {
+							t.Fatalf("%s: took %d cycles, expected 3", name, cycles)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestWaitForInterrupt(t *testing.T) {
+	memory := &TestMemory{}
+
+	// WAI, INX with interrupts disabled so the IRQ only wakes the CPU
+	copy(memory.RAM[0x8000:], []uint8{0xCB, 0xE8})
+
+	testCPU := cpu.NewCPUVariant(memory, cpu.Variant65C02)
+
+	testCPU.PC = 0x8000
+	testCPU.SR = cpu.StatusUnused | cpu.StatusInterrupt
+
+	finishInstruction(testCPU)
+
+	for i := 0; i < 10; i++ {
+		finishInstruction(testCPU)
+	}
+
+	if testCPU.PC != 0x8001 || testCPU.X != 0 {
+		t.Fatalf("PC = $%04X and X = $%02X while waiting, expected $8001 and $00", testCPU.PC, testCPU.X)
+	}
+
+	testCPU.SetIRQ(true)
+
+	finishInstruction(testCPU)
+
+	if testCPU.PC != 0x8002 || testCPU.X != 1 {
+		t.Errorf("PC = $%04X and X = $%02X after the IRQ, expected $8002 and $01", testCPU.PC, testCPU.X)
+	}
+}
+
+// An interrupt that wakes WAI is taken if it isn't masked, returning to the
+// instruction after the WAI
+func TestWaitTakesInterrupt(t *testing.T) {
+	const irqHandler, nmiHandler = 0x9000, 0xA000
+
+	tests := []struct {
+		name    string
+		status  cpu.Status
+		nmi     bool
+		handler uint16
+	}{
+		{"irq", 0, false, irqHandler},
+		{"nmi", cpu.StatusInterrupt, true, nmiHandler},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memory := &TestMemory{}
+
+			copy(memory.RAM[0x8000:], []uint8{0xCB, 0xE8})
+			memory.RAM[0xFFFA], memory.RAM[0xFFFB] = uint8(nmiHandler&0xFF), uint8(nmiHandler>>8)
+			memory.RAM[0xFFFE], memory.RAM[0xFFFF] = uint8(irqHandler&0xFF), uint8(irqHandler>>8)
+
+			testCPU := cpu.NewCPUVariant(memory, cpu.Variant65C02)
+
+			testCPU.PC = 0x8000
+			testCPU.SR = cpu.StatusUnused | test.status
+
+			for i := 0; i < 5; i++ {
+				finishInstruction(testCPU)
+			}
+
+			if test.nmi {
+				testCPU.NMI()
+			} else {
+				testCPU.SetIRQ(true)
+			}
+
+			for i := 0; i < 3 && testCPU.PC != test.handler; i++ {
+				finishInstruction(testCPU)
+			}
+
+			if testCPU.PC != test.handler {
+				t.Fatalf("PC = $%04X, expected the handler at $%04X", testCPU.PC, test.handler)
+			}
+
+			stack := memory.RAM[0x0100+uint16(testCPU.SP)+1:]
+
+			if returnAddr := uint16(stack[2])<<8 | uint16(stack[1]); returnAddr != 0x8001 {
+				t.Errorf("Return address $%04X, expected $8001", returnAddr)
+			}
+		})
+	}
+}
+
+// STP stops the 65C02 until reset, interrupts don't wake it
+func TestStopUntilReset(t *testing.T) {
+	memory := &TestMemory{}
+
+	// STP, INX with the reset vector at $8000
+	copy(memory.RAM[0x8000:], []uint8{0xDB, 0xE8})
+	memory.RAM[0xFFFC] = 0x00
+	memory.RAM[0xFFFD] = 0x80
+
+	testCPU := cpu.NewCPUVariant(memory, cpu.Variant65C02)
+
+	for i := 0; i < 20; i++ {
+		finishInstruction(testCPU)
+
+		if i == 5 {
+			testCPU.NMI()
+			testCPU.SetIRQ(true)
+		}
+	}
+
+	if pc, halted := testCPU.Halted(); !halted || pc != 0x8000 {
+		t.Fatalf("Halted() = $%04X, %t, expected $8000, true", pc, halted)
+	}
+
+	if testCPU.X != 0 {
+		t.Errorf("Stopped CPU kept running, X = %d", testCPU.X)
+	}
+
+	testCPU.SetIRQ(false)
+	testCPU.Reset()
+
+	if _, halted := testCPU.Halted(); halted || testCPU.PC != 0x8000 {
+		t.Errorf("Reset didn't restart the CPU")
+	}
+}
+
+/*
+*
+Klaus Dormann's 6502 functional tests, run from data/functional when present.
+The tests loop on the same instruction when they fail or succeed, the binaries
+from the project's bin_files directory succeed at the addresses below.
+*
+*/
+func TestFunctional(t *testing.T) {
+	tests := []struct {
+		file    string
+		variant cpu.Variant
+		success uint16
+	}{
+		{"6502_functional_test.bin", cpu.VariantNMOS, 0x3469},
+		{"65C02_extended_opcodes_test.bin", cpu.Variant65C02, 0x24F1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			image, err := os.ReadFile(filepath.Join("data", "functional", test.file))
+
+			if err != nil {
+				t.Skipf("Functional test not available: %s", err)
+			}
+
+			memory := &TestMemory{}
+
+			copy(memory.RAM[:], image)
+
+			testCPU := cpu.NewCPUVariant(memory, test.variant)
+
+			testCPU.PC = 0x0400
+
+			for {
+				pc := testCPU.PC
+
+				finishInstruction(testCPU)
+
+				if testCPU.PC == pc {
+					break
+				}
+			}
+
+			if testCPU.PC != test.success {
+				t.Errorf("Trapped at $%04X, expected $%04X", testCPU.PC, test.success)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+; Reports through blargg's $6000 status protocol like his test ROMs do, so
+; the harness is checked end to end when none of them are present. The first
+; run waits for two NMIs and asks for a reset, the second checks that RAM
+; kept the NMI count across the reset and reports that it passed.
+
+PPUCTRL   = $2000
+PPUSTATUS = $2002
+status    = $6000
+signature = $6001
+text      = $6004
+resets    = $6010           ; $A5 once a reset has been requested
+nmis      = $00             ; RAM isn't cleared by reset
+
+        .org $C000
+reset:  sei
+        cld
+        ldx #$FF
+        txs
+        lda #$80            ; Running
+        sta status
+        lda #$DE
+        sta signature
+        lda #$B0
+        sta signature + 1
+        lda #$61
+        sta signature + 2
+        lda resets
+        cmp #$A5
+        beq check
+
+        lda #$A5
+        sta resets
+        lda #0
+        sta nmis
+@vblank:
+        bit PPUSTATUS       ; Waits for the PPU to warm up before enabling NMI
+        bpl @vblank
+        lda #$80
+        sta PPUCTRL
+@wait:  lda nmis
+        cmp #2
+        bcc @wait
+        lda #0
+        sta PPUCTRL
+        lda #$81            ; Requests a reset
+        sta status
+@forever:
+        jmp @forever
+
+check:  ldx #0
+        lda nmis
+        cmp #2
+        bcc failed
+@copy:  lda passed, x
+        sta text, x
+        beq @done
+        inx
+        bne @copy
+@done:  lda #0
+        sta status
+@forever:
+        jmp @forever
+
+failed: lda #2
+        sta status
+@forever:
+        jmp @forever
+
+nmi:    inc nmis
+        rti
+
+passed: .byte "NMI count kept across reset", $0A, 0
+
+        .org $FFFA
+        .word nmi, reset, reset
@@ -0,0 +1,218 @@
+package nes_test
+
+import (
+	"strings"
+	"testing"
+
+	"gonesem/nes"
+	"gonesem/nes/asm"
+	"gonesem/nes/cartridge"
+	"gonesem/nes/color"
+	"gonesem/nes/cpu"
+	"gonesem/nes/debugger"
+)
+
+const debuggerProgram = `
+	.org $C000
+reset:  ldx #$00
+loop:   jsr increment
+        inx
+        stx $10
+        jmp loop
+increment:
+        lda $20
+        clc
+        adc #$01
+        sta $20
+        rts
+video:  lda #$20
+        sta $2006
+        lda #$00
+        sta $2006
+        lda #$55
+        sta $2007
+        jmp video
+`
+
+// Returns a debugger attached to a console running source from its reset label
+func newDebugger(t *testing.T, source string) (*debugger.Debugger, map[string]uint16) {
+	return newRegionDebugger(t, source, cartridge.RegionNTSC)
+}
+
+// Like newDebugger, with the console running with region's timing
+func newRegionDebugger(t *testing.T, source string, region cartridge.Region) (*debugger.Debugger, map[string]uint16) {
+	program, err := asm.NewAssembler(cpu.Variant2A03).Assemble(source, 0xC000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := make(map[uint16][]byte)
+
+	for _, segment := range program.Segments {
+		code[segment.Address] = segment.Bytes
+	}
+
+	cart, err := cartridge.NewCartridgeFromBytes(buildNROM(code, program.Symbols["reset"]))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cart.SetRegion(region)
+
+	return debugger.NewDebugger(nes.NewNES(cart, color.DefaultPalette)), program.Symbols
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	consoleDebugger, symbols := newDebugger(t, debuggerProgram)
+	cpuPtr := consoleDebugger.Console().CPU()
+
+	if stop := consoleDebugger.StepInto(); stop.Reason != debugger.ReasonStep || cpuPtr.PC != symbols["loop"] {
+		t.Fatalf("Stepped into %s at $%04X, expected a step to $%04X", stop, cpuPtr.PC, symbols["loop"])
+	}
+
+	// Over the JSR, which runs the whole subroutine
+	if consoleDebugger.StepOver(); cpuPtr.PC != symbols["loop"]+3 || consoleDebugger.ReadMemory(0x20, 1)[0] != 1 {
+		t.Fatalf("Stepped over to $%04X, expected $%04X with the subroutine run", cpuPtr.PC, symbols["loop"]+3)
+	}
+
+	condition, err := debugger.ParseCondition("X == 3 && C == 0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	breakpoint := consoleDebugger.AddBreakpoint(symbols["increment"], condition)
+
+	stop := consoleDebugger.Continue()
+
+	if stop.Reason != debugger.ReasonBreakpoint || stop.Breakpoint != breakpoint || cpuPtr.PC != symbols["increment"] || cpuPtr.X != 3 {
+		t.Fatalf("Continued to %s at $%04X with X = %d, expected breakpoint %d with X = 3", stop, cpuPtr.PC, cpuPtr.X, breakpoint.ID)
+	}
+
+	if consoleDebugger.StepOut(); cpuPtr.PC != symbols["loop"]+3 || cpuPtr.A != 4 {
+		t.Fatalf("Stepped out to $%04X with A = %d, expected $%04X with A = 4", cpuPtr.PC, cpuPtr.A, symbols["loop"]+3)
+	}
+
+	if err := consoleDebugger.Remove(breakpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := consoleDebugger.Remove(breakpoint.ID); err == nil {
+		t.Error("Removed a breakpoint twice")
+	}
+}
+
+func TestDebuggerWatchpoints(t *testing.T) {
+	consoleDebugger, symbols := newDebugger(t, debuggerProgram)
+	cpuPtr := consoleDebugger.Console().CPU()
+
+	consoleDebugger.AddWatchpoint(debugger.BusCPU, 0x0010, 0x0010, debugger.AccessWrite)
+
+	// Disabled watchpoints never stop it
+	consoleDebugger.AddWatchpoint(debugger.BusCPU, 0x0020, 0x0020, debugger.AccessWrite).Enabled = false
+
+	stop := consoleDebugger.Continue()
+
+	if stop.Reason != debugger.ReasonWatchpoint || stop.Address != 0x0010 || stop.Value != 1 || !stop.Write {
+		t.Fatalf("Continued to %s, expected a write of $01 to $0010", stop)
+	}
+
+	// Stopped after the STX
+	if cpuPtr.PC != symbols["loop"]+6 {
+		t.Errorf("Watchpoint stopped at $%04X, expected $%04X", cpuPtr.PC, symbols["loop"]+6)
+	}
+
+	videoDebugger, symbols := newDebugger(t, strings.Replace(debuggerProgram, "reset:  ldx", "        ldx", 1)+"reset = video\n")
+
+	videoDebugger.AddWatchpoint(debugger.BusPPU, 0x2000, 0x23FF, debugger.AccessReadWrite)
+
+	if stop := videoDebugger.Continue(); stop.Reason != debugger.ReasonWatchpoint || stop.Address != 0x2000 || stop.Value != 0x55 {
+		t.Fatalf("Continued to %s, expected a PPU write of $55 to $2000", stop)
+	}
+
+	if pc := videoDebugger.Console().CPU().PC; pc != symbols["video"]+15 {
+		t.Errorf("PPU watchpoint stopped at $%04X, expected $%04X", pc, symbols["video"]+15)
+	}
+}
+
+func TestDebuggerRunTo(t *testing.T) {
+	consoleDebugger, _ := newDebugger(t, debuggerProgram)
+	console := consoleDebugger.Console()
+
+	if stop := consoleDebugger.RunToFrame(2); stop.Reason != debugger.ReasonStep || console.FrameCount() != 2 {
+		t.Fatalf("Ran to %s in frame %d, expected a step after 2 frames", stop, console.FrameCount())
+	}
+
+	consoleDebugger.RunToScanline(100)
+
+	if scanline, _ := console.PPU().Position(); scanline != 100 {
+		t.Errorf("Ran to scanline %d, expected 100", scanline)
+	}
+}
+
+func TestDebuggerEditing(t *testing.T) {
+	consoleDebugger, _ := newDebugger(t, debuggerProgram)
+	cpuPtr := consoleDebugger.Console().CPU()
+
+	for _, edit := range []struct {
+		register string
+		value    int
+	}{{"a", 0x12}, {"PC", 0xC123}, {"C", 1}, {"z", 1}} {
+		if err := consoleDebugger.SetRegister(edit.register, edit.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if cpuPtr.A != 0x12 || cpuPtr.PC != 0xC123 || cpuPtr.SR&(cpu.StatusCarry|cpu.StatusZero) != cpu.StatusCarry|cpu.StatusZero {
+		t.Errorf("Registers A = $%02X, PC = $%04X and P = $%02X after editing", cpuPtr.A, cpuPtr.PC, uint8(cpuPtr.SR))
+	}
+
+	for _, edit := range []struct {
+		register string
+		value    int
+	}{{"A", 0x100}, {"Q", 0}, {"C", 2}} {
+		if err := consoleDebugger.SetRegister(edit.register, edit.value); err == nil {
+			t.Errorf("Set %s to %d", edit.register, edit.value)
+		}
+	}
+
+	consoleDebugger.WriteMemory(0x0300, []uint8{1, 2, 3})
+
+	if values := consoleDebugger.ReadMemory(0x0300, 3); values[0] != 1 || values[2] != 3 {
+		t.Errorf("Read back % X", values)
+	}
+
+	for _, text := range []string{"A", "Q == 1", "A == $1G", "A == 1 &&"} {
+		if _, err := debugger.ParseCondition(text); err == nil {
+			t.Errorf("Parsed condition %q", text)
+		}
+	}
+}
+
+func TestDebuggerREPL(t *testing.T) {
+	consoleDebugger, _ := newDebugger(t, debuggerProgram)
+
+	var output strings.Builder
+
+	commands := "b C00B if A >= 2\nc\n\nl\nset X $7F\nm 20 1\nq\n"
+
+	if err := consoleDebugger.RunREPL(strings.NewReader(commands), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	// The empty line continues to the breakpoint again
+	for _, expected := range []string{
+		"Breakpoint 1 at $C00B",
+		"Stopped: breakpoint 1 at $C00B\nC00B  A5 20     LDA $20                         A:02",
+		"Stopped: breakpoint 1 at $C00B\nC00B  A5 20     LDA $20                         A:03",
+		"1: break $C00B if A >= 2, 2 hits",
+		"X:7F",
+		"0020  03",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("REPL output missing %q:\n%s", expected, output.String())
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package nes_test
+
+import (
+	"strings"
+	"testing"
+
+	"gonesem/nes/cpu"
+	"gonesem/nes/disasm"
+)
+
+func TestDisassemble(t *testing.T) {
+	symbols := disasm.Symbols{0x0010: "pointer", 0x2002: "PPUSTATUS", 0xC010: "loop"}
+
+	tests := []struct {
+		variant  cpu.Variant
+		code     []uint8
+		expected string
+		ca65     string
+		target   uint16
+		official bool
+	}{
+		{cpu.Variant2A03, []uint8{0xEA}, "NOP", "nop", 0, true},
+		{cpu.Variant2A03, []uint8{0x0A}, "ASL A", "asl a", 0, true},
+		{cpu.Variant2A03, []uint8{0xA9, 0x2C}, "LDA #$2C", "lda #$2C", 0, true},
+		{cpu.Variant2A03, []uint8{0xB1, 0x10}, "LDA (pointer),Y", "lda (pointer),y", 0x0010, true},
+		{cpu.Variant2A03, []uint8{0xAD, 0x02, 0x20}, "LDA PPUSTATUS", "lda PPUSTATUS", 0x2002, true},
+		{cpu.Variant2A03, []uint8{0x8D, 0x10, 0x00}, "STA pointer", "sta a:pointer", 0x0010, true},
+		{cpu.Variant2A03, []uint8{0xBD, 0x34, 0x00}, "LDA $0034,X", "lda a:$0034,x", 0x0034, true},
+		{cpu.Variant2A03, []uint8{0x6C, 0xFC, 0xFF}, "JMP ($FFFC)", "jmp ($FFFC)", 0xFFFC, true},
+		{cpu.Variant2A03, []uint8{0xD0, 0x0E}, "BNE loop", "bne loop", 0xC010, true},
+		{cpu.Variant2A03, []uint8{0xF0, 0xFE}, "BEQ $C000", "beq $C000", 0xC000, true},
+		{cpu.Variant2A03, []uint8{0xA7, 0x10}, "LAX pointer", ".byte $A7, $10 ; lax $10", 0x0010, false},
+		{cpu.Variant2A03, []uint8{0xEB, 0x01}, "SBC #$01", ".byte $EB, $01 ; sbc #$01", 0, false},
+		{cpu.Variant65C02, []uint8{0xB2, 0x10}, "LDA (pointer)", "lda (pointer)", 0x0010, true},
+		{cpu.Variant65C02, []uint8{0x7C, 0x00, 0x90}, "JMP ($9000,X)", "jmp ($9000,x)", 0x9000, true},
+		{cpu.Variant65C02, []uint8{0x8F, 0x10, 0x0D}, "BBS0 pointer, loop", "bbs0 pointer, loop", 0xC010, true},
+		{cpu.Variant65C02, []uint8{0xDB}, "STP", ".byte $DB ; stp", 0, true},
+	}
+
+	for _, test := range tests {
+		disassembler := disasm.NewDisassembler(test.variant)
+		disassembler.SetSymbols(symbols)
+
+		instruction, err := disassembler.DecodeBytes(test.code, 0xC000)
+
+		if err != nil {
+			t.Errorf("% X: %s", test.code, err)
+			continue
+		}
+
+		if actual := disassembler.Format(instruction); actual != test.expected {
+			t.Errorf("% X formatted as %q, expected %q", test.code, actual, test.expected)
+		}
+
+		if actual := disassembler.FormatCA65(instruction); actual != test.ca65 {
+			t.Errorf("% X formatted for ca65 as %q, expected %q", test.code, actual, test.ca65)
+		}
+
+		if instruction.Length() != len(test.code) || instruction.Target != test.target || instruction.Official != test.official {
+			t.Errorf("% X decoded to length %d, target $%04X and official %t", test.code, instruction.Length(), instruction.Target, instruction.Official)
+		}
+	}
+}
+
+func TestDisassembleTruncated(t *testing.T) {
+	disassembler := disasm.NewDisassembler(cpu.Variant2A03)
+
+	if _, err := disassembler.DecodeBytes([]uint8{0x4C, 0x00}, 0x8000); err == nil {
+		t.Error("Decoded a 3 byte instruction from 2 bytes")
+	}
+}
+
+func TestDisassembleMemory(t *testing.T) {
+	memory := &TestMemory{}
+
+	copy(memory.RAM[0x8000:], []uint8{0x78, 0xA2, 0xFF, 0x9A, 0x4C, 0x00, 0x80})
+
+	instructions := disasm.NewDisassembler(cpu.Variant2A03).Disassemble(memory, 0x8000, 4)
+
+	var lines []string
+
+	for _, instruction := range instructions {
+		lines = append(lines, instruction.String())
+	}
+
+	if actual, expected := strings.Join(lines, "; "), "SEI; LDX #$FF; TXS; JMP $8000"; actual != expected {
+		t.Errorf("Disassembled %q, expected %q", actual, expected)
+	}
+}
+
+func TestWriteCA65(t *testing.T) {
+	disassembler := disasm.NewDisassembler(cpu.Variant2A03)
+	disassembler.SetSymbols(disasm.Symbols{0x8000: "reset", 0xFFFC: "vector"})
+
+	var source strings.Builder
+
+	// A trailing byte which isn't a whole instruction is written as data
+	if err := disassembler.WriteCA65(&source, []uint8{0x78, 0x6C, 0xFC, 0xFF, 0x4C, 0x00, 0x80, 0xAD}, 0x8000); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `.setcpu "6502"
+vector = $FFFC
+.org $8000
+reset:
+	sei
+	jmp (vector)
+	jmp reset
+	.byte $AD
+`
+
+	if source.String() != expected {
+		t.Errorf("Wrote:\n%s\nExpected:\n%s", source.String(), expected)
+	}
+}
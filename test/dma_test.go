@@ -0,0 +1,90 @@
+package nes_test
+
+import "testing"
+
+// Fills $0200-$02FF with its offsets and copies the page to OAM from offset 4
+const dmaProgram = `
+	.org $C000
+reset:  ldx #$00
+fill:   txa
+        sta $0200,x
+        inx
+        bne fill
+        lda #$04
+        sta $2003
+        lda #$02
+dma:    sta $4014
+copied: nop
+done:   jmp done
+`
+
+func TestOAMDMA(t *testing.T) {
+	consoleDebugger, symbols := newDebugger(t, dmaProgram)
+	console := consoleDebugger.Console()
+	cpuPtr := console.CPU()
+
+	consoleDebugger.AddBreakpoint(symbols["copied"], nil)
+	consoleDebugger.AddBreakpoint(symbols["done"], nil)
+
+	consoleDebugger.Continue()
+	start := cpuPtr.TotalCycles
+	consoleDebugger.Continue()
+
+	// The NOP takes 2 cycles after the stall
+	if stall := cpuPtr.TotalCycles - start - 2; stall != 513 && stall != 514 {
+		t.Errorf("DMA stalled the CPU for %d cycles, expected 513 or 514", stall)
+	}
+
+	oam := console.PPU().OAM()
+
+	for i, value := range oam {
+		if expected := uint8(i - 4); value != expected {
+			t.Fatalf("OAM[$%02X] = $%02X, expected $%02X", i, value, expected)
+		}
+	}
+
+	// The copy wraps around to where it started, bits 2-4 of the sprite
+	// attribute bytes read back as 0
+	for _, test := range []struct {
+		address uint8
+		value   uint8
+	}{{0x04, 0x00}, {0x06, 0x02 & 0xE3}, {0x1E, 0x1A & 0xE3}, {0x1F, 0x1B}} {
+		console.Write(0x2003, test.address)
+
+		if peeked, read := console.Peek(0x2004), console.Read(0x2004); peeked != test.value || read != test.value {
+			t.Errorf("Peeked $%02X and read $%02X from OAM[$%02X], expected $%02X", peeked, read, test.address, test.value)
+		}
+	}
+}
+
+// A state saved in the middle of a DMA finishes the copy once loaded
+func TestSaveStateDuringDMA(t *testing.T) {
+	consoleDebugger, symbols := newDebugger(t, dmaProgram)
+	console := consoleDebugger.Console()
+
+	consoleDebugger.AddBreakpoint(symbols["copied"], nil)
+	consoleDebugger.Continue()
+
+	for i := 0; i < 3*100; i++ {
+		console.Clock()
+	}
+
+	clone := console.Clone()
+
+	for i := 0; i < 3*600; i++ {
+		console.Clock()
+		clone.Clock()
+	}
+
+	if console.PPU().OAM() != clone.PPU().OAM() {
+		t.Errorf("OAM differs after loading a state saved during DMA")
+	}
+
+	if console.CPU().TotalCycles != clone.CPU().TotalCycles || console.CPU().PC != clone.CPU().PC {
+		t.Errorf("CPU at $%04X after %d cycles, loaded state at $%04X after %d cycles", console.CPU().PC, console.CPU().TotalCycles, clone.CPU().PC, clone.CPU().TotalCycles)
+	}
+
+	if oam := clone.PPU().OAM(); oam[0xFF] != 0xFB {
+		t.Errorf("OAM[$FF] = $%02X after loading, expected the copy finished", oam[0xFF])
+	}
+}
@@ -0,0 +1,202 @@
+package nes_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gonesem/nes/gdb"
+)
+
+// Speaks GDB's remote protocol to the server, as GDB would
+type gdbClient struct {
+	t           *testing.T
+	conn        net.Conn
+	reader      *bufio.Reader
+	acknowledge bool
+}
+
+func newGDBClient(t *testing.T, source string) (*gdbClient, map[string]uint16) {
+	consoleDebugger, symbols := newDebugger(t, source)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go gdb.NewServer(consoleDebugger).Serve(listener)
+
+	return dialGDB(t, listener.Addr().String()), symbols
+}
+
+// Opens another connection to the server at address, which serves it once
+// the previous session ends
+func dialGDB(t *testing.T, address string) *gdbClient {
+	conn, err := net.Dial("tcp", address)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return &gdbClient{t: t, conn: conn, reader: bufio.NewReader(conn), acknowledge: true}
+}
+
+func (client *gdbClient) send(data string) {
+	var checksum uint8
+
+	for i := 0; i < len(data); i++ {
+		checksum += data[i]
+	}
+
+	if _, err := fmt.Fprintf(client.conn, "$%s#%02x", data, checksum); err != nil {
+		client.t.Fatal(err)
+	}
+}
+
+// Reads a reply, acknowledging it
+func (client *gdbClient) receive() string {
+	if client.acknowledge {
+		if ack, err := client.reader.ReadByte(); err != nil || ack != '+' {
+			client.t.Fatalf("Read %q instead of an acknowledgement: %v", ack, err)
+		}
+	}
+
+	if _, err := client.reader.ReadString('$'); err != nil {
+		client.t.Fatal(err)
+	}
+
+	data, err := client.reader.ReadString('#')
+
+	if err != nil {
+		client.t.Fatal(err)
+	}
+
+	if _, err := io.ReadFull(client.reader, make([]byte, 2)); err != nil {
+		client.t.Fatal(err)
+	}
+
+	if client.acknowledge {
+		client.conn.Write([]byte("+"))
+	}
+
+	return strings.TrimSuffix(data, "#")
+}
+
+// Sends a packet and checks the reply
+func (client *gdbClient) expect(data string, reply string) {
+	client.t.Helper()
+	client.send(data)
+
+	if actual := client.receive(); actual != reply {
+		client.t.Errorf("%q replied %q, expected %q", data, actual, reply)
+	}
+}
+
+func TestGDBRegistersAndMemory(t *testing.T) {
+	client, _ := newGDBClient(t, debuggerProgram)
+
+	client.send("qSupported:swbreak+;hwbreak+")
+
+	if supported := client.receive(); !strings.Contains(supported, "qXfer:features:read+") {
+		t.Errorf("qSupported replied %q", supported)
+	}
+
+	client.expect("?", "S05")
+
+	// A, X, Y, P, SP then PC little-endian, at the reset vector after power on
+	client.expect("g", "00000024fd00c0")
+	client.expect("P0=42", "OK")
+	client.expect("P5=34c1", "OK")
+	client.expect("p0", "42")
+	client.expect("p5", "34c1")
+	client.expect("G01020324ff00c0", "OK")
+	client.expect("g", "01020324ff00c0")
+	client.expect("p9", "E01")
+
+	client.expect("M0300,3:aabbcc", "OK")
+	client.expect("m0300,3", "aabbcc")
+	client.expect("mc000,3", "a20020")
+
+	// Hardware registers are peeked, PPUSTATUS is clear until vertical blank
+	client.expect("m2000,8", "0000000000000000")
+
+	client.send("qXfer:features:read:target.xml:0,20")
+
+	if part := client.receive(); !strings.HasPrefix(part, "m<?xml") {
+		t.Errorf("Target description started %q", part)
+	}
+
+	client.expect("vMustReplyEmpty", "")
+	client.expect("D", "OK")
+}
+
+func TestGDBBreakpointsAndStepping(t *testing.T) {
+	client, symbols := newGDBClient(t, debuggerProgram)
+
+	client.expect("s", "S05")
+	client.expect("p5", fmt.Sprintf("%02x%02x", uint8(symbols["loop"]), symbols["loop"]>>8))
+
+	breakpoint := fmt.Sprintf("0,%x,1", symbols["increment"])
+
+	client.expect("Z"+breakpoint, "OK")
+	client.expect("c", "T05swbreak:;")
+	client.expect("p5", fmt.Sprintf("%02x%02x", uint8(symbols["increment"]), symbols["increment"]>>8))
+	client.expect("z"+breakpoint, "OK")
+	client.expect("z"+breakpoint, "E01")
+
+	// Watches the STX $10
+	client.expect("Z2,10,1", "OK")
+	client.expect("vCont;c", "T05watch:0010;")
+	client.expect("z2,10,1", "OK")
+
+	client.expect("Z3,20,1", "OK")
+	client.expect("c", "T05rwatch:0020;")
+	client.expect("z3,20,1", "OK")
+
+	// Runs forever without a breakpoint, until interrupted with Ctrl+C
+	client.send("c")
+	client.conn.Write([]byte{0x03})
+
+	if reply := client.receive(); reply != "S02" {
+		t.Errorf("Interrupted continue replied %q, expected S02", reply)
+	}
+
+	client.expect("QStartNoAckMode", "OK")
+	client.acknowledge = false
+
+	client.expect(fmt.Sprintf("s%x", symbols["increment"]), "S05")
+	client.expect("p5", fmt.Sprintf("%02x%02x", uint8(symbols["increment"]+2), symbols["increment"]>>8))
+	client.send("k")
+}
+
+// Dropping the connection mid-continue stops the run, so the server goes on
+// to serve the next connection, and the stop isn't left for its first run
+func TestGDBDisconnectWhileRunning(t *testing.T) {
+	client, symbols := newGDBClient(t, debuggerProgram)
+
+	// The server reads the packet before the end of the stream, and the
+	// acknowledgement isn't sent until the run stops
+	client.send("c")
+	client.conn.Close()
+
+	next := dialGDB(t, client.conn.RemoteAddr().String())
+
+	next.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	next.expect("?", "S05")
+
+	breakpoint := fmt.Sprintf("0,%x,1", symbols["increment"])
+
+	next.expect("Z"+breakpoint, "OK")
+	next.expect("c", "T05swbreak:;")
+	next.expect("p5", fmt.Sprintf("%02x%02x", uint8(symbols["increment"]), symbols["increment"]>>8))
+	next.expect("D", "OK")
+}
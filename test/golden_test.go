@@ -0,0 +1,162 @@
+package nes_test
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gonesem/nes/controller"
+	"gonesem/nes/golden"
+	"gonesem/nes/movie"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite golden hashes from the current output")
+
+var goldenOut = flag.String("golden-out", filepath.Join(os.TempDir(), "gonesem-golden"), "directory golden frame mismatch images are written to")
+
+var goldenDir = filepath.Join("data", "golden")
+
+// Holds buttons for the frames in [from, to) of a movie of length frames
+func holdButtons(frames int, from int, to int, buttons controller.Buttons) *movie.Movie {
+	script := &movie.Movie{Frames: make([]movie.Frame, frames)}
+
+	for i := from; i < to; i++ {
+		script.Frames[i].Buttons[0] = buttons
+	}
+
+	return script
+}
+
+// The picture is placeholder static until the PPU renders, so these hash the
+// machine state on every frame and none compares its final frame yet
+var goldenStates = []struct {
+	name   string
+	frames int
+	script *movie.Movie
+	frame  bool // Compare the final frame against data/golden/name.png
+}{
+	{"nestest-boot", 30, nil, false},
+	{"nestest-start", 30, holdButtons(30, 5, 10, controller.ButtonStart), false},
+	{"nestest-down", 30, holdButtons(30, 5, 10, controller.ButtonDown), false},
+}
+
+func TestGoldenStates(t *testing.T) {
+	hashesPath := filepath.Join(goldenDir, "hashes.txt")
+	hashes, err := golden.LoadHashes(hashesPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]string{}
+
+	for _, test := range goldenStates {
+		t.Run(test.name, func(t *testing.T) {
+			console := newNestestNES(t)
+			hash, err := golden.RunState(console, test.frames, test.script)
+
+			if err != nil {
+				t.Fatalf("Failed to run: %s", err)
+			}
+
+			if test.frame && *updateGolden {
+				if err := golden.WritePNG(filepath.Join(goldenDir, test.name+".png"), console.GetFrame()); err != nil {
+					t.Fatal(err)
+				}
+			} else if test.frame {
+				if err := golden.CompareFrame(goldenDir, test.name, console.GetFrame(), *goldenOut); err != nil {
+					t.Error(err)
+				}
+			}
+
+			// Input that changes nothing would make the cases meaningless
+			if other, ok := seen[hash]; ok {
+				t.Errorf("State hash is the same as %s's", other)
+			}
+
+			seen[hash] = test.name
+
+			if *updateGolden {
+				hashes[test.name] = hash
+
+				return
+			}
+
+			if expectedHash, ok := hashes[test.name]; !ok {
+				t.Fatalf("No golden hash, run go test with -update-golden to record one")
+			} else if hash != expectedHash {
+				t.Errorf("State hash %s does not match golden %s", hash, expectedHash)
+			}
+		})
+	}
+
+	if *updateGolden {
+		if err := hashes.Save(hashesPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGoldenMismatchImages(t *testing.T) {
+	expected := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	actual := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	actual.SetRGBA(2, 1, color.RGBA{G: 0xFF, A: 0xFF})
+
+	if golden.Hash(expected) == golden.Hash(actual) {
+		t.Fatalf("Different frames hash the same")
+	}
+
+	dir := t.TempDir()
+
+	if err := golden.WriteMismatch(dir, "case", expected, actual); err != nil {
+		t.Fatalf("Failed to write mismatch images: %s", err)
+	}
+
+	diff, err := golden.ReadPNG(filepath.Join(dir, "case.diff.png"))
+
+	if err != nil {
+		t.Fatalf("Failed to read diff image: %s", err)
+	}
+
+	if diff.RGBAAt(2, 1) != (color.RGBA{R: 0xFF, A: 0xFF}) || diff.RGBAAt(0, 0) != (color.RGBA{A: 0xFF}) {
+		t.Errorf("Diff image does not mark the differing pixel")
+	}
+
+	for _, suffix := range []string{".actual.png", ".expected.png"} {
+		if _, err := os.Stat(filepath.Join(dir, "case"+suffix)); err != nil {
+			t.Errorf("Missing %s image: %s", suffix, err)
+		}
+	}
+}
+
+func TestGoldenCompareFrame(t *testing.T) {
+	dir, outDir := t.TempDir(), t.TempDir()
+	expected := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	actual := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	actual.SetRGBA(2, 1, color.RGBA{G: 0xFF, A: 0xFF})
+
+	if err := golden.CompareFrame(dir, "case", actual, outDir); err == nil {
+		t.Errorf("Expected a missing golden frame to be reported")
+	}
+
+	if err := golden.WritePNG(filepath.Join(dir, "case.png"), expected); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := golden.CompareFrame(dir, "case", expected, outDir); err != nil {
+		t.Errorf("Matching frame reported: %s", err)
+	}
+
+	if err := golden.CompareFrame(dir, "case", actual, outDir); err == nil {
+		t.Fatalf("Expected a mismatch to be reported")
+	}
+
+	for _, suffix := range []string{".actual.png", ".expected.png", ".diff.png"} {
+		if _, err := os.Stat(filepath.Join(outDir, "case"+suffix)); err != nil {
+			t.Errorf("Missing %s image: %s", suffix, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package nes_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gonesem/nes/controller"
+	"gonesem/nes/movie"
+)
+
+func TestControllerShiftRegister(t *testing.T) {
+	console := newNestestNES(t)
+	console.SetButtons(0, controller.ButtonA|controller.ButtonStart|controller.ButtonRight)
+
+	console.Write(0x4016, 1)
+	console.Write(0x4016, 0)
+
+	expected := []uint8{1, 0, 0, 1, 0, 0, 0, 1, 1, 1}
+
+	for i, bit := range expected {
+		if value := console.Read(0x4016) & 0x01; value != bit {
+			t.Errorf("Read %d returned %d, expected %d", i, value, bit)
+		}
+	}
+
+	if value := console.Read(0x4017) & 0x01; value != 0 {
+		t.Errorf("Port 2 returned %d with no buttons held", value)
+	}
+}
+
+func recordMovie(t *testing.T) (*movie.Movie, []byte, [2048]uint8) {
+	console := newNestestNES(t)
+
+	session, err := movie.Record(console, true)
+
+	if err != nil {
+		t.Fatalf("Failed to start recording: %s", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		console.SetButtons(0, controller.Buttons(i*37))
+		console.SetButtons(1, controller.Buttons(i*11))
+
+		if i == 12 {
+			session.Reset()
+		}
+
+		if err := session.NextFrame(); err != nil {
+			t.Fatalf("Failed to record frame %d: %s", i, err)
+		}
+	}
+
+	return session.Movie(), append([]byte(nil), console.GetFrame().Pix...), console.RAM()
+}
+
+func TestMoviePlayback(t *testing.T) {
+	recorded, expectedFrame, expectedRAM := recordMovie(t)
+
+	formats := []struct {
+		name  string
+		write func(*bytes.Buffer, *movie.Movie) error
+		read  func(*bytes.Buffer) (*movie.Movie, error)
+	}{
+		{"fm2", func(buf *bytes.Buffer, m *movie.Movie) error { return movie.WriteFM2(buf, m) }, func(buf *bytes.Buffer) (*movie.Movie, error) { return movie.ReadFM2(buf) }},
+		{"bk2", func(buf *bytes.Buffer, m *movie.Movie) error { return movie.WriteBK2(buf, m) }, func(buf *bytes.Buffer) (*movie.Movie, error) { return movie.ReadBK2(buf) }},
+	}
+
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			if err := format.write(&buf, recorded); err != nil {
+				t.Fatalf("Failed to write movie: %s", err)
+			}
+
+			loaded, err := format.read(&buf)
+
+			if err != nil {
+				t.Fatalf("Failed to read movie: %s", err)
+			}
+
+			if len(loaded.Frames) != len(recorded.Frames) {
+				t.Fatalf("Read %d frames, expected %d", len(loaded.Frames), len(recorded.Frames))
+			}
+
+			console := newNestestNES(t)
+			session, err := movie.Play(console, loaded, movie.ModeReadOnly)
+
+			if err != nil {
+				t.Fatalf("Failed to start playback: %s", err)
+			}
+
+			for session.Mode() != movie.ModeFinished {
+				if err := session.NextFrame(); err != nil {
+					t.Fatalf("Failed to play frame: %s", err)
+				}
+			}
+
+			if !bytes.Equal(console.GetFrame().Pix, expectedFrame) || console.RAM() != expectedRAM {
+				t.Errorf("Playback diverged from the recording")
+			}
+		})
+	}
+}
+
+func TestMovieRerecord(t *testing.T) {
+	console := newNestestNES(t)
+
+	session, err := movie.Record(console, false)
+
+	if err != nil {
+		t.Fatalf("Failed to start recording: %s", err)
+	}
+
+	var saved []byte
+
+	for i := 0; i < 10; i++ {
+		if i == 4 {
+			saved = console.AppendState(nil)
+		}
+
+		console.SetButtons(0, controller.ButtonUp)
+		session.NextFrame()
+	}
+
+	if err := session.LoadState(saved); err != nil {
+		t.Fatalf("Failed to load state during recording: %s", err)
+	}
+
+	recorded := session.Movie()
+
+	if len(recorded.Frames) != 4 || recorded.Rerecords != 1 || session.Mode() != movie.ModeRecord {
+		t.Fatalf("Expected 4 frames and 1 rerecord, got %d frames and %d rerecords", len(recorded.Frames), recorded.Rerecords)
+	}
+
+	// Read-only playback only seeks, leaving the movie intact
+	playback, err := movie.Play(newNestestNES(t), recorded, movie.ModeReadOnly)
+
+	if err != nil {
+		t.Fatalf("Failed to start playback: %s", err)
+	}
+
+	playback.NextFrame()
+	playback.NextFrame()
+
+	if err := playback.LoadState(recorded.StartState); err != nil {
+		t.Fatalf("Failed to load state during playback: %s", err)
+	}
+
+	if playback.Frame() != 0 || len(recorded.Frames) != 4 || recorded.Rerecords != 1 {
+		t.Errorf("Read-only playback modified the movie")
+	}
+}
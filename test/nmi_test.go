@@ -0,0 +1,136 @@
+package nes_test
+
+import (
+	"testing"
+
+	"gonesem/nes"
+)
+
+// Enables NMIs when %s and counts them at $10
+const nmiProgram = `
+	.org $C000
+reset:  sei
+        ldx #$FF
+        txs
+        lda #$00
+        sta $10
+        lda #$80
+        sta $2000
+loop:   jmp loop
+nmi:    inc $10
+        rti
+
+	.org $FFFA
+	.word nmi
+`
+
+// Clocks console until the PPU is about to draw dot of scanline, or fails
+// after a frame
+func clockTo(t *testing.T, console *nes.NES, scanline int, dot int) {
+	t.Helper()
+
+	for i := 0; i < 341*312; i++ {
+		console.Clock()
+
+		if line, cycle := console.PPU().Position(); line == scanline && cycle == dot {
+			return
+		}
+	}
+
+	t.Fatalf("PPU never reached dot %d of scanline %d", dot, scanline)
+}
+
+// Returns whether the CPU ran on the dot just clocked, and so sampled the NMI
+// on it. TotalCycles has already moved past it.
+func cpuSampled(console *nes.NES) bool {
+	return (console.TotalCycles-1)%3 == 0
+}
+
+func TestNMI(t *testing.T) {
+	consoleDebugger, _ := newDebugger(t, nmiProgram)
+	console := consoleDebugger.Console()
+
+	consoleDebugger.RunToFrame(3)
+
+	// Boot takes the first frame or so, every one after takes an NMI
+	if nmis := console.Peek(0x10); nmis < 1 || nmis > 3 {
+		t.Errorf("Took %d NMIs in 3 frames", nmis)
+	}
+}
+
+// Enabling NMIs while in vertical blank raises the PPU's NMI output, which
+// the CPU takes as an edge. Toggling them again causes another.
+func TestNMIEnabledDuringVBlank(t *testing.T) {
+	consoleDebugger, _ := newDebugger(t, nmiProgram)
+	console := consoleDebugger.Console()
+
+	consoleDebugger.RunToFrame(2)
+	console.Write(0x2000, 0x00)
+	clockTo(t, console, 245, 0)
+	console.Write(0x0010, 0)
+
+	for i := 1; i <= 2; i++ {
+		console.Write(0x2000, 0x80)
+		clockTo(t, console, 244+2*i, 0)
+
+		if nmis := console.Peek(0x10); nmis != uint8(i) {
+			t.Fatalf("Took %d NMIs after enabling them %d times during vertical blank", nmis, i)
+		}
+
+		// The CPU has to see the output low before it sees another edge
+		console.Write(0x2000, 0x00)
+		clockTo(t, console, 245+2*i, 0)
+	}
+}
+
+// Reading PPUSTATUS the dot before vertical blank starts keeps the flag from
+// being set, reading it on the dot it's set clears it before the CPU samples
+// the NMI. Either way the frame takes no NMI.
+func TestNMISuppressedByStatusRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		dot    int
+		vblank bool
+	}{
+		{"dot before", 1, false},
+		{"same dot", 2, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consoleDebugger, _ := newDebugger(t, nmiProgram)
+			console := consoleDebugger.Console()
+
+			consoleDebugger.RunToFrame(2)
+
+			// The CPU and PPU line up differently each frame, find one where
+			// the CPU didn't run on the dot vertical blank started
+			for clockTo(t, console, 241, test.dot); cpuSampled(console); {
+				clockTo(t, console, 241, test.dot)
+			}
+
+			console.Write(0x0010, 0)
+
+			if status := console.Read(0x2002); (status&0x80 != 0) != test.vblank {
+				t.Errorf("Read PPUSTATUS $%02X", status)
+			}
+
+			clockTo(t, console, 250, 0)
+
+			if nmis := console.Peek(0x10); nmis != 0 {
+				t.Errorf("Took %d NMIs", nmis)
+			}
+
+			if status := console.Peek(0x2002); status&0x80 != 0 {
+				t.Errorf("Vertical blank set after the read, PPUSTATUS $%02X", status)
+			}
+
+			// The next frame isn't affected
+			clockTo(t, console, 250, 0)
+
+			if nmis := console.Peek(0x10); nmis != 1 {
+				t.Errorf("Took %d NMIs in the next frame", nmis)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package nes_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gonesem/nes/cartridge"
+	"gonesem/nes/patch"
+)
+
+func encodePatchNumber(value uint64) []byte {
+	var encoded []byte
+
+	for {
+		x := byte(value & 0x7F)
+		value >>= 7
+
+		if value == 0 {
+			return append(encoded, 0x80|x)
+		}
+
+		encoded = append(encoded, x)
+		value--
+	}
+}
+
+func appendPatchFooter(patchData []byte, source, target []byte) []byte {
+	patchData = binary.LittleEndian.AppendUint32(patchData, crc32.ChecksumIEEE(source))
+	patchData = binary.LittleEndian.AppendUint32(patchData, crc32.ChecksumIEEE(target))
+
+	return binary.LittleEndian.AppendUint32(patchData, crc32.ChecksumIEEE(patchData))
+}
+
+func TestIPSPatch(t *testing.T) {
+	rom := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+
+	ips := []byte("PATCH")
+	ips = append(ips, 0x00, 0x00, 0x02, 0x00, 0x02, 0xAA, 0xBB)       // Write AA BB at 2
+	ips = append(ips, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x04, 0xCC) // RLE CC x4 at 6
+	ips = append(ips, []byte("EOF")...)
+
+	patched, err := patch.Apply(rom, ips)
+
+	if err != nil {
+		t.Fatalf("Failed to apply IPS patch: %s", err)
+	}
+
+	expected := []byte{0, 1, 0xAA, 0xBB, 4, 5, 0xCC, 0xCC, 0xCC, 0xCC}
+
+	if !bytes.Equal(patched, expected) {
+		t.Fatalf("IPS patch result %X, expected %X", patched, expected)
+	}
+
+	truncated, err := patch.Apply(rom, append(ips, 0x00, 0x00, 0x05))
+
+	if err != nil {
+		t.Fatalf("Failed to apply truncating IPS patch: %s", err)
+	}
+
+	if !bytes.Equal(truncated, expected[:5]) {
+		t.Fatalf("Truncated IPS patch result %X, expected %X", truncated, expected[:5])
+	}
+
+	if rom[2] != 2 {
+		t.Fatalf("IPS patch modified the source ROM")
+	}
+}
+
+func TestUPSPatch(t *testing.T) {
+	source := []byte{0x10, 0x20, 0x30, 0x40, 0x50}
+	target := []byte{0x10, 0x21, 0x30, 0x40, 0x55, 0x66}
+
+	ups := []byte("UPS1")
+	ups = append(ups, encodePatchNumber(uint64(len(source)))...)
+	ups = append(ups, encodePatchNumber(uint64(len(target)))...)
+	ups = append(ups, encodePatchNumber(1)...)
+	ups = append(ups, 0x20^0x21, 0x00)
+	ups = append(ups, encodePatchNumber(1)...)
+	ups = append(ups, 0x50^0x55, 0x66, 0x00)
+	ups = appendPatchFooter(ups, source, target)
+
+	patched, err := patch.Apply(source, ups)
+
+	if err != nil {
+		t.Fatalf("Failed to apply UPS patch: %s", err)
+	}
+
+	if !bytes.Equal(patched, target) {
+		t.Fatalf("UPS patch result %X, expected %X", patched, target)
+	}
+
+	if _, err := patch.Apply([]byte{1, 2, 3}, ups); err == nil {
+		t.Fatalf("Expected UPS patch to reject ROM with wrong checksum")
+	}
+}
+
+func TestBPSPatch(t *testing.T) {
+	source := []byte("ABCDEFGH")
+	target := []byte("ABCDxyxyxyEF")
+
+	bps := []byte("BPS1")
+	bps = append(bps, encodePatchNumber(uint64(len(source)))...)
+	bps = append(bps, encodePatchNumber(uint64(len(target)))...)
+	bps = append(bps, encodePatchNumber(0)...)
+	bps = append(bps, encodePatchNumber((4-1)<<2|0)...) // SourceRead "ABCD"
+	bps = append(bps, encodePatchNumber((2-1)<<2|1)...) // TargetRead "xy"
+	bps = append(bps, 'x', 'y')
+	bps = append(bps, encodePatchNumber((4-1)<<2|3)...) // TargetCopy "xyxy" from offset 4
+	bps = append(bps, encodePatchNumber(4<<1)...)
+	bps = append(bps, encodePatchNumber((2-1)<<2|2)...) // SourceCopy "EF" from offset 4
+	bps = append(bps, encodePatchNumber(4<<1)...)
+	bps = appendPatchFooter(bps, source, target)
+
+	patched, err := patch.Apply(source, bps)
+
+	if err != nil {
+		t.Fatalf("Failed to apply BPS patch: %s", err)
+	}
+
+	if !bytes.Equal(patched, target) {
+		t.Fatalf("BPS patch result %q, expected %q", patched, target)
+	}
+
+	corrupt := append([]byte(nil), bps...)
+	corrupt[len(corrupt)-1] ^= 0xFF
+
+	if _, err := patch.Apply(source, corrupt); err == nil {
+		t.Fatalf("Expected BPS patch with bad checksum to be rejected")
+	}
+	// Sizes read from the patch are checked before they're used
+	for _, sizes := range [][2]uint64{{uint64(len(target)), 1 << 63}, {1 << 40, 0}} {
+		crafted := []byte("BPS1")
+		crafted = append(crafted, encodePatchNumber(uint64(len(source)))...)
+		crafted = append(crafted, encodePatchNumber(sizes[0])...)
+		crafted = append(crafted, encodePatchNumber(sizes[1])...)
+		crafted = appendPatchFooter(crafted, source, target)
+
+		if _, err := patch.Apply(source, crafted); err == nil {
+			t.Errorf("Expected BPS patch with target size %d and metadata size %d to be rejected", sizes[0], sizes[1])
+		}
+	}
+}
+
+func TestCartridgeAppliesPatchNextToROM(t *testing.T) {
+	rom := loadNestest()
+	dir := t.TempDir()
+
+	romPath := filepath.Join(dir, "nestest.nes")
+
+	if err := os.WriteFile(romPath, rom, 0o644); err != nil {
+		t.Fatalf("Failed to write ROM: %s", err)
+	}
+
+	// Replace the first PRG byte, which sits at file offset 0x10
+	ips := append([]byte("PATCH"), 0x00, 0x00, 0x10, 0x00, 0x01, 0xEA)
+	ips = append(ips, []byte("EOF")...)
+
+	if err := os.WriteFile(filepath.Join(dir, "nestest.ips"), ips, 0o644); err != nil {
+		t.Fatalf("Failed to write patch: %s", err)
+	}
+
+	cart, err := cartridge.NewCartridge(romPath)
+
+	if err != nil {
+		t.Fatalf("Failed to load patched cartridge: %s", err)
+	}
+
+	if cart.PRGRead(0xC000) != 0xEA {
+		t.Fatalf("Patch next to ROM was not applied, PRG byte is %02X", cart.PRGRead(0xC000))
+	}
+}
@@ -0,0 +1,60 @@
+package nes_test
+
+import (
+	"testing"
+
+	"gonesem/nes/controller"
+)
+
+// Every peek returns what the following read does, without causing it
+func TestPeek(t *testing.T) {
+	consoleDebugger, _ := newDebugger(t, debuggerProgram)
+	console := consoleDebugger.Console()
+
+	consoleDebugger.RunToScanline(242)
+
+	for i := 0; i < 2; i++ {
+		if status := console.Peek(0x2002); status&0x80 == 0 {
+			t.Fatalf("Peek %d of PPUSTATUS $%02X, expected vertical blank", i, status)
+		}
+	}
+
+	console.Read(0x2002)
+
+	if status := console.Peek(0x2002); status&0x80 != 0 {
+		t.Errorf("Peeked PPUSTATUS $%02X after reading it, expected vertical blank cleared", status)
+	}
+
+	// Writes $AB to $2000 then reads it back through the buffered PPUDATA
+	for _, write := range [][2]uint16{{0x2006, 0x20}, {0x2006, 0x00}, {0x2007, 0xAB}, {0x2006, 0x20}, {0x2006, 0x00}} {
+		console.Write(write[0], uint8(write[1]))
+	}
+
+	for i := 0; i < 2; i++ {
+		if first, second := console.Peek(0x2007), console.Peek(0x2007); first != second {
+			t.Fatalf("Peeked PPUDATA $%02X then $%02X", first, second)
+		}
+
+		if peeked, read := console.Peek(0x2007), console.Read(0x2007); peeked != read {
+			t.Errorf("Peeked PPUDATA $%02X, read $%02X", peeked, read)
+		}
+	}
+
+	if value := console.Peek(0x2000); value != 0 {
+		t.Errorf("Peeked PPUCTRL $%02X, expected 0", value)
+	}
+
+	console.SetButtons(0, controller.ButtonB)
+	console.Write(0x4016, 1)
+	console.Write(0x4016, 0)
+
+	for _, expected := range []uint8{0, 1, 0} {
+		if peeked, read := console.Peek(0x4016)&0x01, console.Read(0x4016)&0x01; peeked != expected || read != expected {
+			t.Errorf("Peeked controller bit %d then read %d, expected %d", peeked, read, expected)
+		}
+	}
+
+	if values := consoleDebugger.ReadMemory(0xC000, 2); values[0] != 0xA2 || values[1] != 0x00 {
+		t.Errorf("Read % X from the cartridge, expected A2 00", values)
+	}
+}
@@ -0,0 +1,65 @@
+package nes_test
+
+import (
+	"testing"
+
+	"gonesem/nes/ramsearch"
+)
+
+func TestRAMSearch(t *testing.T) {
+	var ram [2048]uint8
+
+	ram[0x0075] = 3
+	ram[0x0100] = 3
+
+	search := ramsearch.New(ram, ramsearch.Size8, false)
+
+	if err := search.FilterValue(ram, ramsearch.Equal, 3); err != nil {
+		t.Fatalf("Failed to filter: %s", err)
+	}
+
+	// Lose a life, the other address changes the other way
+	ram[0x0075] = 2
+	ram[0x0100] = 4
+
+	search.FilterPrevious(ram, ramsearch.ChangedBy, -1)
+
+	candidates := search.Candidates()
+
+	if len(candidates) != 1 || candidates[0].Address != 0x0075 || candidates[0].Value != 2 || candidates[0].Previous != 3 {
+		t.Fatalf("Unexpected candidates %+v", candidates)
+	}
+}
+
+func TestRAMSearchSigned16(t *testing.T) {
+	var ram [2048]uint8
+
+	ram[0x0010], ram[0x0011] = 0xFE, 0xFF // -2
+
+	search := ramsearch.New(ram, ramsearch.Size16, true)
+	search.FilterValue(ram, ramsearch.Less, 0)
+
+	candidates := search.Candidates()
+
+	if len(candidates) != 2 || candidates[0].Address != 0x000F || candidates[1].Address != 0x0010 || candidates[1].Value != -2 {
+		t.Fatalf("Unexpected candidates %+v", candidates)
+	}
+}
+
+func TestRAMSearchChangedByWraps(t *testing.T) {
+	var ram [2048]uint8
+
+	ram[0x0020] = 0x01
+
+	search := ramsearch.New(ram, ramsearch.Size8, false)
+
+	ram[0x0020] = 0xFF
+
+	search.FilterPrevious(ram, ramsearch.ChangedBy, -2)
+
+	candidates := search.Candidates()
+
+	if len(candidates) != 1 || candidates[0].Address != 0x0020 {
+		t.Fatalf("Unexpected candidates %+v", candidates)
+	}
+}
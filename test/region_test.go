@@ -0,0 +1,63 @@
+package nes_test
+
+import (
+	"testing"
+
+	"gonesem/nes"
+	"gonesem/nes/cartridge"
+	"gonesem/nes/color"
+	"gonesem/nes/ppu"
+)
+
+func TestRegionTiming(t *testing.T) {
+	tests := []struct {
+		region         cartridge.Region
+		expected       cartridge.Region
+		vblankScanline int
+		cpuCycles      uint64 // CPU cycles in a frame, PPU dots per frame over dots per CPU cycle
+		frameRate      float64
+	}{
+		{cartridge.RegionNTSC, cartridge.RegionNTSC, 241, 341 * 262 / 3, nes.FrameRateNTSC},
+		{cartridge.RegionMultiple, cartridge.RegionNTSC, 241, 341 * 262 / 3, nes.FrameRateNTSC},
+		{cartridge.RegionPAL, cartridge.RegionPAL, 241, 341 * 312 * 5 / 16, nes.FrameRatePAL},
+		{cartridge.RegionDendy, cartridge.RegionDendy, 291, 341 * 312 / 3, nes.FrameRatePAL},
+	}
+
+	for _, test := range tests {
+		cart, err := cartridge.NewCartridgeFromBytes(buildNROM(map[uint16][]byte{0xC000: {0x4C, 0x00, 0xC0}}, 0xC000))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cart.SetRegion(test.region)
+		console := nes.NewNES(cart, color.DefaultPalette)
+
+		if console.Region() != test.expected || console.FrameRate() != test.frameRate {
+			t.Errorf("Region %d runs as %d at %g fps, expected %d at %g fps", test.region, console.Region(), console.FrameRate(), test.expected, test.frameRate)
+		}
+
+		// Frames are timed from the start of one vertical blank to the next
+		vblankStart := func() uint64 {
+			for {
+				console.Clock()
+
+				if _, _, status := console.PPU().Registers(); status&ppu.StatusVerticalBlank != 0 {
+					// Acknowledged so the next call waits for the next frame
+					console.Read(0x2002)
+					return console.CPU().TotalCycles
+				}
+			}
+		}
+
+		first := vblankStart()
+
+		if scanline, _ := console.PPU().Position(); scanline != test.vblankScanline {
+			t.Errorf("Region %d starts vertical blank on scanline %d, expected %d", test.region, scanline, test.vblankScanline)
+		}
+
+		if cycles := vblankStart() - first; cycles < test.cpuCycles || cycles > test.cpuCycles+1 {
+			t.Errorf("Region %d ran %d CPU cycles in a frame, expected %d", test.region, cycles, test.cpuCycles)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package nes_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gonesem/nes/rewind"
+)
+
+func TestRewindBuffer(t *testing.T) {
+	buffer := rewind.NewBuffer(1 << 20)
+
+	var states [][]byte
+
+	for i := 0; i < 40; i++ {
+		state := bytes.Repeat([]byte{byte(i)}, 1000+i%3)
+		state[i] = 0xFF
+
+		states = append(states, state)
+		buffer.Push(state)
+	}
+
+	for i := len(states) - 2; i >= 0; i-- {
+		state, ok, err := buffer.Pop()
+
+		if err != nil || !ok {
+			t.Fatalf("Failed to pop state %d: %t %v", i, ok, err)
+		}
+
+		if !bytes.Equal(state, states[i]) {
+			t.Fatalf("Popped state %d does not match pushed state", i)
+		}
+	}
+
+	if _, ok, _ := buffer.Pop(); ok {
+		t.Fatalf("Expected history to be exhausted")
+	}
+}
+
+func TestRewindBufferMemoryLimit(t *testing.T) {
+	buffer := rewind.NewBuffer(4096)
+
+	for i := 0; i < 100; i++ {
+		state := make([]byte, 1024)
+
+		for j := range state {
+			state[j] = byte(i*31 + j*j)
+		}
+
+		buffer.Push(state)
+
+		if buffer.Size() > 4096 {
+			t.Fatalf("Buffer holds %d bytes, over its 4096 byte limit", buffer.Size())
+		}
+	}
+
+	if buffer.Len() == 0 {
+		t.Fatalf("Expected some history to be kept")
+	}
+}
+
+func TestRewinder(t *testing.T) {
+	console := newNestestNES(t)
+	rewinder := rewind.New(console, rewind.Config{Interval: 2, MemoryLimit: 16 << 20})
+
+	var frames [][]byte
+	var ram [][2048]uint8
+
+	for i := 0; i < 6; i++ {
+		frames = append(frames, runFrames(console, 1))
+		ram = append(ram, console.RAM())
+		rewinder.Frame()
+	}
+
+	// Snapshots were taken after frames 0, 2 and 4
+	for _, frame := range []int{4, 2, 0} {
+		if ok, err := rewinder.Rewind(); !ok || err != nil {
+			t.Fatalf("Failed to rewind to frame %d: %t %v", frame, ok, err)
+		}
+
+		if !bytes.Equal(console.GetFrame().Pix, frames[frame]) || console.RAM() != ram[frame] {
+			t.Fatalf("Rewind did not restore frame %d", frame)
+		}
+	}
+
+	if ok, _ := rewinder.Rewind(); ok {
+		t.Fatalf("Expected rewind history to be exhausted")
+	}
+}
@@ -0,0 +1,103 @@
+package nes_test
+
+import (
+	"bytes"
+	"testing"
+
+	"gonesem/nes/runahead"
+)
+
+func TestRunAheadModesAgree(t *testing.T) {
+	reference := newNestestNES(t)
+	single := newNestestNES(t)
+	second := newNestestNES(t)
+
+	singleRunAhead := runahead.New(single, 2, runahead.ModeSingleInstance)
+	secondRunAhead := runahead.New(second, 2, runahead.ModeSecondInstance)
+
+	for i := 0; i < 4; i++ {
+		runFrames(reference, 1)
+
+		singleFrame, err := singleRunAhead.NextFrame()
+
+		if err != nil {
+			t.Fatalf("Single instance run-ahead failed: %s", err)
+		}
+
+		secondFrame, err := secondRunAhead.NextFrame()
+
+		if err != nil {
+			t.Fatalf("Second instance run-ahead failed: %s", err)
+		}
+
+		// The presented frame is the one the reference console reaches 2 frames later
+		expected := runFrames(reference.Clone(), 2)
+
+		if !bytes.Equal(singleFrame.Pix, expected) || !bytes.Equal(secondFrame.Pix, expected) {
+			t.Fatalf("Run-ahead frame %d does not match the frame 2 frames ahead", i)
+		}
+
+		if single.RAM() != reference.RAM() || second.RAM() != reference.RAM() || single.TotalCycles != reference.TotalCycles {
+			t.Fatalf("Run-ahead left the console ahead of the reference on frame %d", i)
+		}
+	}
+}
+
+func TestSnapshotsDoNotAllocate(t *testing.T) {
+	console := newNestestNES(t)
+	buf := console.AppendState(nil)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = console.AppendState(buf[:0])
+
+		if err := console.LoadStateBytes(buf); err != nil {
+			t.Fatalf("Failed to load state: %s", err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Fatalf("Snapshot round trip allocated %.1f times, expected 0", allocs)
+	}
+}
+
+func BenchmarkSaveState(b *testing.B) {
+	console := newNestestNES(b)
+	buf := console.AppendState(nil)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		buf = console.AppendState(buf[:0])
+	}
+}
+
+func BenchmarkLoadState(b *testing.B) {
+	console := newNestestNES(b)
+	buf := console.AppendState(nil)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		console.LoadStateBytes(buf)
+	}
+}
+
+func BenchmarkRunAheadFrame(b *testing.B) {
+	for _, mode := range []runahead.Mode{runahead.ModeSingleInstance, runahead.ModeSecondInstance} {
+		name := map[runahead.Mode]string{runahead.ModeSingleInstance: "single", runahead.ModeSecondInstance: "second"}[mode]
+
+		b.Run(name, func(b *testing.B) {
+			runAhead := runahead.New(newNestestNES(b), 1, mode)
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				runAhead.NextFrame()
+			}
+		})
+	}
+}
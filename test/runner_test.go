@@ -0,0 +1,156 @@
+package nes_test
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Builds the headless runner from the module root into dir
+func buildRunner(t *testing.T, dir string) string {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found, can't build the runner")
+	}
+
+	runner := filepath.Join(dir, "gonesem")
+
+	if output, err := exec.Command("go", "build", "-o", runner, "gonesem").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build the runner: %s\n%s", err, output)
+	}
+
+	return runner
+}
+
+// Runs the runner with args, returning its exit code and standard output
+func runRunner(t *testing.T, runner string, args ...string) (int, string) {
+	var stdout bytes.Buffer
+
+	command := exec.Command(runner, args...)
+	command.Stdout = &stdout
+
+	err := command.Run()
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), stdout.String()
+	} else if err != nil {
+		t.Fatalf("Failed to run the runner: %s", err)
+	}
+
+	return 0, stdout.String()
+}
+
+func TestHeadlessRunner(t *testing.T) {
+	dir := t.TempDir()
+	runner := buildRunner(t, dir)
+
+	writeROM := func(name string, rom []byte) string {
+		path := filepath.Join(dir, name)
+
+		if err := os.WriteFile(path, rom, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	// LDA #$42, STA $10, JMP *
+	romPath := writeROM("store.nes", buildNROM(map[uint16][]byte{0xC000: {0xA9, 0x42, 0x85, 0x10, 0x4C, 0x04, 0xC0}}, 0xC000))
+	passPath := writeROM("pass.nes", buildNROM(statusProgram(0, "Passed\n"), 0xC000))
+	failPath := writeROM("fail.nes", buildNROM(statusProgram(2, "Failed #2\n"), 0xC000))
+
+	hashesPath := filepath.Join(dir, "hashes.txt")
+	screenshotPath := filepath.Join(dir, "frame.png")
+	ramPath := filepath.Join(dir, "ram.bin")
+
+	code, _ := runRunner(t, runner, "-rom", romPath, "-frames", "5", "-hashes", hashesPath, "-screenshot", screenshotPath, "-ram", ramPath)
+
+	if code != 0 {
+		t.Fatalf("Runner exited with %d, expected 0", code)
+	}
+
+	hashes, err := os.ReadFile(hashesPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(hashes)), "\n")
+
+	if len(lines) != 5 {
+		t.Fatalf("Wrote %d frame hashes, expected 5:\n%s", len(lines), hashes)
+	}
+
+	frame, finalHash, _ := strings.Cut(lines[4], " ")
+
+	if frame != "5" || len(finalHash) != 40 {
+		t.Errorf("Last frame hash line %q, expected frame 5 and a SHA-1", lines[4])
+	}
+
+	screenshot, err := os.Open(screenshotPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer screenshot.Close()
+
+	image, err := png.Decode(screenshot)
+
+	if err != nil {
+		t.Fatalf("Failed to decode screenshot: %s", err)
+	}
+
+	if bounds := image.Bounds(); bounds.Dx() != 256 || bounds.Dy() != 240 {
+		t.Errorf("Screenshot is %dx%d, expected 256x240", bounds.Dx(), bounds.Dy())
+	}
+
+	ram, err := os.ReadFile(ramPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ram) != 2048 || ram[0x10] != 0x42 {
+		t.Errorf("RAM dump is %d bytes, expected 2048 with $42 at $10", len(ram))
+	}
+
+	type runnerTest struct {
+		name   string
+		args   []string
+		code   int
+		output string
+	}
+
+	tests := []runnerTest{
+		{"expected frame", []string{"-rom", romPath, "-frames", "5", "-expect", finalHash}, 0, finalHash},
+		{"unexpected frame", []string{"-rom", romPath, "-frames", "5", "-expect", strings.Repeat("0", 40)}, 3, finalHash},
+		{"missing ROM", []string{"-rom", filepath.Join(dir, "missing.nes")}, 1, ""},
+		{"no ROM", []string{"-frames", "5"}, 2, ""},
+		{"negative frames", []string{"-rom", romPath, "-frames", "-1"}, 2, ""},
+		{"test ROM passes", []string{"-rom", passPath, "-testrom"}, 0, "Passed\n"},
+		{"test ROM fails", []string{"-rom", failPath, "-testrom"}, 3, "Failed #2\n"},
+		{"unwritable trace", []string{"-rom", romPath, "-frames", "5", "-trace", dir}, 1, ""},
+	}
+
+	// Opens fine but fails every write, so the trace only fails once it's flushed
+	if _, err := os.Stat("/dev/full"); err == nil {
+		tests = append(tests, runnerTest{"trace write fails", []string{"-rom", romPath, "-frames", "5", "-trace", "/dev/full"}, 1, finalHash})
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, output := runRunner(t, runner, test.args...)
+
+			if code != test.code || !strings.Contains(output, test.output) {
+				t.Errorf("Runner exited with %d printing %q, expected %d printing %q", code, output, test.code, test.output)
+			}
+		})
+	}
+}
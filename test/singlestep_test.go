@@ -0,0 +1,335 @@
+package nes_test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gonesem/nes/cpu"
+)
+
+/*
+*
+Single-step tests in the ProcessorTests JSON format, one file per opcode
+holding an array of cases:
+
+	{
+		"name": "a9 2c 7d",
+		"initial": {"pc": 59638, "s": 100, "a": 1, "x": 2, "y": 3, "p": 170, "ram": [[59638, 169], [59639, 44]]},
+		"final":   {"pc": 59640, "s": 100, "a": 44, "x": 2, "y": 3, "p": 40, "ram": [[59638, 169], [59639, 44]]},
+		"cycles":  [[59638, 169, "read"], [59639, 44, "read"]]
+	}
+
+Each case runs a single instruction against a flat 64KB memory that records
+every bus access, which must match "cycles" in order.
+
+Only vectors from the suite itself belong under data/singlestep, see the
+README there, and the test is skipped while there are none. -singlestep-dir
+runs a full copy of the suite instead.
+
+Like the suite the files are split by CPU variant into nes6502, 6502 and
+wdc65c02 directories, optionally with a version directory such as v1 below.
+*
+*/
+
+var singleStepDir = flag.String("singlestep-dir", filepath.Join("data", "singlestep"), "directory of ProcessorTests JSON files, one per opcode")
+
+// Directories of the suite's CPUs
+var singleStepVariants = []struct {
+	dir     string
+	variant cpu.Variant
+}{
+	{"nes6502", cpu.Variant2A03},
+	{"6502", cpu.VariantNMOS},
+	{"wdc65c02", cpu.Variant65C02},
+}
+
+// Reports at most this many failing cases per opcode file
+const singleStepMaxFailures = 10
+
+type singleStepState struct {
+	PC  uint16      `json:"pc"`
+	S   uint8       `json:"s"`
+	A   uint8       `json:"a"`
+	X   uint8       `json:"x"`
+	Y   uint8       `json:"y"`
+	P   uint8       `json:"p"`
+	RAM [][2]uint16 `json:"ram"`
+}
+
+type busAccess struct {
+	Addr  uint16
+	Value uint8
+	Write bool
+}
+
+func (access busAccess) String() string {
+	kind := "read"
+
+	if access.Write {
+		kind = "write"
+	}
+
+	return fmt.Sprintf("%s $%04X=$%02X", kind, access.Addr, access.Value)
+}
+
+// Cycles are encoded as [addr, value, "read" | "write"]
+func (access *busAccess) UnmarshalJSON(data []byte) error {
+	var fields [3]interface{}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	addr, addrOk := fields[0].(float64)
+	value, valueOk := fields[1].(float64)
+	kind, kindOk := fields[2].(string)
+
+	if !addrOk || !valueOk || !kindOk || (kind != "read" && kind != "write") {
+		return fmt.Errorf("invalid cycle %s", data)
+	}
+
+	*access = busAccess{Addr: uint16(addr), Value: uint8(value), Write: kind == "write"}
+
+	return nil
+}
+
+type singleStepCase struct {
+	Name    string          `json:"name"`
+	Initial singleStepState `json:"initial"`
+	Final   singleStepState `json:"final"`
+	Cycles  []busAccess     `json:"cycles"`
+}
+
+// Flat 64KB memory logging every access made through it
+type RecordingMemory struct {
+	RAM      [0x10000]uint8
+	Accesses []busAccess
+}
+
+func (memory *RecordingMemory) Read(addr uint16) uint8 {
+	value := memory.RAM[addr]
+	memory.Accesses = append(memory.Accesses, busAccess{Addr: addr, Value: value})
+
+	return value
+}
+
+func (memory *RecordingMemory) Write(addr uint16, value uint8) {
+	memory.RAM[addr] = value
+	memory.Accesses = append(memory.Accesses, busAccess{Addr: addr, Value: value, Write: true})
+}
+
+// Runs a case and returns a description of every difference from its final state
+func runSingleStep(memory *RecordingMemory, variant cpu.Variant, test singleStepCase) []string {
+	var mismatches []string
+
+	cpuPtr := cpu.NewCPUVariant(memory, variant)
+
+	for _, cell := range test.Initial.RAM {
+		memory.RAM[cell[0]] = uint8(cell[1])
+	}
+
+	cpuPtr.PC = test.Initial.PC
+	cpuPtr.SP = test.Initial.S
+	cpuPtr.A = test.Initial.A
+	cpuPtr.X = test.Initial.X
+	cpuPtr.Y = test.Initial.Y
+	cpuPtr.SR = cpu.Status(test.Initial.P)
+
+	memory.Accesses = memory.Accesses[:0]
+
+	// No instruction takes more than 8 cycles, give up well after that
+	cycles := 1
+
+	for !cpuPtr.Clock() {
+		if cycles++; cycles > 16 {
+			mismatches = append(mismatches, "instruction never completed")
+			break
+		}
+	}
+
+	registers := []struct {
+		name     string
+		expected uint16
+		actual   uint16
+	}{
+		{"PC", test.Final.PC, cpuPtr.PC},
+		{"S", uint16(test.Final.S), uint16(cpuPtr.SP)},
+		{"A", uint16(test.Final.A), uint16(cpuPtr.A)},
+		{"X", uint16(test.Final.X), uint16(cpuPtr.X)},
+		{"Y", uint16(test.Final.Y), uint16(cpuPtr.Y)},
+		{"P", uint16(test.Final.P), uint16(cpuPtr.SR)},
+	}
+
+	for _, register := range registers {
+		if register.expected != register.actual {
+			mismatches = append(mismatches, fmt.Sprintf("%s = $%02X, expected $%02X", register.name, register.actual, register.expected))
+		}
+	}
+
+	for _, cell := range test.Final.RAM {
+		if actual := memory.RAM[cell[0]]; actual != uint8(cell[1]) {
+			mismatches = append(mismatches, fmt.Sprintf("RAM[$%04X] = $%02X, expected $%02X", cell[0], actual, cell[1]))
+		}
+	}
+
+	if cycles != len(test.Cycles) {
+		mismatches = append(mismatches, fmt.Sprintf("took %d cycles, expected %d", cycles, len(test.Cycles)))
+	}
+
+	for i := 0; i < max(len(test.Cycles), len(memory.Accesses)); i++ {
+		expected, actual := "none", "none"
+
+		if i < len(test.Cycles) {
+			expected = test.Cycles[i].String()
+		}
+
+		if i < len(memory.Accesses) {
+			actual = memory.Accesses[i].String()
+		}
+
+		if expected != actual {
+			mismatches = append(mismatches, fmt.Sprintf("bus access %d is %s, expected %s", i, actual, expected))
+		}
+	}
+
+	// Clear what the case touched so the memory can be reused
+	for _, cell := range test.Initial.RAM {
+		memory.RAM[cell[0]] = 0
+	}
+
+	for _, access := range memory.Accesses {
+		memory.RAM[access.Addr] = 0
+	}
+
+	return mismatches
+}
+
+func TestSingleStep(t *testing.T) {
+	memory := &RecordingMemory{}
+	found := false
+
+	for _, variant := range singleStepVariants {
+		paths, err := filepath.Glob(filepath.Join(*singleStepDir, variant.dir, "*.json"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		versioned, err := filepath.Glob(filepath.Join(*singleStepDir, variant.dir, "v*", "*.json"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paths = append(paths, versioned...)
+
+		if len(paths) == 0 {
+			continue
+		}
+
+		found = true
+
+		t.Run(variant.variant.String(), func(t *testing.T) {
+			for _, path := range paths {
+				t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+					runSingleStepFile(t, memory, variant.variant, path)
+				})
+			}
+		})
+	}
+
+	if !found {
+		t.Skipf("No single-step tests in %s", *singleStepDir)
+	}
+}
+
+func runSingleStepFile(t *testing.T, memory *RecordingMemory, variant cpu.Variant, path string) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests []singleStepCase
+
+	if err := json.Unmarshal(data, &tests); err != nil {
+		t.Fatalf("Failed to parse %s: %s", path, err)
+	}
+
+	failures := 0
+
+	for _, test := range tests {
+		mismatches := runSingleStep(memory, variant, test)
+
+		if len(mismatches) == 0 {
+			continue
+		}
+
+		if failures++; failures <= singleStepMaxFailures {
+			t.Errorf("%s:\n\t%s", test.Name, strings.Join(mismatches, "\n\t"))
+		}
+	}
+
+	if failures > singleStepMaxFailures {
+		t.Errorf("%d more of %d cases failed", failures-singleStepMaxFailures, len(tests))
+	}
+}
+
+// Checks the comparator itself with the case from the format description
+// above and copies of it broken in each way a CPU can disagree, so it's
+// exercised even when no vectors are present. This isn't evidence that the
+// CPU is right, only the suite's own vectors are.
+func TestSingleStepComparator(t *testing.T) {
+	const lda = `{
+		"name": "a9 2c 7d",
+		"initial": {"pc": 59638, "s": 100, "a": 1, "x": 2, "y": 3, "p": 170, "ram": [[59638, 169], [59639, 44]]},
+		"final":   {"pc": 59640, "s": 100, "a": 44, "x": 2, "y": 3, "p": 40, "ram": [[59638, 169], [59639, 44]]},
+		"cycles":  [[59638, 169, "read"], [59639, 44, "read"]]
+	}`
+
+	memory := &RecordingMemory{}
+
+	parse := func() singleStepCase {
+		var test singleStepCase
+
+		if err := json.Unmarshal([]byte(lda), &test); err != nil {
+			t.Fatal(err)
+		}
+
+		return test
+	}
+
+	if mismatches := runSingleStep(memory, cpu.Variant2A03, parse()); len(mismatches) != 0 {
+		t.Fatalf("Matching case reported:\n\t%s", strings.Join(mismatches, "\n\t"))
+	}
+
+	tests := []struct {
+		name     string
+		mutate   func(test *singleStepCase)
+		mismatch string
+	}{
+		{"register", func(test *singleStepCase) { test.Final.A = 0x2D }, "A = $2C, expected $2D"},
+		{"flags", func(test *singleStepCase) { test.Final.P = 0xAA }, "P = $28, expected $AA"},
+		{"memory", func(test *singleStepCase) { test.Final.RAM = append(test.Final.RAM, [2]uint16{0x0010, 0x01}) }, "RAM[$0010] = $00, expected $01"},
+		{"cycle count", func(test *singleStepCase) { test.Cycles = append(test.Cycles, busAccess{Addr: 0xE8F8}) }, "took 2 cycles, expected 3"},
+		{"bus access", func(test *singleStepCase) { test.Cycles[1].Write = true }, "bus access 1 is read $E8F7=$2C, expected write $E8F7=$2C"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broken := parse()
+			test.mutate(&broken)
+
+			mismatches := runSingleStep(memory, cpu.Variant2A03, broken)
+
+			if len(mismatches) == 0 || mismatches[0] != test.mismatch {
+				t.Errorf("Reported %q, expected %q first", mismatches, test.mismatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package nes_test
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+
+	"gonesem/nes"
+	"gonesem/nes/cartridge"
+)
+
+func newNestestNES(t testing.TB) *nes.NES {
+	cart, err := cartridge.NewCartridgeFromBytes(loadNestest())
+
+	if err != nil {
+		t.Fatalf("Failed to load nestest cartridge: %s", err)
+	}
+
+	var palette [64]color.RGBA
+
+	for i := range palette {
+		palette[i] = color.RGBA{R: uint8(i * 4), G: uint8(255 - i*4), B: uint8(i), A: 0xFF}
+	}
+
+	return nes.NewNES(cart, palette)
+}
+
+func runFrames(console *nes.NES, frames int) []byte {
+	for i := 0; i < frames; i++ {
+		console.NextFrame()
+		console.GetFrame()
+	}
+
+	return append([]byte(nil), console.GetFrame().Pix...)
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	console := newNestestNES(t)
+
+	runFrames(console, 3)
+
+	var saved bytes.Buffer
+
+	if err := console.SaveState(&saved); err != nil {
+		t.Fatalf("Failed to save state: %s", err)
+	}
+
+	expectedFrame := runFrames(console, 2)
+	expectedRAM := console.RAM()
+	expectedCycles := console.TotalCycles
+
+	if err := console.LoadState(bytes.NewReader(saved.Bytes())); err != nil {
+		t.Fatalf("Failed to load state: %s", err)
+	}
+
+	actualFrame := runFrames(console, 2)
+
+	if !bytes.Equal(expectedFrame, actualFrame) || console.RAM() != expectedRAM || console.TotalCycles != expectedCycles {
+		t.Fatalf("Emulation diverged after loading save state")
+	}
+
+	// A fresh machine restored from the state must match as well
+	other := newNestestNES(t)
+
+	if err := other.LoadState(bytes.NewReader(saved.Bytes())); err != nil {
+		t.Fatalf("Failed to load state into new machine: %s", err)
+	}
+
+	if !bytes.Equal(runFrames(other, 2), expectedFrame) {
+		t.Fatalf("New machine diverged after loading save state")
+	}
+}
+
+func TestSaveStateRejectsCorruptState(t *testing.T) {
+	console := newNestestNES(t)
+	data := console.AppendState(nil)
+
+	if err := console.LoadStateBytes(data[:len(data)-10]); err == nil {
+		t.Errorf("Expected truncated save state to be rejected")
+	}
+
+	if err := console.LoadStateBytes([]byte("not a state")); err == nil {
+		t.Errorf("Expected invalid save state to be rejected")
+	}
+}
+
+func TestSaveStateKeepsJam(t *testing.T) {
+	cart, err := cartridge.NewCartridgeFromBytes(buildNROM(map[uint16][]byte{0xC000: {0xEA, 0x12}}, 0xC000))
+
+	if err != nil {
+		t.Fatalf("Failed to load cartridge: %s", err)
+	}
+
+	console := nes.NewNES(cart, [64]color.RGBA{})
+	runFrames(console, 1)
+
+	saved := console.AppendState(nil)
+	console.Reset()
+
+	if _, halted := console.Halted(); halted {
+		t.Fatalf("Reset didn't clear the jam")
+	}
+
+	if err := console.LoadStateBytes(saved); err != nil {
+		t.Fatalf("Failed to load state: %s", err)
+	}
+
+	if pc, halted := console.Halted(); !halted || pc != 0xC001 {
+		t.Errorf("Halted() = $%04X, %t after loading a jammed state, expected $C001, true", pc, halted)
+	}
+}
+
+func TestSaveStateLoadIsAtomic(t *testing.T) {
+	corruptions := map[string]func(data []byte){
+		// The RAM chunk claims one byte less than the console has, which is
+		// only found after the chunk before it was read
+		"RAM": func(data []byte) {
+			ram := bytes.Index(data, []byte("RAM "))
+			data[ram+10] = 0xFF
+			data[ram+11] = 0x07
+		},
+		// The PPU's palette follows its registers and nametables
+		"palette": func(data []byte) {
+			ppu := bytes.Index(data, []byte("PPU "))
+			palette := ppu + 10 + 12 + 4 + 2048
+			data[palette] = 0x10
+		},
+	}
+
+	for name, corrupt := range corruptions {
+		console := newNestestNES(t)
+		runFrames(console, 3)
+
+		data := console.AppendState(nil)
+		corrupt(data)
+
+		runFrames(console, 2)
+
+		expected := console.AppendState(nil)
+
+		if err := console.LoadStateBytes(data); err == nil {
+			t.Fatalf("Expected save state with a corrupt %s to be rejected", name)
+		}
+
+		if !bytes.Equal(console.AppendState(nil), expected) {
+			t.Errorf("Machine changed by a save state with a corrupt %s", name)
+		}
+	}
+}
+
+func TestSaveStateKeepsMapperRegisters(t *testing.T) {
+	cart, err := cartridge.NewCartridgeFromBytes(buildMMC1())
+
+	if err != nil {
+		t.Fatalf("Failed to load cartridge: %s", err)
+	}
+
+	console := nes.NewNES(cart, [64]color.RGBA{})
+
+	writeMMC1(cart, 0xE000, 3)
+	cart.PRGWrite(0x8000, 0x01)
+
+	saved := console.AppendState(nil)
+
+	cart.PRGWrite(0x8000, 0x80)
+	writeMMC1(cart, 0xE000, 6)
+
+	if err := console.LoadStateBytes(saved); err != nil {
+		t.Fatalf("Failed to load state: %s", err)
+	}
+
+	// The bank is restored along with the bit already shifted in
+	if cart.PRGRead(0x8000) != 3 {
+		t.Errorf("PRG bank %d mapped after loading, expected 3", cart.PRGRead(0x8000))
+	}
+
+	for i := 0; i < 4; i++ {
+		cart.PRGWrite(0x8000, 0)
+	}
+
+	if cart.PRGRead(0xC000) != 3 {
+		t.Errorf("Shift register was not restored, bank %d mapped at $C000", cart.PRGRead(0xC000))
+	}
+}
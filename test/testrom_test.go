@@ -0,0 +1,211 @@
+package nes_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gonesem/nes"
+	"gonesem/nes/asm"
+	"gonesem/nes/cartridge"
+	"gonesem/nes/color"
+	"gonesem/nes/cpu"
+	"gonesem/nes/testrom"
+)
+
+// Returns a 16KB NROM image with code placed at CPU addresses from $C000 and
+// the reset vector pointing at reset
+func buildNROM(code map[uint16][]byte, reset uint16) []byte {
+	rom := make([]byte, 16+16384+8192)
+	copy(rom, "NES\x1A\x01\x01")
+
+	prg := rom[16 : 16+16384]
+
+	for addr, bytes := range code {
+		copy(prg[addr-0xC000:], bytes)
+	}
+
+	prg[0x3FFC] = uint8(reset)
+	prg[0x3FFD] = uint8(reset >> 8)
+
+	return rom
+}
+
+// Writes the signature, runs, prints message and finishes with status
+func statusProgram(status uint8, message string) map[uint16][]byte {
+	return map[uint16][]byte{
+		0xC000: {
+			0xA9, 0xDE, 0x8D, 0x01, 0x60, // LDA #$DE, STA $6001
+			0xA9, 0xB0, 0x8D, 0x02, 0x60, // LDA #$B0, STA $6002
+			0xA9, 0x61, 0x8D, 0x03, 0x60, // LDA #$61, STA $6003
+			0xA9, 0x80, 0x8D, 0x00, 0x60, // LDA #$80, STA $6000
+			0xA2, 0x00, //                   LDX #0
+			0xBD, 0x40, 0xC0, //             LDA $C040,X
+			0x9D, 0x04, 0x60, //             STA $6004,X
+			0xF0, 0x03, //                   BEQ done
+			0xE8,       //                   INX
+			0xD0, 0xF5, //                   BNE LDA
+			0xA9, status, 0x8D, 0x00, 0x60, // done: LDA #status, STA $6000
+			0x4C, 0x26, 0xC0, //             JMP *
+		},
+		0xC040: append([]byte(message), 0),
+		// Requests a reset the first time it runs, then runs the program above
+		0xC080: {
+			0xA9, 0xDE, 0x8D, 0x01, 0x60,
+			0xA9, 0xB0, 0x8D, 0x02, 0x60,
+			0xA9, 0x61, 0x8D, 0x03, 0x60,
+			0xAD, 0x10, 0x60, //             LDA $6010
+			0xC9, 0x42, //                   CMP #$42
+			0xD0, 0x03, //                   BNE request
+			0x4C, 0x00, 0xC0, //             JMP $C000
+			0xA9, 0x42, 0x8D, 0x10, 0x60, // request: LDA #$42, STA $6010
+			0xA9, 0x81, 0x8D, 0x00, 0x60, // LDA #$81, STA $6000
+			0x4C, 0xA3, 0xC0, //             JMP *
+		},
+	}
+}
+
+func TestTestROMProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		reset   uint16
+		status  uint8
+		message string
+	}{
+		{"passed", 0xC000, 0, "Passed\n"},
+		{"failed", 0xC000, 3, "Failed #3\n"},
+		{"reset request", 0xC080, 0, "Passed after reset\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := testrom.RunROM(buildNROM(statusProgram(test.status, test.message), test.reset), testrom.DefaultOptions)
+
+			if err != nil {
+				t.Fatalf("Failed to run test ROM: %s", err)
+			}
+
+			if result.Status != test.status || result.Message != test.message {
+				t.Errorf("Got status %d %q, expected %d %q", result.Status, result.Message, test.status, test.message)
+			}
+		})
+	}
+}
+
+/*
+*
+This table is opt-in and is not coverage: blargg's ROMs aren't distributed
+with the repository, so in CI every entry is skipped and the harness is only
+exercised by TestGeneratedTestROM. Copy the ROMs under test/data/roms/blargg
+to run them, entries whose ROM is missing are skipped and every other one has
+to pass. The singles are built for MMC1, which is supported.
+
+cpu_interrupts_v2 takes its IRQs from the APU frame counter, its DMA test from
+OAM DMA and its NMI tests from the PPU's NMI output, all emulated. The
+branch_timing_tests ROMs only report on screen, their cases are checked by
+TestBranchTiming instead.
+*
+*/
+var blarggROMs = []string{
+	"instr_test-v5/rom_singles/01-basics.nes",
+	"instr_test-v5/rom_singles/02-implied.nes",
+	"instr_test-v5/rom_singles/03-immediate.nes",
+	"instr_test-v5/rom_singles/04-zero_page.nes",
+	"instr_test-v5/rom_singles/05-zp_xy.nes",
+	"instr_test-v5/rom_singles/06-absolute.nes",
+	"instr_test-v5/rom_singles/07-abs_xy.nes",
+	"instr_test-v5/rom_singles/08-ind_x.nes",
+	"instr_test-v5/rom_singles/09-ind_y.nes",
+	"instr_test-v5/rom_singles/10-branches.nes",
+	"instr_test-v5/rom_singles/11-stack.nes",
+	"instr_test-v5/rom_singles/12-jmp_jsr.nes",
+	"instr_test-v5/rom_singles/13-rts.nes",
+	"instr_test-v5/rom_singles/14-rti.nes",
+	"instr_test-v5/rom_singles/15-brk.nes",
+	"instr_test-v5/rom_singles/16-special.nes",
+	"cpu_interrupts_v2/rom_singles/1-cli_latency.nes",
+	"cpu_interrupts_v2/rom_singles/2-nmi_and_brk.nes",
+	"cpu_interrupts_v2/rom_singles/3-nmi_and_irq.nes",
+	"cpu_interrupts_v2/rom_singles/4-irq_and_dma.nes",
+	"cpu_interrupts_v2/rom_singles/5-branch_delays_irq.nes",
+}
+
+func TestBlarggROMs(t *testing.T) {
+	for _, path := range blarggROMs {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".nes"), func(t *testing.T) {
+			runTestROMFile(t, filepath.Join("data", "roms", "blargg", path))
+		})
+	}
+}
+
+// Assembles data/roms/protocol.s, which reports through the status protocol
+// like blargg's ROMs, and runs it the same way so the harness is checked end
+// to end without them
+func TestGeneratedTestROM(t *testing.T) {
+	source, err := os.ReadFile(filepath.Join("data", "roms", "protocol.s"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	program, err := asm.NewAssembler(cpu.Variant2A03).Assemble(string(source), 0xC000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := make(map[uint16][]byte)
+
+	for _, segment := range program.Segments {
+		code[segment.Address] = segment.Bytes
+	}
+
+	path := filepath.Join(t.TempDir(), "protocol.nes")
+
+	if err := os.WriteFile(path, buildNROM(code, program.Symbols["reset"]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := runTestROMFile(t, path); result.Message != "NMI count kept across reset\n" {
+		t.Errorf("Test ROM printed %q", result.Message)
+	}
+}
+
+// Runs the test ROM at path, which is skipped if it doesn't exist and has to
+// pass otherwise
+func runTestROMFile(t *testing.T, path string) testrom.Result {
+	rom, err := os.ReadFile(path)
+
+	if os.IsNotExist(err) {
+		t.Skipf("%s not found", path)
+	} else if err != nil {
+		t.Fatalf("Failed to read test ROM: %s", err)
+	}
+
+	cart, err := cartridge.NewCartridgeFromBytes(rom)
+
+	if err != nil {
+		t.Fatalf("Failed to load %s: %s", path, err)
+	}
+
+	result, err := testrom.Run(nes.NewNES(cart, color.DefaultPalette), testrom.DefaultOptions)
+
+	if err != nil {
+		t.Fatalf("Failed to run %s: %s", path, err)
+	}
+
+	if !result.Passed() {
+		t.Errorf("%s failed with status %d: %s", path, result.Status, result.Message)
+	}
+
+	return result
+}
+
+func TestTestROMReportsJam(t *testing.T) {
+	_, err := testrom.RunROM(buildNROM(map[uint16][]byte{0xC000: {0xEA, 0xEA, 0x22}}, 0xC000), testrom.DefaultOptions)
+
+	if err == nil || !strings.Contains(err.Error(), "CPU jammed at $C002") {
+		t.Errorf("Expected the jam to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package nes_test
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+
+	"gonesem/nes/cpu"
+	"gonesem/nes/disasm"
+	"gonesem/nes/trace"
+)
+
+func TestTraceNestest(t *testing.T) {
+	rom := loadNestest()
+
+	memory := &TestMemory{}
+
+	copy(memory.RAM[0xC000:0xFFFF], rom[0x10:0x4000])
+
+	testCPU := cpu.NewCPU(memory)
+	testCPU.PC = 0xC000
+
+	var log strings.Builder
+
+	tracer := trace.NewTracer(&log, trace.Nintendulator, cpu.Variant2A03)
+
+	testCPU.SetTraceCallback(func(cpuPtr *cpu.CPU) {
+		tracer.Trace(memory, trace.StateOf(cpuPtr))
+	})
+
+	for tracer.Lines() < 500 {
+		testCPU.Clock()
+	}
+
+	file, err := os.Open("./data/nestest.log")
+
+	if err != nil {
+		t.Fatalf("Failed to open nestest.log: %s", err)
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for i, actual := range strings.Split(strings.TrimSuffix(log.String(), "\n"), "\n") {
+		if !scanner.Scan() {
+			t.Fatal("Traced past the end of nestest.log")
+		}
+
+		if expected := scanner.Text(); actual != expected {
+			t.Fatalf("Line %d of the trace didn't match nestest.log\n Expected:\t%s\n Actual:\t%s\n", i+1, expected, actual)
+		}
+	}
+}
+
+func TestTraceFormats(t *testing.T) {
+	instruction, err := disasm.NewDisassembler(cpu.Variant2A03).DecodeBytes([]uint8{0x4C, 0xF5, 0xC5}, 0xC000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := trace.State{
+		PC:       0xC000,
+		SP:       0xFD,
+		SR:       cpu.StatusUnused | cpu.StatusInterrupt,
+		Cycles:   7,
+		HasPPU:   true,
+		Scanline: 0,
+		Dot:      21,
+		Frame:    2,
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"nintendulator", "C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7"},
+		{"mesen", "C000  $4C $F5 $C5  JMP $C5F5                     A:00 X:00 Y:00 P:24 SP:FD CYC:21  SL:0   FC:2 CPU Cycle:7"},
+		{"fceux", "f2      c7          A:00 X:00 Y:00 S:FD P:nvUbdIzc  $C000:4C F5 C5  JMP $C5F5"},
+	}
+
+	for _, test := range tests {
+		format, err := trace.ParseFormat(test.name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := format(instruction, state); actual != test.expected {
+			t.Errorf("%s formatted\n%q, expected\n%q", test.name, actual, test.expected)
+		}
+	}
+
+	if _, err := trace.ParseFormat("bizhawk"); err == nil {
+		t.Error("Parsed an unknown trace format")
+	}
+}
+
+func TestTraceTriggers(t *testing.T) {
+	console := newNestestNES(t)
+
+	var log strings.Builder
+
+	// nestest waits for vertical blank in a loop from $C00E to $C011
+	tracer := trace.NewTracer(&log, trace.FCEUX, cpu.Variant2A03)
+	tracer.SetStart(trace.All(trace.FromFrame(1), trace.PCRange(0xC00E, 0xC011)))
+	tracer.SetStop(trace.FromFrame(2))
+
+	console.SetTracer(tracer)
+	runFrames(console, 3)
+
+	if !tracer.Stopped() || tracer.Lines() == 0 {
+		t.Fatalf("Traced %d lines and stopped %t, expected the trace to start and stop", tracer.Lines(), tracer.Stopped())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(log.String(), "\n"), "\n")
+
+	if !strings.Contains(lines[0], "$C00E:") && !strings.Contains(lines[0], "$C011:") {
+		t.Errorf("Trace started outside the start range: %s", lines[0])
+	}
+
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "f1 ") {
+			t.Fatalf("Traced outside frame 1: %s", line)
+		}
+	}
+}